@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+var errUnknownProduct = errors.New("unknown product")
+
+// subscriptionOrder lists calculators' products in the order of order,
+// followed by any others alphabetically.
+func subscriptionOrder(order []string, calculators map[string]Calculator) []string {
+	var ordered, others []string
+	for _, productID := range order {
+		if _, ok := calculators[productID]; ok {
+			ordered = append(ordered, productID)
+		}
+	}
+	for productID := range calculators {
+		if !slices.Contains(ordered, productID) {
+			others = append(others, productID)
+		}
+	}
+	sort.Strings(others)
+	return append(ordered, others...)
+}
+
+// SetSubscriptionOrder makes the feed subscribe to the products in the order
+// of order, followed by any others alphabetically. NewPipeline follows the
+// default -products. Call it before the feed starts.
+func (p *Pipeline) SetSubscriptionOrder(order []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.subscribed = subscriptionOrder(order, p.calculators)
+}
+
+// Subscriptions returns the products the feed subscribes to.
+func (p *Pipeline) Subscriptions() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return slices.Clone(p.subscribed)
+}
+
+// attachFeed subscribes conn to every product and makes it the connection
+// that products added or removed later are (un)subscribed on.
+func (p *Pipeline) attachFeed(ctx context.Context, conn *websocket.Conn, logger Logger) error {
+	p.authenticate(ctx, logger)
+	p.breaker.reset()
+	p.feedMu.Lock()
+	defer p.feedMu.Unlock()
+	if err := p.subscribe(ctx, conn, "subscribe", p.Subscriptions()); err != nil {
+		return err
+	}
+	logger.Infof("Subscribed to %s channels", strings.Join(p.channelNames(), ", "))
+	p.feed = conn
+	p.health.setConnected(true)
+	return nil
+}
+
+// detachFeed forgets conn once its connection has ended.
+func (p *Pipeline) detachFeed(conn *websocket.Conn) {
+	p.feedMu.Lock()
+	defer p.feedMu.Unlock()
+	if p.feed == conn {
+		p.feed = nil
+		p.health.setConnected(false)
+	}
+}
+
+// sendFeed sends a subscribe or unsubscribe message for productID on the live
+// connection. Without one there is nothing to do: the next connection
+// subscribes to the current products.
+func (p *Pipeline) sendFeed(ctx context.Context, msgType, productID string) error {
+	p.feedMu.Lock()
+	defer p.feedMu.Unlock()
+	if p.feed == nil {
+		return nil
+	}
+	return p.subscribe(ctx, p.feed, msgType, []string{productID})
+}
+
+// AddProduct starts tracking productID with calculator. Its indicators,
+// format and other settings can be configured before it is subscribed to with
+// Subscribe.
+func (p *Pipeline) AddProduct(productID string, calculator Calculator) error {
+	p.mu.Lock()
+	if _, ok := p.calculators[productID]; ok {
+		p.mu.Unlock()
+		return fmt.Errorf("%s is already tracked", productID)
+	}
+	calculators := maps.Clone(p.calculators)
+	calculators[productID] = calculator
+	p.calculators = calculators
+	p.mu.Unlock()
+	// Not under p.mu: a dispatch blocked on a full queue holds the workers'
+	// lock until a worker, which needs p.mu, makes room.
+	if w := p.workers.Load(); w != nil {
+		w.add(p, productID)
+	}
+	return nil
+}
+
+// Subscribe adds productID, which must have been added with AddProduct, to
+// the feed subscription.
+func (p *Pipeline) Subscribe(ctx context.Context, productID string) error {
+	p.mu.Lock()
+	if !slices.Contains(p.subscribed, productID) {
+		p.subscribed = append(p.subscribed, productID)
+	}
+	p.mu.Unlock()
+	return p.sendFeed(ctx, "subscribe", productID)
+}
+
+// RemoveProduct unsubscribes from productID and discards its calculator,
+// indicators and settings. Trades already in flight for it are dropped as
+// being for an unknown product.
+func (p *Pipeline) RemoveProduct(ctx context.Context, productID string) error {
+	p.mu.Lock()
+	if _, ok := p.calculators[productID]; !ok {
+		p.mu.Unlock()
+		return fmt.Errorf("%w %s", errUnknownProduct, productID)
+	}
+	p.subscribed = slices.DeleteFunc(p.subscribed, func(s string) bool { return s == productID })
+	calculators := maps.Clone(p.calculators)
+	delete(calculators, productID)
+	p.calculators = calculators
+	delete(p.indicators, productID)
+	delete(p.minimums, productID)
+	delete(p.sessions, productID)
+	delete(p.channels, productID)
+	if p.wal != nil {
+		p.wal.Forget(productID)
+	}
+	delete(p.tradeCounts, productID)
+	p.mu.Unlock()
+	// Not under p.mu, as in AddProduct.
+	if w := p.workers.Load(); w != nil {
+		w.remove(productID)
+	}
+	p.gaps.Forget(productID)
+	p.dedupe.Forget(productID)
+	p.emit.forget(productID)
+	confirmedSubscriptions.DeleteLabelValues(productID)
+	currentVWAP.DeleteLabelValues(productID)
+	windowVolume.DeleteLabelValues(productID)
+	windowNotional.DeleteLabelValues(productID)
+	p.throughput.forget(productID)
+	if p.books != nil {
+		p.books.Forget(productID)
+	}
+	return p.sendFeed(ctx, "unsubscribe", productID)
+}
+
+// productAdmin adds and removes products at runtime, setting them up the way
+// run does at startup, and reloads the configuration.
+type productAdmin struct {
+	mu       sync.Mutex // serializes changes, which may update cfg
+	cfg      *Config
+	pipeline *Pipeline
+	rest     *RESTClient
+	output   *reloadableSink
+	stdout   io.Writer
+	logger   Logger
+}
+
+func (a *productAdmin) add(ctx context.Context, productID string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.addLocked(ctx, productID)
+}
+
+func (a *productAdmin) addLocked(ctx context.Context, productID string) error {
+	if slices.ContainsFunc(a.cfg.Synthetics, func(sp SyntheticProduct) bool { return sp.Name == productID }) {
+		return fmt.Errorf("%s is a synthetic product", productID)
+	}
+	calculator, err := newCalculator(a.cfg.Calculators.Get(productID, "vwap"), a.cfg.windowFor(productID), a.cfg.HalfLife)
+	if err != nil {
+		return err
+	}
+	if err := a.pipeline.AddProduct(productID, calculator); err != nil {
+		return err
+	}
+	configureProduct(a.cfg, a.pipeline, productID)
+	if a.rest != nil {
+		backfill(ctx, a.rest, a.pipeline, []string{productID}, a.logger)
+	}
+	logger := a.logger.With("product", productID)
+	if err := a.pipeline.Subscribe(ctx, productID); err != nil {
+		logger.Warnf("Subscribing on the live connection failed, the next connection will: %v", err)
+	}
+	logger.Infof("Product added")
+	return nil
+}
+
+func (a *productAdmin) remove(ctx context.Context, productID string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.removeLocked(ctx, productID)
+}
+
+func (a *productAdmin) removeLocked(ctx context.Context, productID string) error {
+	if slices.Contains(a.cfg.Synthetics.legs(), productID) {
+		return fmt.Errorf("%s is a leg of a synthetic product", productID)
+	}
+	logger := a.logger.With("product", productID)
+	if err := a.pipeline.RemoveProduct(ctx, productID); errors.Is(err, errUnknownProduct) {
+		return err
+	} else if err != nil {
+		logger.Warnf("Unsubscribing on the live connection failed: %v", err)
+	}
+	logger.Infof("Product removed")
+	return nil
+}
+
+// resize changes productID's window, keeping its trades, and remembers the
+// size for the product should it be removed and added again.
+func (a *productAdmin) resize(productID string, size int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if size <= 0 {
+		return fmt.Errorf("invalid window %d: must be positive", size)
+	}
+	if err := a.pipeline.ResizeWindow(productID, size); err != nil {
+		return err
+	}
+	sizes := maps.Clone(a.cfg.WindowSizes)
+	if sizes == nil {
+		sizes = make(productValues)
+	}
+	sizes[productID] = strconv.Itoa(size)
+	a.cfg.WindowSizes = sizes
+	a.logger.With("product", productID).Infof("Window resized to %d trades", size)
+	return nil
+}
+
+// addProductRoutes serves the tracked products.
+func addProductRoutes(mux *http.ServeMux, pipeline *Pipeline) {
+	mux.HandleFunc("GET /products", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, pipeline.Subscriptions())
+	})
+}
+
+// addAdminRoutes lets operators add or remove products, resize their windows
+// and reset their calculators without a restart. They change what the process
+// does, so they are served only on the loopback -admin-addr, never on the
+// public API.
+func addAdminRoutes(mux *http.ServeMux, admin *productAdmin) {
+	mux.HandleFunc("PUT /products/{product}", func(w http.ResponseWriter, r *http.Request) {
+		if err := admin.add(r.Context(), r.PathValue("product")); err != nil {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusCreated, admin.pipeline.Subscriptions())
+	})
+	mux.HandleFunc("DELETE /products/{product}", func(w http.ResponseWriter, r *http.Request) {
+		status := http.StatusOK
+		err := admin.remove(r.Context(), r.PathValue("product"))
+		switch {
+		case errors.Is(err, errUnknownProduct):
+			status = http.StatusNotFound
+		case err != nil:
+			status = http.StatusConflict
+		}
+		if err != nil {
+			writeJSON(w, status, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, status, admin.pipeline.Subscriptions())
+	})
+	mux.HandleFunc("PUT /products/{product}/window", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Size int `json:"size"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request: " + err.Error()})
+			return
+		}
+		productID := r.PathValue("product")
+		err := admin.resize(productID, req.Size)
+		switch {
+		case errors.Is(err, errUnknownProduct):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		case err != nil:
+			writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		}
+		c, _, _ := admin.pipeline.calculator(productID)
+		writeJSON(w, http.StatusOK, newCalculatorState(productID, c))
+	})
+	mux.HandleFunc("POST /calculators/{product}/reset", func(w http.ResponseWriter, r *http.Request) {
+		c, _, ok := admin.pipeline.calculator(r.PathValue("product"))
+		if !ok || !admin.pipeline.ResetProduct(r.PathValue("product")) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown product " + r.PathValue("product")})
+			return
+		}
+		writeJSON(w, http.StatusOK, newCalculatorState(r.PathValue("product"), c))
+	})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestProductRoutes(t *testing.T) {
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator(), "ETH-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	cfg := &Config{Synthetics: syntheticList{{Name: "ETH-BTC-IMPLIED", Base: "ETH-USD", Quote: "BTC-USD"}}}
+	admin := &productAdmin{cfg: cfg, pipeline: pipeline, logger: pipeline.logger}
+	public, mux := http.NewServeMux(), http.NewServeMux()
+	addProductRoutes(public, pipeline)
+	addProductRoutes(mux, pipeline)
+	addAdminRoutes(mux, admin)
+	stop := pipeline.StartWorkers(16, backpressureBlock)
+	defer stop()
+	if err := (MetricsSink{}).Publish(VWAPUpdate{ProductID: "SOL-USD", VWAP: "150"}); err != nil {
+		t.Fatalf("Publish returned error: %v", err)
+	}
+
+	for _, tt := range []struct {
+		method, path string
+		status       int
+		products     []string
+	}{
+		{http.MethodPut, "/products/SOL-USD", http.StatusCreated, []string{"BTC-USD", "ETH-USD", "SOL-USD"}},
+		{http.MethodPut, "/products/SOL-USD", http.StatusConflict, nil},
+		{http.MethodPut, "/products/ETH-BTC-IMPLIED", http.StatusConflict, nil},
+		{http.MethodDelete, "/products/ETH-USD", http.StatusConflict, nil}, // a synthetic leg
+		{http.MethodDelete, "/products/DOGE-USD", http.StatusNotFound, nil},
+		{http.MethodDelete, "/products/SOL-USD", http.StatusOK, []string{"BTC-USD", "ETH-USD"}},
+		{http.MethodGet, "/products", http.StatusOK, []string{"BTC-USD", "ETH-USD"}},
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: expected %d, got %d: %s", tt.method, tt.path, tt.status, rec.Code, rec.Body)
+			continue
+		}
+		if tt.products == nil {
+			continue
+		}
+		var products []string
+		if err := json.NewDecoder(rec.Body).Decode(&products); err != nil || !slices.Equal(products, tt.products) {
+			t.Errorf("%s %s: expected products %v, got %v (%v)", tt.method, tt.path, tt.products, products, err)
+		}
+	}
+
+	// Products can only be added and removed through the admin server.
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		rec := httptest.NewRecorder()
+		public.ServeHTTP(rec, httptest.NewRequest(method, "/products/SOL-USD", nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s /products/SOL-USD on the public API: expected %d, got %d", method, http.StatusNotFound, rec.Code)
+		}
+	}
+
+	// A removed product's gauges go with it.
+	if currentVWAP.DeleteLabelValues("SOL-USD") {
+		t.Error("Expected the SOL-USD VWAP gauge to be deleted on removal")
+	}
+
+	// Trades for a removed product are dropped rather than reaching a worker.
+	pipeline.processMessage(context.Background(), []byte(`{"type":"match","product_id":"SOL-USD","trade_id":1,"price":"150","size":"1"}`))
+	if n := pipeline.tradeCount("SOL-USD"); n != 0 {
+		t.Errorf("Expected no SOL-USD trades after removal, got %d", n)
+	}
+}
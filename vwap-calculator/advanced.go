@@ -0,0 +1,296 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// APIs the feed can speak, chosen with -api.
+const (
+	// apiExchange is the Coinbase Exchange ws-feed.
+	apiExchange = "exchange"
+	// apiAdvanced is the Coinbase Advanced Trade websocket, whose trades
+	// come from the market_trades channel in a different envelope.
+	apiAdvanced = "advanced"
+)
+
+const advancedWebsocketURL = "wss://advanced-trade-ws.coinbase.com"
+
+// Advanced Trade channels.
+const (
+	channelMarketTrades = "market_trades"
+	channelHeartbeats   = "heartbeats"
+)
+
+// Environment variables holding a Coinbase Developer Platform API key, used
+// to sign Advanced Trade subscriptions.
+const (
+	envCDPKeyName    = "COINBASE_CDP_KEY_NAME"
+	envCDPPrivateKey = "COINBASE_CDP_PRIVATE_KEY"
+)
+
+func parseAPI(s string) (string, error) {
+	switch s {
+	case apiExchange, apiAdvanced:
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid -api %q: must be %s or %s", s, apiExchange, apiAdvanced)
+}
+
+// advancedMessage is the envelope of every Advanced Trade message. Errors
+// carry a type instead of a channel.
+type advancedMessage struct {
+	Channel string          `json:"channel"`
+	Type    string          `json:"type"`
+	Message string          `json:"message"`
+	Events  json.RawMessage `json:"events"`
+}
+
+type advancedTradeEvent struct {
+	Type   string `json:"type"` // snapshot on subscribe, then update
+	Trades []struct {
+		TradeID   string    `json:"trade_id"`
+		ProductID string    `json:"product_id"`
+		Price     string    `json:"price"`
+		Size      string    `json:"size"`
+		Side      string    `json:"side"`
+		Time      time.Time `json:"time"`
+	} `json:"trades"`
+}
+
+type advancedSubscriptionsEvent struct {
+	Subscriptions map[string][]string `json:"subscriptions"`
+}
+
+// SetAdvancedTrade makes the pipeline speak the Advanced Trade websocket:
+// it subscribes to market_trades and heartbeats, and translates the
+// messages it receives into the Exchange feed's matches, so everything
+// downstream is shared. sign, if not nil, adds a JWT to each subscribe.
+func (p *Pipeline) SetAdvancedTrade(sign *jwtSigner) {
+	p.advanced = true
+	p.jwt = sign
+	p.channel = channelMarketTrades
+}
+
+// subscribeAdvanced sends one Advanced Trade subscribe or unsubscribe per
+// channel, as the API takes a single channel per message.
+func (p *Pipeline) subscribeAdvanced(conn *websocket.Conn, msgType string, productIDs []string) error {
+	for _, channel := range []string{channelMarketTrades, channelHeartbeats} {
+		msg := map[string]interface{}{
+			"type":        msgType,
+			"product_ids": productIDs,
+			"channel":     channel,
+		}
+		if p.jwt != nil {
+			token, err := p.jwt.sign()
+			if err != nil {
+				return fmt.Errorf("signing %s: %w", msgType, err)
+			}
+			msg["jwt"] = token
+		}
+		if p.writeWait > 0 {
+			conn.SetWriteDeadline(time.Now().Add(p.writeWait))
+		}
+		if err := conn.WriteJSON(msg); err != nil {
+			return fmt.Errorf("%s failed: %w", msgType, err)
+		}
+	}
+	return nil
+}
+
+// dispatchAdvanced translates an Advanced Trade message and dispatches the
+// trades in it, calling done (if not nil) once they have all been
+// processed. A market_trades snapshot, sent on subscribe, is only used for
+// its newest trade, as a last_match.
+func (p *Pipeline) dispatchAdvanced(ctx context.Context, message []byte, done func()) {
+	finish := func() {
+		if done != nil {
+			done()
+		}
+	}
+	var msg advancedMessage
+	if err := json.Unmarshal(message, &msg); err != nil {
+		p.malformedMessage(p.logger, "", "JSON decode error: %v", err)
+		parseErrors.Inc()
+		finish()
+		return
+	}
+	switch {
+	case msg.Type == "error":
+		feedErrors.Inc()
+		p.logger.Errorf("Exchange error: %s", msg.Message)
+		p.reportError("", fmt.Errorf("exchange error: %s", msg.Message))
+	case msg.Channel == "subscriptions":
+		var events []advancedSubscriptionsEvent
+		if err := json.Unmarshal(msg.Events, &events); err != nil {
+			p.malformedMessage(p.logger, "", "Subscriptions decode error: %v", err)
+			break
+		}
+		confirmed := make(map[string][]string)
+		for _, event := range events {
+			for channel, products := range event.Subscriptions {
+				confirmed[channel] = append(confirmed[channel], products...)
+			}
+		}
+		p.checkSubscriptions(confirmed)
+	case msg.Channel == channelMarketTrades:
+		trades, err := advancedTrades(msg.Events)
+		if err != nil {
+			p.malformedMessage(p.logger, "", "Trade decode error: %v", err)
+			parseErrors.Inc()
+			break
+		}
+		if len(trades) == 0 {
+			break
+		}
+		remaining := len(trades)
+		var mu sync.Mutex
+		each := func() {
+			mu.Lock()
+			remaining--
+			last := remaining == 0
+			mu.Unlock()
+			if last {
+				finish()
+			}
+		}
+		for _, trade := range trades {
+			p.throughput.addBytes(trade.ProductID, len(message)/len(trades))
+			if trade.Type == "match" {
+				p.observeLatency(trade)
+			}
+			p.dispatch(ctx, trade, each)
+		}
+		return
+	}
+	finish()
+}
+
+// advancedTrades converts market_trades events into Exchange feed trades,
+// oldest first: matches for updates, and a last_match for the newest trade
+// of each product in a snapshot.
+func advancedTrades(raw json.RawMessage) ([]Trade, error) {
+	var events []advancedTradeEvent
+	if err := json.Unmarshal(raw, &events); err != nil {
+		return nil, err
+	}
+	var trades []Trade
+	for _, event := range events {
+		converted := make([]Trade, 0, len(event.Trades))
+		for _, t := range event.Trades {
+			id, err := strconv.ParseInt(t.TradeID, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trade_id %q", t.TradeID)
+			}
+			converted = append(converted, Trade{
+				Type:      "match",
+				ProductID: t.ProductID,
+				TradeID:   id,
+				Price:     t.Price,
+				Size:      t.Size,
+				Side:      makerSide(t.Side),
+				Time:      t.Time,
+			})
+		}
+		slices.SortFunc(converted, func(a, b Trade) int { return cmp.Compare(a.TradeID, b.TradeID) })
+		if event.Type == "snapshot" {
+			newest := make(map[string]Trade)
+			for _, trade := range converted {
+				trade.Type = "last_match"
+				newest[trade.ProductID] = trade
+			}
+			for _, productID := range slices.Sorted(maps.Keys(newest)) {
+				trades = append(trades, newest[productID])
+			}
+			continue
+		}
+		trades = append(trades, converted...)
+	}
+	return trades, nil
+}
+
+// makerSide converts a taker's side, as Advanced Trade trades and tickers
+// report it, into the matches' convention of the maker order's side.
+func makerSide(takerSide string) string {
+	switch strings.ToUpper(takerSide) {
+	case "BUY":
+		return "sell"
+	case "SELL":
+		return "buy"
+	}
+	return strings.ToLower(takerSide)
+}
+
+// jwtSigner signs Advanced Trade subscriptions with a Coinbase Developer
+// Platform API key: an ES256 JWT valid for two minutes.
+type jwtSigner struct {
+	keyName string
+	key     *ecdsa.PrivateKey
+	now     func() time.Time
+}
+
+// jwtSignerFromEnv reads the API key from the environment. No key means
+// unauthenticated subscriptions, which market_trades allows.
+func jwtSignerFromEnv() (*jwtSigner, error) {
+	name, secret := os.Getenv(envCDPKeyName), os.Getenv(envCDPPrivateKey)
+	if name == "" && secret == "" {
+		return nil, nil
+	}
+	if name == "" || secret == "" {
+		return nil, fmt.Errorf("incomplete API credentials: %s and %s must both be set", envCDPKeyName, envCDPPrivateKey)
+	}
+	// Keys are often stored with escaped newlines.
+	block, _ := pem.Decode([]byte(strings.ReplaceAll(secret, `\n`, "\n")))
+	if block == nil {
+		return nil, fmt.Errorf("invalid %s: no PEM block", envCDPPrivateKey)
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		parsed, pkcs8Err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		var ok bool
+		if key, ok = parsed.(*ecdsa.PrivateKey); pkcs8Err != nil || !ok {
+			return nil, fmt.Errorf("invalid %s: %w", envCDPPrivateKey, err)
+		}
+	}
+	return &jwtSigner{keyName: name, key: key, now: time.Now}, nil
+}
+
+func (s *jwtSigner) sign() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	now := s.now().Unix()
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "typ": "JWT", "kid": s.keyName, "nonce": hex.EncodeToString(nonce)})
+	claims, _ := json.Marshal(map[string]interface{}{"iss": "cdp", "sub": s.keyName, "nbf": now, "exp": now + 120})
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	r, sig, err := ecdsa.Sign(rand.Reader, s.key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	// JWS wants r and s as fixed-width big-endian integers, not ASN.1.
+	size := (s.key.Curve.Params().BitSize + 7) / 8
+	raw := make([]byte, 2*size)
+	r.FillBytes(raw[:size])
+	sig.FillBytes(raw[size:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(raw), nil
+}
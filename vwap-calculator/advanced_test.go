@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grantis/gopkg/vwap-calculator/internal/mockexchange"
+)
+
+func TestAdvancedTrades(t *testing.T) {
+	trades, err := advancedTrades(json.RawMessage(`[
+		{"type":"snapshot","trades":[
+			{"trade_id":"12","product_id":"BTC-USD","price":"101","size":"1","side":"BUY","time":"2024-01-01T00:00:02Z"},
+			{"trade_id":"11","product_id":"BTC-USD","price":"100","size":"1","side":"SELL","time":"2024-01-01T00:00:01Z"}]},
+		{"type":"update","trades":[
+			{"trade_id":"14","product_id":"BTC-USD","price":"103","size":"2","side":"SELL","time":"2024-01-01T00:00:04Z"},
+			{"trade_id":"13","product_id":"BTC-USD","price":"102","size":"1","side":"BUY","time":"2024-01-01T00:00:03Z"}]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, trade := range trades {
+		got = append(got, trade.Type+" "+trade.Side+" "+trade.Price)
+	}
+	want := []string{"last_match sell 101", "match sell 102", "match buy 103"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if _, err := advancedTrades(json.RawMessage(`[{"type":"update","trades":[{"trade_id":"x"}]}]`)); err == nil {
+		t.Error("Expected an error for a non-numeric trade_id")
+	}
+}
+
+func TestDispatchAdvanced(t *testing.T) {
+	store := NewStore()
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"), store)
+	pipeline.SetAdvancedTrade(nil)
+	if got := pipeline.feedChannels(); !slices.Equal(got, []string{"market_trades", "heartbeats"}) {
+		t.Errorf("Unexpected channels %v", got)
+	}
+
+	ctx := context.Background()
+	calls := 0
+	pipeline.dispatchMessage(ctx, []byte(`{"channel":"market_trades","events":[{"type":"update","trades":[
+		{"trade_id":"1","product_id":"BTC-USD","price":"100","size":"1","side":"BUY"},
+		{"trade_id":"2","product_id":"BTC-USD","price":"200","size":"1","side":"SELL"}]}]}`), func() { calls++ })
+	pipeline.dispatchMessage(ctx, []byte(`{"channel":"heartbeats","events":[{"current_time":"now","heartbeat_counter":1}]}`), func() { calls++ })
+	if calls != 2 {
+		t.Errorf("Expected done once per message, got %d calls", calls)
+	}
+	if update, _ := store.Get("BTC-USD"); update.TradeCount != 2 || update.VWAP != "150.0000" {
+		t.Errorf("Expected both trades applied, got %+v", update)
+	}
+}
+
+func TestRunFeedSubscribesAdvancedTrade(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalECPrivateKey(key)
+	t.Setenv(envCDPKeyName, "organizations/o/apiKeys/k")
+	t.Setenv(envCDPPrivateKey, strings.ReplaceAll(string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})), "\n", `\n`))
+	sign, err := jwtSignerFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exchange := mockexchange.New()
+	defer exchange.Close()
+	startFeed(t, exchange, NewStore(), func(_ *Config, p *Pipeline) {
+		p.SetAdvancedTrade(sign)
+	})
+
+	for _, channel := range []string{"market_trades", "heartbeats"} {
+		req := nextRequest(t, exchange)
+		if req.Type != "subscribe" || req.Channel != channel || len(req.ProductIDs) != 3 {
+			t.Errorf("Unexpected subscribe request %+v", req)
+		}
+		verifyJWT(t, req.JWT, &key.PublicKey)
+	}
+}
+
+func verifyJWT(t *testing.T, token string, key *ecdsa.PublicKey) {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("Malformed JWT %q", token)
+	}
+	var header, claims map[string]any
+	for i, v := range []*map[string]any{&header, &claims} {
+		data, _ := base64.RawURLEncoding.DecodeString(parts[i])
+		if err := json.Unmarshal(data, v); err != nil {
+			t.Fatalf("JWT part %d: %v", i, err)
+		}
+	}
+	if header["alg"] != "ES256" || header["kid"] != "organizations/o/apiKeys/k" || claims["iss"] != "cdp" {
+		t.Errorf("Unexpected JWT header %v or claims %v", header, claims)
+	}
+	if exp := int64(claims["exp"].(float64)); exp <= time.Now().Unix() {
+		t.Errorf("Expected the JWT to expire in the future, got %d", exp)
+	}
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if len(sig) != 64 {
+		t.Fatalf("Expected a 64-byte signature, got %d bytes", len(sig))
+	}
+	r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+	if !ecdsa.Verify(key, digest[:], r, s) {
+		t.Error("JWT signature does not verify")
+	}
+}
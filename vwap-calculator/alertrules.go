@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AlertRule is a user-defined threshold, written as
+// "[PRODUCT:]vwap>45000", "[PRODUCT:]vwap<45000" or "[PRODUCT:]deviation>2".
+// A vwap rule fires when the product's VWAP crosses the threshold. A
+// deviation rule fires when a trade is priced more than the threshold
+// percentage away from the VWAP. Both fire once on entering the condition and
+// again only after leaving it. Without a product the rule applies to all.
+type AlertRule struct {
+	ProductID string
+	Metric    string
+	Above     bool
+	Threshold float64
+}
+
+func parseAlertRule(s string) (AlertRule, error) {
+	var rule AlertRule
+	expr := strings.TrimSpace(s)
+	if product, rest, found := strings.Cut(expr, ":"); found {
+		rule.ProductID, expr = product, rest
+	}
+	i := strings.IndexAny(expr, "<>")
+	if i < 0 {
+		return rule, fmt.Errorf("invalid alert rule %q: expected vwap>N, vwap<N or deviation>N", s)
+	}
+	rule.Metric, rule.Above = strings.TrimSpace(expr[:i]), expr[i] == '>'
+	threshold, err := strconv.ParseFloat(strings.TrimSpace(expr[i+1:]), 64)
+	if err != nil {
+		return rule, fmt.Errorf("invalid alert rule %q: %v", s, err)
+	}
+	rule.Threshold = threshold
+	switch {
+	case rule.Metric == "vwap":
+	case rule.Metric == "deviation" && rule.Above && threshold > 0:
+	default:
+		return rule, fmt.Errorf("invalid alert rule %q: expected vwap>N, vwap<N or deviation>N", s)
+	}
+	return rule, nil
+}
+
+func (r AlertRule) String() string {
+	op := "<"
+	if r.Above {
+		op = ">"
+	}
+	s := r.Metric + op + strconv.FormatFloat(r.Threshold, 'f', -1, 64)
+	if r.ProductID != "" {
+		s = r.ProductID + ":" + s
+	}
+	return s
+}
+
+// ruleList is a repeatable flag of alert rules; each value may hold several
+// separated by commas.
+type ruleList []AlertRule
+
+func (l *ruleList) String() string {
+	parts := make([]string, len(*l))
+	for i, rule := range *l {
+		parts[i] = rule.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *ruleList) Set(s string) error {
+	for _, part := range strings.Split(s, ",") {
+		rule, err := parseAlertRule(part)
+		if err != nil {
+			return err
+		}
+		*l = append(*l, rule)
+	}
+	return nil
+}
+
+type ruleState struct {
+	rule    int
+	product string
+}
+
+// RuleEvaluator checks alert rules against each update, tracking which rules
+// are currently triggered per product.
+type RuleEvaluator struct {
+	mu        sync.Mutex
+	rules     []AlertRule
+	triggered map[ruleState]bool
+	seen      map[ruleState]bool
+}
+
+func NewRuleEvaluator(rules []AlertRule) *RuleEvaluator {
+	return &RuleEvaluator{rules: rules, triggered: make(map[ruleState]bool), seen: make(map[ruleState]bool)}
+}
+
+// Evaluate returns the alerts for rules that trade and the update it produced
+// have just triggered.
+func (e *RuleEvaluator) Evaluate(trade Trade, update VWAPUpdate) []Alert {
+	vwap, err := strconv.ParseFloat(update.VWAP, 64)
+	if err != nil || vwap == 0 {
+		return nil
+	}
+	price, err := strconv.ParseFloat(trade.Price, 64)
+	if err != nil {
+		return nil
+	}
+	ts := trade.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var alerts []Alert
+	for i, rule := range e.rules {
+		if rule.ProductID != "" && rule.ProductID != trade.ProductID {
+			continue
+		}
+		key := ruleState{rule: i, product: trade.ProductID}
+		var hit bool
+		alert := Alert{ProductID: trade.ProductID, Rule: rule.String(), TradeID: trade.TradeID, Price: trade.Price, VWAP: update.VWAP, Time: ts}
+		switch rule.Metric {
+		case "vwap":
+			direction := "below"
+			if rule.Above {
+				hit, direction = vwap > rule.Threshold, "above"
+			} else {
+				hit = vwap < rule.Threshold
+			}
+			alert.Kind = "vwap_cross"
+			alert.Message = fmt.Sprintf("%s VWAP %s crossed %s %s", trade.ProductID, update.VWAP, direction,
+				strconv.FormatFloat(rule.Threshold, 'f', -1, 64))
+			// A VWAP already past the threshold on the first update has
+			// not crossed it.
+			if !e.seen[key] {
+				e.seen[key] = true
+				e.triggered[key] = hit
+				continue
+			}
+		case "deviation":
+			pct := (price - vwap) / vwap * 100
+			hit = pct > rule.Threshold || pct < -rule.Threshold
+			alert.Kind = "vwap_deviation"
+			alert.ChangePct = pct
+			alert.Message = fmt.Sprintf("%s trade at %s is %+.2f%% from VWAP %s", trade.ProductID, trade.Price, pct, update.VWAP)
+		}
+		if hit && !e.triggered[key] {
+			alerts = append(alerts, alert)
+		}
+		e.triggered[key] = hit
+	}
+	return alerts
+}
+
+// SetAlertRules makes the pipeline raise alerts when rules trigger.
+func (p *Pipeline) SetAlertRules(rules []AlertRule) {
+	p.rules = NewRuleEvaluator(rules)
+}
+
+func (p *Pipeline) checkRules(logger Logger, trade Trade, update VWAPUpdate) {
+	if p.rules == nil {
+		return
+	}
+	for _, alert := range p.rules.Evaluate(trade, update) {
+		p.raiseAlert(logger, alert)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseAlertRule(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want AlertRule
+	}{
+		{"BTC-USD:vwap>45000", AlertRule{ProductID: "BTC-USD", Metric: "vwap", Above: true, Threshold: 45000}},
+		{"vwap < 0.05", AlertRule{Metric: "vwap", Threshold: 0.05}},
+		{"ETH-USD:deviation>2", AlertRule{ProductID: "ETH-USD", Metric: "deviation", Above: true, Threshold: 2}},
+	} {
+		got, err := parseAlertRule(tc.in)
+		if err != nil || got != tc.want {
+			t.Errorf("parseAlertRule(%q) = %+v, %v; want %+v", tc.in, got, err, tc.want)
+		}
+	}
+	for _, bad := range []string{"vwap", "vwap>abc", "volume>5", "deviation<2", "deviation>0"} {
+		if _, err := parseAlertRule(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestRuleEvaluatorCrossing(t *testing.T) {
+	evaluator := NewRuleEvaluator([]AlertRule{{ProductID: "BTC-USD", Metric: "vwap", Above: true, Threshold: 100}})
+	trade := Trade{ProductID: "BTC-USD", Price: "100"}
+	var fired []int
+	for i, vwap := range []string{"101", "99", "100", "100.5", "102", "98", "101"} {
+		if alerts := evaluator.Evaluate(trade, VWAPUpdate{ProductID: "BTC-USD", VWAP: vwap}); len(alerts) > 0 {
+			if alerts[0].Kind != "vwap_cross" || alerts[0].Rule != "BTC-USD:vwap>100" {
+				t.Errorf("Unexpected alert %+v", alerts[0])
+			}
+			fired = append(fired, i)
+		}
+	}
+	// Already above on the first update, so only the later crossings fire.
+	if len(fired) != 2 || fired[0] != 3 || fired[1] != 6 {
+		t.Errorf("Expected alerts at updates 3 and 6, got %v", fired)
+	}
+	if alerts := evaluator.Evaluate(Trade{ProductID: "ETH-USD", Price: "1"}, VWAPUpdate{VWAP: "1000"}); len(alerts) != 0 {
+		t.Errorf("Expected rule to ignore other products, got %+v", alerts)
+	}
+}
+
+func TestRuleEvaluatorDeviation(t *testing.T) {
+	evaluator := NewRuleEvaluator([]AlertRule{{Metric: "deviation", Above: true, Threshold: 2}})
+	update := VWAPUpdate{VWAP: "100"}
+	var fired []string
+	for _, price := range []string{"101", "97", "96", "100", "103"} {
+		for _, alert := range evaluator.Evaluate(Trade{ProductID: "ETH-USD", Price: price}, update) {
+			fired = append(fired, alert.Price)
+		}
+	}
+	if len(fired) != 2 || fired[0] != "97" || fired[1] != "103" {
+		t.Errorf("Expected alerts for 97 and 103, got %v", fired)
+	}
+}
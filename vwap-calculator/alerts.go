@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Queue limits for WebhookAlertSink. Alerts are rare, so a small queue is
+// plenty and a short wait keeps delivery prompt.
+const (
+	alertQueueSize = 256
+	alertBatchSize = 16
+	alertFlushWait = 100 * time.Millisecond
+)
+
+// Alert is an operational event raised next to, but separately from, the
+// VWAP output.
+type Alert struct {
+	Kind      string `json:"kind"`
+	ProductID string `json:"product_id"`
+	Message   string `json:"message"`
+	// Rule is the -alert-rule that raised the alert, if any.
+	Rule      string    `json:"rule,omitempty"`
+	TradeID   int64     `json:"trade_id,omitempty"`
+	Price     string    `json:"price,omitempty"`
+	Previous  string    `json:"previous_price,omitempty"`
+	VWAP      string    `json:"vwap,omitempty"`
+	ChangePct float64   `json:"change_pct,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// AlertSink receives alerts raised by the pipeline.
+type AlertSink interface {
+	Alert(alert Alert) error
+}
+
+// AddAlertSink registers a sink for alerts.
+func (p *Pipeline) AddAlertSink(sink AlertSink) {
+	p.alertSinks = append(p.alertSinks, sink)
+}
+
+// raiseAlert logs and counts alert and hands it to every alert sink.
+func (p *Pipeline) raiseAlert(logger Logger, alert Alert) {
+	logger.Warnf("Alert %s: %s", alert.Kind, alert.Message)
+	alertsRaised.WithLabelValues(alert.ProductID, alert.Kind).Inc()
+	for _, sink := range p.alertSinks {
+		if err := sink.Alert(alert); err != nil {
+			logger.Errorf("Delivering %s alert failed: %v", alert.Kind, err)
+		}
+	}
+}
+
+// WebhookAlertSink POSTs each alert as a JSON object to a URL from a
+// background goroutine.
+type WebhookAlertSink struct {
+	url    string
+	encode func(Alert) ([]byte, error)
+	client *http.Client
+	queue  *batchQueue[Alert]
+	logger Logger
+}
+
+func NewWebhookAlertSink(url string, logger Logger) *WebhookAlertSink {
+	return newWebhookAlertSink(url, func(alert Alert) ([]byte, error) { return json.Marshal(alert) }, logger)
+}
+
+// NewSlackAlertSink posts alert messages to a Slack incoming webhook.
+func NewSlackAlertSink(url string, logger Logger) *WebhookAlertSink {
+	return newWebhookAlertSink(url, func(alert Alert) ([]byte, error) {
+		return json.Marshal(map[string]string{"text": fmt.Sprintf(":rotating_light: *%s* %s", alert.Kind, alert.Message)})
+	}, logger)
+}
+
+func newWebhookAlertSink(url string, encode func(Alert) ([]byte, error), logger Logger) *WebhookAlertSink {
+	s := &WebhookAlertSink{
+		url:    url,
+		encode: encode,
+		client: &http.Client{Timeout: 10 * time.Second},
+		logger: logger,
+	}
+	s.queue = newBatchQueue(alertQueueSize, alertBatchSize, alertFlushWait, func(alerts []Alert) {
+		for _, alert := range alerts {
+			if err := s.post(alert); err != nil {
+				s.logger.Errorf("Posting %s alert to webhook failed: %v", alert.Kind, err)
+			}
+		}
+	})
+	return s
+}
+
+func (s *WebhookAlertSink) Alert(alert Alert) error {
+	if !s.queue.Offer(alert) {
+		return errQueueFull
+	}
+	return nil
+}
+
+// Close delivers queued alerts.
+func (s *WebhookAlertSink) Close() error {
+	s.queue.Close()
+	return nil
+}
+
+func (s *WebhookAlertSink) post(alert Alert) error {
+	body, err := s.encode(alert)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// RateLimitedAlertSink passes on at most one alert per product, kind and rule
+// every interval, dropping the rest.
+type RateLimitedAlertSink struct {
+	sink     AlertSink
+	interval time.Duration
+	now      func() time.Time
+
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+func NewRateLimitedAlertSink(sink AlertSink, interval time.Duration) *RateLimitedAlertSink {
+	return &RateLimitedAlertSink{sink: sink, interval: interval, now: time.Now, last: make(map[string]time.Time)}
+}
+
+func (s *RateLimitedAlertSink) Alert(alert Alert) error {
+	key := alert.ProductID + "\x00" + alert.Kind + "\x00" + alert.Rule
+	s.mu.Lock()
+	now := s.now()
+	if last, ok := s.last[key]; ok && now.Sub(last) < s.interval {
+		s.mu.Unlock()
+		return nil
+	}
+	s.last[key] = now
+	s.mu.Unlock()
+	return s.sink.Alert(alert)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookAlertSink(t *testing.T) {
+	var received []Alert
+	var contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert Alert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Errorf("Decoding webhook body: %v", err)
+		}
+		received = append(received, alert)
+		contentType = r.Header.Get("Content-Type")
+	}))
+	defer server.Close()
+
+	sink := NewWebhookAlertSink(server.URL, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	ts := time.Unix(1700000000, 0).UTC()
+	sink.Alert(Alert{Kind: "price_jump", ProductID: "BTC-USD", Message: "moved", TradeID: 7, Price: "90", Previous: "100", ChangePct: -10, Time: ts})
+	sink.Close()
+
+	if len(received) != 1 || received[0].TradeID != 7 || received[0].ChangePct != -10 || !received[0].Time.Equal(ts) {
+		t.Errorf("Unexpected alerts received: %+v", received)
+	}
+	if contentType != "application/json" {
+		t.Errorf("Expected JSON content type, got %q", contentType)
+	}
+}
+
+func TestSlackAlertSink(t *testing.T) {
+	var payload map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer server.Close()
+
+	sink := NewSlackAlertSink(server.URL, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	sink.Alert(Alert{Kind: "vwap_cross", ProductID: "BTC-USD", Message: "BTC-USD VWAP 45001 crossed above 45000"})
+	sink.Close()
+
+	if !strings.Contains(payload["text"], "*vwap_cross* BTC-USD VWAP 45001 crossed above 45000") {
+		t.Errorf("Unexpected Slack payload %v", payload)
+	}
+}
+
+func TestRateLimitedAlertSink(t *testing.T) {
+	recorder := &alertRecorder{}
+	sink := NewRateLimitedAlertSink(recorder, time.Minute)
+	now := time.Unix(1700000000, 0)
+	sink.now = func() time.Time { return now }
+
+	alert := Alert{Kind: "vwap_cross", ProductID: "BTC-USD", Rule: "vwap>100"}
+	sink.Alert(alert)
+	sink.Alert(alert)
+	sink.Alert(Alert{Kind: "vwap_cross", ProductID: "ETH-USD", Rule: "vwap>100"})
+	now = now.Add(time.Minute)
+	sink.Alert(alert)
+
+	if len(recorder.alerts) != 3 || recorder.alerts[1].ProductID != "ETH-USD" {
+		t.Errorf("Expected the repeat within a minute to be dropped, got %+v", recorder.alerts)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+// arrowMaxBatch is the most rows sent in one record batch, however short the
+// batch interval.
+const arrowMaxBatch = 10000
+
+var (
+	// Times are null when a trade or update carries none.
+	arrowTimeField = arrow.Field{Name: "time", Type: &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}, Nullable: true}
+
+	arrowTradeSchema = arrow.NewSchema([]arrow.Field{
+		arrowTimeField,
+		{Name: "product_id", Type: arrow.BinaryTypes.String},
+		{Name: "trade_id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "price", Type: arrow.PrimitiveTypes.Float64},
+		{Name: "size", Type: arrow.PrimitiveTypes.Float64},
+		{Name: "side", Type: arrow.BinaryTypes.String},
+	}, nil)
+	arrowUpdateSchema = arrow.NewSchema([]arrow.Field{
+		arrowTimeField,
+		{Name: "product_id", Type: arrow.BinaryTypes.String},
+		{Name: "vwap", Type: arrow.PrimitiveTypes.Float64},
+		{Name: "window_size", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "trade_count", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "missed_trades", Type: arrow.PrimitiveTypes.Int64},
+		// Indicator values are null when they are not numbers.
+		{Name: "indicators", Type: arrow.MapOf(arrow.BinaryTypes.String, arrow.PrimitiveTypes.Float64)},
+	}, nil)
+)
+
+// appendArrowTime appends t, or a null if it is the zero time.
+func appendArrowTime(b array.Builder, t time.Time) {
+	if t.IsZero() {
+		b.AppendNull()
+		return
+	}
+	b.(*array.TimestampBuilder).Append(arrow.Timestamp(t.UnixMicro()))
+}
+
+func parseArrowFloat(s string) float64 {
+	v, _ := strconv.ParseFloat(s, 64)
+	return v
+}
+
+func arrowTradeBatch(trades []Trade) arrow.RecordBatch {
+	b := array.NewRecordBuilder(memory.DefaultAllocator, arrowTradeSchema)
+	defer b.Release()
+	for _, t := range trades {
+		appendArrowTime(b.Field(0), t.Time)
+		b.Field(1).(*array.StringBuilder).Append(t.ProductID)
+		b.Field(2).(*array.Int64Builder).Append(t.TradeID)
+		b.Field(3).(*array.Float64Builder).Append(parseArrowFloat(t.Price))
+		b.Field(4).(*array.Float64Builder).Append(parseArrowFloat(t.Size))
+		b.Field(5).(*array.StringBuilder).Append(t.Side)
+	}
+	return b.NewRecordBatch()
+}
+
+func arrowUpdateBatch(updates []VWAPUpdate) arrow.RecordBatch {
+	b := array.NewRecordBuilder(memory.DefaultAllocator, arrowUpdateSchema)
+	defer b.Release()
+	indicators := b.Field(6).(*array.MapBuilder)
+	keys, values := indicators.KeyBuilder().(*array.StringBuilder), indicators.ItemBuilder().(*array.Float64Builder)
+	for _, u := range updates {
+		appendArrowTime(b.Field(0), u.Time)
+		b.Field(1).(*array.StringBuilder).Append(u.ProductID)
+		b.Field(2).(*array.Float64Builder).Append(parseArrowFloat(u.VWAP))
+		b.Field(3).(*array.Int64Builder).Append(int64(u.WindowSize))
+		b.Field(4).(*array.Int64Builder).Append(u.TradeCount)
+		b.Field(5).(*array.Int64Builder).Append(u.MissedTrades)
+		indicators.Append(true)
+		for _, name := range slices.Sorted(maps.Keys(u.Indicators)) {
+			keys.Append(name)
+			if v, err := strconv.ParseFloat(u.Indicators[name], 64); err == nil {
+				values.Append(v)
+			} else {
+				values.AppendNull()
+			}
+		}
+	}
+	return b.NewRecordBatch()
+}
+
+// ArrowStreams serves trades and VWAP updates as Arrow IPC streams on
+// GET /arrow/trades and GET /arrow/vwap, for columnar consumers such as
+// pyarrow.ipc.open_stream. Each client gets a record batch of what arrived
+// every interval, the first preceded by the schema. It is a Sink and a
+// TradeSink.
+type ArrowStreams struct {
+	interval time.Duration
+	logger   Logger
+
+	mu      sync.Mutex
+	clients map[*arrowClient]struct{}
+	closed  bool
+}
+
+type arrowClient struct {
+	kind     string
+	products map[string]bool // nil for every product
+	rows     chan any        // Trade or VWAPUpdate
+	remote   string
+}
+
+func NewArrowStreams(interval time.Duration, logger Logger) *ArrowStreams {
+	return &ArrowStreams{interval: interval, logger: logger, clients: make(map[*arrowClient]struct{})}
+}
+
+func (s *ArrowStreams) Publish(update VWAPUpdate) error {
+	s.broadcast("vwap", update.ProductID, update)
+	return nil
+}
+
+func (s *ArrowStreams) RecordTrade(trade Trade) error {
+	s.broadcast("trades", trade.ProductID, trade)
+	return nil
+}
+
+// broadcast queues row for every interested client. Clients too slow to keep
+// up are disconnected rather than allowed to stall the pipeline.
+func (s *ArrowStreams) broadcast(kind, productID string, row any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for client := range s.clients {
+		if client.kind != kind || (client.products != nil && !client.products[productID]) {
+			continue
+		}
+		select {
+		case client.rows <- row:
+		default:
+			s.logger.Warnf("Dropping slow Arrow client %s", client.remote)
+			s.removeLocked(client)
+		}
+	}
+}
+
+func (s *ArrowStreams) removeLocked(client *arrowClient) {
+	if _, ok := s.clients[client]; ok {
+		delete(s.clients, client)
+		close(client.rows)
+	}
+}
+
+// Close ends every client's stream.
+func (s *ArrowStreams) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for client := range s.clients {
+		s.removeLocked(client)
+	}
+}
+
+// ServeHTTP streams /arrow/{kind}. products, a comma-separated list, limits
+// the stream to those products.
+func (s *ArrowStreams) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	schema := arrowUpdateSchema
+	switch kind := r.PathValue("kind"); kind {
+	case "vwap":
+	case "trades":
+		schema = arrowTradeSchema
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown Arrow stream " + kind})
+		return
+	}
+	client := &arrowClient{kind: r.PathValue("kind"), rows: make(chan any, arrowMaxBatch), remote: r.RemoteAddr}
+	if products := r.URL.Query().Get("products"); products != "" {
+		client.products = make(map[string]bool)
+		for _, id := range strings.Split(products, ",") {
+			client.products[strings.TrimSpace(id)] = true
+		}
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "shutting down"})
+		return
+	}
+	s.clients[client] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.removeLocked(client)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "application/vnd.apache.arrow.stream")
+	flusher := http.NewResponseController(w)
+	if flusher.Flush() != nil {
+		return
+	}
+	writer := ipc.NewWriter(w, ipc.WithSchema(schema))
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	var trades []Trade
+	var updates []VWAPUpdate
+	send := func() bool {
+		var batch arrow.RecordBatch
+		switch {
+		case len(trades) > 0:
+			batch = arrowTradeBatch(trades)
+		case len(updates) > 0:
+			batch = arrowUpdateBatch(updates)
+		default:
+			return true
+		}
+		defer batch.Release()
+		trades, updates = trades[:0], updates[:0]
+		if err := writer.Write(batch); err != nil {
+			return false
+		}
+		return flusher.Flush() == nil
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case row, ok := <-client.rows:
+			if !ok {
+				if send() && writer.Close() == nil {
+					flusher.Flush()
+				}
+				return
+			}
+			switch row := row.(type) {
+			case Trade:
+				trades = append(trades, row)
+			case VWAPUpdate:
+				updates = append(updates, row)
+			}
+			if len(trades)+len(updates) >= arrowMaxBatch && !send() {
+				return
+			}
+		case <-ticker.C:
+			if !send() {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+)
+
+// openArrowStream serves streams and opens the IPC stream at path. The
+// reader is created by the caller, once rows have been sent, as it waits
+// for the schema that comes with the first batch.
+func openArrowStream(t *testing.T, streams *ArrowStreams, path string) io.Reader {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.Handle("GET /arrow/{kind}", streams)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	resp, err := http.Get(server.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if ct := resp.Header.Get("Content-Type"); ct != "application/vnd.apache.arrow.stream" {
+		t.Errorf("Unexpected content type %s", ct)
+	}
+	return resp.Body
+}
+
+func TestArrowTradeStream(t *testing.T) {
+	streams := NewArrowStreams(10*time.Millisecond, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	body := openArrowStream(t, streams, "/arrow/trades?products=BTC-USD")
+
+	ts := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	streams.RecordTrade(Trade{ProductID: "BTC-USD", TradeID: 7, Price: "45000", Size: "0.5", Side: "buy", Time: ts})
+	streams.RecordTrade(Trade{ProductID: "ETH-USD", TradeID: 1, Price: "3000", Size: "1", Side: "buy", Time: ts})
+	streams.RecordTrade(Trade{ProductID: "BTC-USD", TradeID: 8, Price: "45010.5", Size: "0.25", Side: "sell"})
+
+	r, err := ipc.NewReader(body)
+	if err != nil {
+		t.Fatalf("Reading the schema failed: %v", err)
+	}
+	defer r.Release()
+	var names []string
+	for _, field := range r.Schema().Fields() {
+		names = append(names, field.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"time", "product_id", "trade_id", "price", "size", "side"}) {
+		t.Errorf("Unexpected trade columns %v", names)
+	}
+
+	var ids []int64
+	var products, sides []string
+	var prices, sizes []float64
+	var times []*arrow.Timestamp
+	for len(ids) < 2 && r.Next() {
+		rec := r.RecordBatch()
+		timeCol := rec.Column(0).(*array.Timestamp)
+		for i := 0; i < int(rec.NumRows()); i++ {
+			var at *arrow.Timestamp
+			if timeCol.IsValid(i) {
+				v := timeCol.Value(i)
+				at = &v
+			}
+			times = append(times, at)
+			products = append(products, rec.Column(1).(*array.String).Value(i))
+			ids = append(ids, rec.Column(2).(*array.Int64).Value(i))
+			prices = append(prices, rec.Column(3).(*array.Float64).Value(i))
+			sizes = append(sizes, rec.Column(4).(*array.Float64).Value(i))
+			sides = append(sides, rec.Column(5).(*array.String).Value(i))
+		}
+	}
+	if !reflect.DeepEqual(ids, []int64{7, 8}) || !reflect.DeepEqual(products, []string{"BTC-USD", "BTC-USD"}) {
+		t.Fatalf("Expected the 2 BTC-USD trades, got ids %v for %v", ids, products)
+	}
+	if times[0] == nil || int64(*times[0]) != ts.UnixMicro() || prices[1] != 45010.5 || sizes[0] != 0.5 || sides[1] != "sell" {
+		t.Errorf("Unexpected trade values %v %v %v %v", times, prices, sizes, sides)
+	}
+	if times[1] != nil {
+		t.Errorf("Expected a trade without a time to have a null time, got %d", *times[1])
+	}
+
+	streams.Close()
+	if r.Next() {
+		t.Error("Expected the end of the stream after Close")
+	}
+	if err := r.Err(); err != nil {
+		t.Errorf("Reading the stream failed: %v", err)
+	}
+}
+
+func TestArrowUpdateStream(t *testing.T) {
+	streams := NewArrowStreams(10*time.Millisecond, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	body := openArrowStream(t, streams, "/arrow/vwap")
+
+	ts := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	streams.Publish(VWAPUpdate{ProductID: "BTC-USD", VWAP: "45000.5", WindowSize: 200, TradeCount: 3, Time: ts, Indicators: map[string]string{"sma20": "45001.2", "last": "n/a"}})
+	streams.Publish(VWAPUpdate{ProductID: "ETH-USD", VWAP: "3000", WindowSize: 200, TradeCount: 1, MissedTrades: 2, Time: ts})
+
+	r, err := ipc.NewReader(body)
+	if err != nil {
+		t.Fatalf("Reading the schema failed: %v", err)
+	}
+	defer r.Release()
+	want := arrow.NewSchema([]arrow.Field{
+		{Name: "time", Type: &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}, Nullable: true},
+		{Name: "product_id", Type: arrow.BinaryTypes.String},
+		{Name: "vwap", Type: arrow.PrimitiveTypes.Float64},
+		{Name: "window_size", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "trade_count", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "missed_trades", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "indicators", Type: arrow.MapOf(arrow.BinaryTypes.String, arrow.PrimitiveTypes.Float64)},
+	}, nil)
+	if !r.Schema().Equal(want) {
+		t.Fatalf("Unexpected schema %v", r.Schema())
+	}
+
+	var products []string
+	var vwaps []float64
+	var missed []int64
+	for len(products) < 2 && r.Next() {
+		rec := r.RecordBatch()
+		for i := 0; i < int(rec.NumRows()); i++ {
+			if got := rec.Column(0).(*array.Timestamp).Value(i); int64(got) != ts.UnixMicro() {
+				t.Errorf("Unexpected time %d", got)
+			}
+			products = append(products, rec.Column(1).(*array.String).Value(i))
+			vwaps = append(vwaps, rec.Column(2).(*array.Float64).Value(i))
+			missed = append(missed, rec.Column(5).(*array.Int64).Value(i))
+		}
+	}
+	if !reflect.DeepEqual(products, []string{"BTC-USD", "ETH-USD"}) || !reflect.DeepEqual(vwaps, []float64{45000.5, 3000}) || !reflect.DeepEqual(missed, []int64{0, 2}) {
+		t.Errorf("Unexpected rows: products %v, VWAPs %v, missed trades %v", products, vwaps, missed)
+	}
+
+	streams.Close()
+	if r.Next() {
+		t.Error("Expected the end of the stream after Close")
+	}
+	if err := r.Err(); err != nil {
+		t.Errorf("Reading the stream failed: %v", err)
+	}
+}
+
+func TestArrowUpdateBatch(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	batch := arrowUpdateBatch([]VWAPUpdate{
+		{ProductID: "BTC-USD", VWAP: "45000.5", WindowSize: 200, TradeCount: 3, Time: ts, Indicators: map[string]string{"sma20": "45001.2", "last": "n/a"}},
+		{ProductID: "ETH-USD", VWAP: "3000", WindowSize: 200, TradeCount: 1, MissedTrades: 2},
+	})
+	defer batch.Release()
+	if batch.NumRows() != 2 {
+		t.Fatalf("Expected 2 rows, got %d", batch.NumRows())
+	}
+	if times := batch.Column(0).(*array.Timestamp); !times.IsValid(0) || times.IsValid(1) {
+		t.Errorf("Expected only the update without a time to have a null time, got %v", times)
+	}
+	indicators := batch.Column(6).(*array.Map)
+	if offsets := indicators.Offsets(); !reflect.DeepEqual(offsets, []int32{0, 2, 2}) {
+		t.Errorf("Expected two entries for the first update and none for the second, got offsets %v", offsets)
+	}
+	keys, values := indicators.Keys().(*array.String), indicators.Items().(*array.Float64)
+	if keys.Value(0) != "last" || keys.Value(1) != "sma20" {
+		t.Errorf("Unexpected indicator names %v", keys)
+	}
+	if values.IsValid(0) || values.Value(1) != 45001.2 {
+		t.Errorf("Expected the non-numeric value to be null, got %v", values)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Environment variables holding the Coinbase Exchange API key used to sign
+// subscriptions.
+const (
+	envAPIKey        = "COINBASE_API_KEY"
+	envAPISecret     = "COINBASE_API_SECRET"
+	envAPIPassphrase = "COINBASE_API_PASSPHRASE"
+)
+
+// Credentials are a Coinbase Exchange API key. Secret is base64-encoded, as
+// the exchange issues it.
+type Credentials struct {
+	Key        string
+	Secret     string
+	Passphrase string
+}
+
+// credentialsFromEnv reads the API key from the environment. No key means an
+// unauthenticated feed; a partial or malformed one is an error.
+func credentialsFromEnv() (Credentials, error) {
+	creds := Credentials{
+		Key:        os.Getenv(envAPIKey),
+		Secret:     os.Getenv(envAPISecret),
+		Passphrase: os.Getenv(envAPIPassphrase),
+	}
+	if creds == (Credentials{}) {
+		return creds, nil
+	}
+	if creds.Key == "" || creds.Secret == "" || creds.Passphrase == "" {
+		return Credentials{}, fmt.Errorf("incomplete API credentials: %s, %s and %s must all be set", envAPIKey, envAPISecret, envAPIPassphrase)
+	}
+	if _, err := base64.StdEncoding.DecodeString(creds.Secret); err != nil {
+		return Credentials{}, fmt.Errorf("invalid %s: %w", envAPISecret, err)
+	}
+	return creds, nil
+}
+
+// String keeps the secret and passphrase out of logs and error messages.
+func (c Credentials) String() string {
+	if c.Key == "" {
+		return "none"
+	}
+	return "key " + c.Key
+}
+
+// signer adds the exchange's authentication fields to subscribe messages.
+// Signatures carry a timestamp that the exchange rejects when it is more
+// than 30 seconds off its own clock, so the signer measures the local
+// clock's skew and corrects for it.
+type signer struct {
+	creds  Credentials
+	secret []byte
+	rest   *RESTClient
+	now    func() time.Time
+
+	mu   sync.Mutex
+	skew time.Duration // exchange clock minus local clock
+}
+
+func newSigner(creds Credentials, rest *RESTClient) (*signer, error) {
+	secret, err := base64.StdEncoding.DecodeString(creds.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", envAPISecret, err)
+	}
+	return &signer{creds: creds, secret: secret, rest: rest, now: time.Now}, nil
+}
+
+// sign returns the authentication fields for a subscribe message: an
+// HMAC-SHA256 over the timestamp and the exchange's verification request.
+func (s *signer) sign() map[string]string {
+	s.mu.Lock()
+	at := s.now().Add(s.skew)
+	s.mu.Unlock()
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(timestamp + "GET" + "/users/self/verify"))
+	return map[string]string{
+		"key":        s.creds.Key,
+		"passphrase": s.creds.Passphrase,
+		"timestamp":  timestamp,
+		"signature":  base64.StdEncoding.EncodeToString(mac.Sum(nil)),
+	}
+}
+
+// syncClock measures the skew between the local and exchange clocks and
+// returns it. On failure the previous measurement stays in use.
+func (s *signer) syncClock(ctx context.Context) (time.Duration, error) {
+	sent := s.now()
+	server, err := s.rest.ServerTime(ctx)
+	if err != nil {
+		return 0, err
+	}
+	received := s.now()
+	// Assume the exchange read its clock halfway through the round trip.
+	skew := server.Sub(sent.Add(received.Sub(sent) / 2))
+	s.mu.Lock()
+	s.skew = skew
+	s.mu.Unlock()
+	return skew, nil
+}
+
+// ServerTime returns the exchange's clock.
+func (c *RESTClient) ServerTime(ctx context.Context) (time.Time, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/time", nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("fetching server time: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}, fmt.Errorf("fetching server time: unexpected status %s", resp.Status)
+	}
+
+	var body struct {
+		Epoch float64 `json:"epoch"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return time.Time{}, fmt.Errorf("decoding server time: %w", err)
+	}
+	if body.Epoch <= 0 {
+		return time.Time{}, errors.New("decoding server time: missing epoch")
+	}
+	sec, frac := math.Modf(body.Epoch)
+	return time.Unix(int64(sec), int64(frac*1e9)), nil
+}
+
+// SetSigner makes the pipeline sign its subscriptions.
+func (p *Pipeline) SetSigner(s *signer) {
+	p.signer = s
+}
+
+// authenticate refreshes the clock skew ahead of a new connection's
+// subscribe. A failed measurement is logged, and signing goes ahead with the
+// last one.
+func (p *Pipeline) authenticate(ctx context.Context, logger Logger) {
+	if p.signer == nil {
+		return
+	}
+	skew, err := p.signer.syncClock(ctx)
+	if err != nil {
+		logger.Warnf("Clock sync failed, signing with the last measured skew: %v", err)
+		return
+	}
+	if skew.Abs() > time.Second {
+		logger.Infof("Local clock is %v off the exchange's; correcting signature timestamps", skew.Round(time.Millisecond))
+	}
+}
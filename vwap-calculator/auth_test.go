@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grantis/gopkg/vwap-calculator/internal/mockexchange"
+)
+
+var testSecret = base64.StdEncoding.EncodeToString([]byte("not-a-real-secret"))
+
+func expectedSignature(timestamp string) string {
+	mac := hmac.New(sha256.New, []byte("not-a-real-secret"))
+	mac.Write([]byte(timestamp + "GET/users/self/verify"))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestCredentialsFromEnv(t *testing.T) {
+	t.Setenv(envAPIKey, "")
+	t.Setenv(envAPISecret, "")
+	t.Setenv(envAPIPassphrase, "")
+	if creds, err := credentialsFromEnv(); err != nil || creds.Key != "" {
+		t.Errorf("Expected no credentials, got %v, %v", creds, err)
+	}
+
+	t.Setenv(envAPIKey, "key1")
+	if _, err := credentialsFromEnv(); err == nil {
+		t.Error("Expected error for a key without secret and passphrase")
+	}
+	t.Setenv(envAPIPassphrase, "pass")
+	t.Setenv(envAPISecret, "not base64!")
+	if _, err := credentialsFromEnv(); err == nil {
+		t.Error("Expected error for a secret that is not base64")
+	}
+
+	t.Setenv(envAPISecret, testSecret)
+	creds, err := credentialsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := fmt.Sprintf("%v %+v", creds, struct{ Auth Credentials }{creds}); strings.Contains(s, testSecret) || strings.Contains(s, "pass") {
+		t.Errorf("Expected secrets to be redacted, got %q", s)
+	}
+}
+
+func TestSignerClockSkew(t *testing.T) {
+	local := time.Unix(1700000000, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/time" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"iso":"ignored","epoch":%d.5}`, local.Unix()+45)
+	}))
+	defer server.Close()
+
+	s, err := newSigner(Credentials{Key: "key1", Secret: testSecret, Passphrase: "pass"}, NewRESTClient(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return local }
+
+	fields := s.sign()
+	if fields["timestamp"] != "1700000000" || fields["signature"] != expectedSignature("1700000000") ||
+		fields["key"] != "key1" || fields["passphrase"] != "pass" {
+		t.Errorf("Unexpected fields %v", fields)
+	}
+
+	skew, err := s.syncClock(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skew != 45500*time.Millisecond {
+		t.Errorf("Expected a skew of 45.5s, got %v", skew)
+	}
+	if fields := s.sign(); fields["timestamp"] != "1700000045" || fields["signature"] != expectedSignature("1700000045") {
+		t.Errorf("Expected a corrected timestamp, got %v", fields)
+	}
+}
+
+func TestRunFeedSignsSubscribe(t *testing.T) {
+	rest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"epoch":%d}`, time.Now().Unix())
+	}))
+	defer rest.Close()
+	exchange := mockexchange.New()
+	defer exchange.Close()
+
+	s, err := newSigner(Credentials{Key: "key1", Secret: testSecret, Passphrase: "pass"}, NewRESTClient(rest.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	startFeed(t, exchange, NewStore(), func(_ *Config, p *Pipeline) { p.SetSigner(s) })
+
+	req := nextRequest(t, exchange)
+	if req.Key != "key1" || req.Passphrase != "pass" || req.Signature != expectedSignature(req.Timestamp) {
+		t.Errorf("Unexpected authentication fields %+v", req)
+	}
+}
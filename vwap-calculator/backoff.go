@@ -0,0 +1,68 @@
+package main
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy controls how the feed reconnects after failures.
+type RetryPolicy struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+	// Jitter is the fraction of each delay that is randomised: 0 gives fixed
+	// delays, 1 gives "full jitter" anywhere in [0, delay].
+	Jitter float64
+	// MaxRetries is the number of consecutive failures tolerated before giving
+	// up. Zero retries forever.
+	MaxRetries int
+	// HealthyAfter is how long a connection must stay up before the failure
+	// count is reset. Shorter-lived connections count as failures.
+	HealthyAfter time.Duration
+}
+
+var defaultRetryPolicy = RetryPolicy{
+	InitialDelay: retryDelay,
+	MaxDelay:     maxRetryDelay,
+	Multiplier:   2,
+	Jitter:       0.5,
+	MaxRetries:   maxRetries,
+	HealthyAfter: healthyConnectionPeriod,
+}
+
+// Backoff tracks consecutive failures and yields capped, jittered delays.
+type Backoff struct {
+	policy   RetryPolicy
+	failures int
+	rand     func() float64
+}
+
+func NewBackoff(policy RetryPolicy) *Backoff {
+	return &Backoff{policy: policy, rand: rand.Float64}
+}
+
+// Fail records a failure and returns the delay before the next attempt, or
+// false when MaxRetries has been exhausted.
+func (b *Backoff) Fail() (time.Duration, bool) {
+	b.failures++
+	if b.policy.MaxRetries > 0 && b.failures > b.policy.MaxRetries {
+		return 0, false
+	}
+
+	delay := float64(b.policy.InitialDelay) * math.Pow(b.policy.Multiplier, float64(b.failures-1))
+	if max := float64(b.policy.MaxDelay); b.policy.MaxDelay > 0 && delay > max {
+		delay = max
+	}
+	delay -= delay * b.policy.Jitter * b.rand()
+	return time.Duration(delay), true
+}
+
+// Failures returns the number of consecutive failures recorded.
+func (b *Backoff) Failures() int {
+	return b.failures
+}
+
+func (b *Backoff) Reset() {
+	b.failures = 0
+}
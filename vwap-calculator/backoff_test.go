@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{
+		InitialDelay: time.Second,
+		MaxDelay:     5 * time.Second,
+		Multiplier:   2,
+		MaxRetries:   5,
+	}
+
+	t.Run("ExponentialAndCapped", func(t *testing.T) {
+		b := NewBackoff(policy)
+		expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+		for i, want := range expected {
+			got, ok := b.Fail()
+			if !ok || got != want {
+				t.Errorf("Attempt %d: expected %v, got %v (ok=%v)", i+1, want, got, ok)
+			}
+		}
+		if _, ok := b.Fail(); ok {
+			t.Error("Expected retries to be exhausted")
+		}
+	})
+
+	t.Run("Jitter", func(t *testing.T) {
+		jittered := policy
+		jittered.Jitter = 0.5
+		b := NewBackoff(jittered)
+		b.rand = func() float64 { return 1 }
+		if got, _ := b.Fail(); got != 500*time.Millisecond {
+			t.Errorf("Expected 500ms, got %v", got)
+		}
+	})
+
+	t.Run("ForeverAndReset", func(t *testing.T) {
+		forever := policy
+		forever.MaxRetries = 0
+		b := NewBackoff(forever)
+		for i := 0; i < 100; i++ {
+			if _, ok := b.Fail(); !ok {
+				t.Fatalf("Retry %d refused with MaxRetries=0", i+1)
+			}
+		}
+		b.Reset()
+		if got, _ := b.Fail(); got != time.Second {
+			t.Errorf("Expected delay to restart at 1s after Reset, got %v", got)
+		}
+	})
+}
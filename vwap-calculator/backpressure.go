@@ -0,0 +1,47 @@
+package main
+
+import "fmt"
+
+// Backpressure policies for a full queue.
+const (
+	// backpressureBlock makes the producer wait for room.
+	backpressureBlock = "block"
+	// backpressureDropOldest discards the oldest queued item to make room,
+	// so the producer never waits.
+	backpressureDropOldest = "drop-oldest"
+)
+
+func parseBackpressure(s string) (string, error) {
+	switch s {
+	case backpressureBlock, backpressureDropOldest:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown backpressure policy %q: must be block or drop-oldest", s)
+}
+
+// enqueue sends item on queue. Under drop-oldest, a full queue gives up its
+// oldest items to dropped until item fits; otherwise it blocks until there is
+// room or stop is closed, and reports whether item was sent. drop-oldest
+// needs a buffered queue with a single sender.
+func enqueue[T any](queue chan T, item T, policy string, stop <-chan struct{}, dropped func(T)) bool {
+	if policy == backpressureDropOldest {
+		for {
+			select {
+			case queue <- item:
+				return true
+			default:
+			}
+			select {
+			case old := <-queue:
+				dropped(old)
+			default:
+			}
+		}
+	}
+	select {
+	case queue <- item:
+		return true
+	case <-stop:
+		return false
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEnqueueDropOldest(t *testing.T) {
+	queue := make(chan int, 2)
+	var dropped []int
+	for i := 1; i <= 5; i++ {
+		if !enqueue(queue, i, backpressureDropOldest, nil, func(old int) { dropped = append(dropped, old) }) {
+			t.Fatalf("Expected %d to be sent", i)
+		}
+	}
+	if len(dropped) != 3 || dropped[0] != 1 || dropped[2] != 3 {
+		t.Errorf("Expected 1, 2 and 3 dropped, got %v", dropped)
+	}
+	if a, b := <-queue, <-queue; a != 4 || b != 5 {
+		t.Errorf("Expected the newest items 4 and 5 queued, got %d and %d", a, b)
+	}
+}
+
+func TestEnqueueBlock(t *testing.T) {
+	queue := make(chan int, 1)
+	enqueue(queue, 1, backpressureBlock, nil, nil)
+
+	stop := make(chan struct{})
+	sent := make(chan bool)
+	go func() { sent <- enqueue(queue, 2, backpressureBlock, stop, nil) }()
+	select {
+	case <-sent:
+		t.Fatal("Expected enqueue to block on a full queue")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(stop)
+	if <-sent {
+		t.Error("Expected enqueue to give up once stopped")
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// Defaults for sinks that write through a batchQueue.
+const (
+	storageQueueSize = 4096
+	storageBatchSize = 500
+	storageFlushWait = time.Second
+)
+
+var errQueueFull = errors.New("storage queue full, dropping record")
+
+// batchQueue buffers items and hands them to flush in batches of up to
+// batchSize, or whatever has accumulated after wait, from a single
+// background goroutine.
+type batchQueue[T any] struct {
+	items chan T
+	done  chan struct{}
+}
+
+func newBatchQueue[T any](queueSize, batchSize int, wait time.Duration, flush func([]T)) *batchQueue[T] {
+	q := &batchQueue[T]{
+		items: make(chan T, queueSize),
+		done:  make(chan struct{}),
+	}
+	go q.run(batchSize, wait, flush)
+	return q
+}
+
+// Offer enqueues item without blocking and reports whether it was accepted.
+func (q *batchQueue[T]) Offer(item T) bool {
+	select {
+	case q.items <- item:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close flushes everything still queued and waits for the final flush.
+func (q *batchQueue[T]) Close() {
+	close(q.items)
+	<-q.done
+}
+
+func (q *batchQueue[T]) run(batchSize int, wait time.Duration, flush func([]T)) {
+	defer close(q.done)
+
+	batch := make([]T, 0, batchSize)
+	send := func() {
+		if len(batch) > 0 {
+			flush(batch)
+			batch = batch[:0]
+		}
+	}
+
+	ticker := time.NewTicker(wait)
+	defer ticker.Stop()
+	for {
+		select {
+		case item, ok := <-q.items:
+			if !ok {
+				send()
+				return
+			}
+			if batch = append(batch, item); len(batch) == batchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		}
+	}
+}
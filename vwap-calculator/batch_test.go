@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBatchQueue(t *testing.T) {
+	var batches [][]int
+	q := newBatchQueue(10, 3, time.Hour, func(batch []int) {
+		batches = append(batches, append([]int(nil), batch...))
+	})
+	for i := 1; i <= 7; i++ {
+		if !q.Offer(i) {
+			t.Fatalf("Offer(%d) rejected", i)
+		}
+	}
+	q.Close()
+
+	if len(batches) != 3 || len(batches[0]) != 3 || len(batches[2]) != 1 || batches[2][0] != 7 {
+		t.Errorf("Expected batches of 3, 3 and 1, got %v", batches)
+	}
+}
+
+func TestBatchQueueFlushesAfterWait(t *testing.T) {
+	flushed := make(chan []int, 1)
+	q := newBatchQueue(10, 100, 10*time.Millisecond, func(batch []int) {
+		flushed <- append([]int(nil), batch...)
+	})
+	defer q.Close()
+
+	q.Offer(42)
+	select {
+	case batch := <-flushed:
+		if len(batch) != 1 || batch[0] != 42 {
+			t.Errorf("Unexpected batch %v", batch)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Partial batch was never flushed")
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"testing"
+)
+
+// targetTradesPerSecond is the end-to-end throughput the pipeline should
+// sustain on one core, well above the busiest Coinbase product's peak rate.
+const targetTradesPerSecond = 10000
+
+// benchTrades returns a cycle of realistic price and size strings.
+func benchTrades() (prices, sizes []string) {
+	prices = make([]string, 256)
+	sizes = make([]string, 256)
+	for i := range prices {
+		prices[i] = fmt.Sprintf("%d.%02d", 45000+i%50, i%100)
+		sizes[i] = fmt.Sprintf("0.%08d", 1000+i*31337)
+	}
+	return prices, sizes
+}
+
+func benchmarkCalculator(b *testing.B, calc Calculator) {
+	prices, sizes := benchTrades()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		calc.Update(prices[i%256], sizes[i%256])
+		calc.Calculate()
+	}
+}
+
+func BenchmarkVWAPCalculator(b *testing.B) {
+	benchmarkCalculator(b, NewVWAPCalculator())
+}
+
+func BenchmarkDecimalVWAPCalculator(b *testing.B) {
+	benchmarkCalculator(b, NewDecimalVWAPCalculator(windowSize))
+}
+
+func BenchmarkVWAPCalculatorUpdate(b *testing.B) {
+	calc := NewVWAPCalculator()
+	prices, sizes := benchTrades()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		calc.Update(prices[i%256], sizes[i%256])
+	}
+}
+
+// BenchmarkVWAPCalculatorContended reads the VWAP from parallel goroutines, as
+// the HTTP and websocket servers do, while one writer keeps updating it.
+func BenchmarkVWAPCalculatorContended(b *testing.B) {
+	calc := NewVWAPCalculator()
+	for i := 0; i < windowSize; i++ {
+		calc.Update("45000.12", "0.5")
+	}
+	stop := make(chan struct{})
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+				calc.Update(fmt.Sprintf("%d.5", 45000+i%100), "0.25")
+			}
+		}
+	}()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			calc.Calculate()
+		}
+	})
+	b.StopTimer()
+	close(stop)
+	<-writerDone
+}
+
+// fullRingBuffer returns a window that evicts on every further insert.
+func fullRingBuffer() (*RingBuffer, *big.Rat, *big.Rat) {
+	rb := NewRingBuffer(windowSize)
+	price, size := big.NewRat(4500012, 100), big.NewRat(1, 3)
+	for i := 0; i < windowSize; i++ {
+		rb.push(price, size)
+	}
+	return &rb, price, size
+}
+
+func BenchmarkRingBufferEvictAdd(b *testing.B) {
+	rb, price, size := fullRingBuffer()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rb.Add(price, size)
+	}
+}
+
+func BenchmarkRingBufferEvictPush(b *testing.B) {
+	rb, price, size := fullRingBuffer()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rb.push(price, size)
+	}
+}
+
+func BenchmarkParseRat(b *testing.B) {
+	prices, _ := benchTrades()
+	var r big.Rat
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.SetString(prices[i%256])
+	}
+}
+
+func BenchmarkParseFixed(b *testing.B) {
+	prices, _ := benchTrades()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		parseFixed(prices[i%256])
+	}
+}
+
+// BenchmarkProcessMessage measures a raw match message from JSON decoding
+// through the calculator to the store, and reports the resulting trade rate
+// against targetTradesPerSecond.
+func BenchmarkProcessMessage(b *testing.B) {
+	for _, method := range []string{"vwap", "decimal"} {
+		b.Run(method, func(b *testing.B) {
+			calculators := make(map[string]Calculator, len(products))
+			for _, productID := range products {
+				calculators[productID], _ = newCalculator(method, windowSize, 0)
+			}
+			pipeline := NewPipeline(calculators, NewLogger(io.Discard, slog.LevelInfo, "text"), NewStore())
+			prices, sizes := benchTrades()
+			messages := make([][]byte, 1024)
+			for i := range messages {
+				messages[i] = []byte(fmt.Sprintf(`{"type":"match","product_id":"%s","trade_id":%d,"price":"%s","size":"%s","side":"buy","time":"2024-01-01T00:00:00.000000Z"}`,
+					products[i%len(products)], i+1, prices[i%256], sizes[i%256]))
+			}
+			ctx := context.Background()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Trade IDs repeat every 1024 messages; clear the deduper
+				// so every message is applied.
+				if i%len(messages) == 0 {
+					pipeline.dedupe = NewDeduper(dedupeWindow)
+				}
+				pipeline.processMessage(ctx, messages[i%len(messages)])
+			}
+			b.StopTimer()
+			rate := float64(b.N) / b.Elapsed().Seconds()
+			b.ReportMetric(rate, "trades/s")
+			if b.N > 1 && rate < targetTradesPerSecond {
+				b.Logf("%.0f trades/s is below the %d trades/s target", rate, targetTradesPerSecond)
+			}
+		})
+	}
+}
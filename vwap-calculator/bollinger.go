@@ -0,0 +1,123 @@
+package main
+
+import (
+	"math/big"
+	"sync"
+	"time"
+)
+
+// MultiCalculator is implemented by indicators that report several values.
+// The pipeline reports each one as "<indicator name>_<key>".
+type MultiCalculator interface {
+	Calculator
+	Values() map[string]string
+}
+
+// BollingerCalculator tracks the population standard deviation of trade
+// price over a window of recent trades and reports bands k standard
+// deviations either side of the window's VWAP. Sums are kept as exact
+// rationals, so removing trades as they roll out of the window loses no
+// precision.
+type BollingerCalculator struct {
+	mu          sync.Mutex
+	k           *big.Float
+	buffer      RingBuffer
+	totalPV     big.Rat
+	totalVolume big.Rat
+	sumPrice    big.Rat
+	sumSquares  big.Rat
+	clock       tradeClock
+	formatted
+}
+
+// NewBollingerCalculator returns a BollingerCalculator over the last size
+// trades.
+func NewBollingerCalculator(k float64, size int) *BollingerCalculator {
+	return &BollingerCalculator{k: big.NewFloat(k), buffer: NewRingBuffer(size), clock: newTradeClock(size)}
+}
+
+func (c *BollingerCalculator) Update(priceStr, sizeStr string) error {
+	return c.UpdateAt(priceStr, sizeStr, time.Now())
+}
+
+func (c *BollingerCalculator) UpdateAt(priceStr, sizeStr string, at time.Time) error {
+	price, err := parsePrice(priceStr, sizeStr)
+	if err != nil {
+		return err
+	}
+	size, _ := new(big.Rat).SetString(sizeStr)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if oldPrice, oldSize, removed := c.buffer.Add(price, size); removed {
+		c.totalPV.Sub(&c.totalPV, new(big.Rat).Mul(oldPrice, oldSize))
+		c.totalVolume.Sub(&c.totalVolume, oldSize)
+		c.sumPrice.Sub(&c.sumPrice, oldPrice)
+		c.sumSquares.Sub(&c.sumSquares, new(big.Rat).Mul(oldPrice, oldPrice))
+	}
+	c.totalPV.Add(&c.totalPV, new(big.Rat).Mul(price, size))
+	c.totalVolume.Add(&c.totalVolume, size)
+	c.sumPrice.Add(&c.sumPrice, price)
+	c.sumSquares.Add(&c.sumSquares, new(big.Rat).Mul(price, price))
+	c.clock.add(at)
+	return nil
+}
+
+func (c *BollingerCalculator) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buffer.reset()
+	c.totalPV.SetInt64(0)
+	c.totalVolume.SetInt64(0)
+	c.sumPrice.SetInt64(0)
+	c.sumSquares.SetInt64(0)
+	c.clock.reset()
+}
+
+func (c *BollingerCalculator) TradeCount() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clock.trades
+}
+
+func (c *BollingerCalculator) Stats() CalculatorStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clock.stats(volumeString(&c.totalVolume), volumeString(&c.totalPV))
+}
+
+// Calculate returns the standard deviation.
+func (c *BollingerCalculator) Calculate() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.formatFloat(c.stddev())
+}
+
+func (c *BollingerCalculator) Values() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sigma := c.stddev()
+	if c.buffer.count == 0 {
+		return map[string]string{"stddev": "0", "upper": "0", "lower": "0"}
+	}
+	vwap := new(big.Float).SetRat(new(big.Rat).Quo(&c.totalPV, &c.totalVolume))
+	width := new(big.Float).Mul(c.k, sigma)
+	return map[string]string{
+		"stddev": c.formatFloat(sigma),
+		"upper":  c.formatFloat(new(big.Float).Add(vwap, width)),
+		"lower":  c.formatFloat(new(big.Float).Sub(vwap, width)),
+	}
+}
+
+// stddev returns sqrt(E[p²] - E[p]²) over the window. c.mu must be held.
+func (c *BollingerCalculator) stddev() *big.Float {
+	if c.buffer.count == 0 {
+		return new(big.Float)
+	}
+	n := big.NewRat(int64(c.buffer.count), 1)
+	mean := new(big.Rat).Quo(&c.sumPrice, n)
+	variance := new(big.Rat).Quo(&c.sumSquares, n)
+	variance.Sub(variance, mean.Mul(mean, mean))
+	return sqrtRat(variance)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBollingerCalculator(t *testing.T) {
+	calc := NewBollingerCalculator(2, windowSize)
+	if got := calc.Values(); got["stddev"] != "0" || got["upper"] != "0" {
+		t.Errorf("Expected zeros before any trades, got %v", got)
+	}
+
+	// Prices 2, 4, 4, 4, 5, 5, 7, 9 have mean 5 and standard deviation 2.
+	for _, price := range []string{"2", "4", "4", "4", "5", "5", "7", "9"} {
+		if err := calc.Update(price, "1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := map[string]string{"stddev": "2.0000", "upper": "9.0000", "lower": "1.0000"}
+	if got := calc.Values(); fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+	if got := calc.Calculate(); got != "2.0000" {
+		t.Errorf("Expected Calculate to return the deviation, got %s", got)
+	}
+}
+
+func TestBollingerCalculatorEviction(t *testing.T) {
+	calc := NewBollingerCalculator(1, windowSize)
+	calc.Update("1000000", "5")
+	for i := 0; i < windowSize; i++ {
+		calc.Update(fmt.Sprint(100+i%2*2), "1")
+	}
+	// Only alternating 100/102 prints remain: σ = 1 around a VWAP of 101.
+	expected := map[string]string{"stddev": "1.0000", "upper": "102.0000", "lower": "100.0000"}
+	if got := calc.Values(); fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
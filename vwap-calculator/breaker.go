@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// breakerWindow is the span malformed messages are counted over.
+	breakerWindow = 10 * time.Second
+	// breakerLogLimit is how many malformed messages are logged in full per
+	// window; later ones are only counted.
+	breakerLogLimit = 5
+)
+
+var errMalformedFeed = errors.New("too many malformed messages")
+
+// messageBreaker counts feed messages that fail to decode or validate. Past
+// a threshold it trips, so the feed is resubscribed on a new connection
+// instead of logging every bad message of a changed schema.
+type messageBreaker struct {
+	minErrors int     // malformed messages in a window needed to trip; 0 never trips
+	ratio     float64 // fraction of the window's messages that must be malformed
+	now       func() time.Time
+	trips     chan struct{}
+
+	mu         sync.Mutex
+	start      time.Time // of the current window
+	messages   int
+	errors     int
+	suppressed int  // malformed messages not logged in this window
+	tripped    bool // already tripped in this window
+}
+
+// breakerCheck is the outcome of counting a malformed message.
+type breakerCheck struct {
+	log        bool // log this message
+	trip       bool // this message tripped the breaker
+	errors     int  // malformed messages in the window so far
+	messages   int
+	suppressed int // unlogged messages of the window that just ended
+}
+
+func newMessageBreaker() *messageBreaker {
+	return &messageBreaker{now: time.Now, trips: make(chan struct{}, 1)}
+}
+
+// message counts a feed message, returning how many malformed messages went
+// unlogged if it starts a new window.
+func (b *messageBreaker) message() (suppressed int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	suppressed = b.roll()
+	b.messages++
+	return suppressed
+}
+
+// malformed counts a message that could not be decoded or applied.
+func (b *messageBreaker) malformed() breakerCheck {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	check := breakerCheck{suppressed: b.roll()}
+	b.errors++
+	check.errors, check.messages = b.errors, max(b.messages, b.errors)
+	check.log = b.errors <= breakerLogLimit
+	if !check.log {
+		b.suppressed++
+	}
+	if b.minErrors > 0 && !b.tripped && b.errors >= b.minErrors && float64(b.errors) >= b.ratio*float64(check.messages) {
+		b.tripped, check.trip = true, true
+		select {
+		case b.trips <- struct{}{}:
+		default:
+		}
+	}
+	return check
+}
+
+// roll starts a new window once the current one is over, returning how many
+// malformed messages it left unlogged. b.mu must be held.
+func (b *messageBreaker) roll() int {
+	now := b.now()
+	if now.Sub(b.start) < breakerWindow {
+		return 0
+	}
+	suppressed := b.suppressed
+	b.start, b.messages, b.errors, b.suppressed, b.tripped = now, 0, 0, 0, false
+	return suppressed
+}
+
+// reset starts counting afresh for a new connection, discarding a trip the
+// previous one did not act on.
+func (b *messageBreaker) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.start, b.messages, b.errors, b.suppressed, b.tripped = b.now(), 0, 0, 0, false
+	select {
+	case <-b.trips:
+	default:
+	}
+}
+
+// Tripped delivers a value each time the breaker trips.
+func (b *messageBreaker) Tripped() <-chan struct{} {
+	return b.trips
+}
+
+// SetMessageBreaker makes the pipeline drop the feed connection when at
+// least minErrors messages, and ratio of all messages, within breakerWindow
+// are malformed.
+func (p *Pipeline) SetMessageBreaker(minErrors int, ratio float64) {
+	p.breaker.minErrors, p.breaker.ratio = minErrors, ratio
+}
+
+// countMessage counts a feed message towards the breaker's window.
+func (p *Pipeline) countMessage() {
+	if n := p.breaker.message(); n > 0 {
+		p.logger.Warnf("Suppressed %d more malformed messages in the last %v", n, breakerWindow)
+	}
+}
+
+// malformedMessage logs a message that could not be decoded or applied, up
+// to breakerLogLimit per window, and alerts when it trips the breaker.
+// productID is empty when the message could not be decoded.
+func (p *Pipeline) malformedMessage(logger Logger, productID, format string, args ...interface{}) {
+	check := p.breaker.malformed()
+	p.counts.malformedMessage()
+	p.reportError(productID, fmt.Errorf(format, args...))
+	if check.suppressed > 0 {
+		p.logger.Warnf("Suppressed %d more malformed messages in the last %v", check.suppressed, breakerWindow)
+	}
+	if check.log {
+		logger.Errorf(format, args...)
+	}
+	if check.log && check.errors == breakerLogLimit {
+		logger.Warnf("Not logging further malformed messages for %v", breakerWindow)
+	}
+	if check.trip {
+		breakerTrips.Inc()
+		p.raiseAlert(logger, Alert{
+			Kind:    "malformed_feed",
+			Message: fmt.Sprintf("%d of %d feed messages in %v were malformed; resubscribing", check.errors, check.messages, breakerWindow),
+			Time:    time.Now().UTC(),
+		})
+	}
+}
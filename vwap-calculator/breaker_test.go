@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grantis/gopkg/vwap-calculator/internal/mockexchange"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMessageBreaker(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	b := newMessageBreaker()
+	b.minErrors, b.ratio = 3, 0.5
+	b.now = func() time.Time { return now }
+	b.reset()
+
+	for range 4 {
+		b.message()
+	}
+	if check := b.malformed(); !check.log || check.trip {
+		t.Errorf("Expected the first malformed message to be logged without tripping, got %+v", check)
+	}
+	b.malformed()
+	// Three of four messages are malformed, past both thresholds.
+	if check := b.malformed(); !check.trip || check.errors != 3 || check.messages != 4 {
+		t.Errorf("Expected the third malformed message to trip, got %+v", check)
+	}
+	select {
+	case <-b.Tripped():
+	default:
+		t.Error("Expected a trip to be delivered")
+	}
+	for range 5 {
+		if check := b.malformed(); check.trip {
+			t.Error("Expected one trip per window")
+		}
+	}
+	if check := b.malformed(); check.log || check.errors != 9 {
+		t.Errorf("Expected messages past the log limit to be counted only, got %+v", check)
+	}
+
+	now = now.Add(breakerWindow)
+	if n := b.message(); n != 4 {
+		t.Errorf("Expected 4 suppressed messages reported for the last window, got %d", n)
+	}
+	if check := b.malformed(); !check.log || check.trip || check.errors != 1 {
+		t.Errorf("Expected a fresh window, got %+v", check)
+	}
+}
+
+func TestMessageBreakerRatio(t *testing.T) {
+	b := newMessageBreaker()
+	b.minErrors, b.ratio = 2, 0.5
+	b.reset()
+	for range 10 {
+		b.message()
+	}
+	for range 4 {
+		if b.malformed().trip {
+			t.Fatal("Expected no trip while most messages are valid")
+		}
+	}
+}
+
+func TestPipelineMalformedMessages(t *testing.T) {
+	var logs bytes.Buffer
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, NewLogger(&logs, slog.LevelInfo, "text"))
+	pipeline.SetMessageBreaker(3, 0.5)
+	alerts := &alertRecorder{}
+	pipeline.AddAlertSink(alerts)
+
+	for range 20 {
+		pipeline.processMessage(context.Background(), []byte(`{"type":`))
+	}
+	if n := strings.Count(logs.String(), "JSON decode error"); n != breakerLogLimit {
+		t.Errorf("Expected %d logged decode errors, got %d:\n%s", breakerLogLimit, n, logs.String())
+	}
+	if len(alerts.alerts) != 1 || alerts.alerts[0].Kind != "malformed_feed" {
+		t.Errorf("Expected one malformed_feed alert, got %+v", alerts.alerts)
+	}
+}
+
+func TestRunFeedReconnectsOnMalformedMessages(t *testing.T) {
+	exchange := mockexchange.New()
+	defer exchange.Close()
+	store := NewStore()
+	trips := testutil.ToFloat64(breakerTrips)
+	startFeed(t, exchange, store, func(cfg *Config, p *Pipeline) {
+		p.SetMessageBreaker(3, 0.5)
+	})
+
+	nextRequest(t, exchange)
+	for range 3 {
+		exchange.Send([]byte(`{"type":"match","price":`))
+	}
+	nextRequest(t, exchange)
+	if n := exchange.Connections(); n != 2 {
+		t.Errorf("Expected a second connection, got %d", n)
+	}
+	if got := testutil.ToFloat64(breakerTrips) - trips; got != 1 {
+		t.Errorf("Expected one breaker trip, got %v", got)
+	}
+
+	exchange.Match(mockexchange.Match{ProductID: "ETH-USD", Price: "3000", Size: "1"})
+	waitForUpdate(t, store, "ETH-USD", func(u VWAPUpdate) bool { return u.TradeCount == 1 })
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// TimedCalculator is implemented by calculators that weight trades by when
+// they happened. The pipeline passes the exchange timestamp when it has one.
+type TimedCalculator interface {
+	Calculator
+	UpdateAt(price, size string, at time.Time) error
+}
+
+// WindowedCalculator is implemented by calculators over a fixed number of
+// trades.
+type WindowedCalculator interface {
+	WindowSize() int
+}
+
+// newCalculator builds the calculator for a -calculator method name. window
+// applies to vwap, decimal and twap, halfLife to ewvwap. decimal is a
+// fixed-point VWAP and reports its method as vwap.
+func newCalculator(method string, window int, halfLife time.Duration) (Calculator, error) {
+	switch method {
+	case "", "vwap":
+		return NewWindowedVWAPCalculator(window), nil
+	case "twap":
+		return NewWindowedTWAPCalculator(window), nil
+	case "decimal":
+		return NewDecimalVWAPCalculator(window), nil
+	case "ewvwap":
+		if halfLife <= 0 {
+			return nil, fmt.Errorf("ewvwap needs a positive half-life, got %v", halfLife)
+		}
+		return NewEWVWAPCalculator(halfLife), nil
+	default:
+		return nil, fmt.Errorf("unknown calculator %q: must be vwap, decimal, twap or ewvwap", method)
+	}
+}
+
+// calculatorMethod names the average a calculator produces, for output.
+func calculatorMethod(c Calculator) string {
+	switch c.(type) {
+	case *TWAPCalculator:
+		return "twap"
+	case *EWVWAPCalculator:
+		return "ewvwap"
+	default:
+		return "vwap"
+	}
+}
+
+// windowSizeOf returns c's window size, or 0 for calculators without one.
+func windowSizeOf(c Calculator) int {
+	if w, ok := c.(WindowedCalculator); ok {
+		return w.WindowSize()
+	}
+	return 0
+}
+
+// CalculatorStats describes the trades behind a calculator's current value.
+type CalculatorStats struct {
+	// Volume is the total size of the trades the value is computed over,
+	// decayed for ewvwap. It is empty for averages that ignore size, such as
+	// TWAP and the moving averages.
+	Volume string
+	// Notional is the total price × size of those trades, likewise decayed
+	// for ewvwap and empty when the volume is.
+	Notional string
+	// WindowSpan is the time from the oldest to the newest of those trades.
+	WindowSpan time.Duration
+	// LastTrade is the time of the newest trade, zero before the first.
+	LastTrade time.Time
+}
+
+// tradeClock counts a calculator's trades and remembers when the trades in
+// its window happened, for Stats. With a size of 0 the window is every trade
+// since the last reset. Callers hold the calculator's lock.
+type tradeClock struct {
+	trades int64
+	times  []time.Time // ring of the window's trade times, oldest at start
+	start  int
+	first  time.Time // oldest trade time, when there is no ring
+	last   time.Time
+}
+
+func newTradeClock(size int) tradeClock {
+	return tradeClock{times: make([]time.Time, 0, size)}
+}
+
+func (c *tradeClock) add(at time.Time) {
+	c.trades++
+	if c.trades == 1 {
+		c.first = at
+	}
+	if at.After(c.last) {
+		c.last = at
+	}
+	switch {
+	case cap(c.times) == 0:
+	case len(c.times) < cap(c.times):
+		c.times = append(c.times, at)
+	default:
+		c.times[c.start] = at
+		c.start = (c.start + 1) % len(c.times)
+	}
+}
+
+func (c *tradeClock) reset() {
+	*c = tradeClock{times: c.times[:0]}
+}
+
+// stats returns the clock's part of CalculatorStats along with volume and
+// notional.
+func (c *tradeClock) stats(volume, notional string) CalculatorStats {
+	stats := CalculatorStats{Volume: volume, Notional: notional, LastTrade: c.last}
+	if c.trades == 0 {
+		return stats
+	}
+	oldest := c.first
+	if len(c.times) > 0 {
+		oldest = c.times[c.start]
+	}
+	stats.WindowSpan = max(c.last.Sub(oldest), 0)
+	return stats
+}
+
+// volumeString renders a total trade size, or notional, to the 8 decimal
+// places sizes are quoted in.
+func volumeString(r *big.Rat) string {
+	return r.FloatString(decimalPlaces)
+}
+
+// ResetProduct resets productID's calculator and indicators, for example at a
+// session boundary. It reports whether the product is tracked.
+func (p *Pipeline) ResetProduct(productID string) bool {
+	calculator, indicators, ok := p.calculator(productID)
+	if !ok {
+		return false
+	}
+	calculator.Reset()
+	for _, ind := range indicators {
+		ind.calculator.Reset()
+	}
+	return true
+}
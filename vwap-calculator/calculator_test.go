@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalculatorStatsAndReset(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		name     string
+		calc     Calculator
+		volume   string
+		notional string
+		span     time.Duration
+	}{
+		{"vwap", NewWindowedVWAPCalculator(2), "3.00000000", "350.00000000", time.Second},
+		{"decimal", NewDecimalVWAPCalculator(2), "3.00000000", "350.00000000", time.Second},
+		{"twap", NewWindowedTWAPCalculator(2), "", "", time.Second},
+		{"bollinger", NewBollingerCalculator(2, 2), "3.00000000", "350.00000000", time.Second},
+		{"sma", NewSMACalculator(2), "", "", time.Second},
+		{"ema", NewEMACalculator(2), "", "", 2 * time.Second},
+		{"ewvwap", NewEWVWAPCalculator(time.Hour), "", "", 2 * time.Second},
+		{"time_window", NewTimeWindowVWAPCalculator(90 * time.Second), "3.00000000", "350.00000000", time.Second},
+		{"session", NewAnchoredVWAPCalculator(start, 0), "4.00000000", "450.00000000", 2 * time.Second},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// The time window drops the first trade, being over 90s older than the
+			// last; the count windows drop it for being one of three.
+			for i, trade := range [][2]string{{"100", "1"}, {"110", "1"}, {"120", "2"}} {
+				at := start.Add(time.Duration(i) * time.Second)
+				if tt.name == "time_window" && i == 0 {
+					at = start.Add(-2 * time.Minute)
+				}
+				if err := tt.calc.(TimedCalculator).UpdateAt(trade[0], trade[1], at); err != nil {
+					t.Fatalf("UpdateAt failed: %v", err)
+				}
+			}
+
+			if n := tt.calc.TradeCount(); n != 3 {
+				t.Errorf("Expected 3 trades, got %d", n)
+			}
+			stats := tt.calc.Stats()
+			if tt.volume != "" && stats.Volume != tt.volume {
+				t.Errorf("Expected volume %s, got %s", tt.volume, stats.Volume)
+			}
+			if tt.notional != "" && stats.Notional != tt.notional {
+				t.Errorf("Expected notional %s, got %s", tt.notional, stats.Notional)
+			}
+			if tt.name == "twap" || tt.name == "sma" || tt.name == "ema" {
+				if stats.Volume != "" || stats.Notional != "" {
+					t.Errorf("Expected no volume or notional, got %s and %s", stats.Volume, stats.Notional)
+				}
+			}
+			if stats.WindowSpan != tt.span {
+				t.Errorf("Expected a %v window span, got %v", tt.span, stats.WindowSpan)
+			}
+			if want := start.Add(2 * time.Second); !stats.LastTrade.Equal(want) {
+				t.Errorf("Expected last trade at %v, got %v", want, stats.LastTrade)
+			}
+
+			tt.calc.Reset()
+			if got := tt.calc.Calculate(); got != "0" && got != "0.0000" {
+				t.Errorf("Expected no value after Reset, got %s", got)
+			}
+			if stats := tt.calc.Stats(); tt.calc.TradeCount() != 0 || stats.WindowSpan != 0 || !stats.LastTrade.IsZero() {
+				t.Errorf("Expected empty stats after Reset, got %d trades and %+v", tt.calc.TradeCount(), stats)
+			}
+		})
+	}
+}
+
+func TestVWAPCalculatorResetReusesWindow(t *testing.T) {
+	calc := NewWindowedVWAPCalculator(2)
+	for _, trade := range [][2]string{{"100", "1"}, {"200", "1"}, {"300", "1"}} {
+		calc.Update(trade[0], trade[1])
+	}
+	calc.Reset()
+	calc.Update("50", "1")
+	if got := calc.Calculate(); got != "50.0000" {
+		t.Errorf("Expected 50.0000 from the one trade after Reset, got %s", got)
+	}
+	if high, low := calc.Range(); high != "50.0000" || low != "50.0000" {
+		t.Errorf("Expected the range to restart, got %s-%s", low, high)
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// candleHistory is how many closed candles are kept per product and interval
+// for the HTTP API.
+const candleHistory = 500
+
+// Candle is an OHLCV bar. Prices are the original trade strings; Volume is
+// the exact sum of trade sizes.
+type Candle struct {
+	Type      string    `json:"type"`
+	ProductID string    `json:"product_id"`
+	Interval  string    `json:"interval"`
+	Start     time.Time `json:"start"`
+	Open      string    `json:"open"`
+	High      string    `json:"high"`
+	Low       string    `json:"low"`
+	Close     string    `json:"close"`
+	Volume    string    `json:"volume"`
+	Trades    int64     `json:"trades"`
+	// Closed is false for the bar still being built.
+	Closed bool `json:"closed"`
+}
+
+// CandleSink receives every candle as it closes.
+type CandleSink interface {
+	PublishCandle(candle Candle) error
+}
+
+// CandleBuilder aggregates accepted trades into OHLCV bars for each
+// configured interval. A bar closes, and is published, when the first trade
+// of a later bar arrives; bars with no trades are skipped.
+type CandleBuilder struct {
+	intervals []time.Duration
+	sinks     []CandleSink
+	logger    Logger
+
+	mu      sync.RWMutex
+	open    map[candleKey]*candleState
+	history map[candleKey][]Candle
+}
+
+type candleKey struct {
+	productID string
+	interval  time.Duration
+}
+
+type candleState struct {
+	candle    Candle
+	high, low big.Rat
+	volume    big.Rat
+}
+
+func NewCandleBuilder(intervals []time.Duration, logger Logger) *CandleBuilder {
+	return &CandleBuilder{
+		intervals: intervals,
+		logger:    logger,
+		open:      make(map[candleKey]*candleState),
+		history:   make(map[candleKey][]Candle),
+	}
+}
+
+// AddSink registers a sink for closed candles.
+func (b *CandleBuilder) AddSink(sink CandleSink) {
+	b.sinks = append(b.sinks, sink)
+}
+
+// RecordTrade adds trade to the current bar of every interval, using its
+// exchange timestamp. Trades older than the current bar are ignored.
+func (b *CandleBuilder) RecordTrade(trade Trade) error {
+	price, ok1 := new(big.Rat).SetString(trade.Price)
+	size, ok2 := new(big.Rat).SetString(trade.Size)
+	if !ok1 || !ok2 {
+		return fmt.Errorf("candles: invalid trade %s @ %s", trade.Size, trade.Price)
+	}
+	at := trade.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	var closed []Candle
+	b.mu.Lock()
+	for _, interval := range b.intervals {
+		key := candleKey{trade.ProductID, interval}
+		start := at.UTC().Truncate(interval)
+		state := b.open[key]
+		if state != nil && start.Before(state.candle.Start) {
+			continue
+		}
+		if state != nil && start.After(state.candle.Start) {
+			closed = append(closed, b.closeLocked(key, state))
+			state = nil
+		}
+		if state == nil {
+			state = &candleState{candle: Candle{
+				Type:      "candle",
+				ProductID: trade.ProductID,
+				Interval:  formatInterval(interval),
+				Start:     start,
+				Open:      trade.Price,
+				High:      trade.Price,
+				Low:       trade.Price,
+			}}
+			state.high.Set(price)
+			state.low.Set(price)
+			b.open[key] = state
+		}
+		if price.Cmp(&state.high) > 0 {
+			state.high.Set(price)
+			state.candle.High = trade.Price
+		}
+		if price.Cmp(&state.low) < 0 {
+			state.low.Set(price)
+			state.candle.Low = trade.Price
+		}
+		state.candle.Close = trade.Price
+		state.volume.Add(&state.volume, size)
+		state.candle.Trades++
+	}
+	b.mu.Unlock()
+
+	for _, candle := range closed {
+		for _, sink := range b.sinks {
+			if err := sink.PublishCandle(candle); err != nil {
+				b.logger.Errorf("Publishing candle failed: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (b *CandleBuilder) closeLocked(key candleKey, state *candleState) Candle {
+	candle := state.snapshot()
+	candle.Closed = true
+	history := append(b.history[key], candle)
+	if len(history) > candleHistory {
+		history = history[len(history)-candleHistory:]
+	}
+	b.history[key] = history
+	return candle
+}
+
+func (s *candleState) snapshot() Candle {
+	candle := s.candle
+	candle.Volume = trimDecimal(&s.volume, 8)
+	return candle
+}
+
+// Candles returns up to limit of the most recent bars for productID at
+// interval, oldest first, ending with the bar still being built.
+func (b *CandleBuilder) Candles(productID string, interval time.Duration, limit int) []Candle {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	key := candleKey{productID, interval}
+	candles := append([]Candle(nil), b.history[key]...)
+	if state := b.open[key]; state != nil {
+		candles = append(candles, state.snapshot())
+	}
+	if limit > 0 && len(candles) > limit {
+		candles = candles[len(candles)-limit:]
+	}
+	return candles
+}
+
+// ServeHTTP handles GET /candles/{product}?interval=1m&limit=100. The
+// interval may instead be given in seconds as granularity=60, as on the
+// exchange's REST API, and defaults to the first configured one. start and
+// end, in RFC 3339, keep only the bars starting within that range.
+func (b *CandleBuilder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	interval := b.intervals[0]
+	s := query.Get("interval")
+	if g := query.Get("granularity"); g != "" {
+		if s != "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "interval and granularity are exclusive"})
+			return
+		}
+		s = g + "s"
+	}
+	if s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || !b.hasInterval(d) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported interval " + s})
+			return
+		}
+		interval = d
+	}
+	limit := 0
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid limit " + s})
+			return
+		}
+		limit = n
+	}
+	var bounds [2]time.Time
+	for i, name := range []string{"start", "end"} {
+		if s := query.Get(name); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid " + name + " " + s})
+				return
+			}
+			bounds[i] = t
+		}
+	}
+	// An empty list rather than null keeps charting clients simple.
+	candles := append([]Candle{}, b.Candles(r.PathValue("product"), interval, 0)...)
+	candles = slices.DeleteFunc(candles, func(c Candle) bool {
+		return c.Start.Before(bounds[0]) || !bounds[1].IsZero() && c.Start.After(bounds[1])
+	})
+	if limit > 0 && len(candles) > limit {
+		candles = candles[len(candles)-limit:]
+	}
+	writeJSON(w, http.StatusOK, candles)
+}
+
+func (b *CandleBuilder) hasInterval(d time.Duration) bool {
+	for _, interval := range b.intervals {
+		if interval == d {
+			return true
+		}
+	}
+	return false
+}
+
+// formatInterval renders d compactly, e.g. "1s", "5m" or "1h".
+func formatInterval(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	case d%time.Second == 0:
+		return fmt.Sprintf("%ds", d/time.Second)
+	default:
+		return d.String()
+	}
+}
+
+// durationList is a flag holding a comma-separated list of positive durations.
+type durationList []time.Duration
+
+func (l *durationList) String() string {
+	parts := make([]string, len(*l))
+	for i, d := range *l {
+		parts[i] = formatInterval(d)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *durationList) Set(s string) error {
+	for _, part := range strings.Split(s, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid interval %q: must be a positive duration", part)
+		}
+		*l = append(*l, d)
+	}
+	return nil
+}
+
+func (StdoutSink) PublishCandle(c Candle) error {
+	_, err := fmt.Printf("%s %s candle %s O: %s H: %s L: %s C: %s V: %s\n",
+		c.ProductID, c.Interval, c.Start.Format(time.RFC3339), c.Open, c.High, c.Low, c.Close, c.Volume)
+	return err
+}
+
+func (s *JSONLinesSink) PublishCandle(c Candle) error {
+	return s.encode(c)
+}
+
+func (h *Hub) PublishCandle(c Candle) error {
+	return h.broadcast(c.ProductID, c)
+}
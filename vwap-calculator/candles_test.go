@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type candleRecorder []Candle
+
+func (r *candleRecorder) PublishCandle(c Candle) error {
+	*r = append(*r, c)
+	return nil
+}
+
+func TestCandleBuilder(t *testing.T) {
+	builder := NewCandleBuilder([]time.Duration{time.Second, time.Minute}, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	var recorder candleRecorder
+	builder.AddSink(&recorder)
+
+	base := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	trades := []struct {
+		price, size string
+		offset      time.Duration
+	}{
+		{"100", "1", 100 * time.Millisecond},
+		{"105", "0.5", 200 * time.Millisecond},
+		{"95", "0.25", 900 * time.Millisecond},
+		{"101", "2", 2500 * time.Millisecond},
+		{"99", "1", 500 * time.Millisecond}, // late: ignored by the 1s bars
+	}
+	for _, tr := range trades {
+		builder.RecordTrade(Trade{ProductID: "BTC-USD", Price: tr.price, Size: tr.size, Time: base.Add(tr.offset)})
+	}
+
+	if len(recorder) != 1 {
+		t.Fatalf("Expected one closed candle, got %+v", recorder)
+	}
+	expected := Candle{Type: "candle", ProductID: "BTC-USD", Interval: "1s", Start: base,
+		Open: "100", High: "105", Low: "95", Close: "95", Volume: "1.75", Trades: 3, Closed: true}
+	if recorder[0] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, recorder[0])
+	}
+
+	minute := builder.Candles("BTC-USD", time.Minute, 0)
+	if len(minute) != 1 || minute[0].Closed || minute[0].Close != "99" || minute[0].Low != "95" || minute[0].Volume != "4.75" || minute[0].Trades != 5 {
+		t.Errorf("Unexpected open minute candle %+v", minute)
+	}
+	if seconds := builder.Candles("BTC-USD", time.Second, 1); len(seconds) != 1 || seconds[0].Start != base.Add(2*time.Second) {
+		t.Errorf("Expected only the open 1s candle with limit 1, got %+v", seconds)
+	}
+}
+
+func TestCandleBuilderHTTP(t *testing.T) {
+	builder := NewCandleBuilder([]time.Duration{time.Minute, 5 * time.Minute}, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	builder.RecordTrade(Trade{ProductID: "ETH-USD", Price: "3000", Size: "1", Time: time.Now()})
+	mux := http.NewServeMux()
+	mux.Handle("GET /candles/{product}", builder)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/candles/ETH-USD?interval=5m", nil))
+	var candles []Candle
+	if err := json.NewDecoder(rec.Body).Decode(&candles); err != nil || len(candles) != 1 || candles[0].Interval != "5m" {
+		t.Errorf("Unexpected response %d %+v %v", rec.Code, candles, err)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/candles/ETH-USD?interval=2m", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for unconfigured interval, got %d", rec.Code)
+	}
+}
+
+func TestCandleBuilderHTTPHistory(t *testing.T) {
+	builder := NewCandleBuilder([]time.Duration{time.Minute}, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		builder.RecordTrade(Trade{ProductID: "BTC-USD", Price: "100", Size: "1", Time: start.Add(time.Duration(i) * time.Minute)})
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /candles/{product}", builder)
+
+	get := func(target string) (int, []Candle) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		var candles []Candle
+		json.NewDecoder(rec.Body).Decode(&candles)
+		return rec.Code, candles
+	}
+	code, candles := get("/candles/BTC-USD?granularity=60&limit=3")
+	if code != http.StatusOK || len(candles) != 3 || !candles[0].Start.Equal(start.Add(2*time.Minute)) {
+		t.Errorf("Unexpected response %d %+v", code, candles)
+	}
+	code, candles = get("/candles/BTC-USD?start=2024-01-01T12:01:00Z&end=2024-01-01T12:02:00Z")
+	if code != http.StatusOK || len(candles) != 2 || !candles[1].Start.Equal(start.Add(2*time.Minute)) {
+		t.Errorf("Unexpected range response %d %+v", code, candles)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/candles/SOL-USD", nil))
+	if body := strings.TrimSpace(rec.Body.String()); body != "[]" {
+		t.Errorf("Expected an empty list for a product without bars, got %s", body)
+	}
+	for _, target := range []string{
+		"/candles/BTC-USD?granularity=300",
+		"/candles/BTC-USD?granularity=60&interval=1m",
+		"/candles/BTC-USD?start=yesterday",
+	} {
+		if code, _ := get(target); code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", target, code)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// channelHeartbeat sends a message every second per product, keeping the
+// read deadline from expiring on quiet products.
+const channelHeartbeat = "heartbeat"
+
+// feedChannelNames are the channels -channels may subscribe a product to.
+var feedChannelNames = []string{channelMatches, channelTicker, channelFull, channelHeartbeat, bookLevel2, bookLevel2Batch}
+
+// parseChannelList parses a product's channels, joined with "+", e.g.
+// "matches+level2_batch". At least one must carry trades.
+func parseChannelList(s string) ([]string, error) {
+	var channels []string
+	for _, name := range strings.Split(s, "+") {
+		name = strings.TrimSpace(name)
+		if !slices.Contains(feedChannelNames, name) {
+			return nil, fmt.Errorf("unknown channel %q: must be one of %s", name, strings.Join(feedChannelNames, ", "))
+		}
+		if !slices.Contains(channels, name) {
+			channels = append(channels, name)
+		}
+	}
+	if tradeChannelOf(channels) == "" {
+		return nil, fmt.Errorf("channels %q include none of %s, %s or %s to take trades from", s, channelMatches, channelFull, channelTicker)
+	}
+	return channels, nil
+}
+
+// tradeChannelOf returns the channel trades are taken from out of channels,
+// preferring the one that delivers every trade.
+func tradeChannelOf(channels []string) string {
+	for _, name := range []string{channelMatches, channelFull, channelTicker} {
+		if slices.Contains(channels, name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// bookChannelOf returns the level2 channel in channels, or "".
+func bookChannelOf(channels []string) string {
+	for _, name := range channels {
+		if name == bookLevel2 || name == bookLevel2Batch {
+			return name
+		}
+	}
+	return ""
+}
+
+// SetChannels subscribes productID to channels instead of the pipeline's
+// default ones. nil restores the defaults. A product subscribed to a level2
+// channel needs order books; see SetOrderBooks.
+func (p *Pipeline) SetChannels(productID string, channels []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if channels == nil {
+		delete(p.channels, productID)
+		return
+	}
+	p.channels[productID] = channels
+}
+
+// channelsFor returns the channels productID is subscribed to.
+func (p *Pipeline) channelsFor(productID string) []string {
+	p.mu.RLock()
+	channels, ok := p.channels[productID]
+	p.mu.RUnlock()
+	if ok {
+		return channels
+	}
+	return p.feedChannels()
+}
+
+// tradeChannelFor returns the channel productID's trades are taken from.
+func (p *Pipeline) tradeChannelFor(productID string) string {
+	p.mu.RLock()
+	channels, ok := p.channels[productID]
+	p.mu.RUnlock()
+	if ok {
+		return tradeChannelOf(channels)
+	}
+	return p.channel
+}
+
+// feedSubscription returns the channels field of a subscribe message for
+// productIDs. When they all use the same channels that is a plain list of
+// names, applying to the message's product_ids; otherwise each channel is an
+// object naming its own products.
+func (p *Pipeline) feedSubscription(productIDs []string) any {
+	byChannel := make(map[string][]string)
+	var order []string
+	uniform := true
+	for i, productID := range productIDs {
+		channels := p.channelsFor(productID)
+		if i > 0 && !slices.Equal(channels, p.channelsFor(productIDs[0])) {
+			uniform = false
+		}
+		for _, name := range channels {
+			if _, ok := byChannel[name]; !ok {
+				order = append(order, name)
+			}
+			byChannel[name] = append(byChannel[name], productID)
+		}
+	}
+	if uniform {
+		if len(productIDs) == 0 {
+			return p.feedChannels()
+		}
+		return p.channelsFor(productIDs[0])
+	}
+	subscription := make([]map[string]any, 0, len(byChannel))
+	for _, name := range order {
+		subscription = append(subscription, map[string]any{"name": name, "product_ids": byChannel[name]})
+	}
+	return subscription
+}
+
+// channelNames returns every channel the subscribed products use, for
+// logging.
+func (p *Pipeline) channelNames() []string {
+	names := make(map[string]bool)
+	for _, productID := range p.Subscriptions() {
+		for _, name := range p.channelsFor(productID) {
+			names[name] = true
+		}
+	}
+	return slices.Sorted(maps.Keys(names))
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+
+	"github.com/grantis/gopkg/vwap-calculator/internal/mockexchange"
+)
+
+func TestParseChannelList(t *testing.T) {
+	channels, err := parseChannelList("ticker+heartbeat+level2_batch+ticker")
+	if err != nil || !slices.Equal(channels, []string{"ticker", "heartbeat", "level2_batch"}) {
+		t.Errorf("Unexpected channels %v (%v)", channels, err)
+	}
+	if tradeChannelOf(channels) != channelTicker || bookChannelOf(channels) != bookLevel2Batch {
+		t.Errorf("Expected trades from ticker and books from level2_batch in %v", channels)
+	}
+	for _, bad := range []string{"", "matches+status", "heartbeat+level2"} {
+		if _, err := parseChannelList(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestFeedSubscription(t *testing.T) {
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator(), "ETH-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	if got := pipeline.feedSubscription([]string{"BTC-USD", "ETH-USD"}); !slices.Equal(got.([]string), []string{"matches", "heartbeat"}) {
+		t.Errorf("Expected the default channel names, got %v", got)
+	}
+
+	pipeline.SetChannels("ETH-USD", []string{"ticker", "level2_batch"})
+	data, _ := json.Marshal(pipeline.feedSubscription([]string{"BTC-USD", "ETH-USD"}))
+	want := `[{"name":"matches","product_ids":["BTC-USD"]},{"name":"heartbeat","product_ids":["BTC-USD"]},` +
+		`{"name":"ticker","product_ids":["ETH-USD"]},{"name":"level2_batch","product_ids":["ETH-USD"]}]`
+	if string(data) != want {
+		t.Errorf("Expected per-channel products\n%s\ngot\n%s", want, data)
+	}
+	// A product added later is subscribed on its own channels.
+	if got := pipeline.feedSubscription([]string{"ETH-USD"}); !slices.Equal(got.([]string), []string{"ticker", "level2_batch"}) {
+		t.Errorf("Expected ETH-USD's own channels, got %v", got)
+	}
+	if got := pipeline.channelNames(); !slices.Equal(got, []string{"heartbeat", "level2_batch", "matches", "ticker"}) {
+		t.Errorf("Unexpected channel names %v", got)
+	}
+}
+
+func TestPipelineRoutesChannels(t *testing.T) {
+	store := NewStore()
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator(), "ETH-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"), store)
+	pipeline.SetChannels("BTC-USD", []string{"matches", "ticker"})
+	pipeline.SetChannels("ETH-USD", []string{"ticker", "level2"})
+	pipeline.SetOrderBooks(NewOrderBooks(""))
+	if got := pipeline.feedChannels(); !slices.Equal(got, []string{"matches", "heartbeat"}) {
+		t.Errorf("Expected books for some products not to change the default channels, got %v", got)
+	}
+
+	ctx := context.Background()
+	for _, msg := range []string{
+		`{"type":"match","product_id":"BTC-USD","trade_id":1,"price":"100","size":"1"}`,
+		// BTC-USD's trades come from matches, so its ticker is not a trade.
+		`{"type":"ticker","product_id":"BTC-USD","trade_id":2,"price":"500","last_size":"1"}`,
+		`{"type":"ticker","product_id":"ETH-USD","trade_id":7,"price":"3000","last_size":"2"}`,
+		`{"type":"snapshot","product_id":"ETH-USD","bids":[["2999","1"]],"asks":[["3001","1"]]}`,
+	} {
+		pipeline.dispatchMessage(ctx, []byte(msg), nil)
+	}
+	if update, _ := store.Get("BTC-USD"); update.TradeCount != 1 || update.VWAP != "100.0000" {
+		t.Errorf("Expected only BTC-USD's match to be applied, got %+v", update)
+	}
+	if update, _ := store.Get("ETH-USD"); update.TradeCount != 1 || update.VWAP != "3000.0000" {
+		t.Errorf("Expected ETH-USD's ticker to be applied, got %+v", update)
+	}
+	if _, ok := pipeline.books.Quote("ETH-USD"); !ok {
+		t.Error("Expected ETH-USD's level2 snapshot to reach its book")
+	}
+}
+
+func TestRunFeedSubscribesPerProductChannels(t *testing.T) {
+	exchange := mockexchange.New()
+	defer exchange.Close()
+	startFeed(t, exchange, NewStore(), func(_ *Config, p *Pipeline) {
+		p.SetChannels("ETH-BTC", []string{"ticker", "heartbeat"})
+	})
+
+	req := nextRequest(t, exchange)
+	if req.Type != "subscribe" || !slices.Equal(req.Channels, []string{"matches", "heartbeat", "ticker"}) ||
+		len(req.ProductIDs) != 3 {
+		t.Errorf("Unexpected subscribe request %+v", req)
+	}
+}
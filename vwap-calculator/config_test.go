@@ -0,0 +1,215 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseFlags(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		cfg, err := parseFlags(nil)
+		if err != nil {
+			t.Fatalf("parseFlags returned error: %v", err)
+		}
+		if cfg.LogLevel.Level() != slog.LevelInfo || cfg.LogFormat != "text" || cfg.HTTPAddr != "" {
+			t.Errorf("Unexpected defaults: %+v", cfg)
+		}
+	})
+
+	t.Run("Overrides", func(t *testing.T) {
+		cfg, err := parseFlags([]string{"-log-level", "debug", "-log-format", "json", "-http-addr", ":8080"})
+		if err != nil {
+			t.Fatalf("parseFlags returned error: %v", err)
+		}
+		if cfg.LogLevel.Level() != slog.LevelDebug || cfg.LogFormat != "json" || cfg.HTTPAddr != ":8080" {
+			t.Errorf("Unexpected config: %+v", cfg)
+		}
+	})
+
+	t.Run("Verbosity", func(t *testing.T) {
+		for _, tc := range []struct {
+			args []string
+			want slog.Level
+		}{
+			{[]string{"-quiet"}, slog.LevelWarn},
+			{[]string{"-verbose"}, slog.LevelDebug},
+			{[]string{"-quiet=false"}, slog.LevelInfo},
+			{[]string{"-log-level", "error", "-verbose"}, slog.LevelDebug},
+			{[]string{"-quiet", "-log-level", "info"}, slog.LevelInfo},
+		} {
+			cfg, err := parseFlags(tc.args)
+			if err != nil {
+				t.Fatalf("parseFlags(%v) returned error: %v", tc.args, err)
+			}
+			if got := cfg.LogLevel.Level(); got != tc.want {
+				t.Errorf("parseFlags(%v): expected level %v, got %v", tc.args, tc.want, got)
+			}
+		}
+	})
+
+	t.Run("InvalidFormat", func(t *testing.T) {
+		if _, err := parseFlags([]string{"-log-format", "xml"}); err == nil {
+			t.Error("Expected error for unknown log format")
+		}
+	})
+
+	t.Run("Calculators", func(t *testing.T) {
+		cfg, err := parseFlags([]string{"-calculator", "twap,ETH-BTC=vwap"})
+		if err != nil {
+			t.Fatalf("parseFlags returned error: %v", err)
+		}
+		if got := cfg.Calculators.Get("BTC-USD", "vwap"); got != "twap" {
+			t.Errorf("Expected default twap, got %s", got)
+		}
+		if got := cfg.Calculators.Get("ETH-BTC", "vwap"); got != "vwap" {
+			t.Errorf("Expected ETH-BTC override vwap, got %s", got)
+		}
+		if _, err := parseFlags([]string{"-calculator", "BTC-USD=median"}); err == nil {
+			t.Error("Expected error for unknown calculator")
+		}
+	})
+
+	t.Run("WindowSizes", func(t *testing.T) {
+		cfg, err := parseFlags([]string{"-window", "BTC-USD=500,ETH-BTC=100"})
+		if err != nil {
+			t.Fatalf("parseFlags returned error: %v", err)
+		}
+		for product, want := range map[string]int{"BTC-USD": 500, "ETH-BTC": 100, "ETH-USD": windowSize} {
+			if got := cfg.windowFor(product); got != want {
+				t.Errorf("Expected window %d for %s, got %d", want, product, got)
+			}
+		}
+		if _, err := parseFlags([]string{"-window", "ETH-USD=0"}); err == nil {
+			t.Error("Expected error for a zero window")
+		}
+	})
+
+	t.Run("TradeChannel", func(t *testing.T) {
+		cfg, err := parseFlags(nil)
+		if err != nil {
+			t.Fatalf("parseFlags returned error: %v", err)
+		}
+		if cfg.TradeChannel != channelMatches {
+			t.Errorf("Expected matches by default, got %q", cfg.TradeChannel)
+		}
+		if _, err := parseFlags([]string{"-trade-channel", "level3"}); err == nil {
+			t.Error("Expected error for an unknown channel")
+		}
+	})
+
+	t.Run("OrderBook", func(t *testing.T) {
+		cfg, err := parseFlags([]string{"-order-book", "level2_batch"})
+		if err != nil {
+			t.Fatalf("parseFlags returned error: %v", err)
+		}
+		if cfg.OrderBook != bookLevel2Batch {
+			t.Errorf("Expected level2_batch, got %q", cfg.OrderBook)
+		}
+		if _, err := parseFlags([]string{"-order-book", "level3"}); err == nil {
+			t.Error("Expected error for an unknown channel")
+		}
+	})
+
+	t.Run("Backpressure", func(t *testing.T) {
+		cfg, err := parseFlags([]string{"-backpressure", "drop-oldest", "-message-buffer", "64"})
+		if err != nil {
+			t.Fatalf("parseFlags returned error: %v", err)
+		}
+		if cfg.Backpressure != backpressureDropOldest || cfg.MessageBuffer != 64 || cfg.ProductQueue != 1024 {
+			t.Errorf("Unexpected config: %+v", cfg)
+		}
+		if _, err := parseFlags([]string{"-backpressure", "drop-newest"}); err == nil {
+			t.Error("Expected error for an unknown policy")
+		}
+		if _, err := parseFlags([]string{"-backpressure", "drop-oldest", "-product-queue", "0"}); err == nil {
+			t.Error("Expected error for drop-oldest without a buffer")
+		}
+	})
+
+	t.Run("RetryPolicy", func(t *testing.T) {
+		cfg, err := parseFlags(nil)
+		if err != nil {
+			t.Fatalf("parseFlags returned error: %v", err)
+		}
+		if cfg.Retry != defaultRetryPolicy {
+			t.Errorf("Expected the default policy, got %+v", cfg.Retry)
+		}
+		cfg, err = parseFlags([]string{"-retry-delay", "100ms", "-retry-max-delay", "0", "-retry-multiplier", "1.5", "-retry-jitter", "0", "-retry-forever"})
+		if err != nil {
+			t.Fatalf("parseFlags returned error: %v", err)
+		}
+		want := RetryPolicy{InitialDelay: 100 * time.Millisecond, Multiplier: 1.5, HealthyAfter: time.Minute}
+		if cfg.Retry != want {
+			t.Errorf("Expected %+v, got %+v", want, cfg.Retry)
+		}
+		for _, args := range [][]string{{"-retry-delay", "0"}, {"-retry-multiplier", "0.5"}, {"-retry-jitter", "2"}, {"-max-retries", "-1"}} {
+			if _, err := parseFlags(args); err == nil {
+				t.Errorf("Expected error for %v", args)
+			}
+		}
+	})
+
+	t.Run("Minimums", func(t *testing.T) {
+		cfg, err := parseFlags([]string{"-min-size", "0.001,ETH-BTC=0.1", "-min-notional", "BTC-USD=10"})
+		if err != nil {
+			t.Fatalf("parseFlags returned error: %v", err)
+		}
+		if size, notional := cfg.minimumsFor("BTC-USD"); size.RatString() != "1/1000" || notional.RatString() != "10" {
+			t.Errorf("Unexpected BTC-USD minimums %v, %v", size, notional)
+		}
+		if size, notional := cfg.minimumsFor("ETH-BTC"); size.RatString() != "1/10" || notional != nil {
+			t.Errorf("Unexpected ETH-BTC minimums %v, %v", size, notional)
+		}
+		if _, err := parseFlags([]string{"-min-notional", "-5"}); err == nil {
+			t.Error("Expected error for a negative minimum")
+		}
+	})
+	t.Run("TradingHours", func(t *testing.T) {
+		cfg, err := parseFlags([]string{"-trading-hours", "09:30-16:00@America/New_York,BTC-USD=always"})
+		if err != nil {
+			t.Fatalf("parseFlags returned error: %v", err)
+		}
+		if hours, _ := parseTradingHours(cfg.TradingHours.Get("ETH-USD", "")); hours == nil || hours.loc.String() != "America/New_York" {
+			t.Errorf("Expected ETH-USD to trade New York hours, got %+v", hours)
+		}
+		if hours, _ := parseTradingHours(cfg.TradingHours.Get("BTC-USD", "")); hours != nil {
+			t.Errorf("Expected BTC-USD to trade always, got %+v", hours)
+		}
+		for _, value := range []string{"09:30", "16:00-09:30@Mars/Olympus", "9:30-25:00", "10:00-10:00"} {
+			if _, err := parseFlags([]string{"-trading-hours", value}); err == nil {
+				t.Errorf("Expected error for -trading-hours %s", value)
+			}
+		}
+	})
+	t.Run("ConfigFile", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "vwap.conf")
+		file := "# comment\nlog-level = debug\nproducts BTC-USD, SOL-USD\n\n-window=BTC-USD=500\noutput = json\n"
+		if err := os.WriteFile(path, []byte(file), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := parseFlags([]string{"-config", path, "-output", "text"})
+		if err != nil {
+			t.Fatalf("parseFlags returned error: %v", err)
+		}
+		if cfg.LogLevel.Level() != slog.LevelDebug || cfg.windowFor("BTC-USD") != 500 || !slices.Equal(cfg.Products, []string{"BTC-USD", "SOL-USD"}) {
+			t.Errorf("Expected the file's settings, got %+v", cfg)
+		}
+		if cfg.Output != "text" {
+			t.Errorf("Expected the command line to override the file, got output %s", cfg.Output)
+		}
+
+		if err := os.WriteFile(path, []byte("bogus-flag = 1\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := parseFlags([]string{"-config", path}); err == nil {
+			t.Error("Expected error for an unknown setting")
+		}
+		if _, err := parseFlags([]string{"-config", filepath.Join(t.TempDir(), "missing.conf")}); err == nil {
+			t.Error("Expected error for a missing file")
+		}
+	})
+}
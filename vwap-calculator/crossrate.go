@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+// SyntheticProduct is a cross rate derived from two tracked products, written
+// as "NAME=BASE/QUOTE" or "NAME=BASE*QUOTE". For example
+// "ETH-BTC-IMPLIED=ETH-USD/BTC-USD" divides the ETH-USD VWAP by the BTC-USD
+// VWAP.
+type SyntheticProduct struct {
+	Name     string
+	Base     string
+	Quote    string
+	Multiply bool
+}
+
+func parseSynthetic(s string) (SyntheticProduct, error) {
+	name, expr, found := strings.Cut(strings.TrimSpace(s), "=")
+	op := strings.IndexAny(expr, "/*")
+	if !found || name == "" || op <= 0 || op == len(expr)-1 {
+		return SyntheticProduct{}, fmt.Errorf("invalid synthetic product %q: expected NAME=BASE/QUOTE or NAME=BASE*QUOTE", s)
+	}
+	sp := SyntheticProduct{Name: name, Base: expr[:op], Quote: expr[op+1:], Multiply: expr[op] == '*'}
+	if sp.Base == name || sp.Quote == name {
+		return SyntheticProduct{}, fmt.Errorf("invalid synthetic product %q: cannot be derived from itself", s)
+	}
+	return sp, nil
+}
+
+func (sp SyntheticProduct) String() string {
+	op := "/"
+	if sp.Multiply {
+		op = "*"
+	}
+	return sp.Name + "=" + sp.Base + op + sp.Quote
+}
+
+// syntheticList is a flag of comma-separated synthetic products.
+type syntheticList []SyntheticProduct
+
+func (l *syntheticList) String() string {
+	parts := make([]string, len(*l))
+	for i, sp := range *l {
+		parts[i] = sp.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *syntheticList) Set(s string) error {
+	for _, part := range strings.Split(s, ",") {
+		sp, err := parseSynthetic(part)
+		if err != nil {
+			return err
+		}
+		*l = append(*l, sp)
+	}
+	return nil
+}
+
+// legs returns the products the synthetics are derived from.
+func (l syntheticList) legs() []string {
+	var legs []string
+	for _, sp := range l {
+		legs = append(legs, sp.Base, sp.Quote)
+	}
+	return legs
+}
+
+// CrossRates derives synthetic products from the latest VWAP of their legs,
+// producing a new update whenever either leg updates.
+type CrossRates struct {
+	mu       sync.Mutex
+	products []SyntheticProduct
+	formats  map[string]priceFormat
+	latest   map[string]*big.Rat
+}
+
+func NewCrossRates(products []SyntheticProduct) *CrossRates {
+	return &CrossRates{products: products, formats: make(map[string]priceFormat), latest: make(map[string]*big.Rat)}
+}
+
+// SetFormat sets how the synthetic product name is rendered.
+func (c *CrossRates) SetFormat(name string, format priceFormat) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.formats[name] = format
+}
+
+// Observe records a leg's update and returns updates for every synthetic
+// product whose legs both have a VWAP.
+func (c *CrossRates) Observe(update VWAPUpdate) []VWAPUpdate {
+	vwap, ok := new(big.Rat).SetString(update.VWAP)
+	if !ok || vwap.Sign() <= 0 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.latest[update.ProductID] = vwap
+
+	var derived []VWAPUpdate
+	for _, sp := range c.products {
+		if sp.Base != update.ProductID && sp.Quote != update.ProductID {
+			continue
+		}
+		base, quote := c.latest[sp.Base], c.latest[sp.Quote]
+		if base == nil || quote == nil {
+			continue
+		}
+		rate := new(big.Rat)
+		if sp.Multiply {
+			rate.Mul(base, quote)
+		} else {
+			rate.Quo(base, quote)
+		}
+		format, ok := c.formats[sp.Name]
+		if !ok {
+			format = defaultPriceFormat
+		}
+		derived = append(derived, VWAPUpdate{
+			ProductID: sp.Name,
+			VWAP:      format.rat(rate),
+			Method:    "cross",
+			Time:      update.Time,
+		})
+	}
+	return derived
+}
+
+// SetCrossRates makes the pipeline publish synthetic products derived by
+// cross after each update of their legs.
+func (p *Pipeline) SetCrossRates(cross *CrossRates) {
+	p.cross = cross
+}
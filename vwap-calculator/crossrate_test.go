@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestParseSynthetic(t *testing.T) {
+	sp, err := parseSynthetic("BTC-EUR=BTC-USD/EUR-USD")
+	if err != nil || sp != (SyntheticProduct{Name: "BTC-EUR", Base: "BTC-USD", Quote: "EUR-USD"}) {
+		t.Errorf("Unexpected synthetic %+v, %v", sp, err)
+	}
+	if sp, err := parseSynthetic("ETH-USD-X=ETH-BTC*BTC-USD"); err != nil || !sp.Multiply {
+		t.Errorf("Expected a product, got %+v, %v", sp, err)
+	}
+	for _, bad := range []string{"ETH-BTC", "X=ETH-USD", "X=/BTC-USD", "X=ETH-USD/", "X=X/BTC-USD"} {
+		if _, err := parseSynthetic(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestCrossRatesObserve(t *testing.T) {
+	cross := NewCrossRates([]SyntheticProduct{{Name: "ETH-BTC-IMPLIED", Base: "ETH-USD", Quote: "BTC-USD"}})
+	cross.SetFormat("ETH-BTC-IMPLIED", priceFormat{places: 6, rounding: roundHalfUp})
+
+	if derived := cross.Observe(VWAPUpdate{ProductID: "ETH-USD", VWAP: "3000"}); len(derived) != 0 {
+		t.Errorf("Expected nothing until both legs update, got %+v", derived)
+	}
+	derived := cross.Observe(VWAPUpdate{ProductID: "BTC-USD", VWAP: "45000"})
+	if len(derived) != 1 || derived[0].ProductID != "ETH-BTC-IMPLIED" || derived[0].VWAP != "0.066667" || derived[0].Method != "cross" {
+		t.Fatalf("Unexpected derived updates %+v", derived)
+	}
+	// Either leg triggers a new value.
+	if derived := cross.Observe(VWAPUpdate{ProductID: "ETH-USD", VWAP: "3150"}); len(derived) != 1 || derived[0].VWAP != "0.070000" {
+		t.Errorf("Unexpected derived updates %+v", derived)
+	}
+	if derived := cross.Observe(VWAPUpdate{ProductID: "ETH-BTC", VWAP: "0.07"}); len(derived) != 0 {
+		t.Errorf("Expected unrelated products to be ignored, got %+v", derived)
+	}
+}
+
+func TestPipelineCrossRates(t *testing.T) {
+	store := NewStore()
+	calculators := map[string]Calculator{"BTC-USD": NewVWAPCalculator(), "EUR-USD": NewVWAPCalculator()}
+	pipeline := NewPipeline(calculators, NewLogger(io.Discard, slog.LevelInfo, "text"), store)
+	pipeline.SetCrossRates(NewCrossRates([]SyntheticProduct{{Name: "BTC-EUR", Base: "BTC-USD", Quote: "EUR-USD"}}))
+
+	pipeline.processMessage(context.Background(), []byte(`{"type":"match","product_id":"BTC-USD","trade_id":1,"price":"44000","size":"1"}`))
+	pipeline.processMessage(context.Background(), []byte(`{"type":"match","product_id":"EUR-USD","trade_id":1,"price":"1.1","size":"1000"}`))
+
+	if update, ok := store.Get("BTC-EUR"); !ok || update.VWAP != "40000.0000" {
+		t.Errorf("Expected BTC-EUR 40000.0000, got %+v", update)
+	}
+}
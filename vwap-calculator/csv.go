@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// CSVConfig selects where and how often CSV archives are written.
+type CSVConfig struct {
+	Dir    string
+	Trades bool
+	Rotate time.Duration
+}
+
+var (
+	csvUpdateHeader = []string{"time", "product_id", "vwap", "window_size", "trade_count", "missed_trades"}
+	csvTradeHeader  = []string{"time", "product_id", "trade_id", "price", "size", "side"}
+)
+
+// CSVSink appends VWAP updates, and optionally trades, to CSV files in a
+// directory. A new pair of files is started every Rotate period, named after
+// the UTC start of the period, e.g. vwap-20240101T000000Z.csv.
+type CSVSink struct {
+	cfg    CSVConfig
+	queue  *batchQueue[csvRecord]
+	logger Logger
+	now    func() time.Time
+
+	period time.Time
+	files  map[string]*csvFile
+}
+
+type csvRecord struct {
+	kind   string
+	fields []string
+}
+
+type csvFile struct {
+	f *os.File
+	w *csv.Writer
+}
+
+func NewCSVSink(cfg CSVConfig, logger Logger) (*CSVSink, error) {
+	if cfg.Rotate <= 0 {
+		cfg.Rotate = 24 * time.Hour
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating CSV directory: %w", err)
+	}
+	s := &CSVSink{cfg: cfg, logger: logger, now: time.Now, files: make(map[string]*csvFile)}
+	s.queue = newBatchQueue(storageQueueSize, storageBatchSize, storageFlushWait, func(batch []csvRecord) {
+		if err := s.write(batch); err != nil {
+			s.logger.Errorf("Writing %d CSV records failed: %v", len(batch), err)
+		}
+	})
+	return s, nil
+}
+
+func (s *CSVSink) Publish(update VWAPUpdate) error {
+	return s.enqueue("vwap", []string{
+		update.Time.UTC().Format(time.RFC3339Nano),
+		update.ProductID,
+		update.VWAP,
+		strconv.Itoa(update.WindowSize),
+		strconv.FormatInt(update.TradeCount, 10),
+		strconv.FormatInt(update.MissedTrades, 10),
+	})
+}
+
+func (s *CSVSink) RecordTrade(trade Trade) error {
+	if !s.cfg.Trades {
+		return nil
+	}
+	return s.enqueue("trades", []string{
+		trade.Time.UTC().Format(time.RFC3339Nano),
+		trade.ProductID,
+		strconv.FormatInt(trade.TradeID, 10),
+		trade.Price,
+		trade.Size,
+		trade.Side,
+	})
+}
+
+func (s *CSVSink) enqueue(kind string, fields []string) error {
+	if !s.queue.Offer(csvRecord{kind: kind, fields: fields}) {
+		return errQueueFull
+	}
+	return nil
+}
+
+// Close flushes queued records and closes the open files.
+func (s *CSVSink) Close() error {
+	s.queue.Close()
+	return s.closeFiles()
+}
+
+func (s *CSVSink) write(batch []csvRecord) error {
+	if period := s.now().UTC().Truncate(s.cfg.Rotate); !period.Equal(s.period) {
+		if err := s.closeFiles(); err != nil {
+			s.logger.Warnf("Closing CSV files failed: %v", err)
+		}
+		s.period = period
+	}
+
+	for _, rec := range batch {
+		file, err := s.file(rec.kind)
+		if err != nil {
+			return err
+		}
+		file.w.Write(rec.fields)
+	}
+	for _, file := range s.files {
+		file.w.Flush()
+		if err := file.w.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// file returns the open file for kind in the current period, creating it and
+// writing the header if it is new.
+func (s *CSVSink) file(kind string) (*csvFile, error) {
+	if file, ok := s.files[kind]; ok {
+		return file, nil
+	}
+	path := filepath.Join(s.cfg.Dir, fmt.Sprintf("%s-%s.csv", kind, s.period.Format("20060102T150405Z")))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	file := &csvFile{f: f, w: csv.NewWriter(f)}
+	if info, err := f.Stat(); err == nil && info.Size() == 0 {
+		header := csvUpdateHeader
+		if kind == "trades" {
+			header = csvTradeHeader
+		}
+		file.w.Write(header)
+	}
+	s.files[kind] = file
+	return file, nil
+}
+
+func (s *CSVSink) closeFiles() error {
+	var firstErr error
+	for kind, file := range s.files {
+		file.w.Flush()
+		if err := file.f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(s.files, kind)
+	}
+	return firstErr
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func readCSV(t *testing.T, path string) [][]string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestCSVSinkRotation(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := NewCSVSink(CSVConfig{Dir: dir, Trades: true, Rotate: time.Hour}, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+	sink.now = func() time.Time { return now }
+
+	ts := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+	sink.Publish(VWAPUpdate{ProductID: "BTC-USD", VWAP: "45000", WindowSize: 200, TradeCount: 1, Time: ts})
+	sink.RecordTrade(Trade{ProductID: "BTC-USD", TradeID: 7, Price: "45000", Size: "0.5", Side: "buy", Time: ts})
+	sink.Close()
+
+	now = now.Add(time.Hour)
+	sink, _ = NewCSVSink(CSVConfig{Dir: dir, Rotate: time.Hour}, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	sink.now = func() time.Time { return now }
+	sink.Publish(VWAPUpdate{ProductID: "ETH-USD", VWAP: "3000", WindowSize: 200, TradeCount: 2, Time: ts})
+	sink.RecordTrade(Trade{ProductID: "ETH-USD", Price: "3000", Size: "1"})
+	sink.Close()
+
+	first := readCSV(t, filepath.Join(dir, "vwap-20240101T100000Z.csv"))
+	if len(first) != 2 || !reflect.DeepEqual(first[0], csvUpdateHeader) || first[1][1] != "BTC-USD" {
+		t.Errorf("Unexpected first period updates: %v", first)
+	}
+	trades := readCSV(t, filepath.Join(dir, "trades-20240101T100000Z.csv"))
+	expected := [][]string{csvTradeHeader, {"2024-01-01T10:30:00Z", "BTC-USD", "7", "45000", "0.5", "buy"}}
+	if !reflect.DeepEqual(trades, expected) {
+		t.Errorf("Expected trades %v, got %v", expected, trades)
+	}
+	second := readCSV(t, filepath.Join(dir, "vwap-20240101T110000Z.csv"))
+	if len(second) != 2 || second[1][1] != "ETH-USD" || second[1][4] != "2" {
+		t.Errorf("Unexpected second period updates: %v", second)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "trades-20240101T110000Z.csv")); !os.IsNotExist(err) {
+		t.Errorf("Trades file written with -csv-trades off")
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// dashboardHTML is a self-contained page: it loads the latest updates from
+// /vwap, then follows /ws, and needs nothing from outside the binary.
+//
+//go:embed dashboard/index.html
+var dashboardHTML []byte
+
+func addDashboardRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /dashboard", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(dashboardHTML)
+	})
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDashboardRoute(t *testing.T) {
+	mux := http.NewServeMux()
+	addDashboardRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/dashboard", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("Expected an HTML page, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	// The page follows the /ws stream after loading the latest updates.
+	for _, want := range []string{"/ws", `fetch("/vwap")`, "last_price"} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("Expected the page to use %s", want)
+		}
+	}
+}
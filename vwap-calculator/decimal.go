@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// decimalPlaces is the fixed precision of DecimalVWAPCalculator inputs,
+// matching the 8 decimal places Coinbase quotes prices and sizes in.
+const decimalPlaces = 8
+
+var errDecimalTrade = errors.New("invalid trade data: price and size must be positive decimals with at most 8 decimal places")
+
+// DecimalVWAPCalculator computes the same windowed VWAP as VWAPCalculator
+// using fixed-point integers instead of big.Rat, so Update does not allocate.
+// Prices and sizes are held as int64 counts of 1e-8, and the price × size
+// sum as a 128-bit integer, which is exact for any realistic window.
+type DecimalVWAPCalculator struct {
+	mu     sync.Mutex
+	prices []int64
+	sizes  []int64
+	start  int
+	count  int
+	// totalPV is Σ price × size in units of 1e-16, split into high and low
+	// 64-bit words.
+	totalPVHi, totalPVLo uint64
+	totalVolume          int64
+	clock                tradeClock
+	formatted
+}
+
+// NewDecimalVWAPCalculator returns a DecimalVWAPCalculator over the last size
+// trades.
+func NewDecimalVWAPCalculator(size int) *DecimalVWAPCalculator {
+	return &DecimalVWAPCalculator{prices: make([]int64, size), sizes: make([]int64, size), clock: newTradeClock(size)}
+}
+
+func (d *DecimalVWAPCalculator) WindowSize() int {
+	return len(d.prices)
+}
+
+func (d *DecimalVWAPCalculator) Update(priceStr, sizeStr string) error {
+	return d.UpdateAt(priceStr, sizeStr, time.Now())
+}
+
+func (d *DecimalVWAPCalculator) UpdateAt(priceStr, sizeStr string, at time.Time) error {
+	price, ok1 := parseFixed(priceStr)
+	size, ok2 := parseFixed(sizeStr)
+	if !ok1 || !ok2 || price <= 0 || size <= 0 {
+		return errDecimalTrade
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	i := (d.start + d.count) % len(d.prices)
+	if d.count == len(d.prices) {
+		hi, lo := bits.Mul64(uint64(d.prices[i]), uint64(d.sizes[i]))
+		var borrow uint64
+		d.totalPVLo, borrow = bits.Sub64(d.totalPVLo, lo, 0)
+		d.totalPVHi, _ = bits.Sub64(d.totalPVHi, hi, borrow)
+		d.totalVolume -= d.sizes[i]
+		d.start = (d.start + 1) % len(d.prices)
+	} else {
+		d.count++
+	}
+	d.prices[i], d.sizes[i] = price, size
+	hi, lo := bits.Mul64(uint64(price), uint64(size))
+	var carry uint64
+	d.totalPVLo, carry = bits.Add64(d.totalPVLo, lo, 0)
+	d.totalPVHi, _ = bits.Add64(d.totalPVHi, hi, carry)
+	d.totalVolume += size
+	d.clock.add(at)
+	return nil
+}
+
+func (d *DecimalVWAPCalculator) Calculate() string {
+	vwap := d.CalculateRat()
+	if vwap == nil {
+		return "0"
+	}
+	return d.formatRat(vwap)
+}
+
+// CalculateRat returns the exact VWAP of the fixed-point sums, or nil before
+// the first trade.
+func (d *DecimalVWAPCalculator) CalculateRat() *big.Rat {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.totalVolume == 0 {
+		return nil
+	}
+	pv := d.totalPV()
+	// totalPV is scaled by 1e16 and totalVolume by 1e8, leaving 1e8.
+	volume := new(big.Int).Mul(big.NewInt(d.totalVolume), big.NewInt(1e8))
+	return new(big.Rat).SetFrac(pv, volume)
+}
+
+func (d *DecimalVWAPCalculator) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.start, d.count = 0, 0
+	d.totalPVHi, d.totalPVLo, d.totalVolume = 0, 0, 0
+	d.clock.reset()
+}
+
+func (d *DecimalVWAPCalculator) TradeCount() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.clock.trades
+}
+
+func (d *DecimalVWAPCalculator) Stats() CalculatorStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	notional := new(big.Rat).SetFrac(d.totalPV(), big.NewInt(1e16))
+	return d.clock.stats(volumeString(big.NewRat(d.totalVolume, 1e8)), volumeString(notional))
+}
+
+// totalPV joins the two words of totalPV. d.mu must be held.
+func (d *DecimalVWAPCalculator) totalPV() *big.Int {
+	pv := new(big.Int).SetUint64(d.totalPVHi)
+	return pv.Lsh(pv, 64).Or(pv, new(big.Int).SetUint64(d.totalPVLo))
+}
+
+// parseFixed parses a plain decimal string such as "45000.12" into units of
+// 1e-8 without allocating. It rejects signs, exponents and anything beyond 8
+// decimal places or the int64 range.
+func parseFixed(s string) (int64, bool) {
+	var n int64
+	digits, places, point := 0, 0, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '.' && !point:
+			point = true
+			continue
+		case c < '0' || c > '9':
+			return 0, false
+		}
+		if point {
+			if places == decimalPlaces {
+				if c != '0' {
+					return 0, false
+				}
+				continue
+			}
+			places++
+		}
+		if n > (1<<63-1-int64(c-'0'))/10 {
+			return 0, false
+		}
+		n = n*10 + int64(c-'0')
+		digits++
+	}
+	if digits == 0 {
+		return 0, false
+	}
+	for ; places < decimalPlaces; places++ {
+		if n > (1<<63-1)/10 {
+			return 0, false
+		}
+		n *= 10
+	}
+	return n, true
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseFixed(t *testing.T) {
+	for in, want := range map[string]int64{
+		"1":            100000000,
+		"45000.12":     4500012000000,
+		"0.00000001":   1,
+		"1.5000000000": 150000000,
+		"7.":           700000000,
+	} {
+		if got, ok := parseFixed(in); !ok || got != want {
+			t.Errorf("parseFixed(%q) = %d, %v; want %d", in, got, ok, want)
+		}
+	}
+	for _, bad := range []string{"", ".", "-1", "1e5", "0.000000001", "1.2.3", "99999999999999999999"} {
+		if _, ok := parseFixed(bad); ok {
+			t.Errorf("Expected parseFixed(%q) to fail", bad)
+		}
+	}
+}
+
+func TestDecimalVWAPCalculatorMatchesExact(t *testing.T) {
+	exact := NewWindowedVWAPCalculator(5)
+	decimal := NewDecimalVWAPCalculator(5)
+	for i := 0; i < 12; i++ {
+		price := fmt.Sprintf("%d.%08d", 45000+i*37, i*1234567)
+		size := fmt.Sprintf("0.%08d", 1000000+i*7654321)
+		if err := exact.Update(price, size); err != nil {
+			t.Fatal(err)
+		}
+		if err := decimal.Update(price, size); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := decimal.Calculate(), exact.Calculate(); got != want {
+			t.Fatalf("After trade %d: decimal VWAP %s, exact %s", i, got, want)
+		}
+	}
+	if decimal.Update("100", "0.000000001") == nil {
+		t.Error("Expected an error for a size beyond 8 decimal places")
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import "sync"
+
+// Deduper remembers the most recent trade IDs per product so that a match
+// delivered twice, e.g. across a reconnect or by overlapping channels, is
+// only applied once.
+type Deduper struct {
+	mu      sync.Mutex
+	size    int
+	windows map[string]*idWindow
+}
+
+// idWindow is a fixed-size FIFO of trade IDs with O(1) membership checks.
+type idWindow struct {
+	ids  []int64
+	set  map[int64]struct{}
+	next int
+}
+
+func NewDeduper(size int) *Deduper {
+	return &Deduper{size: size, windows: make(map[string]*idWindow)}
+}
+
+// Forget discards the trade IDs recorded for productID.
+func (d *Deduper) Forget(productID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.windows, productID)
+}
+
+// Seen reports whether tradeID was already recorded for productID, recording
+// it if not. Trades without an ID are never treated as duplicates.
+func (d *Deduper) Seen(productID string, tradeID int64) bool {
+	if tradeID == 0 || d.size <= 0 {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	w, ok := d.windows[productID]
+	if !ok {
+		w = &idWindow{ids: make([]int64, 0, d.size), set: make(map[int64]struct{}, d.size)}
+		d.windows[productID] = w
+	}
+	if _, dup := w.set[tradeID]; dup {
+		return true
+	}
+	if len(w.ids) < d.size {
+		w.ids = append(w.ids, tradeID)
+	} else {
+		delete(w.set, w.ids[w.next])
+		w.ids[w.next] = tradeID
+		w.next = (w.next + 1) % d.size
+	}
+	w.set[tradeID] = struct{}{}
+	return false
+}
@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestDeduper(t *testing.T) {
+	t.Run("DropsRepeats", func(t *testing.T) {
+		d := NewDeduper(10)
+		if d.Seen("BTC-USD", 1) {
+			t.Error("First sighting reported as duplicate")
+		}
+		if !d.Seen("BTC-USD", 1) {
+			t.Error("Repeat not reported as duplicate")
+		}
+		if d.Seen("ETH-USD", 1) {
+			t.Error("Same ID on another product reported as duplicate")
+		}
+	})
+
+	t.Run("WindowEviction", func(t *testing.T) {
+		d := NewDeduper(3)
+		for id := int64(1); id <= 4; id++ {
+			d.Seen("BTC-USD", id)
+		}
+		if d.Seen("BTC-USD", 1) {
+			t.Error("Evicted ID still reported as duplicate")
+		}
+		if !d.Seen("BTC-USD", 4) {
+			t.Error("Recent ID not reported as duplicate")
+		}
+	})
+
+	t.Run("MissingID", func(t *testing.T) {
+		d := NewDeduper(3)
+		if d.Seen("BTC-USD", 0) || d.Seen("BTC-USD", 0) {
+			t.Error("Trades without an ID must never be duplicates")
+		}
+	})
+}
@@ -0,0 +1,31 @@
+package main
+
+import "math/big"
+
+// deviationPlaces is the precision of DeviationPct.
+const deviationPlaces = 4
+
+// SetPriceDeviation makes every update carry the price of the trade behind
+// it and that price's percentage deviation from the VWAP, so consumers need
+// not join the trade and update streams to compute it.
+func (p *Pipeline) SetPriceDeviation(enabled bool) {
+	p.deviation = enabled
+}
+
+// fillDeviation sets update's LastPrice and DeviationPct from trade, when
+// enabled. The deviation is computed exactly from the formatted VWAP, and
+// left empty while the VWAP is zero.
+func (p *Pipeline) fillDeviation(update *VWAPUpdate, trade Trade) {
+	if !p.deviation {
+		return
+	}
+	update.LastPrice = trade.Price
+	price, ok1 := new(big.Rat).SetString(trade.Price)
+	vwap, ok2 := new(big.Rat).SetString(update.VWAP)
+	if !ok1 || !ok2 || vwap.Sign() == 0 {
+		return
+	}
+	pct := new(big.Rat).Sub(price, vwap)
+	pct.Mul(pct, big.NewRat(100, 1)).Quo(pct, vwap)
+	update.DeviationPct = pct.FloatString(deviationPlaces)
+}
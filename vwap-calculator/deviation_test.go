@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestPriceDeviation(t *testing.T) {
+	store := NewStore()
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"), store)
+
+	ctx := context.Background()
+	pipeline.processMessage(ctx, []byte(`{"type":"match","product_id":"BTC-USD","trade_id":1,"price":"100","size":"3"}`))
+	if update, _ := store.Get("BTC-USD"); update.LastPrice != "" || update.DeviationPct != "" {
+		t.Errorf("Expected no deviation unless enabled, got %+v", update)
+	}
+
+	pipeline.SetPriceDeviation(true)
+	// VWAP is (300 + 120) / 4 = 105, and 120 is 14.2857% above it.
+	pipeline.processMessage(ctx, []byte(`{"type":"match","product_id":"BTC-USD","trade_id":2,"price":"120","size":"1"}`))
+	update, _ := store.Get("BTC-USD")
+	if update.LastPrice != "120" || update.DeviationPct != "14.2857" {
+		t.Errorf("Expected last_price 120 and deviation_pct 14.2857, got %q and %q", update.LastPrice, update.DeviationPct)
+	}
+	pipeline.processMessage(ctx, []byte(`{"type":"match","product_id":"BTC-USD","trade_id":3,"price":"84","size":"5"}`))
+	// VWAP is 840 / 9, formatted as 93.3333, and 84 is 10% below it.
+	if update, _ := store.Get("BTC-USD"); update.DeviationPct != "-10.0000" {
+		t.Errorf("Expected a negative deviation from the formatted VWAP, got %q", update.DeviationPct)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// DialerConfig holds how the feed connection reaches the exchange.
+type DialerConfig struct {
+	// Proxy is an http:// or socks5:// proxy URL. When empty, the
+	// HTTPS_PROXY and NO_PROXY environment variables apply.
+	Proxy string
+	// CAFile is a PEM bundle of extra certificate authorities to trust,
+	// such as a TLS-intercepting proxy's.
+	CAFile             string
+	ServerName         string
+	InsecureSkipVerify bool
+	Compression        bool
+}
+
+func parseProxy(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "socks5") || u.Host == "" {
+		return nil, fmt.Errorf("invalid -proxy %q: must be an http:// or socks5:// URL", s)
+	}
+	return u, nil
+}
+
+// newDialer returns the websocket dialer for the feed. Its connections count
+// the bytes they receive, so the wire size can be compared with the size of
+// the messages once decompressed.
+func newDialer(cfg DialerConfig) (*websocket.Dialer, error) {
+	dialer := *websocket.DefaultDialer
+	dialer.EnableCompression = cfg.Compression
+	dialer.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return countingConn{conn}, nil
+	}
+
+	if cfg.Proxy != "" {
+		proxy, err := parseProxy(cfg.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		dialer.Proxy = http.ProxyURL(proxy)
+	}
+
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	dialer.TLSClientConfig = tlsConfig
+	return &dialer, nil
+}
+
+// newTLSConfig returns the TLS settings for the feed connection, or nil for
+// the defaults.
+func newTLSConfig(cfg DialerConfig) (*tls.Config, error) {
+	if cfg.CAFile == "" && cfg.ServerName == "" && !cfg.InsecureSkipVerify {
+		return nil, nil
+	}
+	config := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("reading CA bundle: no certificates in %s", cfg.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+// SetWriteTimeout bounds how long a subscribe or unsubscribe may take to
+// write before the connection is treated as broken.
+func (p *Pipeline) SetWriteTimeout(d time.Duration) {
+	p.writeWait = d
+}
+
+// countingConn adds every byte read from the socket to wireBytes.
+type countingConn struct {
+	net.Conn
+}
+
+func (c countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	wireBytes.Add(float64(n))
+	return n, err
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/grantis/gopkg/vwap-calculator/internal/mockexchange"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDialerTLS(t *testing.T) {
+	var upgrader websocket.Upgrader
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, err := upgrader.Upgrade(w, r, nil); err == nil {
+			conn.Close()
+		}
+	}))
+	defer server.Close()
+	url := "wss" + strings.TrimPrefix(server.URL, "https")
+
+	dialer, err := newDialer(DialerConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := dialer.Dial(url, nil); err == nil {
+		t.Error("Expected the test certificate to be rejected by default")
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	block := &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if dialer, err = newDialer(DialerConfig{CAFile: caFile, ServerName: "example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Expected the CA bundle to be trusted: %v", err)
+	}
+	conn.Close()
+
+	if _, err := newDialer(DialerConfig{CAFile: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Error("Expected error for a missing CA bundle")
+	}
+}
+
+func TestDialerProxy(t *testing.T) {
+	exchange := mockexchange.New()
+	defer exchange.Close()
+
+	// A minimal CONNECT proxy that tunnels to the requested host.
+	var tunnels atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		client, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		tunnels.Add(1)
+		go func() {
+			io.Copy(upstream, client)
+			upstream.Close()
+		}()
+		io.Copy(client, upstream)
+		client.Close()
+	}))
+	defer proxy.Close()
+
+	dialer, err := newDialer(DialerConfig{Proxy: proxy.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, _, err := dialer.Dial(exchange.URL, nil)
+	if err != nil {
+		t.Fatalf("Dial through proxy failed: %v", err)
+	}
+	conn.Close()
+	if n := tunnels.Load(); n != 1 {
+		t.Errorf("Expected 1 tunnel through the proxy, got %d", n)
+	}
+
+	if _, err := newDialer(DialerConfig{Proxy: "ftp://proxy:21"}); err == nil {
+		t.Error("Expected error for an unsupported proxy scheme")
+	}
+}
+
+func TestRunFeedCompression(t *testing.T) {
+	exchange := mockexchange.New()
+	exchange.Compression = true
+	defer exchange.Close()
+	startFeed(t, exchange, NewStore(), func(cfg *Config, _ *Pipeline) { cfg.Dialer.Compression = true })
+	nextRequest(t, exchange)
+
+	wire, payload := testutil.ToFloat64(wireBytes), testutil.ToFloat64(payloadBytes)
+	message := `{"type":"heartbeat","product_id":"BTC-USD","padding":"` + strings.Repeat("a", 10000) + `"}`
+	exchange.Send([]byte(message))
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(payloadBytes)-payload < float64(len(message)) {
+		if time.Now().After(deadline) {
+			t.Fatal("The message was not received")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := testutil.ToFloat64(wireBytes) - wire; got <= 0 || got > 1000 {
+		t.Errorf("Expected the %d-byte message to arrive compressed, read %v bytes", len(message), got)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+)
+
+// exchangeProduct is the part of a Coinbase /products entry needed to decide
+// whether to track it.
+type exchangeProduct struct {
+	ID              string `json:"id"`
+	Status          string `json:"status"`
+	TradingDisabled bool   `json:"trading_disabled"`
+}
+
+// Products returns the IDs of every product currently trading on the
+// exchange, sorted.
+func (c *RESTClient) Products(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/products", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching products: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching products: unexpected status %s", resp.Status)
+	}
+
+	var listed []exchangeProduct
+	if err := json.NewDecoder(resp.Body).Decode(&listed); err != nil {
+		return nil, fmt.Errorf("decoding products: %w", err)
+	}
+	var ids []string
+	for _, p := range listed {
+		if p.Status == "online" && !p.TradingDisabled {
+			ids = append(ids, p.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// parseProductPatterns splits an -all-products value into glob patterns such
+// as "*-USD".
+func parseProductPatterns(s string) ([]string, error) {
+	var patterns []string
+	for _, pattern := range strings.Split(s, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return nil, fmt.Errorf("invalid -all-products pattern %q", pattern)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// discoverProducts lists the exchange's trading products matching any of
+// patterns.
+func discoverProducts(ctx context.Context, client *RESTClient, patterns []string) ([]string, error) {
+	ids, err := client.Products(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var matched []string
+	for _, id := range ids {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, id); ok {
+				matched = append(matched, id)
+				break
+			}
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("no trading products match %s", strings.Join(patterns, ","))
+	}
+	return matched, nil
+}
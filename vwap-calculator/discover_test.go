@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestDiscoverProducts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/products" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, `[
+			{"id":"ETH-USD","status":"online","trading_disabled":false},
+			{"id":"BTC-EUR","status":"online","trading_disabled":false},
+			{"id":"BTC-USD","status":"online","trading_disabled":false},
+			{"id":"OLD-USD","status":"delisted","trading_disabled":true},
+			{"id":"HALT-USD","status":"online","trading_disabled":true},
+			{"id":"ETH-BTC","status":"online","trading_disabled":false}
+		]`)
+	}))
+	defer server.Close()
+	client := NewRESTClient(server.URL)
+
+	for _, tt := range []struct {
+		patterns string
+		want     []string
+	}{
+		{"*", []string{"BTC-EUR", "BTC-USD", "ETH-BTC", "ETH-USD"}},
+		{"*-USD", []string{"BTC-USD", "ETH-USD"}},
+		{"BTC-*, *-BTC", []string{"BTC-EUR", "BTC-USD", "ETH-BTC"}},
+	} {
+		patterns, err := parseProductPatterns(tt.patterns)
+		if err != nil {
+			t.Fatalf("parseProductPatterns(%q) returned error: %v", tt.patterns, err)
+		}
+		got, err := discoverProducts(context.Background(), client, patterns)
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("discoverProducts(%q) = %v, %v; expected %v", tt.patterns, got, err, tt.want)
+		}
+	}
+
+	if _, err := discoverProducts(context.Background(), client, []string{"*-JPY"}); err == nil {
+		t.Error("Expected an error when nothing matches")
+	}
+	if _, err := parseProductPatterns("[-USD"); err == nil {
+		t.Error("Expected an error for a malformed pattern")
+	}
+}
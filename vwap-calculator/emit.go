@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// emitFlushTick is how often held-back updates are checked for being due.
+const emitFlushTick = 100 * time.Millisecond
+
+// emitPolicy decides how often a product's updates are published. The zero
+// value publishes every update.
+type emitPolicy struct {
+	every    int64         // publish every this many trades
+	interval time.Duration // publish at most once per interval
+}
+
+// parseEmit parses an -emit value: "trade", a trade count such as "100" or
+// an interval such as "1s".
+func parseEmit(s string) (emitPolicy, error) {
+	if s == "" || s == "trade" {
+		return emitPolicy{}, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil && n > 0 {
+		return emitPolicy{every: n}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return emitPolicy{interval: d}, nil
+	}
+	return emitPolicy{}, fmt.Errorf("invalid -emit %q: use trade, a trade count such as 100 or an interval such as 1s", s)
+}
+
+// emitter holds back updates according to each product's emitPolicy. The
+// calculators still see every trade; only publishing is thinned out.
+type emitter struct {
+	mu       sync.Mutex
+	policies map[string]emitPolicy
+	pending  map[string]VWAPUpdate
+	last     map[string]time.Time
+	now      func() time.Time
+}
+
+func newEmitter() *emitter {
+	return &emitter{
+		policies: make(map[string]emitPolicy),
+		pending:  make(map[string]VWAPUpdate),
+		last:     make(map[string]time.Time),
+		now:      time.Now,
+	}
+}
+
+// offer reports whether update should be published now. An update held back
+// by an interval is kept until due, replacing any older one.
+func (e *emitter) offer(update VWAPUpdate) bool {
+	return e.offerBatch(update, 1)
+}
+
+// offerBatch is offer for an update that follows n trades applied at once,
+// as a gap fill does. A trade-count policy publishes it if any of the n
+// trades would have been published.
+func (e *emitter) offerBatch(update VWAPUpdate, n int64) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	policy := e.policies[update.ProductID]
+	switch {
+	case policy.every > 0:
+		return update.TradeCount/policy.every > (update.TradeCount-n)/policy.every
+	case policy.interval > 0:
+		now := e.now()
+		if now.Sub(e.last[update.ProductID]) < policy.interval {
+			e.pending[update.ProductID] = update
+			return false
+		}
+		e.last[update.ProductID] = now
+		delete(e.pending, update.ProductID)
+	}
+	return true
+}
+
+// due removes and returns held-back updates whose interval has elapsed, or
+// all of them if all is set.
+func (e *emitter) due(all bool) []VWAPUpdate {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := e.now()
+	var updates []VWAPUpdate
+	for productID, update := range e.pending {
+		if all || now.Sub(e.last[productID]) >= e.policies[productID].interval {
+			updates = append(updates, update)
+			e.last[productID] = now
+			delete(e.pending, productID)
+		}
+	}
+	return updates
+}
+
+// forget discards productID's policy and any update held back for it.
+func (e *emitter) forget(productID string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.policies, productID)
+	delete(e.pending, productID)
+	delete(e.last, productID)
+}
+
+// SetEmitPolicy sets how often productID's updates are published.
+func (p *Pipeline) SetEmitPolicy(productID string, policy emitPolicy) {
+	p.emit.mu.Lock()
+	defer p.emit.mu.Unlock()
+	p.emit.policies[productID] = policy
+}
+
+// StartEmitter publishes updates held back by interval policies once they
+// are due. The returned stop function publishes whatever is still held.
+func (p *Pipeline) StartEmitter() (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(emitFlushTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.publishHeld(false)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+		p.publishHeld(true)
+	}
+}
+
+func (p *Pipeline) publishHeld(all bool) {
+	for _, update := range p.emit.due(all) {
+		p.publish(context.Background(), p.logger.With("product", update.ProductID), update)
+	}
+}
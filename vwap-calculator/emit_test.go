@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+type countingSink struct {
+	mu     sync.Mutex
+	counts []int64
+}
+
+func (s *countingSink) Publish(update VWAPUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts = append(s.counts, update.TradeCount)
+	return nil
+}
+
+func TestParseEmit(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want emitPolicy
+		err  bool
+	}{
+		{in: "", want: emitPolicy{}},
+		{in: "trade", want: emitPolicy{}},
+		{in: "100", want: emitPolicy{every: 100}},
+		{in: "1s", want: emitPolicy{interval: time.Second}},
+		{in: "0", err: true},
+		{in: "-1s", err: true},
+		{in: "often", err: true},
+	} {
+		got, err := parseEmit(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("parseEmit(%q) = %+v, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestPipelineEmitEveryN(t *testing.T) {
+	sink := &countingSink{}
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"), sink)
+	pipeline.SetEmitPolicy("BTC-USD", emitPolicy{every: 3})
+
+	for i := 1; i <= 7; i++ {
+		msg := fmt.Sprintf(`{"type":"match","product_id":"BTC-USD","trade_id":%d,"price":"100","size":"1"}`, i)
+		pipeline.processMessage(context.Background(), []byte(msg))
+	}
+
+	if want := []int64{3, 6}; !slices.Equal(sink.counts, want) {
+		t.Errorf("Expected updates at trade counts %v, got %v", want, sink.counts)
+	}
+}
+
+func TestPipelineEmitInterval(t *testing.T) {
+	sink := &countingSink{}
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"), sink)
+	pipeline.SetEmitPolicy("BTC-USD", emitPolicy{interval: time.Second})
+	now := time.Unix(1700000000, 0)
+	pipeline.emit.now = func() time.Time { return now }
+
+	trade := func(id int) {
+		msg := fmt.Sprintf(`{"type":"match","product_id":"BTC-USD","trade_id":%d,"price":"100","size":"1"}`, id)
+		pipeline.processMessage(context.Background(), []byte(msg))
+	}
+	trade(1) // first update goes out immediately
+	trade(2)
+	trade(3)
+	pipeline.publishHeld(false)
+	if want := []int64{1}; !slices.Equal(sink.counts, want) {
+		t.Fatalf("Expected only the first update before the interval, got %v", sink.counts)
+	}
+
+	now = now.Add(time.Second)
+	pipeline.publishHeld(false)
+	if want := []int64{1, 3}; !slices.Equal(sink.counts, want) {
+		t.Fatalf("Expected the latest held update once due, got %v", sink.counts)
+	}
+
+	trade(4)
+	pipeline.publishHeld(true)
+	if want := []int64{1, 3, 4}; !slices.Equal(sink.counts, want) {
+		t.Errorf("Expected held updates to be flushed on stop, got %v", sink.counts)
+	}
+}
+
+func TestEmitterOfferBatch(t *testing.T) {
+	e := newEmitter()
+	e.policies["BTC-USD"] = emitPolicy{every: 100}
+	for _, tt := range []struct {
+		count, n int64
+		want     bool
+	}{
+		{count: 250, n: 60, want: true}, // crosses 200
+		{count: 250, n: 40, want: false},
+		{count: 300, n: 1, want: true},
+	} {
+		if got := e.offerBatch(VWAPUpdate{ProductID: "BTC-USD", TradeCount: tt.count}, tt.n); got != tt.want {
+			t.Errorf("offerBatch(%d trades ending at %d) = %v, expected %v", tt.n, tt.count, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// EWVWAPCalculator is a VWAP in which each trade's weight halves every
+// halfLife of exchange time, instead of dropping to zero after windowSize
+// trades. Decay factors are irrational, so it works in floats.
+type EWVWAPCalculator struct {
+	halfLife time.Duration
+
+	mu     sync.Mutex
+	pv     float64 // decayed Σ price × size
+	volume float64 // decayed Σ size
+	last   time.Time
+	clock  tradeClock
+	formatted
+}
+
+func NewEWVWAPCalculator(halfLife time.Duration) *EWVWAPCalculator {
+	return &EWVWAPCalculator{halfLife: halfLife}
+}
+
+func (c *EWVWAPCalculator) Update(priceStr, sizeStr string) error {
+	return c.UpdateAt(priceStr, sizeStr, time.Now())
+}
+
+func (c *EWVWAPCalculator) UpdateAt(priceStr, sizeStr string, at time.Time) error {
+	rat, err := parsePrice(priceStr, sizeStr)
+	if err != nil {
+		return err
+	}
+	price, _ := rat.Float64()
+	size, _ := strconv.ParseFloat(sizeStr, 64)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Trades older than the newest one seen are weighted as if simultaneous
+	// with it.
+	if at.After(c.last) {
+		if !c.last.IsZero() {
+			decay := math.Exp2(-float64(at.Sub(c.last)) / float64(c.halfLife))
+			c.pv *= decay
+			c.volume *= decay
+		}
+		c.last = at
+	}
+	c.pv += price * size
+	c.volume += size
+	c.clock.add(at)
+	return nil
+}
+
+func (c *EWVWAPCalculator) Calculate() string {
+	vwap := c.CalculateRat()
+	if vwap == nil {
+		return "0"
+	}
+	return c.formatRat(vwap)
+}
+
+// CalculateRat returns the decayed VWAP, or nil before the first trade. The
+// decayed sums are float64, so it is exact only to their precision.
+func (c *EWVWAPCalculator) CalculateRat() *big.Rat {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.volume == 0 {
+		return nil
+	}
+	return new(big.Rat).SetFloat64(c.pv / c.volume)
+}
+
+func (c *EWVWAPCalculator) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pv, c.volume = 0, 0
+	c.last = time.Time{}
+	c.clock.reset()
+}
+
+func (c *EWVWAPCalculator) TradeCount() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clock.trades
+}
+
+// Stats reports the decayed volume. The window spans every trade since the
+// first, however little weight the oldest still carry.
+func (c *EWVWAPCalculator) Stats() CalculatorStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clock.stats(strconv.FormatFloat(c.volume, 'f', decimalPlaces, 64), strconv.FormatFloat(c.pv, 'f', decimalPlaces, 64))
+}
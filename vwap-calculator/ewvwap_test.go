@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEWVWAPCalculator(t *testing.T) {
+	calc := NewEWVWAPCalculator(time.Minute)
+	if got := calc.Calculate(); got != "0" {
+		t.Errorf("Expected 0 before any trades, got %s", got)
+	}
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	calc.UpdateAt("100", "2", base)
+	calc.UpdateAt("200", "1", base)
+	if got := calc.Calculate(); got != "133.3333" {
+		t.Errorf("Expected plain VWAP 133.3333 for simultaneous trades, got %s", got)
+	}
+
+	// One half-life later the earlier trades weigh 1.5 against the new 1.5.
+	calc.UpdateAt("300", "1.5", base.Add(time.Minute))
+	if got := calc.Calculate(); got != "216.6667" {
+		t.Errorf("Expected 216.6667 after one half-life, got %s", got)
+	}
+
+	// After many half-lives the old trades are negligible.
+	calc.UpdateAt("50", "1", base.Add(time.Hour))
+	if got := calc.Calculate(); got != "50.0000" {
+		t.Errorf("Expected old trades to have decayed away, got %s", got)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grantis/gopkg/vwap-calculator/internal/mockexchange"
+)
+
+// startFeed runs runFeed against exchange until the test ends, after
+// applying any setup to the config and pipeline.
+func startFeed(t *testing.T, exchange *mockexchange.Server, store *Store, setup ...func(*Config, *Pipeline)) *Pipeline {
+	t.Helper()
+	logger := NewLogger(io.Discard, slog.LevelInfo, "text")
+	calculators := map[string]Calculator{
+		"BTC-USD": NewVWAPCalculator(),
+		"ETH-USD": NewVWAPCalculator(),
+		"ETH-BTC": NewVWAPCalculator(),
+	}
+	pipeline := NewPipeline(calculators, logger, store)
+	cfg := &Config{
+		FeedURL: exchange.URL,
+		Retry:   RetryPolicy{InitialDelay: 10 * time.Millisecond, Multiplier: 1},
+	}
+	for _, f := range setup {
+		f(cfg, pipeline)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- runFeed(ctx, cfg, pipeline, logger) }()
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("runFeed returned %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("runFeed did not return after cancellation")
+		}
+	})
+	return pipeline
+}
+
+func nextRequest(t *testing.T, exchange *mockexchange.Server) mockexchange.Request {
+	t.Helper()
+	select {
+	case req := <-exchange.Requests():
+		return req
+	case <-time.After(5 * time.Second):
+		t.Fatal("No subscribe request received")
+		return mockexchange.Request{}
+	}
+}
+
+func waitForUpdate(t *testing.T, store *Store, productID string, cond func(VWAPUpdate) bool) VWAPUpdate {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if update, ok := store.Get(productID); ok && cond(update) {
+			return update
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("No matching %s update", productID)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRunFeedSubscribes(t *testing.T) {
+	exchange := mockexchange.New()
+	defer exchange.Close()
+	store := NewStore()
+	startFeed(t, exchange, store)
+
+	req := nextRequest(t, exchange)
+	if req.Type != "subscribe" || !slices.Equal(req.ProductIDs, []string{"BTC-USD", "ETH-USD", "ETH-BTC"}) ||
+		!slices.Equal(req.Channels, []string{"matches", "heartbeat"}) {
+		t.Errorf("Unexpected subscribe request %+v", req)
+	}
+
+	exchange.Heartbeat("BTC-USD")
+	exchange.Match(mockexchange.Match{ProductID: "BTC-USD", Price: "100", Size: "1"})
+	exchange.Match(mockexchange.Match{ProductID: "BTC-USD", Price: "200", Size: "3"})
+	update := waitForUpdate(t, store, "BTC-USD", func(u VWAPUpdate) bool { return u.TradeCount == 2 })
+	if update.VWAP != "175.0000" {
+		t.Errorf("Expected VWAP 175.0000, got %s", update.VWAP)
+	}
+}
+
+func TestRunFeedReconnects(t *testing.T) {
+	exchange := mockexchange.New()
+	exchange.LastMatch = true
+	defer exchange.Close()
+	store := NewStore()
+	startFeed(t, exchange, store)
+
+	nextRequest(t, exchange)
+	exchange.Match(mockexchange.Match{ProductID: "ETH-USD", Price: "3000", Size: "1"})
+	waitForUpdate(t, store, "ETH-USD", func(u VWAPUpdate) bool { return u.TradeCount == 1 })
+
+	exchange.DropConnections()
+	exchange.SkipTrades("ETH-USD", 4)
+	nextRequest(t, exchange)
+	if n := exchange.Connections(); n != 2 {
+		t.Errorf("Expected a second connection, got %d", n)
+	}
+
+	exchange.Match(mockexchange.Match{ProductID: "ETH-USD", Price: "3100", Size: "1"})
+	update := waitForUpdate(t, store, "ETH-USD", func(u VWAPUpdate) bool { return u.TradeCount == 2 })
+	if update.MissedTrades != 4 {
+		t.Errorf("Expected 4 missed trades across the reconnect, got %d", update.MissedTrades)
+	}
+	if update.VWAP != "3050.0000" {
+		t.Errorf("Expected VWAP 3050.0000, got %s", update.VWAP)
+	}
+}
+
+func TestRunFeedAddsAndRemovesProducts(t *testing.T) {
+	exchange := mockexchange.New()
+	defer exchange.Close()
+	store := NewStore()
+	pipeline := startFeed(t, exchange, store)
+	admin := &productAdmin{cfg: &Config{}, pipeline: pipeline, logger: NewLogger(io.Discard, slog.LevelInfo, "text")}
+	nextRequest(t, exchange)
+
+	if err := admin.add(context.Background(), "SOL-USD"); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	if req := nextRequest(t, exchange); req.Type != "subscribe" || !slices.Equal(req.ProductIDs, []string{"SOL-USD"}) {
+		t.Errorf("Unexpected subscribe request %+v", req)
+	}
+	exchange.Match(mockexchange.Match{ProductID: "SOL-USD", Price: "150", Size: "2"})
+	if update := waitForUpdate(t, store, "SOL-USD", func(u VWAPUpdate) bool { return u.TradeCount == 1 }); update.VWAP != "150.0000" {
+		t.Errorf("Expected VWAP 150.0000, got %s", update.VWAP)
+	}
+
+	if err := admin.remove(context.Background(), "ETH-BTC"); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	if req := nextRequest(t, exchange); req.Type != "unsubscribe" || !slices.Equal(req.ProductIDs, []string{"ETH-BTC"}) {
+		t.Errorf("Unexpected unsubscribe request %+v", req)
+	}
+	if got, want := pipeline.Subscriptions(), []string{"BTC-USD", "ETH-USD", "SOL-USD"}; !slices.Equal(got, want) {
+		t.Errorf("Expected subscriptions %v, got %v", want, got)
+	}
+
+	// A new connection subscribes to the products as they now stand.
+	exchange.DropConnections()
+	if req := nextRequest(t, exchange); !slices.Equal(req.ProductIDs, []string{"BTC-USD", "ETH-USD", "SOL-USD"}) {
+		t.Errorf("Expected the reconnect to subscribe to the current products, got %+v", req)
+	}
+}
+
+func TestRunFeedEnforcesMessageSize(t *testing.T) {
+	exchange := mockexchange.New()
+	defer exchange.Close()
+	startFeed(t, exchange, NewStore(), func(cfg *Config, _ *Pipeline) { cfg.MaxMessageSize = 1000 })
+	nextRequest(t, exchange)
+
+	exchange.Send([]byte(`{"type":"heartbeat","product_id":"BTC-USD","padding":"` + strings.Repeat("a", 2000) + `"}`))
+	nextRequest(t, exchange)
+	if n := exchange.Connections(); n != 2 {
+		t.Errorf("Expected the oversized message to force a reconnect, got %d connections", n)
+	}
+}
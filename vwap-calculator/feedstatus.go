@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// feedMessage is a control message from the exchange: the subscriptions
+// acknowledgement sent after every subscribe or unsubscribe, or an error.
+type feedMessage struct {
+	Type     string `json:"type"`
+	Message  string `json:"message"`
+	Reason   string `json:"reason"`
+	Channels []struct {
+		Name       string   `json:"name"`
+		ProductIDs []string `json:"product_ids"`
+	} `json:"channels"`
+}
+
+// handleFeedMessage checks a subscriptions acknowledgement against the
+// products the pipeline wants, and reports exchange errors. Either way a
+// product left without data is logged rather than going quiet.
+func (p *Pipeline) handleFeedMessage(data []byte) {
+	var msg feedMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		p.logger.Errorf("JSON decode error: %v", err)
+		parseErrors.Inc()
+		return
+	}
+	if msg.Type == "error" {
+		feedErrors.Inc()
+		p.logger.Errorf("Exchange error: %s: %s", msg.Message, msg.Reason)
+		p.reportError("", fmt.Errorf("exchange error: %s: %s", msg.Message, msg.Reason))
+		return
+	}
+
+	matched := make(map[string][]string)
+	for _, channel := range msg.Channels {
+		matched[channel.Name] = channel.ProductIDs
+	}
+	p.checkSubscriptions(matched)
+}
+
+// checkSubscriptions checks the products confirmed on each channel against
+// the products the pipeline wants.
+func (p *Pipeline) checkSubscriptions(matched map[string][]string) {
+	missing, confirmed := 0, 0
+	for _, productID := range p.Subscriptions() {
+		channel := p.tradeChannelFor(productID)
+		if slices.Contains(matched[channel], productID) {
+			confirmedSubscriptions.WithLabelValues(productID).Set(1)
+			confirmed++
+			continue
+		}
+		confirmedSubscriptions.WithLabelValues(productID).Set(0)
+		p.logger.With("product", productID).Errorf("Exchange did not confirm the %s subscription", channel)
+		missing++
+	}
+	if missing == 0 {
+		p.logger.Debugf("Exchange confirmed trade channels for %d products", confirmed)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grantis/gopkg/vwap-calculator/internal/mockexchange"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestHandleFeedMessage(t *testing.T) {
+	var logs bytes.Buffer
+	calculators := map[string]Calculator{"BTC-USD": NewVWAPCalculator(), "ETH-USD": NewVWAPCalculator()}
+	pipeline := NewPipeline(calculators, NewLogger(&logs, slog.LevelInfo, "text"), NewStore())
+
+	pipeline.handleFeedMessage([]byte(`{"type":"subscriptions","channels":[` +
+		`{"name":"matches","product_ids":["BTC-USD"]},{"name":"heartbeat","product_ids":["BTC-USD","ETH-USD"]}]}`))
+	if got := testutil.ToFloat64(confirmedSubscriptions.WithLabelValues("BTC-USD")); got != 1 {
+		t.Errorf("Expected BTC-USD confirmed, got %v", got)
+	}
+	if got := testutil.ToFloat64(confirmedSubscriptions.WithLabelValues("ETH-USD")); got != 0 {
+		t.Errorf("Expected ETH-USD unconfirmed, got %v", got)
+	}
+	if !strings.Contains(logs.String(), "product=ETH-USD") || strings.Contains(logs.String(), "product=BTC-USD") {
+		t.Errorf("Expected an error for ETH-USD only, got %q", logs.String())
+	}
+
+	before := testutil.ToFloat64(feedErrors)
+	pipeline.handleFeedMessage([]byte(`{"type":"error","message":"Failed to subscribe","reason":"XYZ-USD is not a valid product"}`))
+	if got := testutil.ToFloat64(feedErrors); got != before+1 {
+		t.Errorf("Expected feed errors to grow by 1, got %v -> %v", before, got)
+	}
+	if !strings.Contains(logs.String(), "XYZ-USD is not a valid product") {
+		t.Errorf("Expected the exchange's reason in the log, got %q", logs.String())
+	}
+}
+
+func TestRunFeedReportsRejectedSubscribe(t *testing.T) {
+	exchange := mockexchange.New()
+	exchange.Products = []string{"BTC-USD", "ETH-USD"}
+	defer exchange.Close()
+	before := testutil.ToFloat64(feedErrors)
+	startFeed(t, exchange, NewStore())
+
+	nextRequest(t, exchange)
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(feedErrors) == before {
+		if time.Now().After(deadline) {
+			t.Fatal("The rejected subscribe was not reported")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
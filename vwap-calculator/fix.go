@@ -0,0 +1,559 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	fixBeginString = "FIX.4.4"
+	fixSOH         = '\x01'
+	// fixMaxBody bounds a message body, so a corrupt length cannot make the
+	// reader allocate without limit.
+	fixMaxBody = 1 << 20
+	// fixTimeFormat is the UTCTimestamp format of SendingTime.
+	fixTimeFormat = "20060102-15:04:05.000"
+	// fixWriteTimeout bounds each write to the FIX connection.
+	fixWriteTimeout = 10 * time.Second
+)
+
+// Environment variable holding the password sent in the FIX Logon.
+const envFIXPassword = "FIX_PASSWORD"
+
+// FIX message types used by the market data session.
+const (
+	fixHeartbeat          = "0"
+	fixTestRequest        = "1"
+	fixResendRequest      = "2"
+	fixReject             = "3"
+	fixSequenceReset      = "4"
+	fixLogout             = "5"
+	fixLogon              = "A"
+	fixMarketDataRequest  = "V"
+	fixSnapshot           = "W"
+	fixIncrementalRefresh = "X"
+	fixMarketDataReject   = "Y"
+)
+
+// FIX tags used by the market data session.
+const (
+	tagBeginSeqNo              = 7
+	tagBeginString             = 8
+	tagBodyLength              = 9
+	tagCheckSum                = 10
+	tagMsgSeqNum               = 34
+	tagMsgType                 = 35
+	tagNewSeqNo                = 36
+	tagPossDupFlag             = 43
+	tagRefSeqNum               = 45
+	tagSenderCompID            = 49
+	tagSendingTime             = 52
+	tagSide                    = 54
+	tagSymbol                  = 55
+	tagTargetCompID            = 56
+	tagText                    = 58
+	tagEncryptMethod           = 98
+	tagHeartBtInt              = 108
+	tagTestReqID               = 112
+	tagOrigSendingTime         = 122
+	tagGapFillFlag             = 123
+	tagResetSeqNumFlag         = 141
+	tagNoRelatedSym            = 146
+	tagMDReqID                 = 262
+	tagSubscriptionRequestType = 263
+	tagMarketDepth             = 264
+	tagMDUpdateType            = 265
+	tagNoMDEntryTypes          = 267
+	tagNoMDEntries             = 268
+	tagMDEntryType             = 269
+	tagMDEntryPx               = 270
+	tagMDEntrySize             = 271
+	tagMDEntryDate             = 272
+	tagMDEntryTime             = 273
+	tagMDEntryID               = 278
+	tagMDUpdateAction          = 279
+	tagUsername                = 553
+	tagPassword                = 554
+	tagTradeID                 = 1003
+)
+
+// FIXConfig configures the FIX 4.4 market data feed, used instead of the
+// websocket feed when Addr is set.
+type FIXConfig struct {
+	Addr         string // host:port of the FIX acceptor
+	SenderCompID string
+	TargetCompID string
+	Heartbeat    time.Duration
+	// TLS wraps the connection in TLS, verified with the -tls-* settings.
+	TLS      bool
+	Username string
+	Password string // from FIX_PASSWORD
+}
+
+type fixField struct {
+	tag   int
+	value string
+}
+
+// fixMessage is a message's fields between BodyLength and CheckSum, in the
+// order they were sent.
+type fixMessage []fixField
+
+// get returns the first value of tag, or "" when it is absent.
+func (m fixMessage) get(tag int) string {
+	for _, f := range m {
+		if f.tag == tag {
+			return f.value
+		}
+	}
+	return ""
+}
+
+func (m fixMessage) msgType() string {
+	return m.get(tagMsgType)
+}
+
+// encodeFIX frames fields with BeginString, BodyLength and CheckSum.
+func encodeFIX(fields fixMessage) []byte {
+	var body bytes.Buffer
+	for _, f := range fields {
+		body.WriteString(strconv.Itoa(f.tag))
+		body.WriteByte('=')
+		body.WriteString(f.value)
+		body.WriteByte(fixSOH)
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "%d=%s%c%d=%d%c", tagBeginString, fixBeginString, fixSOH, tagBodyLength, body.Len(), fixSOH)
+	msg.Write(body.Bytes())
+	fmt.Fprintf(&msg, "%d=%03d%c", tagCheckSum, fixChecksum(msg.Bytes()), fixSOH)
+	return msg.Bytes()
+}
+
+func fixChecksum(b []byte) int {
+	sum := 0
+	for _, c := range b {
+		sum += int(c)
+	}
+	return sum % 256
+}
+
+// readFIX reads one message from r, checking its framing and checksum. Any
+// error leaves r mid-message, so the connection must be dropped.
+func readFIX(r *bufio.Reader) (fixMessage, error) {
+	begin, err := r.ReadString(fixSOH)
+	if err != nil {
+		return nil, err
+	}
+	if begin != fmt.Sprintf("%d=%s%c", tagBeginString, fixBeginString, fixSOH) {
+		return nil, fmt.Errorf("fix: unexpected BeginString %q", strings.TrimSuffix(begin, string(fixSOH)))
+	}
+	length, err := r.ReadString(fixSOH)
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(length, strconv.Itoa(tagBodyLength)+"="), string(fixSOH)))
+	if err != nil || !strings.HasPrefix(length, strconv.Itoa(tagBodyLength)+"=") || n <= 0 || n > fixMaxBody {
+		return nil, fmt.Errorf("fix: invalid BodyLength %q", strings.TrimSuffix(length, string(fixSOH)))
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	trailer, err := r.ReadString(fixSOH)
+	if err != nil {
+		return nil, err
+	}
+	want := fixChecksum([]byte(begin + length))
+	want = (want + fixChecksum(body)) % 256
+	if trailer != fmt.Sprintf("%d=%03d%c", tagCheckSum, want, fixSOH) {
+		return nil, fmt.Errorf("fix: bad trailer %q, want CheckSum %03d", strings.TrimSuffix(trailer, string(fixSOH)), want)
+	}
+	if body[len(body)-1] != fixSOH {
+		return nil, errors.New("fix: body does not end with a field delimiter")
+	}
+	var msg fixMessage
+	for _, field := range strings.Split(string(body[:len(body)-1]), string(fixSOH)) {
+		tag, value, ok := strings.Cut(field, "=")
+		t, err := strconv.Atoi(tag)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("fix: malformed field %q", field)
+		}
+		msg = append(msg, fixField{t, value})
+	}
+	return msg, nil
+}
+
+// fixTrades returns the trade entries of a MarketDataSnapshotFullRefresh or
+// MarketDataIncrementalRefresh. Incremental entries other than new ones are
+// skipped, as are entries that are not trades.
+func fixTrades(msg fixMessage) ([]Trade, error) {
+	first := tagMDEntryType
+	if msg.msgType() == fixIncrementalRefresh {
+		first = tagMDUpdateAction
+	}
+	// A snapshot names its instrument before the entries; incremental
+	// entries name their own.
+	var (
+		symbol  string
+		entries []map[int]string
+		inGroup bool
+	)
+	for _, f := range msg {
+		switch {
+		case f.tag == tagNoMDEntries:
+			inGroup = true
+		case !inGroup:
+			if f.tag == tagSymbol {
+				symbol = f.value
+			}
+		case f.tag == first:
+			entries = append(entries, map[int]string{f.tag: f.value})
+		case len(entries) > 0:
+			entry := entries[len(entries)-1]
+			if _, ok := entry[f.tag]; !ok {
+				entry[f.tag] = f.value
+			}
+		}
+	}
+
+	var trades []Trade
+	for _, entry := range entries {
+		if entry[tagMDEntryType] != "2" || first == tagMDUpdateAction && entry[tagMDUpdateAction] != "0" {
+			continue
+		}
+		trade := Trade{
+			Type:      "match",
+			ProductID: entry[tagSymbol],
+			Price:     entry[tagMDEntryPx],
+			Size:      entry[tagMDEntrySize],
+		}
+		if trade.ProductID == "" {
+			trade.ProductID = symbol
+		}
+		if trade.ProductID == "" || trade.Price == "" || trade.Size == "" {
+			return nil, errors.New("fix: trade entry without a symbol, price or size")
+		}
+		id := entry[tagTradeID]
+		if id == "" {
+			id = entry[tagMDEntryID]
+		}
+		// Venues whose IDs are not numeric get no deduplication or gap
+		// detection.
+		trade.TradeID, _ = strconv.ParseInt(id, 10, 64)
+		// A trade entry's Side is the aggressor's, where a match's is the
+		// maker's.
+		switch entry[tagSide] {
+		case "1":
+			trade.Side = makerSide("buy")
+		case "2":
+			trade.Side = makerSide("sell")
+		}
+		if at := entry[tagMDEntryTime]; at != "" {
+			date := entry[tagMDEntryDate]
+			if date == "" {
+				date, _, _ = strings.Cut(msg.get(tagSendingTime), "-")
+			}
+			t, err := time.Parse("20060102-15:04:05", date+"-"+at)
+			if err != nil {
+				return nil, fmt.Errorf("fix: invalid trade time %q %q", date, at)
+			}
+			trade.Time = t
+		}
+		trades = append(trades, trade)
+	}
+	return trades, nil
+}
+
+// fixSession is one FIX connection, from Logon until it ends.
+type fixSession struct {
+	cfg    FIXConfig
+	conn   net.Conn
+	reader *bufio.Reader
+	logger Logger
+
+	mu       sync.Mutex // serializes writes
+	outSeq   int
+	lastSent time.Time
+}
+
+func dialFIX(ctx context.Context, cfg FIXConfig, dialer DialerConfig, logger Logger) (*fixSession, error) {
+	logger.Infof("Connecting to FIX acceptor %s", cfg.Addr)
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("connection failed: %w", err)
+	}
+	if cfg.TLS {
+		config, err := newTLSConfig(dialer)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if config == nil {
+			config = &tls.Config{}
+		}
+		if config.ServerName == "" {
+			config.ServerName, _, _ = net.SplitHostPort(cfg.Addr)
+		}
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("TLS handshake failed: %w", err)
+		}
+		conn = tlsConn
+	}
+	conn = countingConn{conn}
+	return &fixSession{cfg: cfg, conn: conn, reader: bufio.NewReader(conn), logger: logger}, nil
+}
+
+// send writes a message of msgType, with the next sequence number, the
+// standard header and fields.
+func (s *fixSession) send(msgType string, fields ...fixField) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.outSeq++
+	return s.write(msgType, s.outSeq, fields)
+}
+
+// write sends a message numbered seq. s.mu must be held.
+func (s *fixSession) write(msgType string, seq int, fields []fixField) error {
+	now := time.Now().UTC()
+	msg := append(fixMessage{
+		{tagMsgType, msgType},
+		{tagSenderCompID, s.cfg.SenderCompID},
+		{tagTargetCompID, s.cfg.TargetCompID},
+		{tagMsgSeqNum, strconv.Itoa(seq)},
+		{tagSendingTime, now.Format(fixTimeFormat)},
+	}, fields...)
+	s.conn.SetWriteDeadline(now.Add(fixWriteTimeout))
+	_, err := s.conn.Write(encodeFIX(msg))
+	s.lastSent = now
+	return err
+}
+
+func (s *fixSession) sinceSent() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return time.Since(s.lastSent)
+}
+
+// logon starts a session with sequence numbers reset to 1, so none need to
+// be kept between connections, and waits for the acceptor's Logon.
+func (s *fixSession) logon() error {
+	fields := []fixField{
+		{tagEncryptMethod, "0"},
+		{tagHeartBtInt, strconv.Itoa(int(s.cfg.Heartbeat / time.Second))},
+		{tagResetSeqNumFlag, "Y"},
+	}
+	if s.cfg.Username != "" {
+		fields = append(fields, fixField{tagUsername, s.cfg.Username})
+	}
+	if s.cfg.Password != "" {
+		fields = append(fields, fixField{tagPassword, s.cfg.Password})
+	}
+	if err := s.send(fixLogon, fields...); err != nil {
+		return fmt.Errorf("sending Logon: %w", err)
+	}
+	s.conn.SetReadDeadline(time.Now().Add(s.cfg.Heartbeat))
+	defer s.conn.SetReadDeadline(time.Time{})
+	reply, err := readFIX(s.reader)
+	if err != nil {
+		return fmt.Errorf("waiting for Logon: %w", err)
+	}
+	switch reply.msgType() {
+	case fixLogon:
+		return nil
+	case fixLogout, fixReject:
+		return fmt.Errorf("logon rejected: %s", reply.get(tagText))
+	default:
+		return fmt.Errorf("expected Logon, got MsgType %s", reply.msgType())
+	}
+}
+
+// subscribe requests a snapshot and then incremental trades for products.
+func (s *fixSession) subscribe(products []string) error {
+	fields := []fixField{
+		{tagMDReqID, "vwap-" + strconv.FormatInt(time.Now().UnixNano(), 36)},
+		{tagSubscriptionRequestType, "1"},
+		{tagMarketDepth, "1"},
+		{tagMDUpdateType, "1"},
+		{tagNoMDEntryTypes, "1"},
+		{tagMDEntryType, "2"},
+		{tagNoRelatedSym, strconv.Itoa(len(products))},
+	}
+	for _, productID := range products {
+		fields = append(fields, fixField{tagSymbol, productID})
+	}
+	return s.send(fixMarketDataRequest, fields...)
+}
+
+// run dispatches trades until the session fails or ctx is cancelled, when
+// it logs out. It keeps the session alive with heartbeats, sends a
+// TestRequest when the acceptor goes quiet and logs out when the
+// malformed-message breaker trips.
+func (s *fixSession) run(ctx context.Context, pipeline *Pipeline) error {
+	messages := make(chan fixMessage)
+	errc := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			msg, err := readFIX(s.reader)
+			if err != nil {
+				errc <- err
+				return
+			}
+			select {
+			case messages <- msg:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(s.cfg.Heartbeat / 4)
+	defer ticker.Stop()
+	lastReceived := time.Now()
+	var testRequest time.Time // when an unanswered TestRequest was sent
+	for {
+		select {
+		case <-ctx.Done():
+			s.send(fixLogout)
+			return nil
+		case err := <-errc:
+			return fmt.Errorf("reading from FIX acceptor: %w", err)
+		case <-pipeline.breaker.Tripped():
+			s.send(fixLogout, fixField{tagText, "too many malformed messages"})
+			return fmt.Errorf("%w within %v", errMalformedFeed, breakerWindow)
+		case msg := <-messages:
+			lastReceived, testRequest = time.Now(), time.Time{}
+			pipeline.health.message()
+			if err := s.handle(ctx, pipeline, msg); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if s.sinceSent() >= s.cfg.Heartbeat {
+				if err := s.send(fixHeartbeat); err != nil {
+					return fmt.Errorf("sending Heartbeat: %w", err)
+				}
+			}
+			switch {
+			case testRequest.IsZero() && time.Since(lastReceived) > s.cfg.Heartbeat*6/5:
+				testRequest = time.Now()
+				if err := s.send(fixTestRequest, fixField{tagTestReqID, strconv.FormatInt(testRequest.UnixNano(), 36)}); err != nil {
+					return fmt.Errorf("sending TestRequest: %w", err)
+				}
+			case !testRequest.IsZero() && time.Since(testRequest) > s.cfg.Heartbeat:
+				return fmt.Errorf("no message from FIX acceptor for %v", time.Since(lastReceived).Round(time.Millisecond))
+			}
+		}
+	}
+}
+
+// handle answers session messages and dispatches market data trades.
+func (s *fixSession) handle(ctx context.Context, pipeline *Pipeline, msg fixMessage) error {
+	switch msg.msgType() {
+	case fixHeartbeat:
+	case fixTestRequest:
+		return s.send(fixHeartbeat, fixField{tagTestReqID, msg.get(tagTestReqID)})
+	case fixResendRequest:
+		// Nothing sent is worth resending, so fill the whole gap up to the
+		// next sequence number.
+		begin, err := strconv.Atoi(msg.get(tagBeginSeqNo))
+		if err != nil || begin <= 0 {
+			return fmt.Errorf("invalid ResendRequest BeginSeqNo %q", msg.get(tagBeginSeqNo))
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.write(fixSequenceReset, begin, []fixField{
+			{tagPossDupFlag, "Y"},
+			{tagOrigSendingTime, time.Now().UTC().Format(fixTimeFormat)},
+			{tagGapFillFlag, "Y"},
+			{tagNewSeqNo, strconv.Itoa(s.outSeq + 1)},
+		})
+	case fixReject:
+		s.logger.Warnf("FIX acceptor rejected message %s: %s", msg.get(tagRefSeqNum), msg.get(tagText))
+	case fixLogout:
+		s.send(fixLogout)
+		return fmt.Errorf("FIX acceptor logged out: %s", msg.get(tagText))
+	case fixMarketDataReject:
+		return fmt.Errorf("market data request rejected: %s", msg.get(tagText))
+	case fixSnapshot, fixIncrementalRefresh:
+		pipeline.countMessage()
+		trades, err := fixTrades(msg)
+		if err != nil {
+			pipeline.malformedMessage(s.logger, "", "FIX decode error: %v", err)
+			parseErrors.Inc()
+			return nil
+		}
+		for _, trade := range trades {
+			pipeline.observeLatency(trade)
+			pipeline.dispatch(ctx, trade, nil)
+		}
+	default:
+		s.logger.Debugf("Ignoring FIX MsgType %s", msg.msgType())
+	}
+	return nil
+}
+
+// runFIXFeed is runFeed for a FIX acceptor: it logs on, subscribes to every
+// product's trades and reconnects with the same backoff. Products added
+// later are subscribed to on the next connection.
+func runFIXFeed(ctx context.Context, cfg *Config, pipeline *Pipeline, logger Logger) error {
+	backoff := NewBackoff(cfg.Retry)
+	pipeline.health.start()
+	for attempt := 0; ctx.Err() == nil; attempt++ {
+		if attempt > 0 {
+			reconnects.Inc()
+			pipeline.health.reconnect()
+		}
+		connectedAt := time.Now()
+		err := runFIXSession(ctx, cfg, pipeline, logger)
+		if time.Since(connectedAt) >= cfg.Retry.HealthyAfter {
+			backoff.Reset()
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			logger.Errorf("FIX session failed: %v", err)
+		}
+		delay, ok := backoff.Fail()
+		if !ok {
+			return fmt.Errorf("max connection retries (%d) reached", cfg.Retry.MaxRetries)
+		}
+		logger.Infof("Reconnecting in %v (attempt %d)", delay.Round(time.Millisecond), backoff.Failures())
+		sleepContext(ctx, delay)
+	}
+	return nil
+}
+
+func runFIXSession(ctx context.Context, cfg *Config, pipeline *Pipeline, logger Logger) error {
+	session, err := dialFIX(ctx, cfg.FIX, cfg.Dialer, logger)
+	if err != nil {
+		return err
+	}
+	defer session.conn.Close()
+	if err := session.logon(); err != nil {
+		return err
+	}
+	pipeline.breaker.reset()
+	products := pipeline.Subscriptions()
+	if err := session.subscribe(products); err != nil {
+		return fmt.Errorf("sending MarketDataRequest: %w", err)
+	}
+	logger.Infof("Logged on to FIX acceptor as %s; requested trades for %s", cfg.FIX.SenderCompID, strings.Join(products, ", "))
+	pipeline.health.setConnected(true)
+	defer pipeline.health.setConnected(false)
+	return session.run(ctx, pipeline)
+}
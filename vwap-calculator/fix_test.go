@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixBody builds message fields from "tag=value|tag=value" text.
+func fixBody(t *testing.T, s string) fixMessage {
+	t.Helper()
+	msg, err := readFIX(bufio.NewReader(bytes.NewReader(encodeFIX(parseFIXText(t, s)))))
+	if err != nil {
+		t.Fatalf("Round trip of %q: %v", s, err)
+	}
+	return msg
+}
+
+func parseFIXText(t *testing.T, s string) fixMessage {
+	t.Helper()
+	var msg fixMessage
+	for _, field := range strings.Split(s, "|") {
+		tag, value, _ := strings.Cut(field, "=")
+		n, err := strconv.Atoi(tag)
+		if err != nil {
+			t.Fatalf("Invalid tag in %q", field)
+		}
+		msg = append(msg, fixField{n, value})
+	}
+	return msg
+}
+
+func TestFIXFraming(t *testing.T) {
+	// A Heartbeat, framed with its length and checksum.
+	raw := encodeFIX(fixMessage{{35, "0"}, {49, "SERVER"}, {56, "CLIENT"}, {34, "2"}, {52, "20240101-12:00:00.000"}})
+	want := "8=FIX.4.4\x019=55\x0135=0\x0149=SERVER\x0156=CLIENT\x0134=2\x0152=20240101-12:00:00.000\x0110="
+	if !strings.HasPrefix(string(raw), want) {
+		t.Fatalf("Unexpected encoding %q", raw)
+	}
+	msg, err := readFIX(bufio.NewReader(bytes.NewReader(raw)))
+	if err != nil || msg.msgType() != "0" || msg.get(tagSenderCompID) != "SERVER" {
+		t.Fatalf("Unexpected decoding %v, %v", msg, err)
+	}
+
+	corrupt := bytes.Replace(raw, []byte("SERVER"), []byte("SERVES"), 1)
+	if _, err := readFIX(bufio.NewReader(bytes.NewReader(corrupt))); err == nil || !strings.Contains(err.Error(), "CheckSum") {
+		t.Errorf("Expected a checksum error, got %v", err)
+	}
+	if _, err := readFIX(bufio.NewReader(strings.NewReader("8=FIX.4.2\x019=5\x0135=0\x0110=000\x01"))); err == nil {
+		t.Error("Expected an error for another FIX version")
+	}
+}
+
+func TestFIXTrades(t *testing.T) {
+	snapshot := fixBody(t, "35=W|52=20240101-12:00:05.000|55=BTC-USD|268=2|269=0|270=99|271=5|269=2|270=100.5|271=0.25|272=20240101|273=11:59:58.250|1003=41|54=1")
+	trades, err := fixTrades(snapshot)
+	if err != nil || len(trades) != 1 {
+		t.Fatalf("Expected one trade from the snapshot, got %+v, %v", trades, err)
+	}
+	// Side=1 is an aggressive buy, which rests against a sell.
+	want := Trade{Type: "match", ProductID: "BTC-USD", TradeID: 41, Price: "100.5", Size: "0.25", Side: "sell",
+		Time: time.Date(2024, 1, 1, 11, 59, 58, 250e6, time.UTC)}
+	if trades[0] != want {
+		t.Errorf("Expected %+v, got %+v", want, trades[0])
+	}
+
+	// Incremental entries carry their own symbol; deletes and bids are
+	// skipped, and a missing date comes from SendingTime.
+	incremental := fixBody(t, "35=X|52=20240102-00:00:01.000|268=4|279=0|269=2|55=ETH-USD|270=2000|271=1|273=00:00:00|278=7|54=2|279=2|269=2|55=ETH-USD|270=2001|271=1|279=0|269=0|55=ETH-USD|270=1999|271=3|279=0|269=2|55=BTC-USD|270=101|271=2")
+	trades, err = fixTrades(incremental)
+	if err != nil || len(trades) != 2 {
+		t.Fatalf("Expected two trades, got %+v, %v", trades, err)
+	}
+	if trades[0].ProductID != "ETH-USD" || trades[0].TradeID != 7 || trades[0].Side != "buy" || !trades[0].Time.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected first trade %+v", trades[0])
+	}
+	if trades[1].ProductID != "BTC-USD" || trades[1].Price != "101" || !trades[1].Time.IsZero() {
+		t.Errorf("Unexpected second trade %+v", trades[1])
+	}
+
+	if _, err := fixTrades(fixBody(t, "35=X|268=1|279=0|269=2|55=BTC-USD|271=1")); err == nil {
+		t.Error("Expected an error for a trade without a price")
+	}
+}
+
+// fixAcceptor is a single-connection FIX acceptor for tests.
+type fixAcceptor struct {
+	t        *testing.T
+	listener net.Listener
+	received chan fixMessage
+	conn     chan net.Conn
+}
+
+func newFIXAcceptor(t *testing.T) *fixAcceptor {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &fixAcceptor{t: t, listener: listener, received: make(chan fixMessage, 16), conn: make(chan net.Conn, 1)}
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		a.conn <- conn
+		r := bufio.NewReader(conn)
+		for {
+			msg, err := readFIX(r)
+			if err != nil {
+				close(a.received)
+				return
+			}
+			a.received <- msg
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return a
+}
+
+func (a *fixAcceptor) next(msgType string) fixMessage {
+	a.t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg, ok := <-a.received:
+			if !ok {
+				a.t.Fatalf("Connection closed waiting for MsgType %s", msgType)
+			}
+			if msg.msgType() == msgType {
+				return msg
+			}
+		case <-timeout:
+			a.t.Fatalf("No MsgType %s received", msgType)
+		}
+	}
+}
+
+func TestRunFIXFeed(t *testing.T) {
+	acceptor := newFIXAcceptor(t)
+	store := NewStore()
+	logger := NewLogger(io.Discard, slog.LevelInfo, "text")
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, logger, store)
+	cfg := &Config{
+		FIX:   FIXConfig{Addr: acceptor.listener.Addr().String(), SenderCompID: "CLIENT", TargetCompID: "VENUE", Heartbeat: time.Second, Username: "u", Password: "p"},
+		Retry: RetryPolicy{InitialDelay: 10 * time.Millisecond, Multiplier: 1},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- runFIXFeed(ctx, cfg, pipeline, logger) }()
+
+	logon := acceptor.next(fixLogon)
+	if logon.get(tagSenderCompID) != "CLIENT" || logon.get(tagTargetCompID) != "VENUE" || logon.get(tagHeartBtInt) != "1" || logon.get(tagResetSeqNumFlag) != "Y" || logon.get(tagPassword) != "p" {
+		t.Errorf("Unexpected Logon %v", logon)
+	}
+	conn := <-acceptor.conn
+	seq := 0
+	send := func(s string) {
+		seq++
+		fields := parseFIXText(t, s)
+		header := fixMessage{fields[0], {tagSenderCompID, "VENUE"}, {tagTargetCompID, "CLIENT"}, {tagMsgSeqNum, strconv.Itoa(seq)}, {tagSendingTime, time.Now().UTC().Format(fixTimeFormat)}}
+		conn.Write(encodeFIX(append(header, fields[1:]...)))
+	}
+	send("35=A|98=0|108=1")
+
+	request := acceptor.next(fixMarketDataRequest)
+	if request.get(tagMDEntryType) != "2" || request.get(tagSymbol) != "BTC-USD" || request.get(tagSubscriptionRequestType) != "1" {
+		t.Errorf("Unexpected MarketDataRequest %v", request)
+	}
+	send("35=X|268=2|279=0|269=2|55=BTC-USD|270=100|271=1|1003=1|279=0|269=2|55=BTC-USD|270=200|271=3|1003=2")
+	if update := waitForUpdate(t, store, "BTC-USD", func(u VWAPUpdate) bool { return u.TradeCount == 2 }); update.VWAP != "175.0000" {
+		t.Errorf("Expected VWAP 175.0000, got %s", update.VWAP)
+	}
+
+	send("35=1|112=ping")
+	if reply := acceptor.next(fixHeartbeat); reply.get(tagTestReqID) != "ping" {
+		t.Errorf("Expected a Heartbeat answering the TestRequest, got %v", reply)
+	}
+
+	cancel()
+	acceptor.next(fixLogout)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("runFIXFeed returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("runFIXFeed did not return after cancellation")
+	}
+}
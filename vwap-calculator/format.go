@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"sync/atomic"
+)
+
+// Rounding modes for priceFormat.
+const (
+	roundHalfUp   = "half-up" // halves away from zero, as big.Rat.FloatString
+	roundHalfEven = "half-even"
+	roundTruncate = "truncate"
+)
+
+// priceFormat controls how calculated prices are rendered.
+type priceFormat struct {
+	places   int
+	rounding string
+}
+
+var defaultPriceFormat = priceFormat{places: 4, rounding: roundHalfUp}
+
+// Formatter is implemented by calculators whose output precision can be
+// configured.
+type Formatter interface {
+	SetFormat(format priceFormat)
+	Format() priceFormat
+}
+
+// formatted is embedded in calculators to implement Formatter. The zero
+// value uses defaultPriceFormat. The format can change while the calculator
+// is in use, as a reload does.
+type formatted struct {
+	format atomic.Pointer[priceFormat]
+}
+
+func (f *formatted) SetFormat(format priceFormat) {
+	f.format.Store(&format)
+}
+
+func (f *formatted) Format() priceFormat {
+	if format := f.format.Load(); format != nil {
+		return *format
+	}
+	return defaultPriceFormat
+}
+
+func (f *formatted) formatRat(r *big.Rat) string {
+	return f.Format().rat(r)
+}
+
+func (f *formatted) formatFloat(x *big.Float) string {
+	return f.Format().float(x)
+}
+
+func (f *formatted) formatFloat64(x float64) string {
+	return f.formatRat(new(big.Rat).SetFloat64(x))
+}
+
+// formatOf returns c's format, or the default for calculators without one.
+func formatOf(c Calculator) priceFormat {
+	if f, ok := c.(Formatter); ok {
+		return f.Format()
+	}
+	return defaultPriceFormat
+}
+
+// rat renders r with the format's decimal places and rounding.
+func (f priceFormat) rat(r *big.Rat) string {
+	return f.decimal(r).String()
+}
+
+// decimal rounds r to the format's decimal places.
+func (f priceFormat) decimal(r *big.Rat) Decimal {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(f.places)), nil)
+	scaled := new(big.Rat).Mul(new(big.Rat).Abs(r), new(big.Rat).SetInt(scale))
+	q, rem := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+
+	// Compare the remainder with half the denominator: 2·rem against denom.
+	half := new(big.Int).Lsh(rem, 1).Cmp(scaled.Denom())
+	switch f.rounding {
+	case roundTruncate:
+	case roundHalfEven:
+		if half > 0 || (half == 0 && q.Bit(0) == 1) {
+			q.Add(q, big.NewInt(1))
+		}
+	default:
+		if half >= 0 {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+
+	if r.Sign() < 0 {
+		q.Neg(q)
+	}
+	return Decimal{Coefficient: q, Places: f.places}
+}
+
+func (f priceFormat) float(x *big.Float) string {
+	r, _ := x.Rat(nil)
+	return f.rat(r)
+}
+
+// SetFormat applies format to productID's calculator and indicators.
+func (p *Pipeline) SetFormat(productID string, format priceFormat) {
+	calculator, indicators, _ := p.calculator(productID)
+	if f, ok := calculator.(Formatter); ok {
+		f.SetFormat(format)
+	}
+	for _, ind := range indicators {
+		if f, ok := ind.calculator.(Formatter); ok {
+			f.SetFormat(format)
+		}
+	}
+}
+
+// parseRounding validates a -rounding value.
+func parseRounding(s string) (string, error) {
+	switch s {
+	case roundHalfUp, roundHalfEven, roundTruncate:
+		return s, nil
+	default:
+		return "", fmt.Errorf("unknown rounding %q: must be half-up, half-even or truncate", s)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestPriceFormat(t *testing.T) {
+	cases := []struct {
+		value    string
+		places   int
+		rounding string
+		want     string
+	}{
+		{"1.23445", 4, roundHalfUp, "1.2345"},
+		{"1.23445", 4, roundHalfEven, "1.2344"},
+		{"1.23455", 4, roundHalfEven, "1.2346"},
+		{"1.23449", 4, roundHalfEven, "1.2345"},
+		{"1.23449", 4, roundTruncate, "1.2344"},
+		{"-1.23445", 4, roundHalfUp, "-1.2345"},
+		{"0.0678912345", 8, roundHalfUp, "0.06789123"},
+		{"2/3", 2, roundHalfUp, "0.67"},
+		{"2.5", 0, roundHalfEven, "2"},
+		{"3.5", 0, roundHalfEven, "4"},
+		{"-0.00001", 2, roundHalfUp, "0.00"},
+		{"45000", 4, roundHalfUp, "45000.0000"},
+	}
+	for _, tc := range cases {
+		r, _ := new(big.Rat).SetString(tc.value)
+		if got := (priceFormat{places: tc.places, rounding: tc.rounding}).rat(r); got != tc.want {
+			t.Errorf("%s to %d places %s: expected %s, got %s", tc.value, tc.places, tc.rounding, tc.want, got)
+		}
+	}
+
+	// The default matches big.Rat.FloatString(4), which earlier output used.
+	r := big.NewRat(123456789, 7)
+	if got := defaultPriceFormat.rat(r); got != r.FloatString(4) {
+		t.Errorf("Default format %s differs from FloatString %s", got, r.FloatString(4))
+	}
+}
+
+func TestPipelineSetFormat(t *testing.T) {
+	calc := NewVWAPCalculator()
+	sma := NewSMACalculator(2)
+	pipeline := NewPipeline(map[string]Calculator{"ETH-BTC": calc}, nil)
+	pipeline.AddIndicator("ETH-BTC", "sma2", sma)
+	pipeline.SetFormat("ETH-BTC", priceFormat{places: 8, rounding: roundTruncate})
+
+	calc.Update("0.067891239", "1")
+	sma.Update("0.067891239", "1")
+	if got := calc.Calculate(); got != "0.06789123" {
+		t.Errorf("Expected 8 truncated places, got %s", got)
+	}
+	if got := sma.Calculate(); got != "0.06789123" {
+		t.Errorf("Expected the indicator to share the format, got %s", got)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import "sync"
+
+// GapDetector tracks the last trade_id seen per product and counts trades
+// that never reached the pipeline, typically because they happened while the
+// feed was disconnected. Coinbase assigns trade IDs contiguously per product.
+type GapDetector struct {
+	mu          sync.Mutex
+	lastTradeID map[string]int64
+	missed      map[string]int64
+}
+
+func NewGapDetector() *GapDetector {
+	return &GapDetector{
+		lastTradeID: make(map[string]int64),
+		missed:      make(map[string]int64),
+	}
+}
+
+// Observe records a trade that was applied to the calculators and returns
+// how many trade IDs were skipped since the previous one.
+func (g *GapDetector) Observe(productID string, tradeID int64) int64 {
+	return g.record(productID, tradeID, 0)
+}
+
+// Skip records a trade that was seen but not applied, such as the
+// last_match sent on subscribe. Once a baseline exists, it counts as missed
+// itself along with any gap before it.
+func (g *GapDetector) Skip(productID string, tradeID int64) int64 {
+	return g.record(productID, tradeID, 1)
+}
+
+// Missed returns the total number of trades missed for productID.
+func (g *GapDetector) Missed(productID string) int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.missed[productID]
+}
+
+// Recovered records that n trades counted as missed for productID were
+// fetched later and applied after all.
+func (g *GapDetector) Recovered(productID string, n int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.missed[productID] = max(g.missed[productID]-n, 0)
+}
+
+// Forget discards what is known about productID, so that trades missed
+// while it was not tracked are not counted.
+func (g *GapDetector) Forget(productID string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.lastTradeID, productID)
+	delete(g.missed, productID)
+}
+
+func (g *GapDetector) record(productID string, tradeID, unapplied int64) int64 {
+	if tradeID <= 0 {
+		return 0
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	last, seen := g.lastTradeID[productID]
+	if seen && tradeID <= last {
+		return 0
+	}
+	g.lastTradeID[productID] = tradeID
+	if !seen {
+		return 0
+	}
+	missed := tradeID - last - 1 + unapplied
+	g.missed[productID] += missed
+	return missed
+}
@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestGapDetector(t *testing.T) {
+	t.Run("ContiguousTrades", func(t *testing.T) {
+		g := NewGapDetector()
+		for id := int64(1); id <= 5; id++ {
+			if missed := g.Observe("BTC-USD", id); missed != 0 {
+				t.Errorf("Expected no gap at %d, got %d", id, missed)
+			}
+		}
+	})
+
+	t.Run("GapAfterReconnect", func(t *testing.T) {
+		g := NewGapDetector()
+		g.Skip("BTC-USD", 10) // last_match on first subscribe sets the baseline
+		g.Observe("BTC-USD", 11)
+		if missed := g.Skip("BTC-USD", 15); missed != 4 {
+			t.Errorf("Expected 4 missed trades (12-15), got %d", missed)
+		}
+		if missed := g.Observe("BTC-USD", 18); missed != 2 {
+			t.Errorf("Expected 2 missed trades (16-17), got %d", missed)
+		}
+		if total := g.Missed("BTC-USD"); total != 6 {
+			t.Errorf("Expected 6 missed in total, got %d", total)
+		}
+	})
+
+	t.Run("DuplicatesAndOtherProducts", func(t *testing.T) {
+		g := NewGapDetector()
+		g.Observe("BTC-USD", 100)
+		if missed := g.Observe("BTC-USD", 100); missed != 0 {
+			t.Errorf("Expected duplicate to be ignored, got %d", missed)
+		}
+		if missed := g.Observe("ETH-USD", 7); missed != 0 {
+			t.Errorf("Expected products to be tracked independently, got %d", missed)
+		}
+	})
+}
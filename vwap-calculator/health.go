@@ -0,0 +1,158 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// feedHealth tracks the state of the websocket feed for the health
+// endpoints. Other sources (stdin, replay, the simulator) never start it,
+// and are always reported healthy.
+type feedHealth struct {
+	lastMessage atomic.Int64 // unix nanoseconds; zero before the first
+
+	mu         sync.Mutex
+	tracking   bool
+	connected  bool
+	changed    time.Time // when connected last changed
+	reconnects int64
+	now        func() time.Time
+}
+
+func newFeedHealth() *feedHealth {
+	return &feedHealth{now: time.Now}
+}
+
+// start begins tracking a feed that is not yet connected.
+func (h *feedHealth) start() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.tracking = true
+	h.changed = h.now()
+}
+
+func (h *feedHealth) setConnected(connected bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.connected != connected {
+		h.connected = connected
+		h.changed = h.now()
+	}
+}
+
+func (h *feedHealth) reconnect() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.reconnects++
+}
+
+func (h *feedHealth) reconnectCount() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.reconnects
+}
+
+func (h *feedHealth) message() {
+	h.lastMessage.Store(h.now().UnixNano())
+}
+
+// healthReport is the body of /healthz and /readyz.
+type healthReport struct {
+	Status    string `json:"status"`
+	Connected bool   `json:"connected"`
+	// StateAge is how long the feed has been connected, or disconnected.
+	StateAge       string                   `json:"state_age,omitempty"`
+	LastMessageAge string                   `json:"last_message_age,omitempty"`
+	Reconnects     int64                    `json:"reconnects"`
+	Products       map[string]productHealth `json:"products"`
+}
+
+type productHealth struct {
+	TradeCount   int64  `json:"trade_count"`
+	LastTradeAge string `json:"last_trade_age,omitempty"`
+}
+
+// healthChecks decides readiness and liveness from the feed's state. The feed
+// is ready while it is connected and messages arrive within readyWithin. It
+// is live unless it has been unready for longer than grace.
+type healthChecks struct {
+	pipeline    *Pipeline
+	readyWithin time.Duration
+	grace       time.Duration
+}
+
+// report returns the feed's state and whether it is ready and live.
+func (c healthChecks) report() (report healthReport, ready, live bool) {
+	h := c.pipeline.health
+	now := h.now()
+	h.mu.Lock()
+	tracking, connected, changed, reconnects := h.tracking, h.connected, h.changed, h.reconnects
+	h.mu.Unlock()
+
+	report = healthReport{Connected: connected, Reconnects: reconnects, Products: make(map[string]productHealth)}
+	for productID, calculator := range c.pipeline.Calculators() {
+		product := productHealth{TradeCount: calculator.TradeCount()}
+		if last := calculator.Stats().LastTrade; !last.IsZero() {
+			product.LastTradeAge = now.Sub(last).Round(time.Millisecond).String()
+		}
+		report.Products[productID] = product
+	}
+	if !tracking {
+		report.Status = "ok"
+		return report, true, true
+	}
+
+	report.StateAge = now.Sub(changed).Round(time.Millisecond).String()
+	// A connection that has been quiet since it opened counts from when it
+	// opened, not from the previous connection's last message.
+	lastActivity := changed
+	if nanos := h.lastMessage.Load(); nanos != 0 {
+		last := time.Unix(0, nanos)
+		report.LastMessageAge = now.Sub(last).Round(time.Millisecond).String()
+		if last.After(lastActivity) {
+			lastActivity = last
+		}
+	}
+	var unreadySince time.Time
+	switch {
+	case !connected:
+		unreadySince = changed
+	case c.readyWithin > 0 && now.Sub(lastActivity) > c.readyWithin:
+		unreadySince = lastActivity.Add(c.readyWithin)
+	default:
+		ready = true
+	}
+	live = ready || c.grace <= 0 || now.Sub(unreadySince) <= c.grace
+	switch {
+	case ready:
+		report.Status = "ok"
+	case live:
+		report.Status = "degraded"
+	default:
+		report.Status = "down"
+	}
+	return report, ready, live
+}
+
+// addHealthRoutes serves /readyz, which fails while the feed is disconnected
+// or silent, and /healthz, which fails once that has lasted past the grace
+// period so an orchestrator can restart the process.
+func addHealthRoutes(mux *http.ServeMux, checks healthChecks) {
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		report, _, live := checks.report()
+		writeJSON(w, healthStatus(live), report)
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		report, ready, _ := checks.report()
+		writeJSON(w, healthStatus(ready), report)
+	})
+}
+
+func healthStatus(ok bool) int {
+	if ok {
+		return http.StatusOK
+	}
+	return http.StatusServiceUnavailable
+}
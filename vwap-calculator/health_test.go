@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthChecks(t *testing.T) {
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	pipeline.health.now = func() time.Time { return now }
+	checks := healthChecks{pipeline: pipeline, readyWithin: 15 * time.Second, grace: time.Minute}
+
+	check := func(name string, wantStatus string, wantReady, wantLive bool) {
+		t.Helper()
+		report, ready, live := checks.report()
+		if report.Status != wantStatus || ready != wantReady || live != wantLive {
+			t.Errorf("%s: expected %s (ready %v, live %v), got %s (ready %v, live %v)", name, wantStatus, wantReady, wantLive, report.Status, ready, live)
+		}
+	}
+	check("Untracked", "ok", true, true)
+
+	pipeline.health.start()
+	check("Connecting", "degraded", false, true)
+	now = now.Add(2 * time.Minute)
+	check("Never connected", "down", false, false)
+
+	pipeline.health.setConnected(true)
+	check("Connected", "ok", true, true)
+	now = now.Add(10 * time.Second)
+	pipeline.health.message()
+	now = now.Add(10 * time.Second)
+	check("Recent message", "ok", true, true)
+	now = now.Add(30 * time.Second)
+	check("Silent", "degraded", false, true)
+	now = now.Add(time.Minute)
+	check("Silent past grace", "down", false, false)
+
+	pipeline.health.setConnected(false)
+	pipeline.health.reconnect()
+	check("Disconnected", "degraded", false, true)
+	if report, _, _ := checks.report(); report.Reconnects != 1 || report.LastMessageAge != "1m40s" {
+		t.Errorf("Unexpected report %+v", report)
+	}
+}
+
+func TestHealthRoutes(t *testing.T) {
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	pipeline.calculators["BTC-USD"].Update("100", "1")
+	mux := http.NewServeMux()
+	addHealthRoutes(mux, healthChecks{pipeline: pipeline, readyWithin: 15 * time.Second, grace: time.Minute})
+	pipeline.health.start()
+
+	for path, want := range map[string]int{"/healthz": http.StatusOK, "/readyz": http.StatusServiceUnavailable} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != want {
+			t.Errorf("Expected %s to return %d, got %d", path, want, rec.Code)
+		}
+		var report healthReport
+		if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		if report.Connected || report.Products["BTC-USD"].TradeCount != 1 || report.Products["BTC-USD"].LastTradeAge == "" {
+			t.Errorf("Unexpected %s report %+v", path, report)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// VWAPHistory keeps each product's recent VWAP updates so the VWAP in effect
+// at a past time can be looked up, e.g. to reconcile execution reports. It
+// is a Sink.
+type VWAPHistory struct {
+	retention time.Duration // how far back from the newest update to keep
+	limit     int           // most updates kept per product; 0 is unlimited
+
+	mu      sync.RWMutex
+	updates map[string][]VWAPUpdate // oldest first
+}
+
+func NewVWAPHistory(retention time.Duration, limit int) *VWAPHistory {
+	return &VWAPHistory{retention: retention, limit: limit, updates: make(map[string][]VWAPUpdate)}
+}
+
+func (h *VWAPHistory) Publish(update VWAPUpdate) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	updates := append(h.updates[update.ProductID], update)
+	// Keep the update in effect at the cutoff, so At answers for the whole
+	// retention period.
+	cutoff := update.Time.Add(-h.retention)
+	expired := max(sort.Search(len(updates), func(i int) bool { return updates[i].Time.After(cutoff) })-1, 0)
+	if h.limit > 0 && len(updates)-expired > h.limit {
+		expired = len(updates) - h.limit
+	}
+	h.updates[update.ProductID] = updates[expired:]
+	return nil
+}
+
+// At returns productID's update in effect at t: the last one published at or
+// before it. It reports false when t is before the oldest update kept.
+func (h *VWAPHistory) At(productID string, t time.Time) (VWAPUpdate, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	updates := h.updates[productID]
+	i := sort.Search(len(updates), func(i int) bool { return updates[i].Time.After(t) })
+	if i == 0 {
+		return VWAPUpdate{}, false
+	}
+	return updates[i-1], true
+}
+
+// Range returns productID's updates published between start and end
+// inclusive, oldest first. A zero start or end leaves that side open.
+func (h *VWAPHistory) Range(productID string, start, end time.Time) []VWAPUpdate {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	updates := h.updates[productID]
+	from := sort.Search(len(updates), func(i int) bool { return !updates[i].Time.Before(start) })
+	to := len(updates)
+	if !end.IsZero() {
+		to = sort.Search(len(updates), func(i int) bool { return updates[i].Time.After(end) })
+	}
+	if from >= to {
+		return []VWAPUpdate{}
+	}
+	return append([]VWAPUpdate{}, updates[from:to]...)
+}
+
+// ServeHTTP handles GET /vwap/{product}/history. With at, in RFC 3339, it
+// returns the single update in effect then; otherwise the updates between
+// start and end, of which limit keeps the most recent.
+func (h *VWAPHistory) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	productID := r.PathValue("product")
+	var times [3]time.Time
+	for i, name := range []string{"at", "start", "end"} {
+		if s := query.Get(name); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid " + name + " " + s})
+				return
+			}
+			times[i] = t
+		}
+	}
+	if at := times[0]; !at.IsZero() {
+		update, ok := h.At(productID, at)
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "no VWAP for product " + productID + " at " + at.Format(time.RFC3339Nano)})
+			return
+		}
+		writeJSON(w, http.StatusOK, update)
+		return
+	}
+	limit := 0
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid limit " + s})
+			return
+		}
+		limit = n
+	}
+	updates := h.Range(productID, times[1], times[2])
+	if limit > 0 && len(updates) > limit {
+		updates = updates[len(updates)-limit:]
+	}
+	writeJSON(w, http.StatusOK, updates)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestVWAPHistory(t *testing.T) {
+	history := NewVWAPHistory(time.Hour, 3)
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, vwap := range []string{"100", "101", "102"} {
+		history.Publish(VWAPUpdate{ProductID: "BTC-USD", VWAP: vwap, Time: start.Add(time.Duration(i) * time.Minute)})
+	}
+
+	cases := []struct {
+		at   time.Duration
+		want string
+	}{
+		{0, "100"},
+		{90 * time.Second, "101"},
+		{2 * time.Minute, "102"},
+		{time.Hour, "102"},
+	}
+	for _, tc := range cases {
+		if update, ok := history.At("BTC-USD", start.Add(tc.at)); !ok || update.VWAP != tc.want {
+			t.Errorf("At +%v: expected %s, got %+v", tc.at, tc.want, update)
+		}
+	}
+	if _, ok := history.At("BTC-USD", start.Add(-time.Second)); ok {
+		t.Error("Expected no VWAP before the first update")
+	}
+	if updates := history.Range("BTC-USD", start.Add(time.Minute), time.Time{}); len(updates) != 2 || updates[0].VWAP != "101" {
+		t.Errorf("Unexpected range %+v", updates)
+	}
+
+	// The limit drops the oldest update. Once an update is an hour newer,
+	// the retention drops those before the one in effect an hour earlier.
+	history.Publish(VWAPUpdate{ProductID: "BTC-USD", VWAP: "103", Time: start.Add(3 * time.Minute)})
+	if _, ok := history.At("BTC-USD", start); ok {
+		t.Error("Expected the oldest update to be dropped past the limit")
+	}
+	history.Publish(VWAPUpdate{ProductID: "BTC-USD", VWAP: "104", Time: start.Add(62 * time.Minute)})
+	if updates := history.Range("BTC-USD", time.Time{}, time.Time{}); len(updates) != 3 || updates[0].VWAP != "102" {
+		t.Errorf("Expected updates older than an hour to expire, got %+v", updates)
+	}
+	if update, ok := history.At("BTC-USD", start.Add(2*time.Minute)); !ok || update.VWAP != "102" {
+		t.Errorf("Expected the VWAP an hour back to be kept, got %+v", update)
+	}
+}
+
+func TestVWAPHistoryHTTP(t *testing.T) {
+	history := NewVWAPHistory(time.Hour, 0)
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, vwap := range []string{"100", "101", "102"} {
+		history.Publish(VWAPUpdate{ProductID: "BTC-USD", VWAP: vwap, Time: start.Add(time.Duration(i) * time.Minute)})
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /vwap/{product}/history", history)
+
+	get := func(target string, v any) int {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		json.NewDecoder(rec.Body).Decode(v)
+		return rec.Code
+	}
+	var update VWAPUpdate
+	if code := get("/vwap/BTC-USD/history?at=2024-01-01T12:01:30Z", &update); code != http.StatusOK || update.VWAP != "101" {
+		t.Errorf("Unexpected point-in-time response %d %+v", code, update)
+	}
+	if code := get("/vwap/BTC-USD/history?at=2024-01-01T11:00:00Z", &update); code != http.StatusNotFound {
+		t.Errorf("Expected 404 before the first update, got %d", code)
+	}
+	var updates []VWAPUpdate
+	if code := get("/vwap/BTC-USD/history?start=2024-01-01T12:00:30Z&limit=1", &updates); code != http.StatusOK || len(updates) != 1 || updates[0].VWAP != "102" {
+		t.Errorf("Unexpected range response %d %+v", code, updates)
+	}
+	for _, target := range []string{"/vwap/BTC-USD/history?at=noon", "/vwap/BTC-USD/history?limit=0"} {
+		if code := get(target, &updates); code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", target, code)
+		}
+	}
+}
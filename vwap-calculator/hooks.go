@@ -0,0 +1,54 @@
+package main
+
+// Hooks are callbacks for code that embeds the pipeline and wants to act on
+// its trades, updates and errors directly, without writing a Sink. They are
+// called synchronously on the goroutine processing the product, so they
+// must not block, and with product workers they run concurrently for
+// different products.
+type Hooks struct {
+	// OnTrade is called with every trade passed to the trade sinks: trades
+	// accepted into a calculator, and trades outside a product's trading
+	// hours.
+	OnTrade func(trade Trade)
+	// OnVWAPUpdate is called with every update published, including
+	// synthetic cross rates.
+	OnVWAPUpdate func(update VWAPUpdate)
+	// OnError is called with errors the pipeline logs and carries on past:
+	// malformed messages, failed sink writes, exchange errors, failed gap
+	// fills and dropped feed connections. productID is empty for errors not
+	// tied to one product.
+	OnError func(productID string, err error)
+}
+
+// SetHooks registers hooks, any of which may be nil. Call it once, before
+// streaming starts.
+func (p *Pipeline) SetHooks(hooks Hooks) {
+	p.hooks = hooks
+	if hooks.OnTrade != nil {
+		p.AddTradeSink(tradeHook(hooks.OnTrade))
+	}
+	if hooks.OnVWAPUpdate != nil {
+		p.AddSink(updateHook(hooks.OnVWAPUpdate))
+	}
+}
+
+// reportError passes err to the OnError hook, if one is set.
+func (p *Pipeline) reportError(productID string, err error) {
+	if p.hooks.OnError != nil {
+		p.hooks.OnError(productID, err)
+	}
+}
+
+type tradeHook func(Trade)
+
+func (h tradeHook) RecordTrade(trade Trade) error {
+	h(trade)
+	return nil
+}
+
+type updateHook func(VWAPUpdate)
+
+func (h updateHook) Publish(update VWAPUpdate) error {
+	h(update)
+	return nil
+}
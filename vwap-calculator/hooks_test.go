@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+type failingSink struct{}
+
+func (failingSink) Publish(VWAPUpdate) error { return errQueueFull }
+
+func TestPipelineHooks(t *testing.T) {
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"), failingSink{})
+	var (
+		trades  []Trade
+		updates []VWAPUpdate
+		errs    []string
+	)
+	pipeline.SetHooks(Hooks{
+		OnTrade:      func(trade Trade) { trades = append(trades, trade) },
+		OnVWAPUpdate: func(update VWAPUpdate) { updates = append(updates, update) },
+		OnError: func(productID string, err error) {
+			if errors.Is(err, errQueueFull) && productID != "BTC-USD" {
+				t.Errorf("Expected the sink error for BTC-USD, got %q", productID)
+			}
+			errs = append(errs, err.Error())
+		},
+	})
+
+	ctx := context.Background()
+	pipeline.processMessage(ctx, []byte(`{"type":"match","product_id":"BTC-USD","trade_id":1,"price":"100","size":"2"}`))
+	pipeline.processMessage(ctx, []byte(`{"type":"match","product_id":"BTC-USD","trade_id":2,"price":"oops","size":"1"}`))
+	pipeline.processMessage(ctx, []byte(`not json`))
+
+	if len(trades) != 1 || trades[0].TradeID != 1 {
+		t.Errorf("Expected OnTrade for the accepted trade, got %v", trades)
+	}
+	if len(updates) != 1 || updates[0].VWAP != "100.0000" {
+		t.Errorf("Expected OnVWAPUpdate for the update, got %v", updates)
+	}
+	want := []string{"publish failed", "Update failed", "JSON decode error"}
+	if len(errs) != len(want) {
+		t.Fatalf("Expected %d errors, got %q", len(want), errs)
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(errs[i], prefix) {
+			t.Errorf("Expected error %d to start %q, got %q", i, prefix, errs[i])
+		}
+	}
+}
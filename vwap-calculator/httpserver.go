@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store keeps the latest VWAP update per product so it can be served over HTTP.
+type Store struct {
+	mu     sync.RWMutex
+	latest map[string]VWAPUpdate
+}
+
+func NewStore() *Store {
+	return &Store{latest: make(map[string]VWAPUpdate)}
+}
+
+func (s *Store) Publish(update VWAPUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latest[update.ProductID] = update
+	return nil
+}
+
+func (s *Store) Get(productID string) (VWAPUpdate, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	update, ok := s.latest[productID]
+	return update, ok
+}
+
+// All returns the latest update for every product, ordered by product ID.
+func (s *Store) All() []VWAPUpdate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	updates := make([]VWAPUpdate, 0, len(s.latest))
+	for _, update := range s.latest {
+		updates = append(updates, update)
+	}
+	sort.Slice(updates, func(i, j int) bool { return updates[i].ProductID < updates[j].ProductID })
+	return updates
+}
+
+func newHTTPHandler(store *Store) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /vwap", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, store.All())
+	})
+	mux.HandleFunc("GET /vwap/{product}", func(w http.ResponseWriter, r *http.Request) {
+		update, ok := store.Get(r.PathValue("product"))
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "no VWAP for product " + r.PathValue("product")})
+			return
+		}
+		writeJSON(w, http.StatusOK, update)
+	})
+	return mux
+}
+
+// calculatorState is a product's calculator as served by /calculators.
+type calculatorState struct {
+	ProductID  string    `json:"product_id"`
+	Method     string    `json:"method"`
+	WindowSize int       `json:"window_size,omitempty"`
+	TradeCount int64     `json:"trade_count"`
+	Volume     string    `json:"volume,omitempty"`
+	Notional   string    `json:"notional,omitempty"`
+	WindowSpan string    `json:"window_span"`
+	LastTrade  time.Time `json:"last_trade"`
+}
+
+func newCalculatorState(productID string, c Calculator) calculatorState {
+	stats := c.Stats()
+	return calculatorState{
+		ProductID:  productID,
+		Method:     calculatorMethod(c),
+		WindowSize: windowSizeOf(c),
+		TradeCount: c.TradeCount(),
+		Volume:     stats.Volume,
+		Notional:   stats.Notional,
+		WindowSpan: stats.WindowSpan.String(),
+		LastTrade:  stats.LastTrade,
+	}
+}
+
+// addCalculatorRoutes serves the state of each product's calculator.
+func addCalculatorRoutes(mux *http.ServeMux, pipeline *Pipeline) {
+	mux.HandleFunc("GET /calculators", func(w http.ResponseWriter, r *http.Request) {
+		calculators := pipeline.Calculators()
+		states := make([]calculatorState, 0, len(calculators))
+		for productID, c := range calculators {
+			states = append(states, newCalculatorState(productID, c))
+		}
+		sort.Slice(states, func(i, j int) bool { return states[i].ProductID < states[j].ProductID })
+		writeJSON(w, http.StatusOK, states)
+	})
+	mux.HandleFunc("GET /calculators/{product}", func(w http.ResponseWriter, r *http.Request) {
+		c, _, ok := pipeline.calculator(r.PathValue("product"))
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown product " + r.PathValue("product")})
+			return
+		}
+		writeJSON(w, http.StatusOK, newCalculatorState(r.PathValue("product"), c))
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
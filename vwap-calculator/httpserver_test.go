@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	store := NewStore()
+	store.Publish(VWAPUpdate{ProductID: "ETH-USD", VWAP: "3000.0000", WindowSize: windowSize, TradeCount: 2, Time: time.Now()})
+	store.Publish(VWAPUpdate{ProductID: "BTC-USD", VWAP: "45000.0000", WindowSize: windowSize, TradeCount: 1, Time: time.Now()})
+	handler := newHTTPHandler(store)
+
+	t.Run("AllProducts", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/vwap", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rec.Code)
+		}
+		var updates []VWAPUpdate
+		if err := json.NewDecoder(rec.Body).Decode(&updates); err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		if len(updates) != 2 || updates[0].ProductID != "BTC-USD" {
+			t.Errorf("Expected BTC-USD first of 2 updates, got %+v", updates)
+		}
+	})
+
+	t.Run("SingleProduct", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/vwap/ETH-USD", nil))
+		var update VWAPUpdate
+		if err := json.NewDecoder(rec.Body).Decode(&update); err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		if update.VWAP != "3000.0000" || update.TradeCount != 2 {
+			t.Errorf("Unexpected update: %+v", update)
+		}
+	})
+
+	t.Run("UnknownProduct", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/vwap/DOGE-USD", nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Expected 404, got %d", rec.Code)
+		}
+	})
+}
+
+func TestCalculatorRoutes(t *testing.T) {
+	calc := NewVWAPCalculator()
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": calc}, nil)
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	calc.UpdateAt("100", "1", at)
+	calc.UpdateAt("110", "0.5", at.Add(90*time.Second))
+	mux := http.NewServeMux()
+	addCalculatorRoutes(mux, pipeline)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/calculators/BTC-USD/reset", nil))
+	if rec.Code != http.StatusNotFound || calc.TradeCount() != 2 {
+		t.Errorf("Expected no reset on the public API, got %d with %d trades", rec.Code, calc.TradeCount())
+	}
+	addAdminRoutes(mux, &productAdmin{cfg: &Config{}, pipeline: pipeline})
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/calculators/BTC-USD", nil))
+	var state calculatorState
+	if err := json.NewDecoder(rec.Body).Decode(&state); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if state.TradeCount != 2 || state.Volume != "1.50000000" || state.Notional != "155.00000000" || state.WindowSpan != "1m30s" || state.Method != "vwap" {
+		t.Errorf("Unexpected state: %+v", state)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/calculators/BTC-USD/reset", nil))
+	if rec.Code != http.StatusOK || calc.TradeCount() != 0 || calc.Calculate() != "0" {
+		t.Errorf("Expected the calculator to be reset, got %d with %d trades", rec.Code, calc.TradeCount())
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/calculators/DOGE-USD/reset", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", rec.Code)
+	}
+}
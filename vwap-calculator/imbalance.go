@@ -0,0 +1,148 @@
+package main
+
+import (
+	"math/big"
+	"sync"
+	"time"
+)
+
+// imbalancePlaces is the precision of the imbalance ratio.
+const imbalancePlaces = 4
+
+// TradeCalculator is implemented by calculators that need more of a trade
+// than its price and size, such as its side.
+type TradeCalculator interface {
+	Calculator
+	UpdateTrade(trade Trade) error
+}
+
+// ImbalanceCalculator splits the volume of a window of recent trades by
+// aggressor and reports (buy - sell) / (buy + sell): 1 when every trade in
+// the window was a taker buying, -1 when every one was a taker selling.
+// Trade sides name the maker order, as in the Exchange feed's matches, so a
+// "sell" trade is an aggressive buy. Trades with no side count towards
+// neither.
+type ImbalanceCalculator struct {
+	mu    sync.Mutex
+	sizes []big.Rat // signed sizes: positive for buys, negative for sells
+	next  int
+	count int
+	buy   big.Rat
+	sell  big.Rat
+	clock tradeClock
+}
+
+// NewImbalanceCalculator returns an ImbalanceCalculator over the last size
+// trades.
+func NewImbalanceCalculator(size int) *ImbalanceCalculator {
+	return &ImbalanceCalculator{sizes: make([]big.Rat, size), clock: newTradeClock(size)}
+}
+
+// Update has no side to go on, so the trade only takes up a place in the
+// window.
+func (c *ImbalanceCalculator) Update(priceStr, sizeStr string) error {
+	return c.UpdateTrade(Trade{Price: priceStr, Size: sizeStr, Time: time.Now()})
+}
+
+func (c *ImbalanceCalculator) UpdateTrade(trade Trade) error {
+	if _, err := parsePrice(trade.Price, trade.Size); err != nil {
+		return err
+	}
+	size, _ := new(big.Rat).SetString(trade.Size)
+	switch trade.Side {
+	case "sell":
+	case "buy":
+		size.Neg(size)
+	default:
+		size.SetInt64(0)
+	}
+	at := trade.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.count == len(c.sizes) {
+		c.remove(&c.sizes[c.next])
+	} else {
+		c.count++
+	}
+	c.sizes[c.next].Set(size)
+	c.add(size)
+	c.next = (c.next + 1) % len(c.sizes)
+	c.clock.add(at)
+	return nil
+}
+
+// add and remove move a signed size in or out of the totals. c.mu must be
+// held.
+func (c *ImbalanceCalculator) add(size *big.Rat) {
+	switch size.Sign() {
+	case 1:
+		c.buy.Add(&c.buy, size)
+	case -1:
+		c.sell.Sub(&c.sell, size)
+	}
+}
+
+func (c *ImbalanceCalculator) remove(size *big.Rat) {
+	switch size.Sign() {
+	case 1:
+		c.buy.Sub(&c.buy, size)
+	case -1:
+		c.sell.Add(&c.sell, size)
+	}
+}
+
+func (c *ImbalanceCalculator) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.next, c.count = 0, 0
+	c.buy.SetInt64(0)
+	c.sell.SetInt64(0)
+	c.clock.reset()
+}
+
+func (c *ImbalanceCalculator) TradeCount() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clock.trades
+}
+
+// Stats reports the volume with a side; the imbalance ignores prices, so
+// Notional is empty.
+func (c *ImbalanceCalculator) Stats() CalculatorStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clock.stats(volumeString(new(big.Rat).Add(&c.buy, &c.sell)), "")
+}
+
+// Calculate returns the imbalance ratio, 0 while the window has no volume
+// with a side.
+func (c *ImbalanceCalculator) Calculate() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ratio()
+}
+
+func (c *ImbalanceCalculator) Values() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return map[string]string{
+		"ratio":       c.ratio(),
+		"buy_volume":  volumeString(&c.buy),
+		"sell_volume": volumeString(&c.sell),
+	}
+}
+
+// ratio returns (buy - sell) / (buy + sell) to four places, whatever the
+// product's price precision. c.mu must be held.
+func (c *ImbalanceCalculator) ratio() string {
+	total := new(big.Rat).Add(&c.buy, &c.sell)
+	if total.Sign() == 0 {
+		return "0"
+	}
+	diff := new(big.Rat).Sub(&c.buy, &c.sell)
+	return diff.Quo(diff, total).FloatString(imbalancePlaces)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestImbalanceCalculator(t *testing.T) {
+	c := NewImbalanceCalculator(3)
+	if got := c.Calculate(); got != "0" {
+		t.Errorf("Expected 0 with no trades, got %s", got)
+	}
+	for _, trade := range []Trade{
+		{Price: "100", Size: "3", Side: "sell"}, // taker buy
+		{Price: "100", Size: "1", Side: "buy"},  // taker sell
+		{Price: "100", Size: "5"},               // no side
+	} {
+		if err := c.UpdateTrade(trade); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := c.Calculate(); got != "0.5000" {
+		t.Errorf("Expected (3-1)/(3+1) = 0.5000, got %s", got)
+	}
+	// The first trade leaves the window.
+	c.UpdateTrade(Trade{Price: "100", Size: "2", Side: "buy"})
+	values := c.Values()
+	if values["ratio"] != "-1.0000" || values["buy_volume"] != "0.00000000" || values["sell_volume"] != "3.00000000" {
+		t.Errorf("Unexpected values %v", values)
+	}
+	if err := c.UpdateTrade(Trade{Price: "100", Size: "-1", Side: "buy"}); err == nil {
+		t.Error("Expected an error for a negative size")
+	}
+	c.Reset()
+	if c.Calculate() != "0" || c.TradeCount() != 0 {
+		t.Errorf("Expected Reset to clear the window, got %s after %d trades", c.Calculate(), c.TradeCount())
+	}
+}
+
+func TestPipelineImbalance(t *testing.T) {
+	store := NewStore()
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"), store)
+	pipeline.AddIndicator("BTC-USD", "imbalance", NewImbalanceCalculator(200))
+
+	ctx := context.Background()
+	pipeline.processMessage(ctx, []byte(`{"type":"match","product_id":"BTC-USD","trade_id":1,"price":"100","size":"1","side":"sell"}`))
+	// A ticker's side is the taker's: this is an aggressive sell.
+	pipeline.SetTradeChannel(channelTicker)
+	pipeline.processMessage(ctx, []byte(`{"type":"ticker","product_id":"BTC-USD","trade_id":2,"price":"100","last_size":"3","side":"sell"}`))
+
+	update, _ := store.Get("BTC-USD")
+	if update.Indicators["imbalance_ratio"] != "-0.5000" || update.Indicators["imbalance_sell_volume"] != "3.00000000" {
+		t.Errorf("Unexpected indicators %v", update.Indicators)
+	}
+}
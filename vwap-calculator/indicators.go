@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// indicator is a secondary Calculator run on a product's trades alongside its
+// main average. Its value is reported in VWAPUpdate.Indicators under name.
+type indicator struct {
+	name       string
+	calculator Calculator
+}
+
+// AddIndicator runs calculator on every trade accepted for productID and
+// includes its value, keyed by name, in the product's updates.
+func (p *Pipeline) AddIndicator(productID, name string, calculator Calculator) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.indicators[productID] = append(p.indicators[productID], indicator{name: name, calculator: calculator})
+}
+
+func parsePrice(priceStr, sizeStr string) (*big.Rat, error) {
+	price, ok1 := new(big.Rat).SetString(priceStr)
+	size, ok2 := new(big.Rat).SetString(sizeStr)
+	if !ok1 || !ok2 || price.Sign() <= 0 || size.Sign() <= 0 {
+		return nil, errors.New("invalid trade data: price and size must be positive rational numbers")
+	}
+	return price, nil
+}
+
+// SMACalculator is the simple moving average of the last period trade prices.
+type SMACalculator struct {
+	mu     sync.Mutex
+	prices []big.Rat
+	next   int
+	count  int
+	total  big.Rat
+	clock  tradeClock
+	formatted
+}
+
+func NewSMACalculator(period int) *SMACalculator {
+	return &SMACalculator{prices: make([]big.Rat, period), clock: newTradeClock(period)}
+}
+
+func (c *SMACalculator) Update(priceStr, sizeStr string) error {
+	return c.UpdateAt(priceStr, sizeStr, time.Now())
+}
+
+func (c *SMACalculator) UpdateAt(priceStr, sizeStr string, at time.Time) error {
+	price, err := parsePrice(priceStr, sizeStr)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.count == len(c.prices) {
+		c.total.Sub(&c.total, &c.prices[c.next])
+	} else {
+		c.count++
+	}
+	c.prices[c.next].Set(price)
+	c.total.Add(&c.total, price)
+	c.next = (c.next + 1) % len(c.prices)
+	c.clock.add(at)
+	return nil
+}
+
+func (c *SMACalculator) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.next, c.count = 0, 0
+	c.total.SetInt64(0)
+	c.clock.reset()
+}
+
+func (c *SMACalculator) TradeCount() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clock.trades
+}
+
+// Stats leaves Volume empty: the moving average ignores trade sizes.
+func (c *SMACalculator) Stats() CalculatorStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clock.stats("", "")
+}
+
+func (c *SMACalculator) Calculate() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.count == 0 {
+		return "0"
+	}
+	return c.formatRat(new(big.Rat).Quo(&c.total, big.NewRat(int64(c.count), 1)))
+}
+
+// EMACalculator is the exponential moving average of trade prices with
+// smoothing factor 2/(period+1), seeded with the first price. It uses floats:
+// exact rationals would grow without bound.
+type EMACalculator struct {
+	mu     sync.Mutex
+	alpha  float64
+	value  float64
+	primed bool
+	clock  tradeClock
+	formatted
+}
+
+func NewEMACalculator(period int) *EMACalculator {
+	return &EMACalculator{alpha: 2 / float64(period+1)}
+}
+
+func (c *EMACalculator) Update(priceStr, sizeStr string) error {
+	return c.UpdateAt(priceStr, sizeStr, time.Now())
+}
+
+func (c *EMACalculator) UpdateAt(priceStr, sizeStr string, at time.Time) error {
+	rat, err := parsePrice(priceStr, sizeStr)
+	if err != nil {
+		return err
+	}
+	price, _ := rat.Float64()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clock.add(at)
+	if !c.primed {
+		c.value, c.primed = price, true
+		return nil
+	}
+	c.value += c.alpha * (price - c.value)
+	return nil
+}
+
+func (c *EMACalculator) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.value, c.primed = 0, false
+	c.clock.reset()
+}
+
+func (c *EMACalculator) TradeCount() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clock.trades
+}
+
+// Stats leaves Volume empty: the moving average ignores trade sizes. Its
+// window spans every trade since the first.
+func (c *EMACalculator) Stats() CalculatorStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clock.stats("", "")
+}
+
+func (c *EMACalculator) Calculate() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.primed {
+		return "0"
+	}
+	return c.formatFloat64(c.value)
+}
+
+// periodList is a flag holding a comma-separated list of positive periods.
+type periodList []int
+
+func (l *periodList) String() string {
+	parts := make([]string, len(*l))
+	for i, n := range *l {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *periodList) Set(s string) error {
+	for _, part := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid period %q: must be a positive integer", part)
+		}
+		*l = append(*l, n)
+	}
+	return nil
+}
+
+// formatIndicators renders indicator values as "name=value" pairs in name
+// order.
+func formatIndicators(values map[string]string) string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + "=" + values[name]
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestSMACalculator(t *testing.T) {
+	calc := NewSMACalculator(3)
+	if got := calc.Calculate(); got != "0" {
+		t.Errorf("Expected 0 before any trades, got %s", got)
+	}
+	for i, tc := range []struct{ price, want string }{
+		{"10", "10.0000"},
+		{"20", "15.0000"},
+		{"30", "20.0000"},
+		{"40", "30.0000"},
+		{"5", "25.0000"},
+	} {
+		if err := calc.Update(tc.price, "1"); err != nil {
+			t.Fatal(err)
+		}
+		if got := calc.Calculate(); got != tc.want {
+			t.Errorf("After trade %d: expected %s, got %s", i, tc.want, got)
+		}
+	}
+	if err := calc.Update("0", "1"); err == nil {
+		t.Error("Expected error for zero price")
+	}
+}
+
+func TestEMACalculator(t *testing.T) {
+	calc := NewEMACalculator(3) // alpha = 0.5
+	for i, tc := range []struct{ price, want string }{
+		{"10", "10.0000"},
+		{"20", "15.0000"},
+		{"30", "22.5000"},
+		{"10", "16.2500"},
+	} {
+		if err := calc.Update(tc.price, "1"); err != nil {
+			t.Fatal(err)
+		}
+		if got := calc.Calculate(); got != tc.want {
+			t.Errorf("After trade %d: expected %s, got %s", i, tc.want, got)
+		}
+	}
+}
+
+func TestPipelineIndicators(t *testing.T) {
+	store := NewStore()
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"), store)
+	pipeline.AddIndicator("BTC-USD", "sma2", NewSMACalculator(2))
+	pipeline.AddIndicator("BTC-USD", "ema2", NewEMACalculator(2))
+
+	ctx := context.Background()
+	pipeline.processMessage(ctx, []byte(`{"type":"match","product_id":"BTC-USD","trade_id":1,"price":"100","size":"3"}`))
+	pipeline.processMessage(ctx, []byte(`{"type":"match","product_id":"BTC-USD","trade_id":2,"price":"400","size":"1"}`))
+
+	update, _ := store.Get("BTC-USD")
+	if update.VWAP != "175.0000" || update.Indicators["sma2"] != "250.0000" || update.Indicators["ema2"] != "300.0000" {
+		t.Errorf("Unexpected update %+v", update)
+	}
+	if got := formatIndicators(update.Indicators); got != "ema2=300.0000 sma2=250.0000" {
+		t.Errorf("Unexpected formatting %q", got)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InfluxConfig locates an InfluxDB v2 bucket.
+type InfluxConfig struct {
+	URL    string
+	Org    string
+	Bucket string
+	Token  string
+}
+
+// InfluxSink writes VWAP updates and trade volumes to InfluxDB using the
+// line protocol, batching points from a background goroutine.
+type InfluxSink struct {
+	writeURL string
+	token    string
+	client   *http.Client
+	queue    *batchQueue[string]
+	logger   Logger
+}
+
+func NewInfluxSink(cfg InfluxConfig, logger Logger) *InfluxSink {
+	query := url.Values{"org": {cfg.Org}, "bucket": {cfg.Bucket}, "precision": {"ns"}}
+	s := &InfluxSink{
+		writeURL: strings.TrimRight(cfg.URL, "/") + "/api/v2/write?" + query.Encode(),
+		token:    cfg.Token,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		logger:   logger,
+	}
+	s.queue = newBatchQueue(storageQueueSize, storageBatchSize, storageFlushWait, func(lines []string) {
+		if err := s.write(lines); err != nil {
+			s.logger.Errorf("Writing %d points to InfluxDB failed: %v", len(lines), err)
+		}
+	})
+	return s
+}
+
+func (s *InfluxSink) Publish(update VWAPUpdate) error {
+	vwap, err := strconv.ParseFloat(update.VWAP, 64)
+	if err != nil {
+		return fmt.Errorf("influx: %w", err)
+	}
+	line := fmt.Sprintf("vwap,product=%s vwap=%s,window_size=%di,trade_count=%di %d",
+		escapeTag(update.ProductID), strconv.FormatFloat(vwap, 'f', -1, 64),
+		update.WindowSize, update.TradeCount, update.Time.UnixNano())
+	return s.enqueue(line)
+}
+
+func (s *InfluxSink) RecordTrade(trade Trade) error {
+	price, err1 := strconv.ParseFloat(trade.Price, 64)
+	size, err2 := strconv.ParseFloat(trade.Size, 64)
+	if err1 != nil || err2 != nil {
+		return fmt.Errorf("influx: unparseable trade %s @ %s", trade.Size, trade.Price)
+	}
+	ts := trade.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	tags := "product=" + escapeTag(trade.ProductID)
+	if trade.Side != "" {
+		tags += ",side=" + escapeTag(trade.Side)
+	}
+	line := fmt.Sprintf("trade_volume,%s size=%s,price=%s,notional=%s %d", tags,
+		strconv.FormatFloat(size, 'f', -1, 64), strconv.FormatFloat(price, 'f', -1, 64),
+		strconv.FormatFloat(price*size, 'f', -1, 64), ts.UnixNano())
+	return s.enqueue(line)
+}
+
+// Close flushes queued points.
+func (s *InfluxSink) Close() error {
+	s.queue.Close()
+	return nil
+}
+
+func (s *InfluxSink) enqueue(line string) error {
+	if !s.queue.Offer(line) {
+		return errQueueFull
+	}
+	return nil
+}
+
+func (s *InfluxSink) write(lines []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	body := strings.Join(lines, "\n")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.writeURL, bytes.NewBufferString(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Token "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+var tagEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+
+func escapeTag(v string) string {
+	return tagEscaper.Replace(v)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInfluxSink(t *testing.T) {
+	var body, auth, query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body, auth, query = string(data), r.Header.Get("Authorization"), r.URL.RawQuery
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink := NewInfluxSink(InfluxConfig{URL: server.URL, Org: "acme", Bucket: "market", Token: "secret"},
+		NewLogger(io.Discard, slog.LevelInfo, "text"))
+	ts := time.Unix(1700000000, 0)
+	sink.Publish(VWAPUpdate{ProductID: "BTC-USD", VWAP: "45000.1234", WindowSize: 200, TradeCount: 12, Time: ts})
+	sink.RecordTrade(Trade{ProductID: "BTC-USD", Price: "45000", Size: "0.5", Side: "buy", Time: ts})
+	sink.Close()
+
+	expected := "vwap,product=BTC-USD vwap=45000.1234,window_size=200i,trade_count=12i 1700000000000000000\n" +
+		"trade_volume,product=BTC-USD,side=buy size=0.5,price=45000,notional=22500 1700000000000000000"
+	if body != expected {
+		t.Errorf("Expected body\n%s\ngot\n%s", expected, body)
+	}
+	if auth != "Token secret" {
+		t.Errorf("Expected token auth header, got %q", auth)
+	}
+	if !strings.Contains(query, "bucket=market") || !strings.Contains(query, "org=acme") {
+		t.Errorf("Unexpected query %q", query)
+	}
+}
+
+func TestEscapeTag(t *testing.T) {
+	if got := escapeTag("a b,c=d"); got != `a\ b\,c\=d` {
+		t.Errorf("Unexpected escaping: %s", got)
+	}
+}
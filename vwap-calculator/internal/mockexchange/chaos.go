@@ -0,0 +1,107 @@
+package mockexchange
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Chaos sets how often each fault is injected around a match, as a
+// probability from 0 to 1 per call to Match. Faults are drawn from a
+// generator seeded with Seed, so a failing soak run can be repeated.
+type Chaos struct {
+	Seed int64
+	// Disconnect drops every connection abruptly after the match is sent.
+	Disconnect float64
+	// Malformed sends a frame that is not a valid feed message before the
+	// match.
+	Malformed float64
+	// Duplicate sends the match twice in a row.
+	Duplicate float64
+	// Stall pauses for up to MaxStall before sending the match, as a slow
+	// network would. Nothing else reaches clients meanwhile.
+	Stall    float64
+	MaxStall time.Duration
+}
+
+// Faults counts the faults injected since SetChaos.
+type Faults struct {
+	Disconnects int
+	Malformed   int
+	Duplicates  int
+	Stalls      int
+}
+
+type chaos struct {
+	Chaos
+	rand   *rand.Rand
+	faults Faults
+}
+
+// malformedFrames are sent by the Malformed fault, in turn.
+var malformedFrames = [][]byte{
+	[]byte(`{"type":"match","product_id":"BTC-USD","trade_id":`),
+	[]byte("\x00\xff not json"),
+	[]byte(`{"type":"match","product_id":"BTC-USD","price":"abc","size":"1"}`),
+	[]byte(`[]`),
+}
+
+// SetChaos starts injecting faults into matches as c describes, or stops
+// when c is nil. It also resets the counts returned by Faults.
+func (s *Server) SetChaos(c *Chaos) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chaos = nil
+	if c != nil {
+		s.chaos = &chaos{Chaos: *c, rand: rand.New(rand.NewPCG(uint64(c.Seed), 0))}
+	}
+}
+
+// Faults returns how many of each fault have been injected.
+func (s *Server) Faults() Faults {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.chaos == nil {
+		return Faults{}
+	}
+	return s.chaos.faults
+}
+
+// sendMatch sends a match message to productID's subscribers, with any
+// faults chaos draws for it. s.feedMu must be held.
+func (s *Server) sendMatch(productID string, data []byte) {
+	var malformed []byte
+	var stall time.Duration
+	var duplicate, disconnect bool
+	s.mu.Lock()
+	if c := s.chaos; c != nil {
+		if c.rand.Float64() < c.Malformed {
+			malformed = malformedFrames[c.faults.Malformed%len(malformedFrames)]
+			c.faults.Malformed++
+		}
+		if c.rand.Float64() < c.Stall && c.MaxStall > 0 {
+			stall = time.Duration(c.rand.Int64N(int64(c.MaxStall))) + 1
+			c.faults.Stalls++
+		}
+		if c.rand.Float64() < c.Duplicate {
+			duplicate = true
+			c.faults.Duplicates++
+		}
+		if c.rand.Float64() < c.Disconnect {
+			disconnect = true
+			c.faults.Disconnects++
+		}
+	}
+	s.mu.Unlock()
+
+	if malformed != nil {
+		s.send(productID, malformed)
+	}
+	time.Sleep(stall)
+	s.send(productID, data)
+	if duplicate {
+		s.send(productID, data)
+	}
+	if disconnect {
+		s.DropConnections()
+	}
+}
@@ -0,0 +1,45 @@
+package mockexchange
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestChaos(t *testing.T) {
+	server := New()
+	defer server.Close()
+	server.SetChaos(&Chaos{Seed: 1, Disconnect: 1, Malformed: 1, Duplicate: 1, Stall: 1, MaxStall: 10 * time.Millisecond})
+
+	conn, _, err := websocket.DefaultDialer.Dial(server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.WriteJSON(Request{Type: "subscribe", ProductIDs: []string{"BTC-USD"}, Channels: []string{"matches"}})
+	<-server.Requests()
+	readType(t, conn)
+
+	server.Match(Match{ProductID: "BTC-USD", Price: "100", Size: "1"})
+	if _, data, err := conn.ReadMessage(); err != nil || !bytes.Equal(data, malformedFrames[0]) {
+		t.Errorf("Expected a malformed frame first, got %q (%v)", data, err)
+	}
+	for range 2 {
+		if msg := readType(t, conn); msg["type"] != "match" || msg["trade_id"] != 1.0 {
+			t.Errorf("Expected match 1 twice, got %v", msg)
+		}
+	}
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Error("Expected the connection to be dropped")
+	}
+	if got, want := server.Faults(), (Faults{Disconnects: 1, Malformed: 1, Duplicates: 1, Stalls: 1}); got != want {
+		t.Errorf("Expected faults %+v, got %+v", want, got)
+	}
+
+	server.SetChaos(nil)
+	if got := server.Faults(); got != (Faults{}) {
+		t.Errorf("Expected no faults once chaos is off, got %+v", got)
+	}
+}
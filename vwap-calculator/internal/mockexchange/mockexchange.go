@@ -0,0 +1,367 @@
+// Package mockexchange runs an in-process websocket server that speaks enough
+// of the Coinbase Exchange feed protocol to drive vwap-calculator's connection
+// handling in tests: subscribe/unsubscribe, subscriptions acknowledgements,
+// unknown-product errors, match and last_match messages, heartbeats and the
+// close handshake. SetChaos adds random faults for soak testing.
+package mockexchange
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Request is a subscribe or unsubscribe message received from a client.
+type Request struct {
+	Type       string   `json:"type"`
+	ProductIDs []string `json:"product_ids"`
+	Channels   []string `json:"channels"`
+	// Signed requests also carry the API key's authentication fields.
+	Key        string `json:"key,omitempty"`
+	Passphrase string `json:"passphrase,omitempty"`
+	Timestamp  string `json:"timestamp,omitempty"`
+	Signature  string `json:"signature,omitempty"`
+	// Advanced Trade requests name a single channel, and may carry a JWT.
+	Channel string `json:"channel,omitempty"`
+	JWT     string `json:"jwt,omitempty"`
+}
+
+// UnmarshalJSON also accepts channels given as objects with their own
+// product_ids, as the exchange does. Their names go into Channels and their
+// products into ProductIDs.
+func (r *Request) UnmarshalJSON(data []byte) error {
+	type plain Request
+	var raw struct {
+		plain
+		Channels []json.RawMessage `json:"channels"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*r = Request(raw.plain)
+	r.Channels = nil
+	for _, entry := range raw.Channels {
+		var name string
+		if json.Unmarshal(entry, &name) == nil {
+			r.Channels = append(r.Channels, name)
+			continue
+		}
+		var channel struct {
+			Name       string   `json:"name"`
+			ProductIDs []string `json:"product_ids"`
+		}
+		if err := json.Unmarshal(entry, &channel); err != nil {
+			return err
+		}
+		r.Channels = append(r.Channels, channel.Name)
+		for _, product := range channel.ProductIDs {
+			if !slices.Contains(r.ProductIDs, product) {
+				r.ProductIDs = append(r.ProductIDs, product)
+			}
+		}
+	}
+	return nil
+}
+
+// Match is a trade to broadcast. TradeID and Time are filled in when zero.
+type Match struct {
+	ProductID string
+	TradeID   int64
+	Price     string
+	Size      string
+	Side      string
+	Time      time.Time
+}
+
+// Server is a mock exchange feed. Create it with New and point the client at
+// URL.
+type Server struct {
+	// URL is the ws:// address of the feed.
+	URL string
+
+	// LastMatch, when set, sends a last_match message carrying the latest
+	// trade ID for each newly subscribed product that has traded. Set it
+	// before any client connects.
+	LastMatch bool
+
+	// Products, when set, lists the products the exchange knows. A
+	// subscribe naming any other product is rejected with an error and
+	// changes nothing, as on the real exchange. Set it before any client
+	// connects.
+	Products []string
+
+	// Compression, when set, accepts permessage-deflate and compresses
+	// messages to clients that negotiate it. Set it before any client
+	// connects.
+	Compression bool
+
+	http     *httptest.Server
+	requests chan Request
+
+	// feedMu orders matches against subscribes, so that a last_match never
+	// names a trade the new subscriber is about to be sent.
+	feedMu sync.Mutex
+
+	mu          sync.Mutex
+	clients     map[*client]struct{}
+	connections int
+	tradeIDs    map[string]int64
+	chaos       *chaos
+}
+
+type client struct {
+	conn     *websocket.Conn
+	writeMu  sync.Mutex
+	products map[string]bool
+}
+
+// New starts a mock exchange on a loopback port.
+func New() *Server {
+	s := &Server{
+		requests: make(chan Request, 64),
+		clients:  make(map[*client]struct{}),
+		tradeIDs: make(map[string]int64),
+	}
+	s.http = httptest.NewServer(http.HandlerFunc(s.serve))
+	s.URL = "ws" + strings.TrimPrefix(s.http.URL, "http")
+	return s
+}
+
+// Requests delivers every subscribe and unsubscribe message received, in
+// order. Unread requests beyond the buffer are dropped.
+func (s *Server) Requests() <-chan Request {
+	return s.requests
+}
+
+// Connections returns how many websocket connections have been accepted.
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connections
+}
+
+// Match sends a match message to every client subscribed to m.ProductID and
+// returns the trade ID used.
+func (s *Server) Match(m Match) int64 {
+	s.feedMu.Lock()
+	defer s.feedMu.Unlock()
+	s.mu.Lock()
+	if m.TradeID == 0 {
+		m.TradeID = s.tradeIDs[m.ProductID] + 1
+	}
+	s.tradeIDs[m.ProductID] = max(s.tradeIDs[m.ProductID], m.TradeID)
+	s.mu.Unlock()
+
+	if m.Time.IsZero() {
+		m.Time = time.Now().UTC()
+	}
+	if m.Side == "" {
+		m.Side = "buy"
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"type":       "match",
+		"product_id": m.ProductID,
+		"trade_id":   m.TradeID,
+		"sequence":   m.TradeID,
+		"price":      m.Price,
+		"size":       m.Size,
+		"side":       m.Side,
+		"time":       m.Time,
+	})
+	if err != nil {
+		return m.TradeID
+	}
+	s.sendMatch(m.ProductID, data)
+	return m.TradeID
+}
+
+// SkipTrades advances productID's trade IDs by n without sending anything,
+// as if the trades happened while the client was disconnected.
+func (s *Server) SkipTrades(productID string, n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tradeIDs[productID] += n
+}
+
+// Heartbeat sends a heartbeat message to clients subscribed to productID.
+func (s *Server) Heartbeat(productID string) {
+	s.mu.Lock()
+	lastID := s.tradeIDs[productID]
+	s.mu.Unlock()
+	s.broadcast(productID, map[string]interface{}{
+		"type":          "heartbeat",
+		"product_id":    productID,
+		"last_trade_id": lastID,
+		"time":          time.Now().UTC(),
+	})
+}
+
+// Send writes a raw message to every connected client, subscribed or not.
+func (s *Server) Send(data []byte) {
+	for _, c := range s.snapshot() {
+		c.write(websocket.TextMessage, data)
+	}
+}
+
+// DropConnections closes every client connection abruptly, without a close
+// frame, as a network failure would.
+func (s *Server) DropConnections() {
+	for _, c := range s.snapshot() {
+		c.conn.Close()
+	}
+}
+
+// Close drops all connections and stops the server.
+func (s *Server) Close() {
+	s.DropConnections()
+	s.http.Close()
+}
+
+func (s *Server) snapshot() []*client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clients := make([]*client, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+func (s *Server) broadcast(productID string, msg interface{}) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	s.send(productID, data)
+}
+
+// send writes data to every client subscribed to productID.
+func (s *Server) send(productID string, data []byte) {
+	for _, c := range s.snapshot() {
+		s.mu.Lock()
+		subscribed := c.products[productID]
+		s.mu.Unlock()
+		if subscribed {
+			c.write(websocket.TextMessage, data)
+		}
+	}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{EnableCompression: s.Compression}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &client{conn: conn, products: make(map[string]bool)}
+	s.mu.Lock()
+	s.clients[c] = struct{}{}
+	s.connections++
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	// The default close handler echoes the client's close frame, completing
+	// the handshake, and ReadMessage then returns an error.
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req Request
+		if err := json.Unmarshal(data, &req); err != nil {
+			c.writeJSON(map[string]string{"type": "error", "message": "Failed to parse message"})
+			continue
+		}
+		switch req.Type {
+		case "subscribe", "unsubscribe":
+			s.apply(c, req)
+		default:
+			c.writeJSON(map[string]string{"type": "error", "message": "Unsupported message type " + req.Type})
+		}
+	}
+}
+
+func (s *Server) apply(c *client, req Request) {
+	select {
+	case s.requests <- req:
+	default:
+	}
+
+	s.feedMu.Lock()
+	defer s.feedMu.Unlock()
+	if req.Type == "subscribe" && s.Products != nil {
+		for _, product := range req.ProductIDs {
+			if !slices.Contains(s.Products, product) {
+				c.writeJSON(map[string]string{
+					"type":    "error",
+					"message": "Failed to subscribe",
+					"reason":  product + " is not a valid product",
+				})
+				return
+			}
+		}
+	}
+
+	s.mu.Lock()
+	for _, product := range req.ProductIDs {
+		c.products[product] = req.Type == "subscribe"
+	}
+	products := make([]string, 0, len(c.products))
+	for product, ok := range c.products {
+		if ok {
+			products = append(products, product)
+		}
+	}
+	slices.Sort(products)
+	lastIDs := make(map[string]int64, len(req.ProductIDs))
+	for _, product := range req.ProductIDs {
+		lastIDs[product] = s.tradeIDs[product]
+	}
+	s.mu.Unlock()
+
+	channels := make([]map[string]interface{}, 0, len(req.Channels))
+	for _, name := range req.Channels {
+		channels = append(channels, map[string]interface{}{"name": name, "product_ids": products})
+	}
+	c.writeJSON(map[string]interface{}{"type": "subscriptions", "channels": channels})
+
+	if s.LastMatch && req.Type == "subscribe" {
+		for _, product := range req.ProductIDs {
+			if lastIDs[product] == 0 {
+				continue
+			}
+			c.writeJSON(map[string]interface{}{
+				"type":       "last_match",
+				"product_id": product,
+				"trade_id":   lastIDs[product],
+				"time":       time.Now().UTC(),
+			})
+		}
+	}
+}
+
+func (c *client) writeJSON(v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	c.write(websocket.TextMessage, data)
+}
+
+func (c *client) write(messageType int, data []byte) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	c.conn.WriteMessage(messageType, data)
+}
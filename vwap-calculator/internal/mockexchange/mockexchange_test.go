@@ -0,0 +1,58 @@
+package mockexchange
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func readType(t *testing.T, conn *websocket.Conn) map[string]interface{} {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	var msg map[string]interface{}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("Invalid JSON %s: %v", data, err)
+	}
+	return msg
+}
+
+func TestServer(t *testing.T) {
+	server := New()
+	server.LastMatch = true
+	defer server.Close()
+	server.SkipTrades("BTC-USD", 41)
+
+	conn, _, err := websocket.DefaultDialer.Dial(server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.WriteJSON(Request{Type: "subscribe", ProductIDs: []string{"BTC-USD"}, Channels: []string{"matches"}})
+
+	if req := <-server.Requests(); req.Type != "subscribe" || req.ProductIDs[0] != "BTC-USD" {
+		t.Errorf("Unexpected request %+v", req)
+	}
+	if msg := readType(t, conn); msg["type"] != "subscriptions" {
+		t.Errorf("Expected subscriptions ack, got %v", msg)
+	}
+	if msg := readType(t, conn); msg["type"] != "last_match" || msg["trade_id"] != 41.0 {
+		t.Errorf("Expected last_match 41, got %v", msg)
+	}
+
+	server.Match(Match{ProductID: "ETH-USD", Price: "1", Size: "1"})
+	if id := server.Match(Match{ProductID: "BTC-USD", Price: "100", Size: "2"}); id != 42 {
+		t.Errorf("Expected trade ID 42, got %d", id)
+	}
+	if msg := readType(t, conn); msg["type"] != "match" || msg["product_id"] != "BTC-USD" || msg["price"] != "100" {
+		t.Errorf("Expected only the subscribed BTC-USD match, got %v", msg)
+	}
+	if server.Connections() != 1 {
+		t.Errorf("Expected 1 connection, got %d", server.Connections())
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaConfig selects the brokers and topics for KafkaSink.
+type KafkaConfig struct {
+	Brokers      string // comma-separated host:port list
+	UpdatesTopic string
+	// TradesTopic receives raw accepted trades; empty disables them.
+	TradesTopic string
+	// Encoding is json or protobuf.
+	Encoding string
+}
+
+// kafkaWriter is the subset of *kafka.Writer used by KafkaSink.
+type kafkaWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// KafkaSink publishes VWAP updates, and optionally raw trades, as JSON or
+// protobuf keyed by product ID so every product stays ordered within its
+// partition.
+type KafkaSink struct {
+	writer       kafkaWriter
+	updatesTopic string
+	tradesTopic  string
+	encoding     string
+}
+
+func NewKafkaSink(cfg KafkaConfig, logger Logger) *KafkaSink {
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(strings.Split(cfg.Brokers, ",")...),
+		Balancer:     &kafka.Hash{},
+		BatchTimeout: 50 * time.Millisecond,
+		Async:        true,
+		Completion: func(messages []kafka.Message, err error) {
+			if err != nil {
+				logger.Errorf("Kafka delivery of %d messages failed: %v", len(messages), err)
+			}
+		},
+	}
+	return &KafkaSink{writer: writer, updatesTopic: cfg.UpdatesTopic, tradesTopic: cfg.TradesTopic, encoding: cfg.Encoding}
+}
+
+func (s *KafkaSink) Publish(update VWAPUpdate) error {
+	value, err := encodeUpdate(s.encoding, update)
+	if err != nil {
+		return err
+	}
+	return s.write(s.updatesTopic, update.ProductID, value)
+}
+
+func (s *KafkaSink) RecordTrade(trade Trade) error {
+	if s.tradesTopic == "" {
+		return nil
+	}
+	value, err := encodeTrade(s.encoding, trade)
+	if err != nil {
+		return err
+	}
+	return s.write(s.tradesTopic, trade.ProductID, value)
+}
+
+// Close flushes buffered messages.
+func (s *KafkaSink) Close() error {
+	return s.writer.Close()
+}
+
+func (s *KafkaSink) write(topic, key string, value []byte) error {
+	return s.writer.WriteMessages(context.Background(), kafka.Message{
+		Topic: topic,
+		Key:   []byte(key),
+		Value: value,
+	})
+}
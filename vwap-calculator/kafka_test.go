@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type fakeKafkaWriter struct {
+	messages []kafka.Message
+}
+
+func (w *fakeKafkaWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.messages = append(w.messages, msgs...)
+	return nil
+}
+
+func (w *fakeKafkaWriter) Close() error { return nil }
+
+func TestKafkaSink(t *testing.T) {
+	t.Run("UpdatesKeyedByProduct", func(t *testing.T) {
+		writer := &fakeKafkaWriter{}
+		sink := &KafkaSink{writer: writer, updatesTopic: "vwap"}
+		sink.Publish(VWAPUpdate{ProductID: "ETH-USD", VWAP: "3000.0000"})
+		sink.RecordTrade(Trade{ProductID: "ETH-USD", Price: "3000", Size: "1"})
+
+		if len(writer.messages) != 1 {
+			t.Fatalf("Expected only the update to be written, got %d messages", len(writer.messages))
+		}
+		msg := writer.messages[0]
+		var update VWAPUpdate
+		if err := json.Unmarshal(msg.Value, &update); err != nil {
+			t.Fatalf("Value is not JSON: %v", err)
+		}
+		if msg.Topic != "vwap" || string(msg.Key) != "ETH-USD" || update.VWAP != "3000.0000" {
+			t.Errorf("Unexpected message: %s %s %+v", msg.Topic, msg.Key, update)
+		}
+	})
+
+	t.Run("RawTrades", func(t *testing.T) {
+		writer := &fakeKafkaWriter{}
+		sink := &KafkaSink{writer: writer, updatesTopic: "vwap", tradesTopic: "trades"}
+		sink.RecordTrade(Trade{ProductID: "BTC-USD", TradeID: 9, Price: "45000", Size: "0.1"})
+
+		if len(writer.messages) != 1 || writer.messages[0].Topic != "trades" || string(writer.messages[0].Key) != "BTC-USD" {
+			t.Errorf("Unexpected messages: %+v", writer.messages)
+		}
+	})
+
+	t.Run("Protobuf", func(t *testing.T) {
+		writer := &fakeKafkaWriter{}
+		sink := &KafkaSink{writer: writer, updatesTopic: "vwap", tradesTopic: "trades", encoding: encodingProtobuf}
+		sink.Publish(VWAPUpdate{ProductID: "ETH-USD", VWAP: "3000.0000"})
+		sink.RecordTrade(Trade{ProductID: "ETH-USD", TradeID: 3, Price: "3000", Size: "1"})
+
+		if len(writer.messages) != 2 {
+			t.Fatalf("Expected 2 messages, got %d", len(writer.messages))
+		}
+		if fields := decodeProto(t, writer.messages[0].Value); protoString(fields, 2) != "3000.0000" {
+			t.Errorf("Unexpected update %v", fields)
+		}
+		if fields := decodeProto(t, writer.messages[1].Value); protoString(fields, 5) != "3000" {
+			t.Errorf("Unexpected trade %v", fields)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// latencyWarnInterval limits latency warnings to one per product per
+// interval, so a lagging feed does not flood the log.
+const latencyWarnInterval = 10 * time.Second
+
+// latencyMonitor measures how long after the exchange's trade time each
+// trade is received.
+type latencyMonitor struct {
+	warnAbove time.Duration
+	now       func() time.Time
+
+	mu     sync.Mutex
+	warned map[string]time.Time // last warning, by product
+}
+
+func newLatencyMonitor(warnAbove time.Duration) *latencyMonitor {
+	return &latencyMonitor{warnAbove: warnAbove, now: time.Now, warned: make(map[string]time.Time)}
+}
+
+// observe records trade's latency and reports whether it should be warned
+// about.
+func (m *latencyMonitor) observe(trade Trade) (time.Duration, bool) {
+	now := m.now()
+	// A clock behind the exchange's would make latency negative.
+	latency := max(now.Sub(trade.Time), 0)
+	feedLatency.WithLabelValues(trade.ProductID).Observe(latency.Seconds())
+	if m.warnAbove <= 0 || latency <= m.warnAbove {
+		return latency, false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.Sub(m.warned[trade.ProductID]) < latencyWarnInterval {
+		return latency, false
+	}
+	m.warned[trade.ProductID] = now
+	return latency, true
+}
+
+// SetLatencyMonitor makes the pipeline measure feed latency, warning about
+// trades received more than warnAbove after they happened (0 never warns).
+func (p *Pipeline) SetLatencyMonitor(warnAbove time.Duration) {
+	p.latency = newLatencyMonitor(warnAbove)
+}
+
+// observeLatency measures a match's latency on receipt, before it waits in
+// any product queue.
+func (p *Pipeline) observeLatency(trade Trade) {
+	if p.latency == nil || trade.Type != "match" || trade.Time.IsZero() {
+		return
+	}
+	if latency, warn := p.latency.observe(trade); warn {
+		p.logger.With("product", trade.ProductID).Warnf("Trade %d received %v after the exchange time; VWAP may be stale", trade.TradeID, latency.Round(time.Millisecond))
+	}
+}
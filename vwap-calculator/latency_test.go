@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLatencyMonitor(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	m := newLatencyMonitor(2 * time.Second)
+	m.now = func() time.Time { return now }
+
+	if latency, warn := m.observe(Trade{ProductID: "BTC-USD", Time: now.Add(-500 * time.Millisecond)}); latency != 500*time.Millisecond || warn {
+		t.Errorf("Expected 500ms without a warning, got %v, %v", latency, warn)
+	}
+	if _, warn := m.observe(Trade{ProductID: "BTC-USD", Time: now.Add(-3 * time.Second)}); !warn {
+		t.Error("Expected a warning above the threshold")
+	}
+	if _, warn := m.observe(Trade{ProductID: "BTC-USD", Time: now.Add(-4 * time.Second)}); warn {
+		t.Error("Expected repeated warnings to be suppressed")
+	}
+	if _, warn := m.observe(Trade{ProductID: "ETH-USD", Time: now.Add(-4 * time.Second)}); !warn {
+		t.Error("Expected warnings to be limited per product")
+	}
+	if latency, _ := m.observe(Trade{ProductID: "BTC-USD", Time: now.Add(time.Second)}); latency != 0 {
+		t.Errorf("Expected a trade from the future to count as 0, got %v", latency)
+	}
+}
+
+func TestPipelineFeedLatency(t *testing.T) {
+	var logs bytes.Buffer
+	pipeline := NewPipeline(map[string]Calculator{"SOL-USD": NewVWAPCalculator()}, NewLogger(&logs, slog.LevelInfo, "text"), NewStore())
+	pipeline.SetLatencyMonitor(time.Second)
+
+	before := testutil.CollectAndCount(feedLatency)
+	stale := time.Now().Add(-5 * time.Second).UTC().Format(time.RFC3339Nano)
+	pipeline.dispatchMessage(context.Background(), []byte(`{"type":"match","product_id":"SOL-USD","trade_id":1,"price":"150","size":"1","time":"`+stale+`"}`), nil)
+	if testutil.CollectAndCount(feedLatency) != before+1 {
+		t.Error("Expected a latency series for SOL-USD")
+	}
+	if !strings.Contains(logs.String(), "VWAP may be stale") || !strings.Contains(logs.String(), "product=SOL-USD") {
+		t.Errorf("Expected a latency warning, got %q", logs.String())
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LeaderConfig selects the lock replicas campaign for.
+type LeaderConfig struct {
+	Lock string // a file path, or a redis:// URL
+	Key  string // the Redis key holding the lock
+	TTL  time.Duration
+}
+
+// LeaderLock is a lock held by at most one replica at a time.
+type LeaderLock interface {
+	// Acquire takes the lock or, when this replica already holds it, renews
+	// it. It reports whether the lock is held.
+	Acquire(ctx context.Context) (bool, error)
+	Release(ctx context.Context) error
+}
+
+// newLeaderLock returns a Redis lock for a redis:// or rediss:// URL, and a
+// file lock otherwise.
+func newLeaderLock(cfg LeaderConfig) (LeaderLock, error) {
+	if strings.HasPrefix(cfg.Lock, "redis://") || strings.HasPrefix(cfg.Lock, "rediss://") {
+		opts, err := redis.ParseURL(cfg.Lock)
+		if err != nil {
+			return nil, fmt.Errorf("parsing leader lock URL: %w", err)
+		}
+		return newRedisLock(redis.NewClient(opts), cfg.Key, cfg.TTL), nil
+	}
+	return &fileLock{path: cfg.Lock}, nil
+}
+
+// fileLock is an exclusive lock on a file shared by replicas on one host or
+// a shared filesystem that supports it: flock(2) on Unix and LockFileEx on
+// Windows. The operating system releases it when
+// the holder exits, however it exits.
+type fileLock struct {
+	path string
+	f    *os.File
+}
+
+func (l *fileLock) Acquire(context.Context) (bool, error) {
+	if l.f != nil {
+		return true, nil
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return false, fmt.Errorf("opening leader lock: %w", err)
+	}
+	locked, err := lockFile(f)
+	if err != nil || !locked {
+		f.Close()
+		if err != nil {
+			return false, fmt.Errorf("locking %s: %w", l.path, err)
+		}
+		return false, nil
+	}
+	l.f = f
+	return true, nil
+}
+
+func (l *fileLock) Release(context.Context) error {
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close() // closing the file drops the lock
+	l.f = nil
+	return err
+}
+
+// redisAcquire sets the lock to this replica's ID if it is free, or extends
+// it if this replica already holds it.
+var redisAcquire = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return redis.call("set", KEYS[1], ARGV[1], "NX", "PX", ARGV[2])
+`)
+
+// redisRelease deletes the lock only if this replica still holds it.
+var redisRelease = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0
+`)
+
+// redisLock is a lock held in a Redis key with a TTL. A leader that stops
+// renewing it, because it crashed or lost its connection, loses the lock when
+// the key expires.
+type redisLock struct {
+	client *redis.Client
+	key    string
+	id     string
+	ttl    time.Duration
+}
+
+func newRedisLock(client *redis.Client, key string, ttl time.Duration) *redisLock {
+	host, _ := os.Hostname()
+	return &redisLock{
+		client: client,
+		key:    key,
+		id:     fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano()),
+		ttl:    ttl,
+	}
+}
+
+func (l *redisLock) Acquire(ctx context.Context) (bool, error) {
+	err := redisAcquire.Run(ctx, l.client, []string{l.key}, l.id, l.ttl.Milliseconds()).Err()
+	switch {
+	case errors.Is(err, redis.Nil):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("acquiring leader lock: %w", err)
+	}
+	return true, nil
+}
+
+func (l *redisLock) Release(ctx context.Context) error {
+	err := redisRelease.Run(ctx, l.client, []string{l.key}, l.id).Err()
+	if closeErr := l.client.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// LeaderElector campaigns for a LeaderLock, so that of several replicas
+// sharing it only one publishes while the others stand by with their feeds
+// and windows warm. A replica that cannot confirm it holds the lock steps
+// down at once; a duplicate is worse than a short gap.
+type LeaderElector struct {
+	lock     LeaderLock
+	interval time.Duration
+	logger   Logger
+	leader   atomic.Bool
+}
+
+// NewLeaderElector tries for lock every interval, which must be well within
+// the lock's TTL so the leader renews it in time.
+func NewLeaderElector(lock LeaderLock, interval time.Duration, logger Logger) *LeaderElector {
+	return &LeaderElector{lock: lock, interval: interval, logger: logger}
+}
+
+// IsLeader reports whether this replica holds the lock. A nil elector always
+// leads.
+func (e *LeaderElector) IsLeader() bool {
+	return e == nil || e.leader.Load()
+}
+
+// Run campaigns every interval until ctx is cancelled, then releases the
+// lock so a standby can take over without waiting for it to expire.
+func (e *LeaderElector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		e.campaign(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			e.setLeader(false)
+			releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := e.lock.Release(releaseCtx); err != nil {
+				e.logger.Warnf("Releasing leader lock failed: %v", err)
+			}
+			return
+		}
+	}
+}
+
+func (e *LeaderElector) campaign(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, e.interval)
+	defer cancel()
+	held, err := e.lock.Acquire(ctx)
+	if err != nil {
+		e.logger.Warnf("%v", err)
+	}
+	e.setLeader(held)
+}
+
+func (e *LeaderElector) setLeader(held bool) {
+	if e.leader.Swap(held) == held {
+		return
+	}
+	if held {
+		e.logger.Infof("Became leader, publishing updates")
+		leaderGauge.Set(1)
+	} else {
+		e.logger.Infof("Standing by, not publishing updates")
+		leaderGauge.Set(0)
+	}
+}
+
+// Sink passes sink's updates on only while this replica leads. A nil
+// elector returns sink unchanged.
+func (e *LeaderElector) Sink(sink Sink) Sink {
+	if e == nil {
+		return sink
+	}
+	return leaderSink{sink, e}
+}
+
+// TradeSink is Sink for trade sinks.
+func (e *LeaderElector) TradeSink(sink TradeSink) TradeSink {
+	if e == nil {
+		return sink
+	}
+	return leaderTradeSink{sink, e}
+}
+
+// AlertSink is Sink for alert sinks.
+func (e *LeaderElector) AlertSink(sink AlertSink) AlertSink {
+	if e == nil {
+		return sink
+	}
+	return leaderAlertSink{sink, e}
+}
+
+// CandleSink is Sink for candle sinks.
+func (e *LeaderElector) CandleSink(sink CandleSink) CandleSink {
+	if e == nil {
+		return sink
+	}
+	return leaderCandleSink{sink, e}
+}
+
+type leaderSink struct {
+	sink    Sink
+	elector *LeaderElector
+}
+
+func (s leaderSink) Publish(update VWAPUpdate) error {
+	if !s.elector.IsLeader() {
+		return nil
+	}
+	return s.sink.Publish(update)
+}
+
+type leaderTradeSink struct {
+	sink    TradeSink
+	elector *LeaderElector
+}
+
+func (s leaderTradeSink) RecordTrade(trade Trade) error {
+	if !s.elector.IsLeader() {
+		return nil
+	}
+	return s.sink.RecordTrade(trade)
+}
+
+type leaderAlertSink struct {
+	sink    AlertSink
+	elector *LeaderElector
+}
+
+func (s leaderAlertSink) Alert(alert Alert) error {
+	if !s.elector.IsLeader() {
+		return nil
+	}
+	return s.sink.Alert(alert)
+}
+
+type leaderCandleSink struct {
+	sink    CandleSink
+	elector *LeaderElector
+}
+
+func (s leaderCandleSink) PublishCandle(candle Candle) error {
+	if !s.elector.IsLeader() {
+		return nil
+	}
+	return s.sink.PublishCandle(candle)
+}
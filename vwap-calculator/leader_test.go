@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestFileLock(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "leader.lock")
+	first, second := &fileLock{path: path}, &fileLock{path: path}
+
+	if held, err := first.Acquire(ctx); err != nil || !held {
+		t.Fatalf("Expected the first replica to take the lock, got %v (%v)", held, err)
+	}
+	if held, err := second.Acquire(ctx); err != nil || held {
+		t.Fatalf("Expected the second replica to stand by, got %v (%v)", held, err)
+	}
+	if held, _ := first.Acquire(ctx); !held {
+		t.Error("Expected the leader to keep the lock")
+	}
+	first.Release(ctx)
+	if held, err := second.Acquire(ctx); err != nil || !held {
+		t.Errorf("Expected the second replica to take over, got %v (%v)", held, err)
+	}
+	second.Release(ctx)
+}
+
+func TestRedisLock(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	newLock := func() *redisLock {
+		return newRedisLock(redis.NewClient(&redis.Options{Addr: server.Addr()}), "vwap:leader", 10*time.Second)
+	}
+	first, second := newLock(), newLock()
+
+	if held, err := first.Acquire(ctx); err != nil || !held {
+		t.Fatalf("Expected the first replica to take the lock, got %v (%v)", held, err)
+	}
+	if held, err := second.Acquire(ctx); err != nil || held {
+		t.Fatalf("Expected the second replica to stand by, got %v (%v)", held, err)
+	}
+
+	server.FastForward(8 * time.Second)
+	if held, _ := first.Acquire(ctx); !held {
+		t.Fatal("Expected the leader to renew the lock")
+	}
+	if ttl := server.TTL("vwap:leader"); ttl != 10*time.Second {
+		t.Errorf("Expected renewal to reset the TTL, got %v", ttl)
+	}
+
+	// The leader stops renewing, as if it had crashed.
+	server.FastForward(11 * time.Second)
+	if held, err := second.Acquire(ctx); err != nil || !held {
+		t.Fatalf("Expected the second replica to take over once the lock expired, got %v (%v)", held, err)
+	}
+	if held, _ := first.Acquire(ctx); held {
+		t.Error("Expected the old leader to stand by")
+	}
+	first.Release(ctx)
+	if !server.Exists("vwap:leader") {
+		t.Error("Expected releasing a lock held by another replica to leave it")
+	}
+	second.Release(ctx)
+	if server.Exists("vwap:leader") {
+		t.Error("Expected the leader's release to delete the lock")
+	}
+}
+
+type stubLock struct {
+	held bool
+	err  error
+}
+
+func (l *stubLock) Acquire(context.Context) (bool, error) { return l.held, l.err }
+func (l *stubLock) Release(context.Context) error         { return nil }
+
+func TestLeaderElectorGatesSinks(t *testing.T) {
+	lock := &stubLock{}
+	elector := NewLeaderElector(lock, time.Second, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	store := NewStore()
+	var trades recordedTrades
+	sink, tradeSink := elector.Sink(store), elector.TradeSink(&trades)
+
+	elector.campaign(context.Background())
+	sink.Publish(VWAPUpdate{ProductID: "BTC-USD", VWAP: "45000"})
+	tradeSink.RecordTrade(Trade{ProductID: "BTC-USD", TradeID: 1})
+	if _, ok := store.Get("BTC-USD"); ok || len(trades) != 0 {
+		t.Error("Expected a standby to publish nothing")
+	}
+
+	lock.held = true
+	elector.campaign(context.Background())
+	sink.Publish(VWAPUpdate{ProductID: "BTC-USD", VWAP: "45000"})
+	tradeSink.RecordTrade(Trade{ProductID: "BTC-USD", TradeID: 2})
+	if _, ok := store.Get("BTC-USD"); !ok || len(trades) != 1 {
+		t.Error("Expected the leader to publish")
+	}
+
+	lock.err = context.DeadlineExceeded
+	lock.held = false
+	elector.campaign(context.Background())
+	if elector.IsLeader() {
+		t.Error("Expected a leader that cannot renew to step down")
+	}
+
+	var none *LeaderElector
+	if !none.IsLeader() || none.Sink(store) != Sink(store) {
+		t.Error("Expected no elector to always publish")
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Logger interface for dependency injection
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+	// With returns a Logger that adds the given key/value pairs to every record.
+	With(args ...interface{}) Logger
+}
+
+// SlogLogger adapts log/slog to the printf-style Logger interface.
+type SlogLogger struct {
+	logger *slog.Logger
+}
+
+// NewLogger writes records at or above level to w, as logfmt-style text or
+// one JSON object per line depending on format.
+func NewLogger(w io.Writer, level slog.Leveler, format string) *SlogLogger {
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if format == "json" {
+		handler = slog.NewJSONHandler(w, opts)
+	} else {
+		handler = slog.NewTextHandler(w, opts)
+	}
+	return &SlogLogger{logger: slog.New(handler)}
+}
+
+func (l *SlogLogger) Debugf(format string, args ...interface{}) {
+	l.logf(slog.LevelDebug, format, args...)
+}
+
+func (l *SlogLogger) Infof(format string, args ...interface{}) {
+	l.logf(slog.LevelInfo, format, args...)
+}
+
+func (l *SlogLogger) Warnf(format string, args ...interface{}) {
+	l.logf(slog.LevelWarn, format, args...)
+}
+
+func (l *SlogLogger) Errorf(format string, args ...interface{}) {
+	l.logf(slog.LevelError, format, args...)
+}
+
+func (l *SlogLogger) With(args ...interface{}) Logger {
+	return &SlogLogger{logger: l.logger.With(args...)}
+}
+
+// logf skips formatting entirely when the level is disabled, so demoted
+// per-trade messages cost nothing in production.
+func (l *SlogLogger) logf(level slog.Level, format string, args ...interface{}) {
+	ctx := context.Background()
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+	l.logger.Log(ctx, level, fmt.Sprintf(format, args...))
+}
+
+// RateLimitedLogger logs the first of a run of identical warnings or errors
+// at once, then suppresses repeats for interval and logs a single summary
+// counting them, so a misbehaving feed cannot bury everything else in the
+// logs. Messages are identical when their text and With fields match.
+type RateLimitedLogger struct {
+	Logger
+	limiter *repeatLimiter
+	scope   string // the With fields, distinguishing children's messages
+}
+
+type repeatLimiter struct {
+	interval  time.Duration
+	afterFunc func(time.Duration, func()) *time.Timer
+
+	mu      sync.Mutex
+	repeats map[string]int // suppressed repeats of each message logged this interval
+}
+
+func NewRateLimitedLogger(logger Logger, interval time.Duration) *RateLimitedLogger {
+	return &RateLimitedLogger{
+		Logger:  logger,
+		limiter: &repeatLimiter{interval: interval, afterFunc: time.AfterFunc, repeats: make(map[string]int)},
+	}
+}
+
+func (l *RateLimitedLogger) Warnf(format string, args ...interface{}) {
+	l.logf(slog.LevelWarn, l.Logger.Warnf, format, args...)
+}
+
+func (l *RateLimitedLogger) Errorf(format string, args ...interface{}) {
+	l.logf(slog.LevelError, l.Logger.Errorf, format, args...)
+}
+
+func (l *RateLimitedLogger) With(args ...interface{}) Logger {
+	return &RateLimitedLogger{Logger: l.Logger.With(args...), limiter: l.limiter, scope: l.scope + fmt.Sprintln(args...)}
+}
+
+func (l *RateLimitedLogger) logf(level slog.Level, log func(string, ...interface{}), format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	key := fmt.Sprint(level, "\x00", l.scope, "\x00", msg)
+	r := l.limiter
+	r.mu.Lock()
+	if _, ok := r.repeats[key]; ok {
+		r.repeats[key]++
+		r.mu.Unlock()
+		return
+	}
+	r.repeats[key] = 0
+	r.mu.Unlock()
+
+	log("%s", msg)
+	r.afterFunc(r.interval, func() {
+		r.mu.Lock()
+		n := r.repeats[key]
+		delete(r.repeats, key)
+		r.mu.Unlock()
+		if n > 0 {
+			log("%s (repeated %d times in the last %v)", msg, n, r.interval)
+		}
+	})
+}
+
+// LogFileConfig configures writing logs to a file instead of stderr.
+type LogFileConfig struct {
+	Path string
+	// MaxSize rotates the file before a write would take it past this many
+	// bytes; RotateEvery rotates it once it has been open that long. Zero
+	// disables either.
+	MaxSize     int64
+	RotateEvery time.Duration
+	// MaxBackups and MaxAge limit the rotated files kept, by count and by
+	// age. Zero keeps them all.
+	MaxBackups int
+	MaxAge     time.Duration
+}
+
+// backupTimeFormat names rotated files, e.g. vwap.log.20240102T030405.000;
+// it sorts in rotation order.
+const backupTimeFormat = "20060102T150405.000"
+
+// RotatingFile is an append-only log file that is renamed aside, with the
+// rotation time as a suffix, when it grows too large or too old. Rotated
+// files past the retention limits are deleted.
+type RotatingFile struct {
+	cfg LogFileConfig
+	now func() time.Time
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+func OpenRotatingFile(cfg LogFileConfig) (*RotatingFile, error) {
+	f := &RotatingFile{cfg: cfg, now: time.Now}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.cfg.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("opening log file: %w", err)
+	}
+	f.file, f.size, f.opened = file, info.Size(), f.now()
+	return nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	tooBig := f.cfg.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.cfg.MaxSize
+	tooOld := f.cfg.RotateEvery > 0 && f.now().Sub(f.opened) >= f.cfg.RotateEvery
+	if tooBig || tooOld {
+		// A failed rotation leaves the current file open where it can, as
+		// losing logs is worse than an oversized file.
+		if err := f.rotate(); err != nil && f.file == nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate renames the current file aside and starts a new one. f.mu must be
+// held.
+func (f *RotatingFile) rotate() error {
+	f.file.Close()
+	f.file = nil
+	backup := f.cfg.Path + "." + f.now().UTC().Format(backupTimeFormat)
+	renameErr := os.Rename(f.cfg.Path, backup)
+	if err := f.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return fmt.Errorf("rotating log file: %w", renameErr)
+	}
+	return f.prune()
+}
+
+// prune deletes rotated files beyond MaxBackups or older than MaxAge.
+func (f *RotatingFile) prune() error {
+	backups, err := filepath.Glob(f.cfg.Path + ".*")
+	if err != nil {
+		return err
+	}
+	// Keep only names this file produced, newest first.
+	backups = slices.DeleteFunc(backups, func(name string) bool {
+		_, err := time.Parse(backupTimeFormat, strings.TrimPrefix(name, f.cfg.Path+"."))
+		return err != nil
+	})
+	slices.Sort(backups)
+	slices.Reverse(backups)
+	for i, name := range backups {
+		expired := f.cfg.MaxBackups > 0 && i >= f.cfg.MaxBackups
+		if !expired && f.cfg.MaxAge > 0 {
+			info, err := os.Stat(name)
+			expired = err == nil && f.now().Sub(info.ModTime()) > f.cfg.MaxAge
+		}
+		if expired {
+			if err := os.Remove(name); err != nil {
+				return fmt.Errorf("removing old log file: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlogLogger(t *testing.T) {
+	t.Run("LevelFiltering", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := NewLogger(&buf, slog.LevelInfo, "text")
+		logger.Debugf("hidden %d", 1)
+		logger.Infof("shown %d", 2)
+		if out := buf.String(); strings.Contains(out, "hidden") || !strings.Contains(out, "shown 2") {
+			t.Errorf("Unexpected output: %q", out)
+		}
+	})
+
+	t.Run("JSONWithFields", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := NewLogger(&buf, slog.LevelDebug, "json").With("product", "BTC-USD")
+		logger.Warnf("gap of %d", 3)
+
+		var record map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+			t.Fatalf("Output is not JSON: %v", err)
+		}
+		if record["level"] != "WARN" || record["msg"] != "gap of 3" || record["product"] != "BTC-USD" {
+			t.Errorf("Unexpected record: %v", record)
+		}
+	})
+}
+
+func TestRateLimitedLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewRateLimitedLogger(NewLogger(&buf, slog.LevelInfo, "text"), 10*time.Second)
+	var pending []func()
+	logger.limiter.afterFunc = func(_ time.Duration, f func()) *time.Timer {
+		pending = append(pending, f)
+		return nil
+	}
+
+	for range 5 {
+		logger.Errorf("Publish failed: %v", "queue full")
+	}
+	logger.With("product", "BTC-USD").Errorf("Publish failed: %v", "queue full")
+	logger.Warnf("Once only")
+	logger.Infof("Not limited")
+	logger.Infof("Not limited")
+	if n := strings.Count(buf.String(), "Publish failed: queue full"); n != 2 {
+		t.Errorf("Expected the first of the repeats and the other product's error, got %d lines:\n%s", n, buf.String())
+	}
+	if n := strings.Count(buf.String(), "Not limited"); n != 2 {
+		t.Errorf("Expected info messages not to be limited, got %d", n)
+	}
+
+	buf.Reset()
+	for _, f := range pending {
+		f()
+	}
+	if out := buf.String(); strings.Count(out, "\n") != 1 || !strings.Contains(out, `"Publish failed: queue full (repeated 4 times in the last 10s)"`) {
+		t.Errorf("Expected one summary of the suppressed repeats, got:\n%s", out)
+	}
+
+	buf.Reset()
+	logger.Errorf("Publish failed: %v", "queue full")
+	if !strings.Contains(buf.String(), "Publish failed: queue full") {
+		t.Error("Expected the message to be logged again once the interval ended")
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "vwap.log")
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	f, err := OpenRotatingFile(LogFileConfig{Path: path, MaxSize: 10, RotateEvery: time.Hour, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.now = func() time.Time { return now }
+	f.opened = now
+
+	write := func(s string) {
+		t.Helper()
+		if _, err := f.Write([]byte(s)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		now = now.Add(time.Second)
+	}
+	write("1234\n")
+	write("6789\n") // fits exactly
+	write("abc\n")  // rotates by size
+	now = now.Add(time.Hour)
+	write("def\n") // rotates by age
+	write("ghi\n")
+	write("jklmnopq\n") // rotates by size, pruning the oldest backup
+
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 backups, got %v", backups)
+	}
+	for name, want := range map[string]string{
+		path:       "jklmnopq\n",
+		backups[0]: "abc\n",
+		backups[1]: "def\nghi\n",
+	} {
+		if data, _ := os.ReadFile(name); string(data) != want {
+			t.Errorf("Expected %s to hold %q, got %q", filepath.Base(name), want, data)
+		}
+	}
+}
+
+func TestRotatingFileMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "vwap.log")
+	old := path + ".20240101T000000.000"
+	os.WriteFile(old, []byte("old\n"), 0o644)
+	os.Chtimes(old, time.Now().Add(-48*time.Hour), time.Now().Add(-48*time.Hour))
+	unrelated := path + ".bak"
+	os.WriteFile(unrelated, nil, 0o644)
+
+	f, err := OpenRotatingFile(LogFileConfig{Path: path, MaxSize: 4, MaxAge: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Write([]byte("one\n"))
+	f.Write([]byte("two\n"))
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("Expected the expired backup to be removed, got %v", err)
+	}
+	if _, err := os.Stat(unrelated); err != nil {
+		t.Errorf("Expected files not made by rotation to be kept, got %v", err)
+	}
+}
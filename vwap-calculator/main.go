@@ -1,45 +1,175 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"maps"
 	"math/big"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Calculator interface {
 	Update(price, size string) error
 	Calculate() string
+	// Reset discards every trade, leaving the calculator as if new.
+	Reset()
+	// TradeCount returns how many trades have been applied since the
+	// calculator was created or last reset.
+	TradeCount() int64
+	// Stats describes the trades behind the current value.
+	Stats() CalculatorStats
 }
 
 const (
 	windowSize   = 200
 	websocketURL = "wss://ws-feed.exchange.coinbase.com"
+	restURL      = "https://api.exchange.coinbase.com"
+	venue        = "coinbase"
 	retryDelay   = 3 * time.Second
 	maxRetries   = 5
+
+	maxRetryDelay           = time.Minute
+	healthyConnectionPeriod = time.Minute
+
+	// dedupeWindow is how many recent trade IDs are remembered per product.
+	dedupeWindow = 1000
+
+	drainTimeout    = 2 * time.Second
+	shutdownTimeout = 5 * time.Second
+)
+
+// products are the markets tracked unless -products says otherwise. It is
+// only read: run keeps the products it tracks in its own list.
+var products = []string{"BTC-USD", "ETH-USD", "ETH-BTC"}
+
+var (
+	errMaxConnectionAge = errors.New("connection reached its maximum age")
+	errStaleFeed        = errors.New("feed went stale")
 )
 
+// inboundMessage is a raw feed message along with the span covering its
+// journey from receipt to VWAP emission.
+type inboundMessage struct {
+	ctx  context.Context
+	data []byte
+}
+
 type Trade struct {
-	Type      string `json:"type"`
+	Type      string    `json:"type"`
+	ProductID string    `json:"product_id"`
+	TradeID   int64     `json:"trade_id"`
+	Sequence  int64     `json:"sequence"`
+	Price     string    `json:"price"`
+	Size      string    `json:"size"`
+	Side      string    `json:"side"`
+	Time      time.Time `json:"time"`
+	// LastSize is the size of a ticker message's trade, which becomes Size
+	// once it is converted to a match.
+	LastSize string `json:"last_size,omitempty"`
+}
+
+// VWAPUpdate is a single recomputed VWAP for a product.
+type VWAPUpdate struct {
 	ProductID string `json:"product_id"`
-	Price     string `json:"price"`
-	Size      string `json:"size"`
+	// VWAP holds the product's average, which is a TWAP when Method says so.
+	VWAP       string `json:"vwap"`
+	Method     string `json:"method,omitempty"`
+	WindowSize int    `json:"window_size"`
+	TradeCount int64  `json:"trade_count"`
+	// High and Low are the extreme trade prices in the window.
+	High string `json:"high,omitempty"`
+	Low  string `json:"low,omitempty"`
+	// StdDev is the volume-weighted standard deviation of price around VWAP,
+	// and Bands the prices at configured multiples of it.
+	StdDev string `json:"stddev,omitempty"`
+	Bands  []Band `json:"bands,omitempty"`
+	// MissedTrades counts trades known to have been skipped by the feed, so
+	// consumers can tell when the VWAP may be incomplete.
+	MissedTrades int64 `json:"missed_trades"`
+	// Indicators holds secondary values such as moving averages, keyed by
+	// name (e.g. "sma20").
+	Indicators map[string]string `json:"indicators,omitempty"`
+	// BestBid, BestAsk and MidPrice are the top of the product's order book
+	// when -order-book is set.
+	BestBid  string `json:"best_bid,omitempty"`
+	BestAsk  string `json:"best_ask,omitempty"`
+	MidPrice string `json:"mid_price,omitempty"`
+	// LastPrice is the price of the trade behind the update, and
+	// DeviationPct its percentage distance from VWAP, with -price-deviation.
+	LastPrice    string `json:"last_price,omitempty"`
+	DeviationPct string `json:"deviation_pct,omitempty"`
+	// Volume and Notional are the total size and price × size of the trades
+	// in the window, for calculators that weight by size.
+	Volume   string `json:"volume,omitempty"`
+	Notional string `json:"notional,omitempty"`
+	// USDVWAP is VWAP converted to USD for products quoted in another
+	// currency, and USDNotional the USD value of the trade behind the update.
+	USDVWAP     string    `json:"usd_vwap,omitempty"`
+	USDNotional string    `json:"usd_notional,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// Sink receives every VWAP update produced by the pipeline.
+type Sink interface {
+	Publish(update VWAPUpdate) error
+}
+
+// StdoutSink prints updates in the human-readable "<product> VWAP: <value>" format.
+type StdoutSink struct{}
+
+func (StdoutSink) Publish(update VWAPUpdate) error {
+	label := "VWAP"
+	if update.Method != "" {
+		label = strings.ToUpper(update.Method)
+	}
+	extras := formatIndicators(update.Indicators)
+	if update.MidPrice != "" {
+		extras = strings.TrimSpace(fmt.Sprintf("%s bid=%s ask=%s mid=%s", extras, update.BestBid, update.BestAsk, update.MidPrice))
+	}
+	if update.DeviationPct != "" {
+		extras = strings.TrimSpace(fmt.Sprintf("%s last=%s dev=%s%%", extras, update.LastPrice, update.DeviationPct))
+	}
+	if extras != "" {
+		_, err := fmt.Printf("%s %s: %s %s\n", update.ProductID, label, update.VWAP, extras)
+		return err
+	}
+	_, err := fmt.Printf("%s %s: %s\n", update.ProductID, label, update.VWAP)
+	return err
 }
 
 type RingBuffer struct {
-	data  [windowSize * 2]big.Rat
+	data  []big.Rat
+	size  int
 	start int
 	count int
 }
 
+// NewRingBuffer returns a buffer holding the last size pairs.
+func NewRingBuffer(size int) RingBuffer {
+	return RingBuffer{data: make([]big.Rat, size*2), size: size}
+}
+
 func (rb *RingBuffer) Add(price, size *big.Rat) (oldPrice, oldSize *big.Rat, removed bool) {
-	if rb.count == windowSize {
+	if rb.count == rb.size {
 		oldPrice = new(big.Rat).Set(&rb.data[rb.start])
 		oldSize = new(big.Rat).Set(&rb.data[rb.start+1])
 		rb.start = (rb.start + 2) % len(rb.data)
@@ -53,183 +183,1398 @@ func (rb *RingBuffer) Add(price, size *big.Rat) (oldPrice, oldSize *big.Rat, rem
 	return
 }
 
+// reset empties the buffer. Stale slots are overwritten as pairs are added.
+func (rb *RingBuffer) reset() {
+	rb.start, rb.count = 0, 0
+}
+
+// push is Add without keeping the evicted pair: the oldest slot is
+// overwritten in place, reusing its storage. It returns the stored copies.
+func (rb *RingBuffer) push(a, b *big.Rat) (storedA, storedB *big.Rat) {
+	if rb.count == rb.size {
+		rb.start = (rb.start + 2) % len(rb.data)
+	} else {
+		rb.count++
+	}
+	pos := (rb.start + (rb.count-1)*2) % len(rb.data)
+	return rb.data[pos].Set(a), rb.data[pos+1].Set(b)
+}
+
 type VWAPCalculator struct {
 	mu          sync.Mutex
 	buffer      RingBuffer
 	totalPV     big.Rat
 	totalVolume big.Rat
+	totalPV2    big.Rat // Σ size × price², for the deviation
+	evicted     int     // trades evicted since the sums were recomputed
+	priceRange  windowRange
+	clock       tradeClock
+	// price, size and pv are scratch values reused by every Update so that
+	// parsing and the running sums do not allocate fresh big.Rats per trade.
+	price, size, pv big.Rat
+	// vwap is the latest average, swapped in by Update so that Calculate
+	// never waits for the lock. It is nil while the window is empty.
+	vwap atomic.Pointer[vwapValue]
+	formatted
+}
+
+// vwapValue is an immutable VWAP result along with its rendering.
+type vwapValue struct {
+	rat    *big.Rat
+	format priceFormat
+	text   string
+}
+
+func newVWAPValue(r *big.Rat, format priceFormat) *vwapValue {
+	return &vwapValue{rat: r, format: format, text: format.rat(r)}
 }
 
 func NewVWAPCalculator() *VWAPCalculator {
-	return &VWAPCalculator{}
+	return NewWindowedVWAPCalculator(windowSize)
 }
 
-func (v *VWAPCalculator) Update(priceStr, sizeStr string) error {
-	price, ok1 := new(big.Rat).SetString(priceStr)
-	size, ok2 := new(big.Rat).SetString(sizeStr)
+// NewWindowedVWAPCalculator returns a VWAPCalculator over the last size
+// trades.
+func NewWindowedVWAPCalculator(size int) *VWAPCalculator {
+	return &VWAPCalculator{buffer: NewRingBuffer(size), priceRange: windowRange{size: int64(size)}, clock: newTradeClock(size)}
+}
 
-	if !ok1 || !ok2 || price.Cmp(big.NewRat(0, 1)) <= 0 || size.Cmp(big.NewRat(0, 1)) <= 0 {
-		return errors.New("invalid trade data: price and size must be positive rational numbers")
-	}
+func (v *VWAPCalculator) Update(priceStr, sizeStr string) error {
+	return v.UpdateAt(priceStr, sizeStr, time.Now())
+}
 
+func (v *VWAPCalculator) UpdateAt(priceStr, sizeStr string, at time.Time) error {
 	v.mu.Lock()
 	defer v.mu.Unlock()
 
-	oldPrice, oldSize, removed := v.buffer.Add(price, size)
+	price, ok1 := v.price.SetString(priceStr)
+	size, ok2 := v.size.SetString(sizeStr)
+	if !ok1 || !ok2 || price.Sign() <= 0 || size.Sign() <= 0 {
+		return errors.New("invalid trade data: price and size must be positive rational numbers")
+	}
+
+	pv := &v.pv
+	removed := v.buffer.count == v.buffer.size
 	if removed {
-		v.totalPV.Sub(&v.totalPV, new(big.Rat).Mul(oldPrice, oldSize))
+		oldPrice, oldSize := v.buffer.oldest()
+		pv.Mul(oldPrice, oldSize)
+		v.totalPV.Sub(&v.totalPV, pv)
+		v.totalPV2.Sub(&v.totalPV2, pv.Mul(pv, oldPrice))
 		v.totalVolume.Sub(&v.totalVolume, oldSize)
 	}
-	v.totalPV.Add(&v.totalPV, new(big.Rat).Mul(price, size))
+	// The buffer's copy of the price outlives the scratch value, so that is
+	// what the range keeps.
+	price, _ = v.buffer.push(price, size)
+	pv.Mul(price, size)
+	v.totalPV.Add(&v.totalPV, pv)
 	v.totalVolume.Add(&v.totalVolume, size)
+	v.totalPV2.Add(&v.totalPV2, pv.Mul(pv, price))
+	v.priceRange.Add(price)
+	v.clock.add(at)
+	if removed {
+		if v.evicted++; v.evicted >= v.buffer.size {
+			v.recompute()
+		}
+	}
+	v.vwap.Store(newVWAPValue(new(big.Rat).Quo(&v.totalPV, &v.totalVolume), v.Format()))
 	return nil
 }
 
+// Calculate returns the VWAP as of the last completed Update without taking
+// the lock, so readers never contend with the writer or each other.
 func (v *VWAPCalculator) Calculate() string {
+	vwap := v.vwap.Load()
+	if vwap == nil {
+		return "0"
+	}
+	if format := v.Format(); format != vwap.format {
+		return format.rat(vwap.rat)
+	}
+	return vwap.text
+}
+
+// CalculateRat returns the VWAP as of the last completed Update, or nil
+// before the first trade. Like Calculate, it never waits for the lock.
+func (v *VWAPCalculator) CalculateRat() *big.Rat {
+	vwap := v.vwap.Load()
+	if vwap == nil {
+		return nil
+	}
+	return new(big.Rat).Set(vwap.rat)
+}
+
+func (v *VWAPCalculator) Reset() {
 	v.mu.Lock()
 	defer v.mu.Unlock()
+	v.buffer.reset()
+	v.totalPV.SetInt64(0)
+	v.totalVolume.SetInt64(0)
+	v.totalPV2.SetInt64(0)
+	v.evicted = 0
+	v.priceRange = windowRange{size: int64(v.buffer.size)}
+	v.clock.reset()
+	v.vwap.Store(nil)
+}
 
-	if v.totalVolume.Cmp(big.NewRat(0, 1)) == 0 {
-		return "0"
-	}
-	vwap := new(big.Rat).Quo(&v.totalPV, &v.totalVolume)
-	return vwap.FloatString(4) // Convert to decimal with 4 decimal places
+func (v *VWAPCalculator) TradeCount() int64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.clock.trades
 }
 
-// Logger interface for dependency injection
-type Logger interface {
-	Infof(format string, args ...interface{})
-	Errorf(format string, args ...interface{})
+func (v *VWAPCalculator) Stats() CalculatorStats {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.clock.stats(volumeString(&v.totalVolume), volumeString(&v.totalPV))
 }
 
-type DefaultLogger struct {
-	*log.Logger
+// WindowSize takes the lock, as Resize may change the size at runtime.
+func (v *VWAPCalculator) WindowSize() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.buffer.size
+}
+
+func (v *VWAPCalculator) Range() (high, low string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.priceRange.Range(v.Format())
 }
 
-func NewLogger() *DefaultLogger {
-	return &DefaultLogger{
-		Logger: log.New(os.Stdout, "[VWAP] ", log.LstdFlags|log.Lmsgprefix),
+// Pipeline routes decoded trades to their calculators and publishes the results.
+type Pipeline struct {
+	// mu guards calculators, indicators, minimums, sessions, subscribed
+	// and tradeCounts, which change when products are added or removed at
+	// runtime. calculators is replaced rather than modified.
+	mu          sync.RWMutex
+	calculators map[string]Calculator
+	subscribed  []string
+	tradeCounts map[string]int64
+	gaps        *GapDetector
+	dedupe      *Deduper
+	indicators  map[string][]indicator
+	bands       []float64
+	minimums    map[string]tradeMinimum
+	sessions    map[string]*tradingHours
+	channels    map[string][]string // per-product channels, overriding feedChannels
+	wal         *TradeLog
+	hooks       Hooks
+	gapFill     *RESTClient
+	jumps       *JumpDetector
+	deviation   bool // report each trade's deviation from VWAP
+	rules       *RuleEvaluator
+	cross       *CrossRates
+	usd         *USDConverter
+	books       *OrderBooks
+	signer      *signer
+	advanced    bool       // speak the Advanced Trade websocket; see SetAdvancedTrade
+	jwt         *jwtSigner // signs Advanced Trade subscriptions
+	health      *feedHealth
+	latency     *latencyMonitor
+	throughput  *throughputStats
+	breaker     *messageBreaker
+	counts      *runCounts
+	reorder     time.Duration
+	writeWait   time.Duration
+	channel     string // the channel trades come from
+	outliers    *OutlierFilter
+	quarantine  []QuarantineSink
+	sinks       []Sink
+	tradeSinks  []TradeSink
+	alertSinks  []AlertSink
+	workers     atomic.Pointer[productWorkers] // set while StartWorkers runs
+	emit        *emitter
+	feed        *websocket.Conn // the live feed connection, guarded by feedMu
+	feedMu      sync.Mutex
+	logger      Logger
+}
+
+func NewPipeline(calculators map[string]Calculator, logger Logger, sinks ...Sink) *Pipeline {
+	return &Pipeline{
+		calculators: calculators,
+		subscribed:  subscriptionOrder(products, calculators),
+		tradeCounts: make(map[string]int64, len(calculators)),
+		gaps:        NewGapDetector(),
+		dedupe:      NewDeduper(dedupeWindow),
+		indicators:  make(map[string][]indicator),
+		minimums:    make(map[string]tradeMinimum),
+		sessions:    make(map[string]*tradingHours),
+		channels:    make(map[string][]string),
+		emit:        newEmitter(),
+		channel:     channelMatches,
+		health:      newFeedHealth(),
+		throughput:  newThroughputStats(),
+		breaker:     newMessageBreaker(),
+		counts:      newRunCounts(),
+		sinks:       sinks,
+		logger:      logger,
 	}
 }
 
-func (l *DefaultLogger) Infof(format string, args ...interface{}) {
-	l.Printf("INFO: "+format, args...)
+// AddSink registers an additional sink for VWAP updates.
+func (p *Pipeline) AddSink(sink Sink) {
+	p.sinks = append(p.sinks, sink)
+}
+
+// AddTradeSink registers a sink for every trade accepted into a calculator,
+// and for trades passed through from outside a product's trading hours.
+func (p *Pipeline) AddTradeSink(sink TradeSink) {
+	p.tradeSinks = append(p.tradeSinks, sink)
+}
+
+// Calculators returns every tracked product's calculator. The map is not
+// modified once returned, and must not be modified by the caller.
+func (p *Pipeline) Calculators() map[string]Calculator {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.calculators
 }
 
-func (l *DefaultLogger) Errorf(format string, args ...interface{}) {
-	l.Printf("ERROR: "+format, args...)
+// calculator returns productID's calculator and indicators.
+func (p *Pipeline) calculator(productID string) (Calculator, []indicator, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	calculator, ok := p.calculators[productID]
+	return calculator, p.indicators[productID], ok
+}
+
+// countTrade adds an accepted trade to productID's count and returns the new
+// total.
+func (p *Pipeline) countTrade(productID string) int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tradeCounts[productID]++
+	return p.tradeCounts[productID]
+}
+
+func (p *Pipeline) tradeCount(productID string) int64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.tradeCounts[productID]
 }
 
 func main() {
-	logger := NewLogger()
-	calculators := map[string]Calculator{
-		"BTC-USD": NewVWAPCalculator(),
-		"ETH-USD": NewVWAPCalculator(),
-		"ETH-BTC": NewVWAPCalculator(),
+	cfg, err := parseFlags(os.Args[1:])
+	if err != nil {
+		os.Exit(2)
 	}
 
-	retryCount := 0
-	for {
-		conn, err := connectWebSocket(logger)
+	// Logs go to stderr so stdout carries nothing but VWAP output.
+	var logOutput io.Writer = os.Stderr
+	var dashboard *TerminalDashboard
+	if cfg.TUI {
+		dashboard = NewTerminalDashboard(os.Stdout)
+		// Logs on the dashboard's terminal would scroll it away, so they are
+		// shown inside it unless stderr is redirected.
+		if isTerminal(os.Stderr) {
+			logOutput = dashboard.Logs()
+		}
+	}
+	var logFile *RotatingFile
+	if cfg.LogFile.Path != "" {
+		if logFile, err = OpenRotatingFile(cfg.LogFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		logOutput = logFile
+	}
+	var logger Logger = NewLogger(logOutput, cfg.LogLevel, cfg.LogFormat)
+	if cfg.LogRepeats > 0 {
+		logger = NewRateLimitedLogger(logger, cfg.LogRepeats)
+	}
+	logger = logger.With("venue", venue)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, cfg, logger, dashboard)
+	stop()
+	if logFile != nil {
+		logFile.Close()
+	}
+	os.Exit(code)
+}
+
+// run wires up the pipeline and streams trades until ctx is cancelled or the
+// feed cannot be re-established. Updates go to dashboard instead of stdout
+// when it is not nil. It returns the process exit code.
+func run(ctx context.Context, cfg *Config, logger Logger, dashboard *TerminalDashboard) int {
+	shutdownTracing, err := initTracing(ctx, cfg.OTLPEndpoint)
+	if err != nil {
+		logger.Errorf("Tracing setup failed: %v", err)
+		return 1
+	}
+	defer shutdownTracing(context.Background())
+
+	tracked := slices.Clone(cfg.Products)
+	if cfg.AllProducts != "" {
+		patterns, _ := parseProductPatterns(cfg.AllProducts)
+		if tracked, err = discoverProducts(ctx, NewRESTClient(restURL), patterns); err != nil {
+			logger.Errorf("Product discovery failed: %v", err)
+			return 1
+		}
+		logger.Infof("Discovered %d products matching %s", len(tracked), cfg.AllProducts)
+	}
+	// Synthetic products need both legs, so subscribe to any that are not
+	// already tracked.
+	for _, leg := range cfg.Synthetics.legs() {
+		if !slices.Contains(tracked, leg) {
+			tracked = append(tracked, leg)
+		}
+	}
+	for _, sp := range cfg.Synthetics {
+		if slices.Contains(tracked, sp.Name) {
+			logger.Errorf("Synthetic product %s clashes with a tracked product", sp.Name)
+			return 1
+		}
+	}
+
+	calculators := make(map[string]Calculator, len(tracked))
+	for _, productID := range tracked {
+		if calculators[productID], err = newCalculator(cfg.Calculators.Get(productID, "vwap"), cfg.windowFor(productID), cfg.HalfLife); err != nil {
+			logger.Errorf("%v", err)
+			return 1
+		}
+	}
+
+	var leader *LeaderElector
+	if cfg.Leader.Lock != "" {
+		lock, err := newLeaderLock(cfg.Leader)
 		if err != nil {
-			if retryCount++; retryCount > maxRetries {
-				logger.Errorf("Max connection retries (%d) reached", maxRetries)
-				return
+			logger.Errorf("%v", err)
+			return 1
+		}
+		leader = NewLeaderElector(lock, cfg.Leader.TTL/3, logger)
+		leaderCtx, stopLeader := context.WithCancel(context.WithoutCancel(ctx))
+		leaderDone := make(chan struct{})
+		go func() {
+			defer close(leaderDone)
+			leader.Run(leaderCtx)
+		}()
+		// Registered before the sinks, so the lock is only released once
+		// they have flushed.
+		defer func() {
+			stopLeader()
+			<-leaderDone
+		}()
+	}
+
+	store := NewStore()
+	hub := NewHub(logger)
+	hub.SetEncoding(cfg.WSEncoding)
+	output := &reloadableSink{sink: newOutputSink(cfg.Output, os.Stdout)}
+	// Standbys keep serving the HTTP API, WebSocket clients and the terminal
+	// dashboard; only output that leaves the process waits for leadership.
+	outputLeader := leader
+	if dashboard != nil {
+		output.set(dashboard)
+		outputLeader = nil
+	}
+	pipeline := NewPipeline(calculators, logger, outputLeader.Sink(output), store, hub, MetricsSink{})
+	if dashboard != nil {
+		pipeline.AddTradeSink(dashboard)
+	}
+	pipeline.SetSubscriptionOrder(tracked)
+	pipeline.SetBands(cfg.VWAPBands)
+	var history *VWAPHistory
+	if cfg.HistoryRetention > 0 {
+		history = NewVWAPHistory(cfg.HistoryRetention, cfg.HistoryLimit)
+		pipeline.AddSink(history)
+	}
+	var arrow *ArrowStreams
+	if cfg.ArrowBatch > 0 && cfg.HTTPAddr != "" {
+		arrow = NewArrowStreams(cfg.ArrowBatch, logger)
+		pipeline.AddSink(arrow)
+		pipeline.AddTradeSink(arrow)
+	}
+	for _, productID := range tracked {
+		configureProduct(cfg, pipeline, productID)
+	}
+
+	if cfg.USDNotional {
+		pipeline.SetUSDConverter(NewUSDConverter())
+	}
+	pipeline.SetTradeChannel(cfg.TradeChannel)
+	pipeline.SetWriteTimeout(cfg.WriteTimeout)
+	if cfg.GapFill {
+		pipeline.SetGapFill(NewRESTClient(restURL))
+	}
+	if cfg.API == apiAdvanced {
+		sign, err := jwtSignerFromEnv()
+		if err != nil {
+			logger.Errorf("%v", err)
+			return 1
+		}
+		pipeline.SetAdvancedTrade(sign)
+		if sign != nil {
+			logger.Infof("Signing subscriptions with API key %s", sign.keyName)
+		}
+	} else if cfg.Auth.Key != "" {
+		signer, err := newSigner(cfg.Auth, NewRESTClient(restURL))
+		if err != nil {
+			logger.Errorf("%v", err)
+			return 1
+		}
+		pipeline.SetSigner(signer)
+		logger.Infof("Signing subscriptions with API %s", cfg.Auth)
+	}
+	if cfg.OrderBook != "" {
+		pipeline.SetOrderBooks(NewOrderBooks(cfg.OrderBook))
+	} else {
+		for _, value := range cfg.Channels {
+			if channels, _ := parseChannelList(value); bookChannelOf(channels) != "" {
+				// Only the products -channels subscribes to level2 get
+				// books.
+				pipeline.SetOrderBooks(NewOrderBooks(""))
+				break
+			}
+		}
+	}
+	if len(cfg.Synthetics) > 0 {
+		cross := NewCrossRates(cfg.Synthetics)
+		for _, sp := range cfg.Synthetics {
+			cross.SetFormat(sp.Name, cfg.formatFor(sp.Name))
+		}
+		pipeline.SetCrossRates(cross)
+	}
+
+	if cfg.OutlierPercent > 0 || cfg.OutlierSigma > 0 {
+		pipeline.SetOutlierFilter(NewOutlierFilter(cfg.OutlierPercent, cfg.OutlierSigma))
+		if cfg.QuarantineFile != "" {
+			f, err := os.OpenFile(cfg.QuarantineFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+			if err != nil {
+				logger.Errorf("Opening quarantine file: %v", err)
+				return 1
+			}
+			defer f.Close()
+			pipeline.AddQuarantineSink(NewJSONLinesSink(f))
+		}
+	}
+
+	pipeline.SetPriceDeviation(cfg.PriceDeviation || cfg.Dashboard)
+	if cfg.JumpPercent > 0 {
+		pipeline.SetJumpDetector(NewJumpDetector(cfg.JumpPercent))
+	}
+	if len(cfg.AlertRules) > 0 {
+		pipeline.SetAlertRules(cfg.AlertRules)
+	}
+	addNotifier := func(sink AlertSink) {
+		if cfg.AlertInterval > 0 {
+			sink = NewRateLimitedAlertSink(sink, cfg.AlertInterval)
+		}
+		pipeline.AddAlertSink(leader.AlertSink(sink))
+	}
+	if cfg.AlertWebhook != "" {
+		sink := NewWebhookAlertSink(cfg.AlertWebhook, logger)
+		defer sink.Close()
+		addNotifier(sink)
+	}
+	if cfg.AlertSlack != "" {
+		sink := NewSlackAlertSink(cfg.AlertSlack, logger)
+		defer sink.Close()
+		addNotifier(sink)
+	}
+
+	var candles *CandleBuilder
+	if len(cfg.Candles) > 0 {
+		candles = NewCandleBuilder(cfg.Candles, logger)
+		candles.AddSink(outputLeader.CandleSink(output))
+		candles.AddSink(hub)
+		pipeline.AddTradeSink(candles)
+	}
+
+	var profile *VolumeProfile
+	if len(cfg.ProfileBuckets) > 0 {
+		buckets := make(map[string]string)
+		for _, productID := range tracked {
+			if width := cfg.ProfileBuckets.Get(productID, ""); width != "" {
+				buckets[productID] = width
+			}
+		}
+		if profile, err = NewVolumeProfile(cfg.ProfilePeriod, buckets); err != nil {
+			logger.Errorf("%v", err)
+			return 1
+		}
+		pipeline.AddTradeSink(profile)
+	}
+
+	admin := &productAdmin{cfg: cfg, pipeline: pipeline, output: output, stdout: os.Stdout, logger: logger}
+	if cfg.Backfill {
+		admin.rest = NewRESTClient(restURL)
+	}
+	if cfg.ConfigFile != "" {
+		go reloadOnHangup(ctx, admin, logger)
+	}
+
+	checks := healthChecks{pipeline: pipeline, readyWithin: cfg.StaleTimeout, grace: cfg.HealthGrace}
+	var apiMux, adminMux *http.ServeMux
+	if cfg.HTTPAddr != "" {
+		mux := newHTTPHandler(store)
+		addCalculatorRoutes(mux, pipeline)
+		addProductRoutes(mux, pipeline)
+		addHealthRoutes(mux, checks)
+		addStatsRoutes(mux, pipeline)
+		mux.Handle("GET /ws", hub)
+		mux.Handle("GET /metrics", promhttp.Handler())
+		if cfg.Dashboard {
+			addDashboardRoutes(mux)
+		}
+		if candles != nil {
+			mux.Handle("GET /candles/{product}", candles)
+		}
+		if profile != nil {
+			mux.Handle("GET /profile/{product}", profile)
+		}
+		if history != nil {
+			mux.Handle("GET /vwap/{product}/history", history)
+		}
+		if arrow != nil {
+			mux.Handle("GET /arrow/{kind}", arrow)
+		}
+		apiMux = mux
+	}
+	if cfg.AdminAddr != "" {
+		adminMux = http.NewServeMux()
+		addAdminRoutes(adminMux, admin)
+	}
+	if cfg.HealthAddr != "" {
+		mux := http.NewServeMux()
+		addHealthRoutes(mux, checks)
+		defer startHTTPServer(cfg.HealthAddr, mux, "Health checks", logger)()
+	}
+	if cfg.PprofAddr != "" {
+		defer startHTTPServer(cfg.PprofAddr, newPprofHandler(), "Profiling", logger)()
+	}
+
+	if cfg.SQLitePath != "" {
+		store, err := OpenSQLiteStore(cfg.SQLitePath, logger)
+		if err != nil {
+			logger.Errorf("%v", err)
+			return 1
+		}
+		defer store.Close()
+		pipeline.AddTradeSink(leader.TradeSink(store))
+	}
+
+	if cfg.PostgresDSN != "" {
+		sink, err := OpenPostgresSink(ctx, cfg.PostgresDSN, logger)
+		if err != nil {
+			logger.Errorf("%v", err)
+			return 1
+		}
+		defer sink.Close()
+		pipeline.AddSink(leader.Sink(sink))
+		pipeline.AddTradeSink(leader.TradeSink(sink))
+	}
+
+	if cfg.Influx.URL != "" {
+		sink := NewInfluxSink(cfg.Influx, logger)
+		defer sink.Close()
+		pipeline.AddSink(leader.Sink(sink))
+		pipeline.AddTradeSink(leader.TradeSink(sink))
+	}
+
+	if cfg.Kafka.Brokers != "" {
+		sink := NewKafkaSink(cfg.Kafka, logger)
+		defer sink.Close()
+		pipeline.AddSink(leader.Sink(sink))
+		pipeline.AddTradeSink(leader.TradeSink(sink))
+	}
+
+	if cfg.NATS.URL != "" {
+		sink, err := NewNATSSink(ctx, cfg.NATS, logger)
+		if err != nil {
+			logger.Errorf("%v", err)
+			return 1
+		}
+		defer sink.Close()
+		pipeline.AddSink(leader.Sink(sink))
+	}
+
+	if cfg.Redis.URL != "" {
+		sink, err := NewRedisSink(ctx, cfg.Redis, logger)
+		if err != nil {
+			logger.Errorf("%v", err)
+			return 1
+		}
+		defer sink.Close()
+		pipeline.AddSink(leader.Sink(sink))
+	}
+
+	if cfg.StatsD.Addr != "" {
+		emitter, err := NewStatsDEmitter(cfg.StatsD, prometheus.DefaultGatherer, []string{"venue:" + venue}, logger)
+		if err != nil {
+			logger.Errorf("%v", err)
+			return 1
+		}
+		defer emitter.Close()
+		statsdCtx, stopStatsD := context.WithCancel(context.WithoutCancel(ctx))
+		statsdDone := make(chan struct{})
+		go func() {
+			defer close(statsdDone)
+			emitter.Run(statsdCtx)
+		}()
+		// Stop after the feed so the final flush includes its last trades.
+		defer func() {
+			stopStatsD()
+			<-statsdDone
+		}()
+	}
+
+	if cfg.RemoteWrite.URL != "" {
+		writer, err := NewRemoteWriter(cfg.RemoteWrite, prometheus.DefaultGatherer, map[string]string{"venue": venue}, logger)
+		if err != nil {
+			logger.Errorf("%v", err)
+			return 1
+		}
+		remoteCtx, stopRemote := context.WithCancel(context.WithoutCancel(ctx))
+		remoteDone := make(chan struct{})
+		go func() {
+			defer close(remoteDone)
+			writer.Run(remoteCtx)
+		}()
+		// Stop after the feed so the final push includes its last trades.
+		defer func() {
+			stopRemote()
+			<-remoteDone
+		}()
+	}
+
+	if cfg.CSV.Dir != "" {
+		sink, err := NewCSVSink(cfg.CSV, logger)
+		if err != nil {
+			logger.Errorf("%v", err)
+			return 1
+		}
+		defer sink.Close()
+		pipeline.AddSink(leader.Sink(sink))
+		pipeline.AddTradeSink(leader.TradeSink(sink))
+	}
+
+	if cfg.Parquet.Dir != "" {
+		sink, err := NewParquetSink(cfg.Parquet, logger)
+		if err != nil {
+			logger.Errorf("%v", err)
+			return 1
+		}
+		defer sink.Close()
+		pipeline.AddSink(leader.Sink(sink))
+		pipeline.AddTradeSink(leader.TradeSink(sink))
+	}
+
+	var restored map[string]bool
+	if cfg.SnapshotFile != "" {
+		if restored, err = loadSnapshot(cfg.SnapshotFile, calculators, logger); err != nil {
+			logger.Errorf("%v", err)
+		}
+		defer func() {
+			if err := saveSnapshot(cfg.SnapshotFile, pipeline.Calculators()); err != nil {
+				logger.Errorf("%v", err)
+			}
+		}()
+		if cfg.SnapshotInterval > 0 {
+			go runSnapshotter(ctx, cfg.SnapshotFile, cfg.SnapshotInterval, pipeline.Calculators, logger)
+		}
+	}
+	if cfg.WALFile != "" {
+		// Keep enough of every product's trades to refill the largest
+		// window.
+		keep := windowSize
+		for _, c := range calculators {
+			keep = max(keep, windowSizeOf(c))
+		}
+		wal, trades, err := OpenTradeLog(cfg.WALFile, keep, logger)
+		if err != nil {
+			logger.Errorf("%v", err)
+			return 1
+		}
+		defer wal.Close()
+		replayed := pipeline.ReplayTradeLog(trades, logger)
+		if restored == nil {
+			restored = make(map[string]bool)
+		}
+		maps.Copy(restored, replayed)
+		pipeline.SetTradeLog(wal)
+	}
+
+	if cfg.Backfill {
+		// Products restored from a snapshot already have a full window, and
+		// backfilling them would double count the overlap.
+		var products []string
+		for productID := range calculators {
+			if !restored[productID] {
+				products = append(products, productID)
+			}
+		}
+		backfill(ctx, NewRESTClient(restURL), pipeline, products, logger)
+	}
+
+	feed := runFeed
+	switch {
+	case cfg.Stdin:
+		feed = func(ctx context.Context, cfg *Config, pipeline *Pipeline, logger Logger) error {
+			return runReader(ctx, os.Stdin, pipeline, logger)
+		}
+	case cfg.ReplayFile != "":
+		feed = func(ctx context.Context, cfg *Config, pipeline *Pipeline, logger Logger) error {
+			return runReplay(ctx, cfg.ReplayFile, cfg.ReplaySpeed, pipeline, logger)
+		}
+	case cfg.SimulateRate > 0:
+		products := make([]string, 0, len(calculators))
+		for productID := range calculators {
+			products = append(products, productID)
+		}
+		sim := NewSimulator(products, uint64(time.Now().UnixNano()))
+		feed = func(ctx context.Context, cfg *Config, pipeline *Pipeline, logger Logger) error {
+			return runSimulator(ctx, sim, cfg.SimulateRate, pipeline, logger)
+		}
+	case cfg.FIX.Addr != "":
+		feed = runFIXFeed
+		pipeline.SetLatencyMonitor(cfg.LatencyWarn)
+	default:
+		// Only the live feed's trade times say how current the data is.
+		pipeline.SetLatencyMonitor(cfg.LatencyWarn)
+	}
+
+	pipeline.SetMessageBreaker(cfg.BreakerErrors, cfg.BreakerRatio)
+	pipeline.SetReorderWindow(cfg.ReorderWindow)
+	if cfg.StatsInterval > 0 {
+		go runThroughputLog(ctx, pipeline, cfg.StatsInterval, logger)
+	}
+
+	stopEmitter := pipeline.StartEmitter()
+	stopWorkers := pipeline.StartWorkers(cfg.ProductQueue, cfg.Backpressure)
+	// The API and admin servers start once the workers are running, as their
+	// handlers add and remove products' workers.
+	if adminMux != nil {
+		defer startHTTPServer(cfg.AdminAddr, adminMux, "Admin API", logger)()
+	}
+	if apiMux != nil {
+		defer startHTTPServer(cfg.HTTPAddr, apiMux, "HTTP API", logger)()
+		if arrow != nil {
+			// End the streams first, so the server's shutdown isn't held up
+			// waiting for them.
+			defer arrow.Close()
+		}
+	}
+	stopDashboard := func() {}
+	if dashboard != nil {
+		stopDashboard = dashboard.Start(pipeline)
+	}
+	code := 0
+	err = feed(ctx, cfg, pipeline, logger)
+	stopWorkers()
+	stopEmitter()
+	stopDashboard()
+	if err != nil {
+		logger.Errorf("%v", err)
+		code = 1
+	} else {
+		logger.Infof("Shutting down")
+	}
+	if cfg.Output != "text" {
+		pipeline.WriteSummary(os.Stderr)
+	} else {
+		pipeline.WriteSummary(os.Stdout)
+	}
+	if cfg.SummaryFile != "" {
+		if err := pipeline.WriteSummaryFile(cfg.SummaryFile); err != nil {
+			logger.Errorf("Writing summary failed: %v", err)
+			code = 1
+		}
+	}
+	return code
+}
+
+// configureProduct sets up productID's indicators and per-product settings
+// from cfg.
+func configureProduct(cfg *Config, pipeline *Pipeline, productID string) {
+	for _, window := range cfg.Windows {
+		pipeline.AddIndicator(productID, window.label(), window.calculator())
+	}
+	for _, period := range cfg.SMA {
+		pipeline.AddIndicator(productID, fmt.Sprintf("sma%d", period), NewSMACalculator(period))
+	}
+	for _, period := range cfg.EMA {
+		pipeline.AddIndicator(productID, fmt.Sprintf("ema%d", period), NewEMACalculator(period))
+	}
+	for _, period := range cfg.Median {
+		pipeline.AddIndicator(productID, fmt.Sprintf("vwmedian%d", period), NewMedianCalculator(period))
+	}
+	if cfg.BollingerK > 0 {
+		pipeline.AddIndicator(productID, "bb", NewBollingerCalculator(cfg.BollingerK, cfg.windowFor(productID)))
+	}
+	if cfg.Imbalance {
+		pipeline.AddIndicator(productID, "imbalance", NewImbalanceCalculator(cfg.windowFor(productID)))
+	}
+	if !cfg.SessionAnchor.IsZero() {
+		pipeline.AddIndicator(productID, "session_vwap", NewAnchoredVWAPCalculator(cfg.SessionAnchor, cfg.SessionPeriod))
+	}
+	for _, spec := range cfg.Indicators.For(productID) {
+		// Set already built each spec once, so this cannot fail.
+		if c, err := spec.calculator(productID); err == nil {
+			pipeline.AddIndicator(productID, spec.name(), c)
+		}
+	}
+	pipeline.SetFormat(productID, cfg.formatFor(productID))
+	emit, _ := parseEmit(cfg.Emit.Get(productID, ""))
+	pipeline.SetEmitPolicy(productID, emit)
+	minSize, minNotional := cfg.minimumsFor(productID)
+	pipeline.SetMinimum(productID, minSize, minNotional)
+	hours, _ := parseTradingHours(cfg.TradingHours.Get(productID, ""))
+	pipeline.SetTradingHours(productID, hours)
+	channels, _ := parseChannelList(cfg.Channels.Get(productID, ""))
+	pipeline.SetChannels(productID, channels)
+}
+
+// runFeed keeps a websocket session open, reconnecting on failure. It returns
+// nil once ctx is cancelled and an error when retries are exhausted.
+func runFeed(ctx context.Context, cfg *Config, pipeline *Pipeline, logger Logger) error {
+	dialer, err := newDialer(cfg.Dialer)
+	if err != nil {
+		return err
+	}
+	if cfg.Dialer.InsecureSkipVerify {
+		logger.Warnf("TLS certificate verification is disabled for the feed connection")
+	}
+	backoff := NewBackoff(cfg.Retry)
+	pipeline.health.start()
+	retry := func() error {
+		delay, ok := backoff.Fail()
+		if !ok {
+			return fmt.Errorf("max connection retries (%d) reached", cfg.Retry.MaxRetries)
+		}
+		logger.Infof("Reconnecting in %v (attempt %d)", delay.Round(time.Millisecond), backoff.Failures())
+		sleepContext(ctx, delay)
+		return nil
+	}
+
+	for attempt := 0; ctx.Err() == nil; attempt++ {
+		if attempt > 0 {
+			reconnects.Inc()
+			pipeline.health.reconnect()
+		}
+		conn, err := connectWebSocket(ctx, dialer, cfg.FeedURL, logger)
+		if err != nil {
+			logger.Errorf("%v", err)
+			pipeline.reportError("", err)
+			if err := retry(); err != nil {
+				return err
 			}
-			time.Sleep(retryDelay)
 			continue
 		}
-		retryCount = 0
 
-		if err := handleConnection(conn, calculators, logger); err != nil {
+		connCtx, cancel := ctx, context.CancelFunc(func() {})
+		if cfg.MaxConnectionAge > 0 {
+			connCtx, cancel = context.WithTimeoutCause(ctx, cfg.MaxConnectionAge, errMaxConnectionAge)
+		}
+		connectedAt := time.Now()
+		err = handleConnection(connCtx, conn, cfg, pipeline, logger)
+		cancel()
+		if time.Since(connectedAt) >= cfg.Retry.HealthyAfter {
+			backoff.Reset()
+		}
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case errors.Is(err, errMaxConnectionAge):
+			logger.Infof("Recycling connection: %v", err)
+			continue
+		case err != nil:
 			logger.Errorf("Connection handling failed: %v", err)
+			pipeline.reportError("", fmt.Errorf("connection handling failed: %w", err))
+		}
+		if err := retry(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startHTTPServer serves handler on addr in the background and returns a
+// function that shuts the server down.
+func startHTTPServer(addr string, handler http.Handler, name string, logger Logger) (shutdown func()) {
+	server := &http.Server{Addr: addr, Handler: handler}
+	go func() {
+		logger.Infof("%s listening on %s", name, addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Errorf("%s server failed: %v", name, err)
 		}
-		conn.Close()
-		time.Sleep(retryDelay)
+	}()
+	return func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
 	}
 }
 
-func connectWebSocket(logger Logger) (*websocket.Conn, error) {
-	logger.Infof("Connecting to %s", websocketURL)
-	dialer := websocket.DefaultDialer
-	conn, _, err := dialer.Dial(websocketURL, nil)
+// sleepContext waits for d or until ctx is cancelled, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+func connectWebSocket(ctx context.Context, dialer *websocket.Dialer, url string, logger Logger) (*websocket.Conn, error) {
+	ctx, span := tracer.Start(ctx, "ws.connect",
+		trace.WithAttributes(attribute.String("url", url)))
+	defer span.End()
+
+	logger.Infof("Connecting to %s", url)
+	conn, resp, err := dialer.DialContext(ctx, url, nil)
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "dial failed")
 		return nil, fmt.Errorf("connection failed: %w", err)
 	}
+	if dialer.EnableCompression {
+		if strings.Contains(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate") {
+			logger.Debugf("Negotiated permessage-deflate compression")
+		} else {
+			logger.Infof("Exchange declined compression; receiving uncompressed messages")
+		}
+	}
 	return conn, nil
 }
 
-func handleConnection(conn *websocket.Conn, calculators map[string]Calculator, logger Logger) error {
-	if err := subscribe(conn, logger); err != nil {
+// handleConnection owns conn until it returns: the reader goroutine has
+// always exited and the socket is closed by then. Cancelling ctx drains the
+// connection and returns context.Cause(ctx).
+func handleConnection(ctx context.Context, conn *websocket.Conn, cfg *Config, pipeline *Pipeline, logger Logger) error {
+	defer conn.Close()
+
+	if err := pipeline.attachFeed(ctx, conn, logger); err != nil {
 		return err
 	}
+	defer pipeline.detachFeed(conn)
 
-	messageChan := make(chan []byte)
+	messageChan := make(chan inboundMessage, cfg.MessageBuffer)
 	errChan := make(chan error)
 
-	go readMessages(conn, messageChan, errChan)
+	// The reader outlives ctx so that drainConnection can still receive the
+	// messages that were in flight when cancellation arrived.
+	readCtx, stopReader := context.WithCancel(context.WithoutCancel(ctx))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		readMessages(readCtx, conn, cfg.StaleTimeout, cfg.MaxMessageSize, cfg.Backpressure, messageChan, errChan)
+	}()
+	defer func() {
+		stopReader()
+		conn.Close() // unblocks a pending ReadMessage
+		wg.Wait()
+	}()
 
 	for {
 		select {
 		case message := <-messageChan:
-			processMessage(message, calculators, logger)
+			pipeline.handle(message)
 		case err := <-errChan:
 			return err
+		case <-pipeline.breaker.Tripped():
+			return fmt.Errorf("%w within %v", errMalformedFeed, breakerWindow)
+		case <-ctx.Done():
+			drainConnection(conn, messageChan, errChan, pipeline, logger)
+			return context.Cause(ctx)
+		}
+	}
+}
+
+// drainConnection sends a close frame and keeps processing messages the
+// exchange had already sent until it acknowledges the close or drainTimeout
+// elapses.
+func drainConnection(conn *websocket.Conn, messageChan <-chan inboundMessage, errChan <-chan error, pipeline *Pipeline, logger Logger) {
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "shutting down")
+	if err := conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(drainTimeout)); err != nil {
+		logger.Warnf("Sending close frame failed: %v", err)
+		return
+	}
+
+	timeout := time.NewTimer(drainTimeout)
+	defer timeout.Stop()
+	drained := 0
+	for {
+		select {
+		case message, ok := <-messageChan:
+			if !ok {
+				return
+			}
+			pipeline.handle(message)
+			drained++
+		case <-errChan:
+			logger.Infof("Websocket closed after draining %d messages", drained)
+			return
+		case <-timeout.C:
+			logger.Warnf("Timed out waiting for close acknowledgement after draining %d messages", drained)
+			return
 		}
 	}
 }
 
-func readMessages(conn *websocket.Conn, messageChan chan<- []byte, errChan chan<- error) {
+// readMessages forwards every frame from conn. With a non-zero staleTimeout a
+// read that waits longer than that fails with errStaleFeed; heartbeats keep a
+// healthy but quiet feed well inside the limit. A non-zero maxSize fails the
+// read of any larger message. When messageChan is full, policy decides
+// whether the reader waits or drops the oldest message.
+func readMessages(ctx context.Context, conn *websocket.Conn, staleTimeout time.Duration, maxSize int64, policy string, messageChan chan inboundMessage, errChan chan<- error) {
 	defer close(messageChan)
 	defer close(errChan)
+	if maxSize > 0 {
+		conn.SetReadLimit(maxSize)
+	}
 
 	for {
+		start := time.Now()
+		if staleTimeout > 0 {
+			conn.SetReadDeadline(start.Add(staleTimeout))
+		}
 		_, message, err := conn.ReadMessage()
 		if err != nil {
-			errChan <- fmt.Errorf("read error: %w", err)
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				staleFeeds.Inc()
+				err = fmt.Errorf("%w: no message for %v", errStaleFeed, staleTimeout)
+			}
+			if errors.Is(err, websocket.ErrReadLimit) {
+				err = fmt.Errorf("%w: message larger than %d bytes", err, maxSize)
+			}
+			select {
+			case errChan <- fmt.Errorf("read error: %w", err):
+			case <-ctx.Done():
+			}
+			return
+		}
+		readLatency.Observe(time.Since(start).Seconds())
+		payloadBytes.Add(float64(len(message)))
+		msgCtx, span := tracer.Start(ctx, "ws.message",
+			trace.WithAttributes(attribute.Int("bytes", len(message))))
+		messageBacklog.Inc()
+		sent := enqueue(messageChan, inboundMessage{ctx: msgCtx, data: message}, policy, ctx.Done(), func(old inboundMessage) {
+			trace.SpanFromContext(old.ctx).End()
+			messageBacklog.Dec()
+			backpressureDrops.WithLabelValues("feed").Inc()
+		})
+		if !sent {
+			span.End()
+			messageBacklog.Dec()
 			return
 		}
-		messageChan <- message
 	}
 }
 
-func processMessage(message []byte, calculators map[string]Calculator, logger Logger) {
+// handle processes one inbound message and closes out its span once the
+// message's product worker is done with it.
+func (p *Pipeline) handle(message inboundMessage) {
+	p.health.message()
+	p.dispatchMessage(message.ctx, message.data, func() {
+		trace.SpanFromContext(message.ctx).End()
+		messageBacklog.Dec()
+	})
+}
+
+func (p *Pipeline) processMessage(ctx context.Context, message []byte) {
+	p.dispatchMessage(ctx, message, nil)
+}
+
+// dispatchMessage decodes message and dispatches the trade, calling done
+// (if not nil) once it has been processed or failed to decode. Control and
+// order book messages are handled in place.
+func (p *Pipeline) dispatchMessage(ctx context.Context, message []byte, done func()) {
+	p.countMessage()
+	if p.advanced {
+		p.dispatchAdvanced(ctx, message, done)
+		return
+	}
+	_, decodeSpan := tracer.Start(ctx, "decode")
 	var trade Trade
-	if err := json.Unmarshal(message, &trade); err != nil {
-		logger.Errorf("JSON decode error: %v", err)
+	err := json.Unmarshal(message, &trade)
+	decodeSpan.End()
+	if err != nil {
+		p.malformedMessage(p.logger, "", "JSON decode error: %v", err)
+		parseErrors.Inc()
+		if done != nil {
+			done()
+		}
 		return
 	}
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("type", trade.Type),
+		attribute.String("product", trade.ProductID),
+	)
+	if trade.ProductID != "" {
+		p.throughput.addBytes(trade.ProductID, len(message))
+	}
+	switch {
+	case isOrderMessage(trade.Type):
+		// The full channel's order messages are dropped here, so they do
+		// not take up room in the product queues.
+		fullMessages.WithLabelValues(trade.Type).Inc()
+	case trade.Type == "subscriptions", trade.Type == "error":
+		p.handleFeedMessage(message)
+	case trade.Type == "snapshot", trade.Type == "l2update":
+		if p.books != nil {
+			if err := p.books.Apply(message); err != nil {
+				p.logger.With("product", trade.ProductID).Errorf("Order book update failed: %v", err)
+			}
+		}
+	case trade.Type == "ticker" && p.tradeChannelFor(trade.ProductID) != channelTicker:
+		// Subscribed alongside a product's matches; its trades would only
+		// be dropped as duplicates.
+	case trade.Type == "ticker":
+		trade = tickerTrade(trade)
+		p.observeLatency(trade)
+		p.dispatch(ctx, trade, done)
+		return
+	default:
+		p.observeLatency(trade)
+		p.dispatch(ctx, trade, done)
+		return
+	}
+	if done != nil {
+		done()
+	}
+}
 
-	if trade.Type != "match" {
+// processTrade handles a decoded feed message, ignoring anything other than
+// match and last_match.
+func (p *Pipeline) processTrade(ctx context.Context, trade Trade) {
+	logger := p.logger.With("product", trade.ProductID)
+	switch trade.Type {
+	case "match":
+	case "last_match":
+		// Sent once per product on subscribe; only used to spot trades that
+		// happened while disconnected.
+		missed := p.gaps.Skip(trade.ProductID, trade.TradeID)
+		p.recordGap(logger, trade, missed)
+		if missed > 0 && p.gapFill != nil {
+			// The last_match itself was never applied, so it is the last of
+			// the missing trades.
+			p.fillGap(ctx, logger, trade.ProductID, trade.TradeID-missed+1, trade.TradeID)
+		}
+		return
+	default:
 		return
 	}
 
-	logger.Infof("Received trade: %s %s @ %s", trade.ProductID, trade.Size, trade.Price)
+	logger.Debugf("Received trade: %s @ %s", trade.Size, trade.Price)
+	if update, ok := p.applyTrade(ctx, logger, trade); ok && p.emit.offer(update) {
+		p.publish(ctx, logger, update)
+	}
+}
 
-	calculator, exists := calculators[trade.ProductID]
+// applyTrade runs a match through deduplication, its calculator and gap
+// detection, returning the resulting update if the trade was accepted.
+func (p *Pipeline) applyTrade(ctx context.Context, logger Logger, trade Trade) (VWAPUpdate, bool) {
+	calculator, list, exists := p.calculator(trade.ProductID)
 	if !exists {
-		logger.Errorf("Received trade for unknown product: %s", trade.ProductID)
-		return
+		logger.Warnf("Received trade for unknown product")
+		return VWAPUpdate{}, false
 	}
 
-	if err := calculator.Update(trade.Price, trade.Size); err != nil {
-		logger.Errorf("Update failed: %v", err)
-		return
+	if p.dedupe.Seen(trade.ProductID, trade.TradeID) {
+		logger.Debugf("Dropping duplicate trade_id %d", trade.TradeID)
+		duplicateTrades.WithLabelValues(trade.ProductID).Inc()
+		p.counts.tradeError(trade.ProductID, tradeErrDuplicate)
+		return VWAPUpdate{}, false
+	}
+
+	if p.belowMinimum(logger, trade) {
+		return VWAPUpdate{}, false
+	}
+
+	// Trades outside the session are not part of its VWAP, but they still
+	// happened: the gap detector and trade sinks see them.
+	if p.offSession(logger, trade) {
+		p.recordGap(logger, trade, p.gaps.Observe(trade.ProductID, trade.TradeID))
+		p.recordTrade(logger, trade)
+		return VWAPUpdate{}, false
+	}
+
+	// Jumps are checked before outlier filtering so that bad prints raise
+	// an alert as well as being quarantined.
+	if p.jumps != nil {
+		if alert, ok := p.jumps.Check(trade); ok {
+			p.raiseAlert(logger, alert)
+		}
 	}
 
-	vwap := calculator.Calculate()
-	fmt.Printf("%s VWAP: %s\n", trade.ProductID, vwap)
+	if p.rejectOutlier(logger, calculator, trade) {
+		return VWAPUpdate{}, false
+	}
+
+	_, updateSpan := tracer.Start(ctx, "calculator.update")
+	err := updateCalculator(calculator, trade)
+	updateSpan.End()
+	if err != nil {
+		p.malformedMessage(logger, trade.ProductID, "Update failed: %v", err)
+		p.counts.tradeError(trade.ProductID, tradeErrInvalid)
+		return VWAPUpdate{}, false
+	}
+	// Only trades the calculator accepted are logged, so a replay doesn't
+	// trip over a bad one.
+	if p.wal != nil {
+		if err := p.wal.Append(trade); err != nil {
+			logger.Errorf("Writing trade log failed: %v", err)
+		}
+	}
+	var indicators map[string]string
+	if len(list) > 0 {
+		indicators = make(map[string]string, len(list))
+		for _, ind := range list {
+			if err := updateCalculator(ind.calculator, trade); err != nil {
+				logger.Errorf("Updating %s failed: %v", ind.name, err)
+			}
+			if multi, ok := ind.calculator.(MultiCalculator); ok {
+				for key, value := range multi.Values() {
+					indicators[ind.name+"_"+key] = value
+				}
+			} else {
+				indicators[ind.name] = ind.calculator.Calculate()
+			}
+		}
+	}
+	tradeCount := p.countTrade(trade.ProductID)
+	tradesProcessed.WithLabelValues(trade.ProductID).Inc()
+	p.throughput.addTrade(trade.ProductID, trade.Size)
+	p.recordGap(logger, trade, p.gaps.Observe(trade.ProductID, trade.TradeID))
+	p.recordTrade(logger, trade)
+
+	var high, low string
+	if ranged, ok := calculator.(RangeCalculator); ok {
+		high, low = ranged.Range()
+	}
+	stddev, bands := p.deviationBands(calculator)
+	stats := calculator.Stats()
+
+	update := VWAPUpdate{
+		ProductID:    trade.ProductID,
+		VWAP:         calculator.Calculate(),
+		Method:       calculatorMethod(calculator),
+		WindowSize:   windowSizeOf(calculator),
+		TradeCount:   tradeCount,
+		High:         high,
+		Low:          low,
+		StdDev:       stddev,
+		Bands:        bands,
+		MissedTrades: p.gaps.Missed(trade.ProductID),
+		Indicators:   indicators,
+		Volume:       stats.Volume,
+		Notional:     stats.Notional,
+		Time:         time.Now().UTC(),
+	}
+	p.normalizeUSD(&update, trade, calculator)
+	p.quoteBook(&update, calculator)
+	p.fillDeviation(&update, trade)
+	p.checkRules(logger, trade, update)
+	return update, true
+}
+
+// recordTrade passes trade to every trade sink.
+func (p *Pipeline) recordTrade(logger Logger, trade Trade) {
+	for _, sink := range p.tradeSinks {
+		if err := sink.RecordTrade(trade); err != nil {
+			logger.Errorf("Recording trade failed: %v", err)
+			p.reportError(trade.ProductID, fmt.Errorf("recording trade failed: %w", err))
+		}
+	}
+}
+
+// updateCalculator feeds trade to c, passing the trade time to calculators
+// that use it and the whole trade to custom indicators and others that
+// need it.
+func updateCalculator(c Calculator, trade Trade) error {
+	if whole, ok := c.(TradeCalculator); ok {
+		return whole.UpdateTrade(trade)
+	}
+	if timed, ok := c.(TimedCalculator); ok {
+		at := trade.Time
+		if at.IsZero() {
+			at = time.Now()
+		}
+		return timed.UpdateAt(trade.Price, trade.Size, at)
+	}
+	return c.Update(trade.Price, trade.Size)
 }
 
-func subscribe(conn *websocket.Conn, logger Logger) error {
+func (p *Pipeline) publish(ctx context.Context, logger Logger, update VWAPUpdate) {
+	_, span := tracer.Start(ctx, "publish")
+	defer span.End()
+	for _, sink := range p.sinks {
+		if err := sink.Publish(update); err != nil {
+			logger.Errorf("Publish failed: %v", err)
+			p.reportError(update.ProductID, fmt.Errorf("publish failed: %w", err))
+		}
+	}
+	if p.cross != nil {
+		for _, derived := range p.cross.Observe(update) {
+			p.publish(ctx, logger, derived)
+		}
+	}
+}
+
+// Backfill seeds a product's calculator with historical trades, given in
+// chronological order, and publishes a single update for the result.
+func (p *Pipeline) Backfill(ctx context.Context, productID string, trades []Trade) int {
+	logger := p.logger.With("product", productID)
+	var (
+		last    VWAPUpdate
+		applied int
+	)
+	for _, trade := range trades {
+		if update, ok := p.applyTrade(ctx, logger, trade); ok {
+			last = update
+			applied++
+		}
+	}
+	if applied > 0 {
+		p.publish(ctx, logger, last)
+	}
+	return applied
+}
+
+func (p *Pipeline) recordGap(logger Logger, trade Trade, missed int64) {
+	if missed == 0 {
+		return
+	}
+	logger.Warnf("Trade gap: %d trades missing before trade_id %d", missed, trade.TradeID)
+	tradeGaps.WithLabelValues(trade.ProductID).Inc()
+	missedTrades.WithLabelValues(trade.ProductID).Add(float64(missed))
+}
+
+// subscribe sends a subscribe, or with msgType "unsubscribe" an unsubscribe,
+// message for productIDs on the pipeline's channels, signed when it has
+// credentials.
+func (p *Pipeline) subscribe(ctx context.Context, conn *websocket.Conn, msgType string, productIDs []string) error {
+	_, span := tracer.Start(ctx, "ws."+msgType)
+	defer span.End()
+
+	if p.advanced {
+		if err := p.subscribeAdvanced(conn, msgType, productIDs); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, msgType+" failed")
+			return err
+		}
+		return nil
+	}
 	subMsg := map[string]interface{}{
-		"type":        "subscribe",
-		"product_ids": []string{"BTC-USD", "ETH-USD", "ETH-BTC"},
-		"channels":    []string{"matches"},
+		"type":        msgType,
+		"product_ids": productIDs,
+		"channels":    p.feedSubscription(productIDs),
+	}
+	if p.signer != nil {
+		for field, value := range p.signer.sign() {
+			subMsg[field] = value
+		}
+	}
+	if p.writeWait > 0 {
+		conn.SetWriteDeadline(time.Now().Add(p.writeWait))
 	}
 	if err := conn.WriteJSON(subMsg); err != nil {
-		return fmt.Errorf("subscribe failed: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, msgType+" failed")
+		return fmt.Errorf("%s failed: %w", msgType, err)
 	}
-	logger.Infof("Subscribed to matches channel")
 	return nil
 }
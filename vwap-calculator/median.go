@@ -0,0 +1,210 @@
+package main
+
+import (
+	"math/big"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// MedianCalculator is the volume-weighted median price of the last period
+// trades: the lowest price at or below which at least half the window's
+// volume traded. Unlike the VWAP it is not pulled by a few huge prints at
+// outlying prices.
+//
+// The window's trades are kept in a treap ordered by price, each node
+// holding its subtree's volume, so adding a trade, evicting the oldest and
+// finding the median each take O(log period).
+type MedianCalculator struct {
+	mu     sync.Mutex
+	period int
+	window []*medianNode // ring of the window's trades, oldest at start
+	start  int
+	seq    int64
+	root   *medianNode
+	clock  tradeClock
+	formatted
+}
+
+// medianNode is one trade in the treap. Trades at the same price are ordered
+// by arrival, so each can be found again for eviction.
+type medianNode struct {
+	price  *big.Rat
+	size   *big.Rat
+	seq    int64
+	prio   uint64
+	volume big.Rat // size of this trade and every trade below it
+	left   *medianNode
+	right  *medianNode
+}
+
+func NewMedianCalculator(period int) *MedianCalculator {
+	return &MedianCalculator{period: period, window: make([]*medianNode, 0, period), clock: newTradeClock(period)}
+}
+
+func (c *MedianCalculator) Update(priceStr, sizeStr string) error {
+	return c.UpdateAt(priceStr, sizeStr, time.Now())
+}
+
+func (c *MedianCalculator) UpdateAt(priceStr, sizeStr string, at time.Time) error {
+	price, err := parsePrice(priceStr, sizeStr)
+	if err != nil {
+		return err
+	}
+	size, _ := new(big.Rat).SetString(sizeStr)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	node := &medianNode{price: price, size: size, seq: c.seq, prio: rand.Uint64()}
+	node.update()
+	if len(c.window) < c.period {
+		c.window = append(c.window, node)
+	} else {
+		c.root = c.root.remove(c.window[c.start])
+		c.window[c.start] = node
+		c.start = (c.start + 1) % c.period
+	}
+	c.root = c.root.insert(node)
+	c.clock.add(at)
+	return nil
+}
+
+func (c *MedianCalculator) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.window, c.start, c.root = c.window[:0], 0, nil
+	c.clock.reset()
+}
+
+func (c *MedianCalculator) TradeCount() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clock.trades
+}
+
+func (c *MedianCalculator) Stats() CalculatorStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.root == nil {
+		return c.clock.stats("", "")
+	}
+	return c.clock.stats(volumeString(&c.root.volume), "")
+}
+
+func (c *MedianCalculator) Calculate() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.root == nil {
+		return "0"
+	}
+	half := new(big.Rat).Quo(&c.root.volume, big.NewRat(2, 1))
+	return c.formatRat(c.root.median(half))
+}
+
+func (n *medianNode) before(other *medianNode) bool {
+	if cmp := n.price.Cmp(other.price); cmp != 0 {
+		return cmp < 0
+	}
+	return n.seq < other.seq
+}
+
+// update recomputes n's subtree volume from its children.
+func (n *medianNode) update() {
+	n.volume.Set(n.size)
+	if n.left != nil {
+		n.volume.Add(&n.volume, &n.left.volume)
+	}
+	if n.right != nil {
+		n.volume.Add(&n.volume, &n.right.volume)
+	}
+}
+
+// insert adds node to the treap rooted at n and returns the new root.
+func (n *medianNode) insert(node *medianNode) *medianNode {
+	if n == nil {
+		return node
+	}
+	if node.before(n) {
+		n.left = n.left.insert(node)
+		if n.left.prio > n.prio {
+			n = n.rotateRight()
+		}
+	} else {
+		n.right = n.right.insert(node)
+		if n.right.prio > n.prio {
+			n = n.rotateLeft()
+		}
+	}
+	n.update()
+	return n
+}
+
+// remove takes node out of the treap rooted at n and returns the new root.
+func (n *medianNode) remove(node *medianNode) *medianNode {
+	switch {
+	case n == nil:
+		return nil
+	case n == node:
+		return mergeMedianNodes(n.left, n.right)
+	case node.before(n):
+		n.left = n.left.remove(node)
+	default:
+		n.right = n.right.remove(node)
+	}
+	n.update()
+	return n
+}
+
+func (n *medianNode) rotateRight() *medianNode {
+	l := n.left
+	n.left, l.right = l.right, n
+	n.update()
+	return l
+}
+
+func (n *medianNode) rotateLeft() *medianNode {
+	r := n.right
+	n.right, r.left = r.left, n
+	n.update()
+	return r
+}
+
+// mergeMedianNodes joins two treaps where every node of a comes before every
+// node of b.
+func mergeMedianNodes(a, b *medianNode) *medianNode {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	case a.prio > b.prio:
+		a.right = mergeMedianNodes(a.right, b)
+		a.update()
+		return a
+	default:
+		b.left = mergeMedianNodes(a, b.left)
+		b.update()
+		return b
+	}
+}
+
+// median returns the lowest price at which the volume traded at or below it
+// reaches half.
+func (n *medianNode) median(half *big.Rat) *big.Rat {
+	remaining := new(big.Rat).Set(half)
+	for {
+		if n.left != nil && n.left.volume.Cmp(remaining) >= 0 {
+			n = n.left
+			continue
+		}
+		if n.left != nil {
+			remaining.Sub(remaining, &n.left.volume)
+		}
+		if n.size.Cmp(remaining) >= 0 || n.right == nil {
+			return n.price
+		}
+		remaining.Sub(remaining, n.size)
+		n = n.right
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"math/big"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestMedianCalculator(t *testing.T) {
+	calc := NewMedianCalculator(3)
+	if got := calc.Calculate(); got != "0" {
+		t.Errorf("Expected 0 before any trades, got %s", got)
+	}
+	for i, tc := range []struct{ price, size, want string }{
+		{"10", "1", "10.0000"},
+		{"20", "1", "10.0000"}, // half the volume is at 10
+		{"30", "5", "30.0000"},
+		{"15", "2", "30.0000"}, // 10 evicted: 15×2, 20×1, 30×5
+		{"5", "10", "5.0000"},  // 20 evicted: 5×10 outweighs the rest
+	} {
+		if err := calc.Update(tc.price, tc.size); err != nil {
+			t.Fatal(err)
+		}
+		if got := calc.Calculate(); got != tc.want {
+			t.Errorf("After trade %d: expected %s, got %s", i, tc.want, got)
+		}
+	}
+	if got := calc.Stats().Volume; got != "17.00000000" {
+		t.Errorf("Expected window volume 17, got %s", got)
+	}
+	if err := calc.Update("10", "0"); err == nil {
+		t.Error("Expected error for zero size")
+	}
+	calc.Reset()
+	if got := calc.Calculate(); got != "0" {
+		t.Errorf("Expected 0 after reset, got %s", got)
+	}
+}
+
+// TestMedianCalculatorMatchesSort checks the treap against sorting the window
+// after every trade, with repeated prices and evictions.
+func TestMedianCalculatorMatchesSort(t *testing.T) {
+	const period = 25
+	calc := NewMedianCalculator(period)
+	calc.SetFormat(priceFormat{places: 0, rounding: roundHalfUp})
+	type trade struct{ price, size int64 }
+	var trades []trade
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := range 500 {
+		tr := trade{price: 90 + rng.Int64N(20), size: 1 + rng.Int64N(9)}
+		trades = append(trades, tr)
+		if err := calc.Update(strconv.FormatInt(tr.price, 10), strconv.FormatInt(tr.size, 10)); err != nil {
+			t.Fatal(err)
+		}
+
+		window := slices.Clone(trades[max(len(trades)-period, 0):])
+		slices.SortFunc(window, func(a, b trade) int { return int(a.price - b.price) })
+		var total, cumulative int64
+		for _, tr := range window {
+			total += tr.size
+		}
+		var want int64
+		for _, tr := range window {
+			cumulative += tr.size
+			if 2*cumulative >= total {
+				want = tr.price
+				break
+			}
+		}
+		if got := calc.Calculate(); got != big.NewRat(want, 1).FloatString(0) {
+			t.Fatalf("After trade %d: expected %d, got %s", i, want, got)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Pipeline metrics, exposed on /metrics when the HTTP API is enabled.
+var (
+	tradesProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vwap_trades_processed_total",
+		Help: "Trades accepted into a calculator, by product.",
+	}, []string{"product"})
+
+	parseErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "vwap_parse_errors_total",
+		Help: "Feed messages that could not be decoded.",
+	})
+
+	breakerTrips = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "vwap_breaker_trips_total",
+		Help: "Feed connections dropped because too many messages were malformed.",
+	})
+
+	lateTrades = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vwap_late_trades_total",
+		Help: "Trades that arrived after a later trade had already left the reorder window, by product.",
+	}, []string{"product"})
+
+	reconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "vwap_reconnects_total",
+		Help: "Websocket reconnection attempts after the initial connection.",
+	})
+
+	staleFeeds = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "vwap_stale_feed_total",
+		Help: "Connections dropped because no message arrived within the stale timeout.",
+	})
+
+	duplicateTrades = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vwap_duplicate_trades_total",
+		Help: "Trades dropped because their trade_id was already applied, by product.",
+	}, []string{"product"})
+
+	tradeGaps = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vwap_trade_gaps_total",
+		Help: "Discontinuities detected in trade_id, by product.",
+	}, []string{"product"})
+
+	missedTrades = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vwap_missed_trades_total",
+		Help: "Trades skipped by the feed according to trade_id gaps, by product.",
+	}, []string{"product"})
+
+	gapFilledTrades = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vwap_gap_filled_trades_total",
+		Help: "Missed trades fetched from the REST API after a reconnect and applied, by product.",
+	}, []string{"product"})
+
+	dustTrades = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vwap_dust_trades_total",
+		Help: "Trades ignored as below -min-size or -min-notional, by product.",
+	}, []string{"product"})
+
+	offSessionTrades = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vwap_off_session_trades_total",
+		Help: "Trades outside -trading-hours, passed to trade sinks but not applied to the VWAP, by product.",
+	}, []string{"product"})
+
+	outlierTrades = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vwap_outlier_trades_total",
+		Help: "Trades quarantined by the outlier filter, by product.",
+	}, []string{"product"})
+
+	alertsRaised = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vwap_alerts_total",
+		Help: "Alerts raised, by product and kind.",
+	}, []string{"product", "kind"})
+
+	notionalUSD = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vwap_notional_usd_total",
+		Help: "USD value of accepted trades, by product; requires -usd-notional.",
+	}, []string{"product"})
+
+	backpressureDrops = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vwap_backpressure_drops_total",
+		Help: "Messages dropped by the drop-oldest backpressure policy, by queue: feed or a product ID.",
+	}, []string{"queue"})
+
+	feedErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "vwap_feed_errors_total",
+		Help: "Error messages received from the exchange, such as a rejected subscription.",
+	})
+
+	fullMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vwap_order_messages_total",
+		Help: "Order messages from the full channel skipped as not being trades, by type.",
+	}, []string{"type"})
+
+	confirmedSubscriptions = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "vwap_subscribed",
+		Help: "1 when the exchange has confirmed the trade channel subscription for a product, 0 when it left the product out.",
+	}, []string{"product"})
+
+	currentVWAP = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "vwap_current",
+		Help: "Most recent VWAP, by product.",
+	}, []string{"product"})
+
+	windowVolume = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "vwap_window_volume",
+		Help: "Total size of the trades in the VWAP window, by product.",
+	}, []string{"product"})
+
+	windowNotional = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "vwap_window_notional",
+		Help: "Total price × size of the trades in the VWAP window, in the quote currency, by product.",
+	}, []string{"product"})
+
+	readLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "vwap_ws_read_seconds",
+		Help:    "Time spent waiting for each websocket message.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 4, 10),
+	})
+
+	receivedBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vwap_ws_received_bytes_total",
+		Help: "Bytes received on the feed connection, by layer: wire (as read from the socket, compressed when negotiated) or payload (decoded messages).",
+	}, []string{"layer"})
+	wireBytes    = receivedBytes.WithLabelValues("wire")
+	payloadBytes = receivedBytes.WithLabelValues("payload")
+
+	feedLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "vwap_feed_latency_seconds",
+		Help:    "Time from a trade's exchange timestamp to its receipt, by product.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"product"})
+
+	productBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vwap_product_received_bytes_total",
+		Help: "Bytes of feed messages received, by product.",
+	}, []string{"product"})
+
+	tradedVolume = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vwap_volume_total",
+		Help: "Total size of trades accepted into a calculator, by product.",
+	}, []string{"product"})
+
+	messageBacklog = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "vwap_message_backlog",
+		Help: "Messages read from the websocket but not yet processed.",
+	})
+
+	leaderGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "vwap_leader",
+		Help: "1 while this replica holds the -leader-lock and publishes, 0 while it stands by.",
+	})
+)
+
+// MetricsSink mirrors each VWAP update into the vwap_current gauge, and its
+// window totals into vwap_window_volume and vwap_window_notional.
+type MetricsSink struct{}
+
+func (MetricsSink) Publish(update VWAPUpdate) error {
+	value, err := strconv.ParseFloat(update.VWAP, 64)
+	if err != nil {
+		return fmt.Errorf("metrics: %w", err)
+	}
+	currentVWAP.WithLabelValues(update.ProductID).Set(value)
+	for gauge, total := range map[*prometheus.GaugeVec]string{windowVolume: update.Volume, windowNotional: update.Notional} {
+		if total == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(total, 64)
+		if err != nil {
+			return fmt.Errorf("metrics: %w", err)
+		}
+		gauge.WithLabelValues(update.ProductID).Set(value)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsSink(t *testing.T) {
+	if err := (MetricsSink{}).Publish(VWAPUpdate{ProductID: "BTC-USD", VWAP: "45000.1234"}); err != nil {
+		t.Fatalf("Publish returned error: %v", err)
+	}
+	if got := testutil.ToFloat64(currentVWAP.WithLabelValues("BTC-USD")); got != 45000.1234 {
+		t.Errorf("Expected 45000.1234, got %f", got)
+	}
+	if err := (MetricsSink{}).Publish(VWAPUpdate{ProductID: "BTC-USD", VWAP: "bogus"}); err == nil {
+		t.Error("Expected error for non-numeric VWAP")
+	}
+}
+
+func TestMetricsSinkWindowTotals(t *testing.T) {
+	update := VWAPUpdate{ProductID: "SOL-USD", VWAP: "150", Volume: "2.50000000", Notional: "375.00000000"}
+	if err := (MetricsSink{}).Publish(update); err != nil {
+		t.Fatalf("Publish returned error: %v", err)
+	}
+	if got := testutil.ToFloat64(windowVolume.WithLabelValues("SOL-USD")); got != 2.5 {
+		t.Errorf("Expected window volume 2.5, got %f", got)
+	}
+	if got := testutil.ToFloat64(windowNotional.WithLabelValues("SOL-USD")); got != 375 {
+		t.Errorf("Expected window notional 375, got %f", got)
+	}
+}
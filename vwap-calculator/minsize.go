@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// tradeMinimum holds the smallest trade a product's calculator accepts. A nil
+// bound is not checked.
+type tradeMinimum struct {
+	size     *big.Rat
+	notional *big.Rat
+}
+
+// SetMinimum makes the pipeline ignore productID trades smaller than size or
+// with price × size below notional. Either may be nil.
+func (p *Pipeline) SetMinimum(productID string, size, notional *big.Rat) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if size == nil && notional == nil {
+		delete(p.minimums, productID)
+		return
+	}
+	p.minimums[productID] = tradeMinimum{size: size, notional: notional}
+}
+
+// belowMinimum reports whether trade is dust under its product's minimum.
+func (p *Pipeline) belowMinimum(logger Logger, trade Trade) bool {
+	p.mu.RLock()
+	min, ok := p.minimums[trade.ProductID]
+	p.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	price, ok1 := new(big.Rat).SetString(trade.Price)
+	size, ok2 := new(big.Rat).SetString(trade.Size)
+	if !ok1 || !ok2 {
+		// Let the calculator report the malformed trade.
+		return false
+	}
+	if (min.size != nil && size.Cmp(min.size) < 0) ||
+		(min.notional != nil && new(big.Rat).Mul(price, size).Cmp(min.notional) < 0) {
+		logger.Debugf("Ignoring trade_id %d below the minimum size: %s @ %s", trade.TradeID, trade.Size, trade.Price)
+		dustTrades.WithLabelValues(trade.ProductID).Inc()
+		p.counts.tradeError(trade.ProductID, tradeErrDust)
+		return true
+	}
+	return false
+}
+
+// parseMinimum parses a -min-size or -min-notional value; "" means no minimum.
+func parseMinimum(s string) (*big.Rat, error) {
+	if s == "" {
+		return nil, nil
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok || r.Sign() < 0 {
+		return nil, fmt.Errorf("invalid minimum %q: must be a non-negative number", s)
+	}
+	return r, nil
+}
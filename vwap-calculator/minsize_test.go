@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math/big"
+	"testing"
+)
+
+func TestPipelineMinimum(t *testing.T) {
+	store := NewStore()
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"), store)
+	pipeline.SetMinimum("BTC-USD", big.NewRat(1, 100), big.NewRat(5, 1))
+
+	for _, msg := range []string{
+		`{"type":"match","product_id":"BTC-USD","trade_id":1,"price":"100","size":"1"}`,
+		`{"type":"match","product_id":"BTC-USD","trade_id":2,"price":"900","size":"0.001"}`, // below min size
+		`{"type":"match","product_id":"BTC-USD","trade_id":3,"price":"400","size":"0.01"}`,  // notional 4
+		`{"type":"match","product_id":"BTC-USD","trade_id":4,"price":"200","size":"0.05"}`,  // notional 10
+	} {
+		pipeline.processMessage(context.Background(), []byte(msg))
+	}
+
+	update, _ := store.Get("BTC-USD")
+	if update.TradeCount != 2 || update.VWAP != "104.7619" {
+		t.Errorf("Expected VWAP 104.7619 over 2 trades, got %s over %d", update.VWAP, update.TradeCount)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"math"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// decodeMsgpack decodes the subset of MessagePack marshalMsgpack writes,
+// returning integers as int64 and floats as float64.
+func decodeMsgpack(t *testing.T, b []byte) (any, []byte) {
+	t.Helper()
+	if len(b) == 0 {
+		t.Fatal("Truncated MessagePack")
+	}
+	c, b := b[0], b[1:]
+	length := func(n int) (int, []byte) {
+		switch n {
+		case 1:
+			return int(b[0]), b[1:]
+		case 2:
+			return int(binary.BigEndian.Uint16(b)), b[2:]
+		}
+		return int(binary.BigEndian.Uint32(b)), b[4:]
+	}
+	str := func(n int, b []byte) (any, []byte) { return string(b[:n]), b[n:] }
+	array := func(n int, b []byte) (any, []byte) {
+		a := make([]any, n)
+		for i := range a {
+			a[i], b = decodeMsgpack(t, b)
+		}
+		return a, b
+	}
+	object := func(n int, b []byte) (any, []byte) {
+		m := make(map[string]any, n)
+		for range n {
+			var k, v any
+			k, b = decodeMsgpack(t, b)
+			v, b = decodeMsgpack(t, b)
+			m[k.(string)] = v
+		}
+		return m, b
+	}
+	switch {
+	case c <= 0x7f:
+		return int64(c), b
+	case c >= 0xe0:
+		return int64(int8(c)), b
+	case c&0xe0 == 0xa0:
+		return str(int(c&0x1f), b)
+	case c&0xf0 == 0x90:
+		return array(int(c&0x0f), b)
+	case c&0xf0 == 0x80:
+		return object(int(c&0x0f), b)
+	}
+	switch c {
+	case 0xc0:
+		return nil, b
+	case 0xc2, 0xc3:
+		return c == 0xc3, b
+	case 0xcb:
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), b[8:]
+	case 0xcc:
+		return int64(b[0]), b[1:]
+	case 0xcd:
+		return int64(binary.BigEndian.Uint16(b)), b[2:]
+	case 0xce:
+		return int64(binary.BigEndian.Uint32(b)), b[4:]
+	case 0xcf:
+		return int64(binary.BigEndian.Uint64(b)), b[8:]
+	case 0xd0:
+		return int64(int8(b[0])), b[1:]
+	case 0xd1:
+		return int64(int16(binary.BigEndian.Uint16(b))), b[2:]
+	case 0xd2:
+		return int64(int32(binary.BigEndian.Uint32(b))), b[4:]
+	case 0xd3:
+		return int64(binary.BigEndian.Uint64(b)), b[8:]
+	case 0xd9, 0xda, 0xdb:
+		n, b := length(map[byte]int{0xd9: 1, 0xda: 2, 0xdb: 4}[c])
+		return str(n, b)
+	case 0xdc, 0xdd:
+		n, b := length(map[byte]int{0xdc: 2, 0xdd: 4}[c])
+		return array(n, b)
+	case 0xde, 0xdf:
+		n, b := length(map[byte]int{0xde: 2, 0xdf: 4}[c])
+		return object(n, b)
+	}
+	t.Fatalf("Unexpected MessagePack type byte %#x", c)
+	return nil, nil
+}
+
+func TestMarshalMsgpack(t *testing.T) {
+	data, err := marshalMsgpack(map[string]any{"b": []int{1, -1, 200, -200, 70000, -70000}, "a": true, "c": 1.5, "d": nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x84,
+		0xa1, 'a', 0xc3,
+		0xa1, 'b', 0x96, 0x01, 0xff, 0xcc, 0xc8, 0xd1, 0xff, 0x38, 0xce, 0x00, 0x01, 0x11, 0x70, 0xd2, 0xff, 0xfe, 0xee, 0x90,
+		0xa1, 'c', 0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0,
+		0xa1, 'd', 0xc0,
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("Expected\n% x\ngot\n% x", want, data)
+	}
+
+	long := strings.Repeat("x", 300)
+	data, _ = marshalMsgpack(long)
+	if got, rest := decodeMsgpack(t, data); got != long || len(rest) != 0 {
+		t.Errorf("Long string did not round-trip")
+	}
+}
+
+func TestMsgpackSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := newOutputSink(encodingMsgpack, &buf)
+	sink.Publish(VWAPUpdate{ProductID: "BTC-USD", VWAP: "45000.0000", WindowSize: 200, TradeCount: 3, Time: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)})
+	sink.PublishCandle(Candle{Type: "candle", ProductID: "BTC-USD", Interval: "1m"})
+
+	update, rest := decodeMsgpack(t, buf.Bytes())
+	want := map[string]any{
+		"product_id": "BTC-USD", "vwap": "45000.0000", "window_size": int64(200), "trade_count": int64(3),
+		"missed_trades": int64(0), "time": "2024-01-02T03:04:05Z",
+	}
+	if !reflect.DeepEqual(update, want) {
+		t.Errorf("Expected %v, got %v", want, update)
+	}
+	candle, rest := decodeMsgpack(t, rest)
+	if candle.(map[string]any)["interval"] != "1m" || len(rest) != 0 {
+		t.Errorf("Expected the candle to follow the update, got %v and %d more bytes", candle, len(rest))
+	}
+}
+
+func TestHubMsgpack(t *testing.T) {
+	hub := NewHub(NewLogger(io.Discard, slog.LevelInfo, "text"))
+	hub.SetEncoding(encodingMsgpack)
+	server := httptest.NewServer(hub)
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	if err := conn.WriteJSON(SubscribeRequest{Type: "subscribe"}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	for _, want := range []string{"subscriptions", "vwap"} {
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Reading %s failed: %v", want, err)
+		}
+		msg, _ := decodeMsgpack(t, data)
+		if kind != websocket.BinaryMessage || msg.(map[string]any)["type"] != want {
+			t.Errorf("Expected a binary %s message, got %d %v", want, kind, msg)
+		}
+		if want == "subscriptions" {
+			hub.Publish(VWAPUpdate{ProductID: "ETH-USD", VWAP: "3000.0000"})
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// NATSConfig selects the server and subjects for NATSSink.
+type NATSConfig struct {
+	URL           string
+	SubjectPrefix string
+	// Stream, when set, publishes through JetStream into this stream (created
+	// if needed) so durable consumers can replay updates.
+	Stream string
+	// Encoding is json or protobuf.
+	Encoding string
+}
+
+// NATSSink publishes every VWAP update as JSON or protobuf on
+// <prefix>.<product>, e.g. vwap.BTC-USD.
+type NATSSink struct {
+	conn     *nats.Conn
+	js       jetstream.JetStream
+	prefix   string
+	encoding string
+}
+
+func NewNATSSink(ctx context.Context, cfg NATSConfig, logger Logger) (*NATSSink, error) {
+	conn, err := nats.Connect(cfg.URL, nats.Name("vwap-calculator"))
+	if err != nil {
+		return nil, fmt.Errorf("connecting to NATS: %w", err)
+	}
+	sink := &NATSSink{conn: conn, prefix: cfg.SubjectPrefix, encoding: cfg.Encoding}
+	if cfg.Stream == "" {
+		return sink, nil
+	}
+
+	js, err := jetstream.New(conn, jetstream.WithPublishAsyncErrHandler(func(_ jetstream.JetStream, msg *nats.Msg, err error) {
+		logger.Errorf("JetStream publish to %s failed: %v", msg.Subject, err)
+	}))
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("creating JetStream context: %w", err)
+	}
+	if _, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     cfg.Stream,
+		Subjects: []string{cfg.SubjectPrefix + ".>"},
+	}); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("creating stream %s: %w", cfg.Stream, err)
+	}
+	sink.js = js
+	return sink, nil
+}
+
+func (s *NATSSink) Publish(update VWAPUpdate) error {
+	data, err := encodeUpdate(s.encoding, update)
+	if err != nil {
+		return err
+	}
+	subject := natsSubject(s.prefix, update.ProductID)
+	if s.js != nil {
+		_, err = s.js.PublishAsync(subject, data)
+		return err
+	}
+	return s.conn.Publish(subject, data)
+}
+
+// Close waits briefly for outstanding JetStream acks, then drains the
+// connection.
+func (s *NATSSink) Close() error {
+	if s.js != nil {
+		select {
+		case <-s.js.PublishAsyncComplete():
+		case <-time.After(shutdownTimeout):
+		}
+	}
+	return s.conn.Drain()
+}
+
+func natsSubject(prefix, productID string) string {
+	return prefix + "." + productID
+}
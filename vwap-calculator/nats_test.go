@@ -0,0 +1,9 @@
+package main
+
+import "testing"
+
+func TestNATSSubject(t *testing.T) {
+	if got := natsSubject("vwap", "BTC-USD"); got != "vwap.BTC-USD" {
+		t.Errorf("Expected vwap.BTC-USD, got %s", got)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"math/big"
+	"strings"
+)
+
+// RatCalculator is implemented by calculators that can return their value
+// unformatted, so library users need not parse Calculate's string.
+type RatCalculator interface {
+	Calculator
+	// CalculateRat returns the current value, or nil before the first
+	// trade. The result is a copy the caller may modify.
+	CalculateRat() *big.Rat
+}
+
+// Decimal is a base-10 fixed-point number: Coefficient × 10^-Places.
+type Decimal struct {
+	Coefficient *big.Int
+	Places      int
+}
+
+// String renders d with exactly d.Places decimal places, as Calculate does.
+func (d Decimal) String() string {
+	digits := new(big.Int).Abs(d.Coefficient).String()
+	if d.Places > 0 {
+		if len(digits) <= d.Places {
+			digits = strings.Repeat("0", d.Places-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-d.Places] + "." + digits[len(digits)-d.Places:]
+	}
+	if d.Coefficient.Sign() < 0 {
+		digits = "-" + digits
+	}
+	return digits
+}
+
+// Rat returns d as an exact rational.
+func (d Decimal) Rat() *big.Rat {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(d.Places)), nil)
+	return new(big.Rat).SetFrac(d.Coefficient, scale)
+}
+
+// CalculateRat returns c's current value, and false before its first trade.
+// Calculators that are not RatCalculators have their Calculate output
+// parsed, so the value is only as precise as their formatting.
+func CalculateRat(c Calculator) (*big.Rat, bool) {
+	if rc, ok := c.(RatCalculator); ok {
+		r := rc.CalculateRat()
+		return r, r != nil
+	}
+	if c.TradeCount() == 0 {
+		return nil, false
+	}
+	r, ok := new(big.Rat).SetString(c.Calculate())
+	return r, ok
+}
+
+// CalculateFloat returns c's current value as the nearest float64, and false
+// before its first trade.
+func CalculateFloat(c Calculator) (float64, bool) {
+	r, ok := CalculateRat(c)
+	if !ok {
+		return 0, false
+	}
+	f, _ := r.Float64()
+	return f, true
+}
+
+// CalculateDecimal returns c's current value rounded as Calculate rounds it,
+// to the calculator's configured places, and false before its first trade.
+func CalculateDecimal(c Calculator) (Decimal, bool) {
+	r, ok := CalculateRat(c)
+	if !ok {
+		return Decimal{}, false
+	}
+	return formatOf(c).decimal(r), true
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestCalculateRat(t *testing.T) {
+	calculators := map[string]Calculator{
+		"vwap":    NewWindowedVWAPCalculator(10),
+		"decimal": NewDecimalVWAPCalculator(10),
+		"sma":     NewSMACalculator(10),
+	}
+	for name, calc := range calculators {
+		if _, ok := CalculateRat(calc); ok {
+			t.Errorf("%s: expected no value before the first trade", name)
+		}
+		if _, ok := CalculateFloat(calc); ok {
+			t.Errorf("%s: expected no float before the first trade", name)
+		}
+		if _, ok := CalculateDecimal(calc); ok {
+			t.Errorf("%s: expected no decimal before the first trade", name)
+		}
+	}
+
+	// (1·1 + 2·2) / 3 = 5/3, which no decimal string represents exactly.
+	for _, name := range []string{"vwap", "decimal"} {
+		calc := calculators[name]
+		calc.Update("1", "1")
+		calc.Update("2", "2")
+		r, ok := CalculateRat(calc)
+		if !ok || r.Cmp(big.NewRat(5, 3)) != 0 {
+			t.Errorf("%s: expected exactly 5/3, got %v", name, r)
+		}
+		// The result is a copy.
+		r.SetInt64(0)
+		if again, _ := CalculateRat(calc); again.Cmp(big.NewRat(5, 3)) != 0 {
+			t.Errorf("%s: modifying the result changed the calculator to %v", name, again)
+		}
+		if f, ok := CalculateFloat(calc); !ok || f != 5.0/3 {
+			t.Errorf("%s: expected float %v, got %v", name, 5.0/3, f)
+		}
+		d, ok := CalculateDecimal(calc)
+		if !ok || d.Coefficient.Int64() != 16667 || d.Places != 4 {
+			t.Errorf("%s: expected decimal 16667e-4, got %v", name, d)
+		}
+		if d.String() != calc.Calculate() {
+			t.Errorf("%s: decimal %s differs from Calculate %s", name, d, calc.Calculate())
+		}
+	}
+
+	// Calculators without CalculateRat have their output parsed.
+	sma := calculators["sma"]
+	sma.Update("1", "1")
+	sma.Update("2", "1")
+	if r, ok := CalculateRat(sma); !ok || r.Cmp(big.NewRat(3, 2)) != 0 {
+		t.Errorf("sma: expected 3/2, got %v", r)
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	cases := []struct {
+		coefficient int64
+		places      int
+		want        string
+	}{
+		{12345, 2, "123.45"},
+		{5, 3, "0.005"},
+		{-5, 3, "-0.005"},
+		{42, 0, "42"},
+		{0, 2, "0.00"},
+	}
+	for _, tc := range cases {
+		d := Decimal{Coefficient: big.NewInt(tc.coefficient), Places: tc.places}
+		if got := d.String(); got != tc.want {
+			t.Errorf("%de-%d: expected %s, got %s", tc.coefficient, tc.places, tc.want, got)
+		}
+		if want, _ := new(big.Rat).SetString(tc.want); d.Rat().Cmp(want) != 0 {
+			t.Errorf("%de-%d: expected rat %s, got %s", tc.coefficient, tc.places, want, d.Rat())
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"slices"
+	"sync"
+)
+
+// Order book channels accepted by -order-book. level2_batch carries the same
+// messages as level2, batched every 50ms.
+const (
+	bookLevel2      = "level2"
+	bookLevel2Batch = "level2_batch"
+)
+
+func parseBookChannel(s string) (string, error) {
+	switch s {
+	case "", bookLevel2, bookLevel2Batch:
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid -order-book %q: must be %s or %s", s, bookLevel2, bookLevel2Batch)
+}
+
+// bookMessage is a level2 snapshot or l2update. Snapshot levels are
+// [price, size] pairs; update changes are [side, price, size] triples.
+type bookMessage struct {
+	Type      string      `json:"type"`
+	ProductID string      `json:"product_id"`
+	Bids      [][2]string `json:"bids"`
+	Asks      [][2]string `json:"asks"`
+	Changes   [][3]string `json:"changes"`
+}
+
+// Quote is the top of a product's order book.
+type Quote struct {
+	Bid, Ask *big.Rat
+}
+
+// Mid returns the midpoint of the best bid and ask.
+func (q Quote) Mid() *big.Rat {
+	mid := new(big.Rat).Add(q.Bid, q.Ask)
+	return mid.Quo(mid, big.NewRat(2, 1))
+}
+
+// OrderBooks maintains a local order book per product from the level2
+// channel, so updates can report the spread around their VWAP.
+type OrderBooks struct {
+	// Channel is the level2 channel every product is subscribed to, or
+	// empty when only some are, through their own channels.
+	Channel string
+
+	mu    sync.Mutex
+	books map[string]*orderBook
+}
+
+func NewOrderBooks(channel string) *OrderBooks {
+	return &OrderBooks{Channel: channel, books: make(map[string]*orderBook)}
+}
+
+// Apply applies a snapshot or l2update message. A snapshot replaces the
+// product's book, which is how it is rebuilt after a reconnect.
+func (b *OrderBooks) Apply(data []byte) error {
+	var msg bookMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+	switch msg.Type {
+	case "snapshot":
+		book := &orderBook{}
+		var err error
+		if book.bids, err = bookLevels(msg.Bids, compareBids); err != nil {
+			return err
+		}
+		if book.asks, err = bookLevels(msg.Asks, compareAsks); err != nil {
+			return err
+		}
+		b.mu.Lock()
+		b.books[msg.ProductID] = book
+		b.mu.Unlock()
+	case "l2update":
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		book, ok := b.books[msg.ProductID]
+		if !ok {
+			// Updates are only meaningful on top of a snapshot.
+			return nil
+		}
+		for _, change := range msg.Changes {
+			if err := book.set(change[0], change[1], change[2]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Quote returns productID's best bid and ask, or false until both sides of
+// its book have orders.
+func (b *OrderBooks) Quote(productID string) (Quote, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	book, ok := b.books[productID]
+	if !ok || len(book.bids) == 0 || len(book.asks) == 0 {
+		return Quote{}, false
+	}
+	return Quote{
+		Bid: new(big.Rat).Set(book.bids[len(book.bids)-1]),
+		Ask: new(big.Rat).Set(book.asks[len(book.asks)-1]),
+	}, true
+}
+
+// Forget drops productID's book.
+func (b *OrderBooks) Forget(productID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.books, productID)
+}
+
+// orderBook holds the prices with resting orders on each side. Both are
+// sorted with the best price last, which is where most changes land.
+type orderBook struct {
+	bids, asks []*big.Rat
+}
+
+func compareBids(a, b *big.Rat) int { return a.Cmp(b) }
+func compareAsks(a, b *big.Rat) int { return b.Cmp(a) }
+
+// bookLevels returns the prices of a snapshot's [price, size] levels,
+// sorted by compare.
+func bookLevels(levels [][2]string, compare func(a, b *big.Rat) int) ([]*big.Rat, error) {
+	prices := make([]*big.Rat, 0, len(levels))
+	for _, level := range levels {
+		price, size, err := parseLevel(level[0], level[1])
+		if err != nil {
+			return nil, err
+		}
+		if size.Sign() > 0 {
+			prices = append(prices, price)
+		}
+	}
+	slices.SortFunc(prices, compare)
+	return slices.CompactFunc(prices, func(a, b *big.Rat) bool { return a.Cmp(b) == 0 }), nil
+}
+
+// set records the size resting at price on side ("buy" or "sell"); a zero
+// size removes the level.
+func (o *orderBook) set(side, price, size string) error {
+	p, s, err := parseLevel(price, size)
+	if err != nil {
+		return err
+	}
+	var (
+		levels  *[]*big.Rat
+		compare func(a, b *big.Rat) int
+	)
+	switch side {
+	case "buy":
+		levels, compare = &o.bids, compareBids
+	case "sell":
+		levels, compare = &o.asks, compareAsks
+	default:
+		return fmt.Errorf("invalid side %q", side)
+	}
+	i, found := slices.BinarySearchFunc(*levels, p, compare)
+	switch {
+	case s.Sign() > 0 && !found:
+		*levels = slices.Insert(*levels, i, p)
+	case s.Sign() == 0 && found:
+		*levels = slices.Delete(*levels, i, i+1)
+	}
+	return nil
+}
+
+func parseLevel(price, size string) (*big.Rat, *big.Rat, error) {
+	p, ok := new(big.Rat).SetString(price)
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid price %q", price)
+	}
+	s, ok := new(big.Rat).SetString(size)
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid size %q", size)
+	}
+	return p, s, nil
+}
+
+// SetOrderBooks makes the pipeline subscribe to books.Channel and report
+// each product's best bid, ask and mid-price with its updates. With an empty
+// Channel, only products given a level2 channel by SetChannels have books.
+func (p *Pipeline) SetOrderBooks(books *OrderBooks) {
+	p.books = books
+}
+
+// feedChannels returns the channels to subscribe each product to.
+func (p *Pipeline) feedChannels() []string {
+	if p.advanced {
+		return []string{channelMarketTrades, channelHeartbeats}
+	}
+	channels := []string{p.channel, channelHeartbeat}
+	if p.books != nil && p.books.Channel != "" {
+		channels = append(channels, p.books.Channel)
+	}
+	return channels
+}
+
+// quoteBook fills in update's order book fields, once the product's book
+// has both sides.
+func (p *Pipeline) quoteBook(update *VWAPUpdate, calculator Calculator) {
+	if p.books == nil {
+		return
+	}
+	quote, ok := p.books.Quote(update.ProductID)
+	if !ok {
+		return
+	}
+	format := formatOf(calculator)
+	update.BestBid = format.rat(quote.Bid)
+	update.BestAsk = format.rat(quote.Ask)
+	update.MidPrice = format.rat(quote.Mid())
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestOrderBooks(t *testing.T) {
+	books := NewOrderBooks(bookLevel2Batch)
+	if err := books.Apply([]byte(`{"type":"l2update","product_id":"BTC-USD","changes":[["buy","100","1"]]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := books.Quote("BTC-USD"); ok {
+		t.Error("Expected no quote before a snapshot")
+	}
+
+	snapshot := `{"type":"snapshot","product_id":"BTC-USD","bids":[["100.5","1"],["100","2"],["99","0"]],"asks":[["101","1"],["102","3"]]}`
+	if err := books.Apply([]byte(snapshot)); err != nil {
+		t.Fatal(err)
+	}
+	quote, ok := books.Quote("BTC-USD")
+	if !ok || quote.Bid.RatString() != "201/2" || quote.Ask.RatString() != "101" || quote.Mid().FloatString(2) != "100.75" {
+		t.Fatalf("Unexpected quote %v/%v", quote.Bid, quote.Ask)
+	}
+
+	updates := []string{
+		// A better bid, then the best ask is taken out.
+		`{"type":"l2update","product_id":"BTC-USD","changes":[["buy","100.80","0.5"]]}`,
+		`{"type":"l2update","product_id":"BTC-USD","changes":[["sell","101.00","0"],["sell","101.5","2"]]}`,
+	}
+	for _, update := range updates {
+		if err := books.Apply([]byte(update)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if quote, _ := books.Quote("BTC-USD"); quote.Bid.FloatString(2) != "100.80" || quote.Ask.FloatString(2) != "101.50" {
+		t.Errorf("Unexpected quote %v/%v", quote.Bid, quote.Ask)
+	}
+
+	if err := books.Apply([]byte(`{"type":"l2update","product_id":"BTC-USD","changes":[["hold","1","1"]]}`)); err == nil {
+		t.Error("Expected an error for an unknown side")
+	}
+	books.Forget("BTC-USD")
+	if _, ok := books.Quote("BTC-USD"); ok {
+		t.Error("Expected no quote after Forget")
+	}
+}
+
+func TestPipelineOrderBook(t *testing.T) {
+	store := NewStore()
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"), store)
+	pipeline.SetOrderBooks(NewOrderBooks(bookLevel2))
+	if got := pipeline.feedChannels(); len(got) != 3 || got[2] != bookLevel2 {
+		t.Errorf("Expected the level2 channel to be subscribed, got %v", got)
+	}
+
+	ctx := context.Background()
+	pipeline.dispatchMessage(ctx, []byte(`{"type":"snapshot","product_id":"BTC-USD","bids":[["44999","1"]],"asks":[["45001","1"]]}`), nil)
+	pipeline.dispatchMessage(ctx, []byte(`{"type":"match","product_id":"BTC-USD","trade_id":1,"price":"45000","size":"1"}`), nil)
+
+	update, _ := store.Get("BTC-USD")
+	if update.BestBid != "44999.0000" || update.BestAsk != "45001.0000" || update.MidPrice != "45000.0000" {
+		t.Errorf("Unexpected book fields %q, %q, %q", update.BestBid, update.BestAsk, update.MidPrice)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+)
+
+const (
+	// outlierWarmup is how many trades a product must have before the
+	// outlier filter applies, so an empty window can't reject everything.
+	outlierWarmup = 20
+	// outlierResetAfter is how many consecutive rejections are taken as a
+	// genuine move rather than bad prints. The next trade is accepted so the
+	// average can catch up.
+	outlierResetAfter = 10
+)
+
+// QuarantinedTrade is a trade rejected by the outlier filter.
+type QuarantinedTrade struct {
+	Trade
+	Reason string `json:"reason"`
+	VWAP   string `json:"vwap"`
+}
+
+// QuarantineSink receives trades rejected by the outlier filter.
+type QuarantineSink interface {
+	Quarantine(trade QuarantinedTrade) error
+}
+
+// OutlierFilter rejects trades too far from a product's current VWAP, by
+// percentage, by multiples of the volume-weighted standard deviation, or
+// both. A zero threshold disables that test.
+type OutlierFilter struct {
+	MaxPercent float64
+	MaxSigma   float64
+
+	mu       sync.Mutex
+	rejected map[string]int
+}
+
+func NewOutlierFilter(maxPercent, maxSigma float64) *OutlierFilter {
+	return &OutlierFilter{MaxPercent: maxPercent, MaxSigma: maxSigma, rejected: make(map[string]int)}
+}
+
+// Check returns why trade should be rejected, or "" to accept it. trades is
+// how many trades the product has accepted so far.
+func (f *OutlierFilter) Check(calculator Calculator, trade Trade, trades int64) string {
+	if trades < outlierWarmup {
+		return ""
+	}
+	reason := f.reason(calculator, trade)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if reason == "" || f.rejected[trade.ProductID] >= outlierResetAfter {
+		f.rejected[trade.ProductID] = 0
+		return ""
+	}
+	f.rejected[trade.ProductID]++
+	return reason
+}
+
+func (f *OutlierFilter) reason(calculator Calculator, trade Trade) string {
+	price, ok := new(big.Float).SetString(trade.Price)
+	if !ok {
+		return ""
+	}
+	var vwap, stddev *big.Float
+	if dev, ok := calculator.(DeviationCalculator); ok {
+		if vwap, stddev, ok = dev.Deviation(); !ok {
+			return ""
+		}
+	} else if vwap, ok = new(big.Float).SetString(calculator.Calculate()); !ok || vwap.Sign() == 0 {
+		return ""
+	}
+
+	diff := new(big.Float).Sub(price, vwap)
+	diff.Abs(diff)
+	if f.MaxPercent > 0 {
+		pct, _ := new(big.Float).Quo(new(big.Float).Mul(diff, big.NewFloat(100)), vwap).Float64()
+		if pct > f.MaxPercent {
+			return fmt.Sprintf("%.2f%% from VWAP exceeds %g%%", pct, f.MaxPercent)
+		}
+	}
+	if f.MaxSigma > 0 && stddev != nil && stddev.Sign() > 0 {
+		sigmas, _ := new(big.Float).Quo(diff, stddev).Float64()
+		if sigmas > f.MaxSigma {
+			return fmt.Sprintf("%.1fσ from VWAP exceeds %gσ", sigmas, f.MaxSigma)
+		}
+	}
+	return ""
+}
+
+// SetOutlierFilter makes the pipeline reject trades that filter flags.
+func (p *Pipeline) SetOutlierFilter(filter *OutlierFilter) {
+	p.outliers = filter
+}
+
+// AddQuarantineSink registers a sink for trades rejected as outliers.
+func (p *Pipeline) AddQuarantineSink(sink QuarantineSink) {
+	p.quarantine = append(p.quarantine, sink)
+}
+
+// rejectOutlier reports whether trade was quarantined.
+func (p *Pipeline) rejectOutlier(logger Logger, calculator Calculator, trade Trade) bool {
+	if p.outliers == nil {
+		return false
+	}
+	reason := p.outliers.Check(calculator, trade, p.tradeCount(trade.ProductID))
+	if reason == "" {
+		return false
+	}
+	logger.Warnf("Quarantined trade_id %d at %s: %s", trade.TradeID, trade.Price, reason)
+	outlierTrades.WithLabelValues(trade.ProductID).Inc()
+	p.counts.tradeError(trade.ProductID, tradeErrOutlier)
+	quarantined := QuarantinedTrade{Trade: trade, Reason: reason, VWAP: calculator.Calculate()}
+	for _, sink := range p.quarantine {
+		if err := sink.Quarantine(quarantined); err != nil {
+			logger.Errorf("Quarantining trade failed: %v", err)
+		}
+	}
+	return true
+}
+
+func (s *JSONLinesSink) Quarantine(trade QuarantinedTrade) error {
+	return s.encode(trade)
+}
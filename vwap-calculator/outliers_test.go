@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+type quarantineRecorder struct {
+	trades []QuarantinedTrade
+}
+
+func (r *quarantineRecorder) Quarantine(trade QuarantinedTrade) error {
+	r.trades = append(r.trades, trade)
+	return nil
+}
+
+func TestPipelineOutlierFilter(t *testing.T) {
+	store := NewStore()
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"), store)
+	pipeline.SetOutlierFilter(NewOutlierFilter(5, 0))
+	recorder := &quarantineRecorder{}
+	pipeline.AddQuarantineSink(recorder)
+
+	match := func(id int, price string) {
+		msg := fmt.Sprintf(`{"type":"match","product_id":"BTC-USD","trade_id":%d,"price":"%s","size":"1"}`, id, price)
+		pipeline.processMessage(context.Background(), []byte(msg))
+	}
+	// The first trade is far off, but the filter is still warming up.
+	match(1, "200")
+	for i := 2; i <= outlierWarmup; i++ {
+		match(i, "100")
+	}
+	match(outlierWarmup+1, "120")
+	match(outlierWarmup+2, "104")
+
+	if len(recorder.trades) != 1 || recorder.trades[0].TradeID != outlierWarmup+1 || recorder.trades[0].VWAP != "105.0000" {
+		t.Fatalf("Expected trade %d quarantined against VWAP 105.0000, got %+v", outlierWarmup+1, recorder.trades)
+	}
+	if !strings.Contains(recorder.trades[0].Reason, "exceeds 5%") {
+		t.Errorf("Unexpected reason %q", recorder.trades[0].Reason)
+	}
+	if update, _ := store.Get("BTC-USD"); update.TradeCount != outlierWarmup+1 {
+		t.Errorf("Expected %d accepted trades, got %d", outlierWarmup+1, update.TradeCount)
+	}
+}
+
+func TestOutlierFilterSigma(t *testing.T) {
+	calc := NewVWAPCalculator()
+	for i := 0; i < 10; i++ {
+		calc.Update("99", "1")
+		calc.Update("101", "1")
+	}
+	// VWAP 100, σ 1.
+	filter := NewOutlierFilter(0, 3)
+	if reason := filter.Check(calc, Trade{ProductID: "BTC-USD", Price: "102.5"}, outlierWarmup); reason != "" {
+		t.Errorf("Expected 2.5σ to pass, got %q", reason)
+	}
+	if reason := filter.Check(calc, Trade{ProductID: "BTC-USD", Price: "96"}, outlierWarmup); reason == "" {
+		t.Error("Expected 4σ to be rejected")
+	}
+}
+
+func TestOutlierFilterAcceptsSustainedMove(t *testing.T) {
+	calc := NewVWAPCalculator()
+	calc.Update("100", "1")
+	filter := NewOutlierFilter(5, 0)
+	trade := Trade{ProductID: "BTC-USD", Price: "150"}
+	for i := 0; i < outlierResetAfter; i++ {
+		if filter.Check(calc, trade, outlierWarmup) == "" {
+			t.Fatalf("Expected rejection %d to be quarantined", i+1)
+		}
+	}
+	if reason := filter.Check(calc, trade, outlierWarmup); reason != "" {
+		t.Errorf("Expected the trade after %d consecutive rejections to be accepted, got %q", outlierResetAfter, reason)
+	}
+	if filter.Check(calc, trade, outlierWarmup) == "" {
+		t.Error("Expected the rejection count to restart after accepting")
+	}
+}
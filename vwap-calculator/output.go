@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// JSONLinesSink writes one JSON object per update, for piping into jq and
+// other line-oriented tools.
+type JSONLinesSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewJSONLinesSink(w io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{enc: json.NewEncoder(w)}
+}
+
+func (s *JSONLinesSink) Publish(update VWAPUpdate) error {
+	return s.encode(update)
+}
+
+// encode writes v as one line; product workers may call it concurrently.
+func (s *JSONLinesSink) encode(v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(v)
+}
+
+// OutputSink writes updates and candles to stdout.
+type OutputSink interface {
+	Sink
+	CandleSink
+}
+
+// newOutputSink returns the stdout sink for the -output format.
+func newOutputSink(format string, w io.Writer) OutputSink {
+	switch format {
+	case "json":
+		return NewJSONLinesSink(w)
+	case encodingMsgpack:
+		return NewMsgpackSink(w)
+	}
+	return StdoutSink{}
+}
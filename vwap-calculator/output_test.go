@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONLinesSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONLinesSink(&buf)
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sink.Publish(VWAPUpdate{ProductID: "BTC-USD", VWAP: "45000.1234", WindowSize: 200, TradeCount: 5, Time: ts})
+	sink.Publish(VWAPUpdate{ProductID: "ETH-USD", VWAP: "3000.0000", WindowSize: 200, TradeCount: 1, Time: ts})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d: %q", len(lines), buf.String())
+	}
+	var first map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("Line is not JSON: %v", err)
+	}
+	if first["product_id"] != "BTC-USD" || first["vwap"] != "45000.1234" || first["trade_count"] != 5.0 || first["time"] != "2024-01-01T00:00:00Z" {
+		t.Errorf("Unexpected object: %v", first)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+const (
+	// parquetFlushTick is how often partitions whose hour is over are
+	// written, so that a quiet product's file doesn't wait for its next row.
+	parquetFlushTick = time.Minute
+	// parquetMaxRows is the most rows a partition holds before they are
+	// written to a file of their own, ahead of the end of the hour.
+	parquetMaxRows = 100000
+	// parquetMaxAge is the longest a partition holds rows before they are
+	// written to a file of their own, bounding what is held per partition.
+	parquetMaxAge = 10 * time.Minute
+	// parquetMaxHeld is the most rows kept for a partition whose writes keep
+	// failing. Past it the rows are dropped.
+	parquetMaxHeld = 2 * parquetMaxRows
+)
+
+// ParquetConfig selects where Parquet archives are written.
+type ParquetConfig struct {
+	Dir    string
+	Trades bool
+}
+
+// The columns of the Parquet files, which are all required.
+var (
+	parquetUpdateSchema = arrow.NewSchema([]arrow.Field{
+		{Name: "time", Type: &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}},
+		{Name: "product_id", Type: arrow.BinaryTypes.String},
+		{Name: "vwap", Type: arrow.PrimitiveTypes.Float64},
+		{Name: "window_size", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "trade_count", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "missed_trades", Type: arrow.PrimitiveTypes.Int64},
+	}, nil)
+	parquetTradeSchema = arrow.NewSchema([]arrow.Field{
+		{Name: "time", Type: &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}},
+		{Name: "product_id", Type: arrow.BinaryTypes.String},
+		{Name: "trade_id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "price", Type: arrow.PrimitiveTypes.Float64},
+		{Name: "size", Type: arrow.PrimitiveTypes.Float64},
+		{Name: "side", Type: arrow.BinaryTypes.String},
+	}, nil)
+)
+
+// ParquetSink archives VWAP updates, and optionally trades, as Parquet files
+// partitioned by product and hour, e.g.
+// trades/product=BTC-USD/date=2024-01-01/hour=10/part-1704105000000000000.parquet.
+// Parquet files cannot be appended to, so each partition's rows are held in
+// memory and written once its hour is over, at shutdown, or in parts once
+// they number parquetMaxRows or are parquetMaxAge old.
+type ParquetSink struct {
+	cfg    ParquetConfig
+	queue  *batchQueue[parquetRecord]
+	logger Logger
+	now    func() time.Time
+	stop   chan struct{}
+	done   chan struct{}
+
+	mu      sync.Mutex // guards pending, and serializes writing it
+	pending map[parquetPartition]*parquetPending
+}
+
+// parquetPartition is the file a row belongs in: its kind, vwap or trades,
+// its product and the UTC hour it happened in.
+type parquetPartition struct {
+	kind      string
+	productID string
+	hour      time.Time
+}
+
+// parquetPending is the rows held for a partition.
+type parquetPending struct {
+	rows    [][]any
+	since   time.Time // when the oldest row was held
+	retryAt time.Time // when to try again after a failed write
+}
+
+type parquetRecord struct {
+	partition parquetPartition
+	row       []any // int64, float64 or string, in schema order
+}
+
+func NewParquetSink(cfg ParquetConfig, logger Logger) (*ParquetSink, error) {
+	return newParquetSink(cfg, logger, time.Now, parquetFlushTick)
+}
+
+// newParquetSink is NewParquetSink with the clock and the interval at which
+// finished hours are written.
+func newParquetSink(cfg ParquetConfig, logger Logger, now func() time.Time, tick time.Duration) (*ParquetSink, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating Parquet directory: %w", err)
+	}
+	s := &ParquetSink{cfg: cfg, logger: logger, now: now, stop: make(chan struct{}), done: make(chan struct{}), pending: make(map[parquetPartition]*parquetPending)}
+	s.queue = newBatchQueue(storageQueueSize, storageBatchSize, storageFlushWait, func(batch []parquetRecord) {
+		s.add(batch)
+		s.flush(false)
+	})
+	go s.flushFinished(tick)
+	return s, nil
+}
+
+// flushFinished writes partitions whose hour is over every tick, until Close.
+func (s *ParquetSink) flushFinished(tick time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.flush(false)
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *ParquetSink) Publish(update VWAPUpdate) error {
+	vwap, _ := strconv.ParseFloat(update.VWAP, 64)
+	at := s.timeOf(update.Time)
+	return s.enqueue("vwap", update.ProductID, at, []any{
+		at.UnixMicro(), update.ProductID, vwap,
+		int64(update.WindowSize), update.TradeCount, update.MissedTrades,
+	})
+}
+
+func (s *ParquetSink) RecordTrade(trade Trade) error {
+	if !s.cfg.Trades {
+		return nil
+	}
+	price, _ := strconv.ParseFloat(trade.Price, 64)
+	size, _ := strconv.ParseFloat(trade.Size, 64)
+	at := s.timeOf(trade.Time)
+	return s.enqueue("trades", trade.ProductID, at, []any{
+		at.UnixMicro(), trade.ProductID, trade.TradeID, price, size, trade.Side,
+	})
+}
+
+// timeOf returns t, or now for records without a timestamp.
+func (s *ParquetSink) timeOf(t time.Time) time.Time {
+	if t.IsZero() {
+		return s.now()
+	}
+	return t
+}
+
+func (s *ParquetSink) enqueue(kind, productID string, at time.Time, row []any) error {
+	partition := parquetPartition{kind: kind, productID: productID, hour: at.UTC().Truncate(time.Hour)}
+	if !s.queue.Offer(parquetRecord{partition: partition, row: row}) {
+		return errQueueFull
+	}
+	return nil
+}
+
+// Close writes every partition still held, including the current hour's.
+func (s *ParquetSink) Close() error {
+	s.queue.Close()
+	close(s.stop)
+	<-s.done
+	return s.flush(true)
+}
+
+func (s *ParquetSink) add(batch []parquetRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, rec := range batch {
+		p := s.pending[rec.partition]
+		if p == nil {
+			p = &parquetPending{since: s.now()}
+			s.pending[rec.partition] = p
+		}
+		p.rows = append(p.rows, rec.row)
+	}
+}
+
+// flush writes the partitions whose hour is over, that reached
+// parquetMaxRows or that are parquetMaxAge old, or all of them. A partition
+// that fails to write keeps its rows and is retried a flush tick later,
+// unless it holds parquetMaxHeld rows.
+func (s *ParquetSink) flush(all bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var firstErr error
+	now := s.now()
+	current := now.UTC().Truncate(time.Hour)
+	for partition, p := range s.pending {
+		due := partition.hour.Before(current) || len(p.rows) >= parquetMaxRows || now.Sub(p.since) >= parquetMaxAge
+		if !all && (!due || now.Before(p.retryAt)) {
+			continue
+		}
+		err := s.write(partition, p.rows)
+		if err == nil {
+			delete(s.pending, partition)
+			continue
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if len(p.rows) >= parquetMaxHeld {
+			s.logger.Errorf("Writing %d Parquet rows failed, dropping them: %v", len(p.rows), err)
+			delete(s.pending, partition)
+			continue
+		}
+		s.logger.Errorf("Writing %d Parquet rows failed, will retry: %v", len(p.rows), err)
+		p.retryAt = now.Add(parquetFlushTick)
+	}
+	return firstErr
+}
+
+// write stores rows as a new file in partition's directory. It is written
+// under a temporary name first, so readers globbing *.parquet never see a
+// partial file. Late rows for an hour already written go to another file.
+func (s *ParquetSink) write(partition parquetPartition, rows [][]any) error {
+	schema := parquetUpdateSchema
+	if partition.kind == "trades" {
+		schema = parquetTradeSchema
+	}
+	data, err := encodeParquet(schema, rows)
+	if err != nil {
+		return fmt.Errorf("encoding Parquet: %w", err)
+	}
+	dir := filepath.Join(s.cfg.Dir, partition.kind,
+		"product="+partition.productID,
+		"date="+partition.hour.Format("2006-01-02"),
+		"hour="+partition.hour.Format("15"))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("part-%d.parquet", s.now().UnixNano()))
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// encodeParquet builds a Parquet file of rows, whose values are int64,
+// float64 or string in schema order.
+func encodeParquet(schema *arrow.Schema, rows [][]any) ([]byte, error) {
+	b := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer b.Release()
+	for _, row := range rows {
+		for i, v := range row {
+			switch field := b.Field(i).(type) {
+			case *array.TimestampBuilder:
+				field.Append(arrow.Timestamp(v.(int64)))
+			case *array.Int64Builder:
+				field.Append(v.(int64))
+			case *array.Float64Builder:
+				field.Append(v.(float64))
+			case *array.StringBuilder:
+				field.Append(v.(string))
+			}
+		}
+	}
+	rec := b.NewRecordBatch()
+	defer rec.Release()
+
+	var buf bytes.Buffer
+	w, err := pqarrow.NewFileWriter(schema, &buf, parquet.NewWriterProperties(), pqarrow.DefaultWriterProps())
+	if err != nil {
+		return nil, err
+	}
+	if err := w.Write(rec); err != nil {
+		w.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+// readParquet reads a Parquet file into its column names and rows, with
+// times as microseconds.
+func readParquet(t *testing.T, path string) ([]string, [][]any) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	table, err := pqarrow.ReadTable(context.Background(), f, parquet.NewReaderProperties(memory.DefaultAllocator), pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+	if err != nil {
+		t.Fatalf("Reading %s failed: %v", path, err)
+	}
+	defer table.Release()
+
+	var names []string
+	rows := make([][]any, table.NumRows())
+	for i := range rows {
+		rows[i] = make([]any, table.NumCols())
+	}
+	for col := 0; col < int(table.NumCols()); col++ {
+		names = append(names, table.Schema().Field(col).Name)
+		row := 0
+		for _, chunk := range table.Column(col).Data().Chunks() {
+			for i := 0; i < chunk.Len(); i++ {
+				switch chunk := chunk.(type) {
+				case *array.Timestamp:
+					rows[row][col] = int64(chunk.Value(i))
+				case *array.Int64:
+					rows[row][col] = chunk.Value(i)
+				case *array.Float64:
+					rows[row][col] = chunk.Value(i)
+				case *array.String:
+					rows[row][col] = chunk.Value(i)
+				default:
+					t.Fatalf("Unexpected column type %s", chunk.DataType())
+				}
+				row++
+			}
+		}
+	}
+	return names, rows
+}
+
+func TestParquetSink(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+	sink, err := newParquetSink(ParquetConfig{Dir: dir, Trades: true}, NewLogger(io.Discard, slog.LevelInfo, "text"), func() time.Time { return now }, parquetFlushTick)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC)
+	sink.RecordTrade(Trade{ProductID: "BTC-USD", TradeID: 7, Price: "45000", Size: "0.5", Side: "buy", Time: ts})
+	sink.RecordTrade(Trade{ProductID: "BTC-USD", TradeID: 8, Price: "45010.5", Size: "0.25", Side: "sell", Time: ts.Add(time.Minute)})
+	sink.RecordTrade(Trade{ProductID: "BTC-USD", TradeID: 6, Price: "44990", Size: "1", Side: "buy", Time: ts.Add(-time.Hour)})
+	sink.Publish(VWAPUpdate{ProductID: "ETH-USD", VWAP: "3000.25", WindowSize: 200, TradeCount: 2, Time: ts})
+	sink.Close()
+
+	names, rows := readParquet(t, onlyFile(t, filepath.Join(dir, "trades", "product=BTC-USD", "date=2024-01-01", "hour=10")))
+	if !reflect.DeepEqual(names, []string{"time", "product_id", "trade_id", "price", "size", "side"}) {
+		t.Errorf("Unexpected trade columns %v", names)
+	}
+	expected := [][]any{
+		{ts.UnixMicro(), "BTC-USD", int64(7), 45000.0, 0.5, "buy"},
+		{ts.Add(time.Minute).UnixMicro(), "BTC-USD", int64(8), 45010.5, 0.25, "sell"},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected trades %v, got %v", expected, rows)
+	}
+	if _, rows := readParquet(t, onlyFile(t, filepath.Join(dir, "trades", "product=BTC-USD", "date=2024-01-01", "hour=09"))); len(rows) != 1 || rows[0][2] != int64(6) {
+		t.Errorf("Expected the 09:00 trade in its own partition, got %v", rows)
+	}
+	_, rows = readParquet(t, onlyFile(t, filepath.Join(dir, "vwap", "product=ETH-USD", "date=2024-01-01", "hour=10")))
+	if want := [][]any{{ts.UnixMicro(), "ETH-USD", 3000.25, int64(200), int64(2), int64(0)}}; !reflect.DeepEqual(rows, want) {
+		t.Errorf("Expected updates %v, got %v", want, rows)
+	}
+}
+
+func TestParquetSinkWritesFinishedHours(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 1, 1, 10, 59, 0, 0, time.UTC)
+	sink, err := newParquetSink(ParquetConfig{Dir: dir}, NewLogger(io.Discard, slog.LevelInfo, "text"), func() time.Time { return now }, parquetFlushTick)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	sink.add([]parquetRecord{{partition: parquetPartition{kind: "vwap", productID: "BTC-USD", hour: now.Truncate(time.Hour)}, row: []any{now.UnixMicro(), "BTC-USD", 1.0, int64(1), int64(1), int64(0)}}})
+	sink.flush(false)
+	partition := filepath.Join(dir, "vwap", "product=BTC-USD", "date=2024-01-01", "hour=10")
+	if _, err := os.Stat(partition); !os.IsNotExist(err) {
+		t.Fatalf("Expected the current hour to be held, got %v", err)
+	}
+	now = now.Add(time.Minute)
+	sink.flush(false)
+	if _, rows := readParquet(t, onlyFile(t, partition)); len(rows) != 1 {
+		t.Errorf("Expected 1 row once the hour is over, got %d", len(rows))
+	}
+}
+
+func TestParquetSinkFlushesOnTimer(t *testing.T) {
+	dir := t.TempDir()
+	var now atomic.Int64
+	now.Store(time.Date(2024, 1, 1, 10, 59, 0, 0, time.UTC).UnixNano())
+	clock := func() time.Time { return time.Unix(0, now.Load()).UTC() }
+	sink, err := newParquetSink(ParquetConfig{Dir: dir}, NewLogger(io.Discard, slog.LevelInfo, "text"), clock, 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	hour := clock().Truncate(time.Hour)
+	sink.add([]parquetRecord{{partition: parquetPartition{kind: "vwap", productID: "BTC-USD", hour: hour}, row: []any{hour.UnixMicro(), "BTC-USD", 1.0, int64(1), int64(1), int64(0)}}})
+	// No more rows arrive, but the hour ends.
+	now.Add(int64(time.Minute))
+	partition := filepath.Join(dir, "vwap", "product=BTC-USD", "date=2024-01-01", "hour=10")
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		if files, _ := filepath.Glob(filepath.Join(partition, "*.parquet")); len(files) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the finished hour to be written without waiting for another row")
+		}
+	}
+}
+
+func TestParquetSinkRetriesFailedWrites(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)
+	sink, err := newParquetSink(ParquetConfig{Dir: dir}, NewLogger(io.Discard, slog.LevelInfo, "text"), func() time.Time { return now }, parquetFlushTick)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	// A file where the vwap directory belongs makes writes fail.
+	blocker := filepath.Join(dir, "vwap")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	hour := now.Add(-time.Hour)
+	sink.add([]parquetRecord{{partition: parquetPartition{kind: "vwap", productID: "BTC-USD", hour: hour}, row: []any{hour.UnixMicro(), "BTC-USD", 1.0, int64(1), int64(1), int64(0)}}})
+	if err := sink.flush(false); err == nil {
+		t.Fatal("Expected the write to fail")
+	}
+	os.Remove(blocker)
+	if err := sink.flush(false); err != nil {
+		t.Fatalf("Expected no retry before the next tick, got %v", err)
+	}
+	partition := filepath.Join(dir, "vwap", "product=BTC-USD", "date=2024-01-01", "hour=10")
+	if _, err := os.Stat(partition); !os.IsNotExist(err) {
+		t.Fatalf("Expected nothing written before the retry, got %v", err)
+	}
+
+	now = now.Add(parquetFlushTick)
+	if err := sink.flush(false); err != nil {
+		t.Fatalf("Retrying the write failed: %v", err)
+	}
+	if _, rows := readParquet(t, onlyFile(t, partition)); len(rows) != 1 {
+		t.Errorf("Expected the held row to be written on retry, got %v", rows)
+	}
+}
+
+func TestParquetSinkWritesOldRowsInParts(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	sink, err := newParquetSink(ParquetConfig{Dir: dir}, NewLogger(io.Discard, slog.LevelInfo, "text"), func() time.Time { return now }, parquetFlushTick)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	partition := parquetPartition{kind: "vwap", productID: "BTC-USD", hour: now}
+	for range 2 {
+		sink.add([]parquetRecord{{partition: partition, row: []any{now.UnixMicro(), "BTC-USD", 1.0, int64(1), int64(1), int64(0)}}})
+		sink.flush(false)
+		now = now.Add(parquetMaxAge)
+		sink.flush(false)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "vwap", "product=BTC-USD", "date=2024-01-01", "hour=10", "*.parquet"))
+	if len(files) != 2 {
+		t.Errorf("Expected a part for each %s of the hour, got %v", parquetMaxAge, files)
+	}
+}
+
+func onlyFile(t *testing.T, dir string) string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*.parquet"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Expected one Parquet file in %s, got %v (%v)", dir, files, err)
+	}
+	return files[0]
+}
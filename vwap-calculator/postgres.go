@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS vwap_trades (
+	product_id  TEXT        NOT NULL,
+	trade_id    BIGINT,
+	price       NUMERIC     NOT NULL,
+	size        NUMERIC     NOT NULL,
+	side        TEXT,
+	time        TIMESTAMPTZ NOT NULL,
+	received_at TIMESTAMPTZ NOT NULL,
+	UNIQUE (product_id, trade_id, time)
+);
+CREATE TABLE IF NOT EXISTS vwap_updates (
+	product_id  TEXT        NOT NULL,
+	vwap        NUMERIC     NOT NULL,
+	window_size INTEGER     NOT NULL,
+	trade_count BIGINT      NOT NULL,
+	time        TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS vwap_updates_product_time ON vwap_updates (product_id, time DESC);
+`
+
+// Converting to hypertables only happens when TimescaleDB is installed; on
+// plain Postgres the tables are used as they are.
+const timescaleSetup = `
+SELECT create_hypertable('vwap_trades', 'time', if_not_exists => TRUE, migrate_data => TRUE);
+SELECT create_hypertable('vwap_updates', 'time', if_not_exists => TRUE, migrate_data => TRUE);
+`
+
+// postgresRecord is either a trade or a VWAP update awaiting insertion.
+type postgresRecord struct {
+	trade  *recordedTrade
+	update *VWAPUpdate
+}
+
+// PostgresSink stores raw trades and VWAP updates in Postgres or TimescaleDB
+// using batched inserts from a background goroutine.
+type PostgresSink struct {
+	pool   *pgxpool.Pool
+	queue  *batchQueue[postgresRecord]
+	logger Logger
+}
+
+func OpenPostgresSink(ctx context.Context, dsn string, logger Logger) (*PostgresSink, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to postgres: %w", err)
+	}
+	if _, err := pool.Exec(ctx, postgresSchema); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("creating postgres schema: %w", err)
+	}
+
+	var timescale bool
+	if err := pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'timescaledb')`).Scan(&timescale); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("checking for timescaledb: %w", err)
+	}
+	if timescale {
+		if _, err := pool.Exec(ctx, timescaleSetup); err != nil {
+			pool.Close()
+			return nil, fmt.Errorf("creating hypertables: %w", err)
+		}
+		logger.Infof("Writing to TimescaleDB hypertables")
+	}
+
+	s := &PostgresSink{pool: pool, logger: logger}
+	s.queue = newBatchQueue(storageQueueSize, storageBatchSize, storageFlushWait, func(batch []postgresRecord) {
+		if err := s.insert(batch); err != nil {
+			s.logger.Errorf("Writing %d records to postgres failed: %v", len(batch), err)
+		}
+	})
+	return s, nil
+}
+
+func (s *PostgresSink) RecordTrade(trade Trade) error {
+	record := recordedTrade{Trade: trade, receivedAt: time.Now().UTC()}
+	if !s.queue.Offer(postgresRecord{trade: &record}) {
+		return errQueueFull
+	}
+	return nil
+}
+
+func (s *PostgresSink) Publish(update VWAPUpdate) error {
+	if !s.queue.Offer(postgresRecord{update: &update}) {
+		return errQueueFull
+	}
+	return nil
+}
+
+// Close flushes queued records and closes the connection pool.
+func (s *PostgresSink) Close() error {
+	s.queue.Close()
+	s.pool.Close()
+	return nil
+}
+
+func (s *PostgresSink) insert(records []postgresRecord) error {
+	batch := &pgx.Batch{}
+	for _, r := range records {
+		switch {
+		case r.trade != nil:
+			t := r.trade
+			tradeTime := t.Time
+			if tradeTime.IsZero() {
+				tradeTime = t.receivedAt
+			}
+			batch.Queue(`INSERT INTO vwap_trades (product_id, trade_id, price, size, side, time, received_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT DO NOTHING`,
+				t.ProductID, nullInt64(t.TradeID), t.Price, t.Size, nullString(t.Side), tradeTime, t.receivedAt)
+		case r.update != nil:
+			u := r.update
+			batch.Queue(`INSERT INTO vwap_updates (product_id, vwap, window_size, trade_count, time)
+				VALUES ($1, $2, $3, $4, $5)`,
+				u.ProductID, u.VWAP, u.WindowSize, u.TradeCount, u.Time)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return s.pool.SendBatch(ctx, batch).Close()
+}
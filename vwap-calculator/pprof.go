@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+)
+
+// parseLoopbackAddr checks that the address given to flag listens on a
+// loopback interface only, for servers that expose the process's internals
+// or change its state. example is a valid address to suggest.
+func parseLoopbackAddr(flag, addr, example string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err == nil {
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid -%s %q: must be a loopback address such as %s", flag, addr, example)
+}
+
+// newPprofHandler serves the net/http/pprof endpoints under /debug/pprof/.
+func newPprofHandler() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseLoopbackAddr(t *testing.T) {
+	for addr, ok := range map[string]bool{
+		"localhost:6060": true,
+		"127.0.0.1:6060": true,
+		"[::1]:6060":     true,
+		":6060":          false,
+		"0.0.0.0:6060":   false,
+		"10.0.0.5:6060":  false,
+		"localhost":      false,
+	} {
+		if err := parseLoopbackAddr("pprof-addr", addr, "localhost:6060"); (err == nil) != ok {
+			t.Errorf("parseLoopbackAddr(%q) returned %v", addr, err)
+		}
+	}
+}
+
+func TestPprofHandler(t *testing.T) {
+	mux := newPprofHandler()
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/heap?debug=1", "/debug/pprof/goroutine?debug=1"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+			t.Errorf("Unexpected response from %s: %d", path, rec.Code)
+		}
+	}
+}
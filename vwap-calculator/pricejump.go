@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// JumpDetector flags consecutive trades of a product whose prices differ by
+// more than Threshold percent.
+type JumpDetector struct {
+	Threshold float64
+
+	mu   sync.Mutex
+	last map[string]*big.Rat
+}
+
+func NewJumpDetector(threshold float64) *JumpDetector {
+	return &JumpDetector{Threshold: threshold, last: make(map[string]*big.Rat)}
+}
+
+// Check records trade's price and returns a price_jump alert if it moved
+// too far from the product's previous trade.
+func (d *JumpDetector) Check(trade Trade) (Alert, bool) {
+	price, ok := new(big.Rat).SetString(trade.Price)
+	if !ok || price.Sign() <= 0 {
+		return Alert{}, false
+	}
+	d.mu.Lock()
+	previous := d.last[trade.ProductID]
+	d.last[trade.ProductID] = price
+	d.mu.Unlock()
+	if previous == nil {
+		return Alert{}, false
+	}
+
+	change := new(big.Rat).Sub(price, previous)
+	change.Quo(change.Mul(change, big.NewRat(100, 1)), previous)
+	pct, _ := change.Float64()
+	if pct <= d.Threshold && pct >= -d.Threshold {
+		return Alert{}, false
+	}
+	ts := trade.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	return Alert{
+		Kind:      "price_jump",
+		ProductID: trade.ProductID,
+		Message:   fmt.Sprintf("%s moved %+.2f%% from %s to %s in one trade", trade.ProductID, pct, trimDecimal(previous, 8), trade.Price),
+		TradeID:   trade.TradeID,
+		Price:     trade.Price,
+		Previous:  trimDecimal(previous, 8),
+		ChangePct: pct,
+		Time:      ts,
+	}, true
+}
+
+// SetJumpDetector makes the pipeline raise an alert whenever detector flags a
+// trade.
+func (p *Pipeline) SetJumpDetector(detector *JumpDetector) {
+	p.jumps = detector
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+type alertRecorder struct {
+	alerts []Alert
+}
+
+func (r *alertRecorder) Alert(alert Alert) error {
+	r.alerts = append(r.alerts, alert)
+	return nil
+}
+
+func TestJumpDetector(t *testing.T) {
+	detector := NewJumpDetector(2)
+	for _, tc := range []struct {
+		product, price string
+		jump           bool
+	}{
+		{"BTC-USD", "100", false},
+		{"BTC-USD", "101.5", false},
+		{"ETH-USD", "50", false}, // first ETH-USD trade, nothing to compare
+		{"BTC-USD", "98", true},  // -3.45%
+		{"BTC-USD", "100", true}, // +2.04%
+		{"BTC-USD", "abc", false},
+	} {
+		if _, jump := detector.Check(Trade{ProductID: tc.product, Price: tc.price}); jump != tc.jump {
+			t.Errorf("%s at %s: expected jump %v", tc.product, tc.price, tc.jump)
+		}
+	}
+}
+
+func TestPipelinePriceJumpAlert(t *testing.T) {
+	store := NewStore()
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"), store)
+	pipeline.SetJumpDetector(NewJumpDetector(5))
+	recorder := &alertRecorder{}
+	pipeline.AddAlertSink(recorder)
+
+	pipeline.processMessage(context.Background(), []byte(`{"type":"match","product_id":"BTC-USD","trade_id":1,"price":"100","size":"1"}`))
+	pipeline.processMessage(context.Background(), []byte(`{"type":"match","product_id":"BTC-USD","trade_id":2,"price":"90","size":"1"}`))
+
+	if len(recorder.alerts) != 1 {
+		t.Fatalf("Expected one alert, got %+v", recorder.alerts)
+	}
+	alert := recorder.alerts[0]
+	if alert.Kind != "price_jump" || alert.TradeID != 2 || alert.Previous != "100" || alert.ChangePct != -10 {
+		t.Errorf("Unexpected alert %+v", alert)
+	}
+	// Alerts are separate from the VWAP output; the trade is still applied.
+	if update, _ := store.Get("BTC-USD"); update.TradeCount != 2 {
+		t.Errorf("Expected both trades applied, got %d", update.TradeCount)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// valueAreaShare is the fraction of volume the value area must contain.
+var valueAreaShare = big.NewRat(7, 10)
+
+// VolumeProfile keeps, per product, a histogram of traded volume by price
+// bucket over a rolling period, and serves it with the point of control and
+// value area.
+type VolumeProfile struct {
+	period  time.Duration
+	buckets map[string]*big.Rat // bucket width per product
+
+	mu       sync.Mutex
+	products map[string]*productProfile
+}
+
+type productProfile struct {
+	volumes map[int64]*big.Rat // bucket index -> volume
+	entries []profileEntry     // oldest first, for expiry
+	total   big.Rat
+	newest  time.Time
+}
+
+type profileEntry struct {
+	at     time.Time
+	bucket int64
+	size   *big.Rat
+}
+
+// ProfileLevel is one price bucket; Price is its lower bound.
+type ProfileLevel struct {
+	Price  string `json:"price"`
+	Volume string `json:"volume"`
+}
+
+// ProfileReport is the volume profile of a product as served over HTTP.
+type ProfileReport struct {
+	ProductID     string         `json:"product_id"`
+	Period        string         `json:"period"`
+	BucketSize    string         `json:"bucket_size"`
+	TotalVolume   string         `json:"total_volume"`
+	POC           string         `json:"poc,omitempty"`
+	ValueAreaLow  string         `json:"value_area_low,omitempty"`
+	ValueAreaHigh string         `json:"value_area_high,omitempty"`
+	Levels        []ProfileLevel `json:"levels"`
+}
+
+// NewVolumeProfile builds profiles for the products in buckets, which maps
+// each to its bucket width as a decimal string.
+func NewVolumeProfile(period time.Duration, buckets map[string]string) (*VolumeProfile, error) {
+	p := &VolumeProfile{period: period, buckets: make(map[string]*big.Rat), products: make(map[string]*productProfile)}
+	for productID, s := range buckets {
+		width, ok := new(big.Rat).SetString(s)
+		if !ok || width.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid bucket size %q for %s", s, productID)
+		}
+		p.buckets[productID] = width
+		p.products[productID] = &productProfile{volumes: make(map[int64]*big.Rat)}
+	}
+	return p, nil
+}
+
+// RecordTrade adds the trade's size to its price bucket and drops trades that
+// have aged out of the period, measured from the newest trade seen.
+func (p *VolumeProfile) RecordTrade(trade Trade) error {
+	width, ok := p.buckets[trade.ProductID]
+	if !ok {
+		return nil
+	}
+	price, ok1 := new(big.Rat).SetString(trade.Price)
+	size, ok2 := new(big.Rat).SetString(trade.Size)
+	if !ok1 || !ok2 {
+		return fmt.Errorf("volume profile: invalid trade %s @ %s", trade.Size, trade.Price)
+	}
+	at := trade.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+	q := new(big.Rat).Quo(price, width)
+	bucket := new(big.Int).Quo(q.Num(), q.Denom()).Int64()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	prof := p.products[trade.ProductID]
+	if at.After(prof.newest) {
+		prof.newest = at
+	}
+	if p.period > 0 && at.Before(prof.newest.Add(-p.period)) {
+		return nil
+	}
+	if prof.volumes[bucket] == nil {
+		prof.volumes[bucket] = new(big.Rat)
+	}
+	prof.volumes[bucket].Add(prof.volumes[bucket], size)
+	prof.total.Add(&prof.total, size)
+	prof.entries = append(prof.entries, profileEntry{at: at, bucket: bucket, size: size})
+	p.expireLocked(prof)
+	return nil
+}
+
+func (p *VolumeProfile) expireLocked(prof *productProfile) {
+	if p.period <= 0 {
+		return
+	}
+	cutoff := prof.newest.Add(-p.period)
+	n := 0
+	for n < len(prof.entries) && prof.entries[n].at.Before(cutoff) {
+		e := prof.entries[n]
+		prof.volumes[e.bucket].Sub(prof.volumes[e.bucket], e.size)
+		if prof.volumes[e.bucket].Sign() == 0 {
+			delete(prof.volumes, e.bucket)
+		}
+		prof.total.Sub(&prof.total, e.size)
+		n++
+	}
+	prof.entries = prof.entries[n:]
+}
+
+// Report returns productID's profile, levels ordered by price.
+func (p *VolumeProfile) Report(productID string) (ProfileReport, bool) {
+	width, ok := p.buckets[productID]
+	if !ok {
+		return ProfileReport{}, false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	prof := p.products[productID]
+	report := ProfileReport{
+		ProductID:   productID,
+		Period:      p.period.String(),
+		BucketSize:  trimDecimal(width, 8),
+		TotalVolume: trimDecimal(&prof.total, 8),
+		Levels:      make([]ProfileLevel, 0, len(prof.volumes)),
+	}
+
+	indexes := make([]int64, 0, len(prof.volumes))
+	for bucket := range prof.volumes {
+		indexes = append(indexes, bucket)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+	bucketPrice := func(bucket int64) string {
+		return trimDecimal(new(big.Rat).Mul(width, new(big.Rat).SetInt64(bucket)), 8)
+	}
+	poc := -1
+	for i, bucket := range indexes {
+		report.Levels = append(report.Levels, ProfileLevel{Price: bucketPrice(bucket), Volume: trimDecimal(prof.volumes[bucket], 8)})
+		if poc < 0 || prof.volumes[bucket].Cmp(prof.volumes[indexes[poc]]) > 0 {
+			poc = i
+		}
+	}
+	if poc < 0 {
+		return report, true
+	}
+
+	// Grow the value area outwards from the point of control, taking the
+	// heavier neighbour each time, until it holds valueAreaShare of volume.
+	target := new(big.Rat).Mul(&prof.total, valueAreaShare)
+	covered := new(big.Rat).Set(prof.volumes[indexes[poc]])
+	low, high := poc, poc
+	for covered.Cmp(target) < 0 && (low > 0 || high < len(indexes)-1) {
+		takeLow := high == len(indexes)-1 ||
+			(low > 0 && prof.volumes[indexes[low-1]].Cmp(prof.volumes[indexes[high+1]]) >= 0)
+		if takeLow {
+			low--
+			covered.Add(covered, prof.volumes[indexes[low]])
+		} else {
+			high++
+			covered.Add(covered, prof.volumes[indexes[high]])
+		}
+	}
+	report.POC = bucketPrice(indexes[poc])
+	report.ValueAreaLow = bucketPrice(indexes[low])
+	report.ValueAreaHigh = bucketPrice(indexes[high] + 1)
+	return report, true
+}
+
+// ServeHTTP handles GET /profile/{product}.
+func (p *VolumeProfile) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report, ok := p.Report(r.PathValue("product"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no volume profile for product " + r.PathValue("product")})
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// trimDecimal formats r with up to places decimal places, dropping trailing
+// zeros.
+func trimDecimal(r *big.Rat, places int) string {
+	s := r.FloatString(places)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestVolumeProfile(t *testing.T) {
+	profile, err := NewVolumeProfile(time.Hour, map[string]string{"BTC-USD": "10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, tr := range []struct {
+		price, size string
+	}{
+		{"100", "1"}, {"105", "1"}, // bucket 100: 2
+		{"112", "5"}, // bucket 110: 5
+		{"121", "2"}, // bucket 120: 2
+		{"135", "1"}, // bucket 130: 1
+	} {
+		profile.RecordTrade(Trade{ProductID: "BTC-USD", Price: tr.price, Size: tr.size, Time: base})
+	}
+	profile.RecordTrade(Trade{ProductID: "ETH-USD", Price: "3000", Size: "1", Time: base})
+
+	report, ok := profile.Report("BTC-USD")
+	if !ok {
+		t.Fatal("No report for BTC-USD")
+	}
+	levels := []ProfileLevel{{"100", "2"}, {"110", "5"}, {"120", "2"}, {"130", "1"}}
+	if !reflect.DeepEqual(report.Levels, levels) {
+		t.Errorf("Expected levels %v, got %v", levels, report.Levels)
+	}
+	// 70% of 10 is 7: the POC's 5 plus the lower neighbour (tie) reaches it.
+	if report.POC != "110" || report.ValueAreaLow != "100" || report.ValueAreaHigh != "120" || report.TotalVolume != "10" {
+		t.Errorf("Unexpected summary %+v", report)
+	}
+
+	profile.RecordTrade(Trade{ProductID: "BTC-USD", Price: "131", Size: "0.5", Time: base.Add(90 * time.Minute)})
+	report, _ = profile.Report("BTC-USD")
+	if !reflect.DeepEqual(report.Levels, []ProfileLevel{{"130", "0.5"}}) || report.TotalVolume != "0.5" {
+		t.Errorf("Expected earlier trades to expire, got %+v", report)
+	}
+
+	if _, ok := profile.Report("ETH-USD"); ok {
+		t.Error("Expected no profile for a product without a bucket size")
+	}
+}
+
+func TestVolumeProfileHTTP(t *testing.T) {
+	profile, _ := NewVolumeProfile(0, map[string]string{"ETH-BTC": "0.0001"})
+	profile.RecordTrade(Trade{ProductID: "ETH-BTC", Price: "0.06789", Size: "3"})
+	mux := http.NewServeMux()
+	mux.Handle("GET /profile/{product}", profile)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/profile/ETH-BTC", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	report, _ := profile.Report("ETH-BTC")
+	if report.POC != "0.0678" || report.ValueAreaHigh != "0.0679" {
+		t.Errorf("Unexpected report %+v", report)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/profile/BTC-USD", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", rec.Code)
+	}
+	if _, err := NewVolumeProfile(0, map[string]string{"BTC-USD": "-1"}); err == nil {
+		t.Error("Expected error for negative bucket size")
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Encodings a sink can write trades and updates in.
+const (
+	encodingJSON = "json"
+	// encodingProtobuf is the vwap.v1 schema in proto/vwap.proto.
+	encodingProtobuf = "protobuf"
+)
+
+func parseEncoding(flag, s string) (string, error) {
+	switch s {
+	case encodingJSON, encodingProtobuf:
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid -%s %q: must be %s or %s", flag, s, encodingJSON, encodingProtobuf)
+}
+
+// encodeUpdate serializes update in encoding, JSON when it is empty.
+func encodeUpdate(encoding string, update VWAPUpdate) ([]byte, error) {
+	if encoding == encodingProtobuf {
+		return appendUpdateProto(nil, update), nil
+	}
+	return json.Marshal(update)
+}
+
+// encodeTrade serializes trade in encoding, JSON when it is empty.
+func encodeTrade(encoding string, trade Trade) ([]byte, error) {
+	if encoding == encodingProtobuf {
+		return appendTradeProto(nil, trade), nil
+	}
+	return json.Marshal(trade)
+}
+
+// appendTradeProto appends trade as a vwap.v1.Trade message.
+func appendTradeProto(b []byte, trade Trade) []byte {
+	b = appendProtoString(b, 1, trade.Type)
+	b = appendProtoString(b, 2, trade.ProductID)
+	b = appendProtoInt(b, 3, trade.TradeID)
+	b = appendProtoInt(b, 4, trade.Sequence)
+	b = appendProtoString(b, 5, trade.Price)
+	b = appendProtoString(b, 6, trade.Size)
+	b = appendProtoString(b, 7, trade.Side)
+	return appendProtoTime(b, 8, trade.Time)
+}
+
+// appendUpdateProto appends update as a vwap.v1.VWAPUpdate message.
+// Indicators are written in name order, so equal updates encode equally.
+func appendUpdateProto(b []byte, update VWAPUpdate) []byte {
+	b = appendProtoString(b, 1, update.ProductID)
+	b = appendProtoString(b, 2, update.VWAP)
+	b = appendProtoString(b, 3, update.Method)
+	b = appendProtoInt(b, 4, int64(update.WindowSize))
+	b = appendProtoInt(b, 5, update.TradeCount)
+	b = appendProtoString(b, 6, update.High)
+	b = appendProtoString(b, 7, update.Low)
+	b = appendProtoString(b, 8, update.StdDev)
+	for _, band := range update.Bands {
+		var m []byte
+		if band.K != 0 {
+			m = protowire.AppendTag(m, 1, protowire.Fixed64Type)
+			m = protowire.AppendFixed64(m, math.Float64bits(band.K))
+		}
+		m = appendProtoString(m, 2, band.Upper)
+		m = appendProtoString(m, 3, band.Lower)
+		b = appendProtoMessage(b, 9, m)
+	}
+	b = appendProtoInt(b, 10, update.MissedTrades)
+	for _, name := range slices.Sorted(maps.Keys(update.Indicators)) {
+		// A map field is a repeated entry message of key = 1, value = 2.
+		var m []byte
+		m = appendProtoString(m, 1, name)
+		m = appendProtoString(m, 2, update.Indicators[name])
+		b = appendProtoMessage(b, 11, m)
+	}
+	b = appendProtoString(b, 12, update.BestBid)
+	b = appendProtoString(b, 13, update.BestAsk)
+	b = appendProtoString(b, 14, update.MidPrice)
+	b = appendProtoString(b, 15, update.Volume)
+	b = appendProtoString(b, 16, update.Notional)
+	b = appendProtoString(b, 17, update.USDVWAP)
+	b = appendProtoString(b, 18, update.USDNotional)
+	b = appendProtoTime(b, 19, update.Time)
+	b = appendProtoString(b, 20, update.LastPrice)
+	return appendProtoString(b, 21, update.DeviationPct)
+}
+
+// The append helpers leave out proto3 default values, as protoc-generated
+// code does.
+
+func appendProtoString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendProtoInt(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func appendProtoMessage(b []byte, num protowire.Number, m []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m)
+}
+
+// appendProtoTime appends t as a google.protobuf.Timestamp.
+func appendProtoTime(b []byte, num protowire.Number, t time.Time) []byte {
+	if t.IsZero() {
+		return b
+	}
+	var m []byte
+	m = appendProtoInt(m, 1, t.Unix())
+	m = appendProtoInt(m, 2, int64(t.Nanosecond()))
+	return appendProtoMessage(b, num, m)
+}
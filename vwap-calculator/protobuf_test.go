@@ -0,0 +1,97 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodeProto returns a message's fields in order: varints and fixed64s as
+// uint64, and length-delimited fields as []byte.
+func decodeProto(t *testing.T, b []byte) map[protowire.Number][]any {
+	t.Helper()
+	fields := make(map[protowire.Number][]any)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("Bad tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		var v any
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		default:
+			t.Fatalf("Unexpected wire type %d for field %d", typ, num)
+		}
+		if n < 0 {
+			t.Fatalf("Bad field %d: %v", num, protowire.ParseError(n))
+		}
+		fields[num] = append(fields[num], v)
+		b = b[n:]
+	}
+	return fields
+}
+
+func protoString(fields map[protowire.Number][]any, num protowire.Number) string {
+	if len(fields[num]) == 0 {
+		return ""
+	}
+	return string(fields[num][0].([]byte))
+}
+
+func TestTradeProto(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC)
+	data, err := encodeTrade(encodingProtobuf, Trade{Type: "match", ProductID: "BTC-USD", TradeID: 42, Price: "45000.01", Size: "0.5", Side: "buy", Time: at})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := decodeProto(t, data)
+	if protoString(fields, 2) != "BTC-USD" || fields[3][0].(uint64) != 42 || protoString(fields, 5) != "45000.01" ||
+		protoString(fields, 6) != "0.5" || protoString(fields, 7) != "buy" {
+		t.Errorf("Unexpected fields %v", fields)
+	}
+	if _, ok := fields[4]; ok {
+		t.Error("Expected the zero sequence to be left out")
+	}
+	ts := decodeProto(t, fields[8][0].([]byte))
+	if ts[1][0].(uint64) != uint64(at.Unix()) || ts[2][0].(uint64) != 6000 {
+		t.Errorf("Unexpected timestamp %v", ts)
+	}
+}
+
+func TestUpdateProto(t *testing.T) {
+	data, err := encodeUpdate(encodingProtobuf, VWAPUpdate{
+		ProductID:  "ETH-USD",
+		VWAP:       "3000.0000",
+		WindowSize: 200,
+		TradeCount: 7,
+		Bands:      []Band{{K: 2, Upper: "3100", Lower: "2900"}},
+		Indicators: map[string]string{"sma20": "2990", "ema10": "2995"},
+		MidPrice:   "3000.5",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := decodeProto(t, data)
+	if protoString(fields, 1) != "ETH-USD" || protoString(fields, 2) != "3000.0000" || fields[4][0].(uint64) != 200 ||
+		fields[5][0].(uint64) != 7 || protoString(fields, 14) != "3000.5" {
+		t.Errorf("Unexpected fields %v", fields)
+	}
+	band := decodeProto(t, fields[9][0].([]byte))
+	if math.Float64frombits(band[1][0].(uint64)) != 2 || protoString(band, 2) != "3100" || protoString(band, 3) != "2900" {
+		t.Errorf("Unexpected band %v", band)
+	}
+	if len(fields[11]) != 2 || protoString(decodeProto(t, fields[11][0].([]byte)), 1) != "ema10" {
+		t.Errorf("Expected indicator entries in name order, got %v", fields[11])
+	}
+	if _, ok := fields[19]; ok {
+		t.Error("Expected the zero time to be left out")
+	}
+}
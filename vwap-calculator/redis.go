@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisFlushWait bounds how stale the cached latest value can be, so it is
+// much shorter than the flush interval of the storage sinks.
+const redisFlushWait = 50 * time.Millisecond
+
+// RedisConfig selects the server, channels and keys for RedisSink.
+type RedisConfig struct {
+	URL           string
+	ChannelPrefix string
+	KeyPrefix     string
+	TTL           time.Duration
+}
+
+// RedisSink publishes each VWAP update on <channel prefix>.<product> and
+// caches it under <key prefix>:<product> with a TTL, so readers can fetch
+// the current value with a single GET.
+type RedisSink struct {
+	client *redis.Client
+	cfg    RedisConfig
+	queue  *batchQueue[VWAPUpdate]
+	logger Logger
+}
+
+func NewRedisSink(ctx context.Context, cfg RedisConfig, logger Logger) (*RedisSink, error) {
+	opts, err := redis.ParseURL(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing redis URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connecting to redis: %w", err)
+	}
+
+	s := &RedisSink{client: client, cfg: cfg, logger: logger}
+	s.queue = newBatchQueue(storageQueueSize, storageBatchSize, redisFlushWait, func(batch []VWAPUpdate) {
+		if err := s.write(batch); err != nil {
+			s.logger.Errorf("Writing %d updates to redis failed: %v", len(batch), err)
+		}
+	})
+	return s, nil
+}
+
+func (s *RedisSink) Publish(update VWAPUpdate) error {
+	if !s.queue.Offer(update) {
+		return errQueueFull
+	}
+	return nil
+}
+
+// Close flushes queued updates and closes the client.
+func (s *RedisSink) Close() error {
+	s.queue.Close()
+	return s.client.Close()
+}
+
+func (s *RedisSink) write(batch []VWAPUpdate) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, update := range batch {
+			data, err := json.Marshal(update)
+			if err != nil {
+				return err
+			}
+			pipe.Publish(ctx, s.cfg.ChannelPrefix+"."+update.ProductID, data)
+			pipe.Set(ctx, s.cfg.KeyPrefix+":"+update.ProductID, data, s.cfg.TTL)
+		}
+		return nil
+	})
+	return err
+}
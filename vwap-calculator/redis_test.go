@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisSink(t *testing.T) {
+	server := miniredis.RunT(t)
+	ctx := context.Background()
+	cfg := RedisConfig{URL: "redis://" + server.Addr(), ChannelPrefix: "vwap", KeyPrefix: "vwap:latest", TTL: time.Minute}
+	sink, err := NewRedisSink(ctx, cfg, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	if err != nil {
+		t.Fatalf("NewRedisSink returned error: %v", err)
+	}
+
+	subscriber := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer subscriber.Close()
+	sub := subscriber.Subscribe(ctx, "vwap.BTC-USD")
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	sink.Publish(VWAPUpdate{ProductID: "BTC-USD", VWAP: "45000.1234", TradeCount: 3})
+	sink.Close()
+
+	raw, err := server.Get("vwap:latest:BTC-USD")
+	if err != nil {
+		t.Fatalf("Latest value not cached: %v", err)
+	}
+	var cached VWAPUpdate
+	if err := json.Unmarshal([]byte(raw), &cached); err != nil || cached.VWAP != "45000.1234" {
+		t.Errorf("Unexpected cached value %q (%v)", raw, err)
+	}
+	if ttl := server.TTL("vwap:latest:BTC-USD"); ttl != time.Minute {
+		t.Errorf("Expected 1m TTL, got %v", ttl)
+	}
+
+	select {
+	case msg := <-sub.Channel():
+		if msg.Payload != raw {
+			t.Errorf("Published payload %q differs from cached %q", msg.Payload, raw)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("No message published")
+	}
+}
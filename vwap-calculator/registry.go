@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CustomIndicator is a user-defined indicator run on a product's trades. It
+// is only called from the product's worker, so it needs no locking of its
+// own.
+type CustomIndicator interface {
+	// OnTrade is called with each trade accepted for the product, in order.
+	OnTrade(trade Trade) error
+	// Value returns the indicator's current value for the product's next
+	// update.
+	Value() string
+}
+
+// IndicatorFactory builds a CustomIndicator from the arguments given after
+// its kind in -indicator, e.g. "20" for vwma:20; args is empty when none
+// were given.
+type IndicatorFactory func(args string) (CustomIndicator, error)
+
+var (
+	indicatorsMu       sync.RWMutex
+	indicatorFactories = make(map[string]IndicatorFactory)
+)
+
+// RegisterIndicator makes an indicator kind available to -indicator. It is
+// meant to be called from init and panics if kind is already registered.
+func RegisterIndicator(kind string, factory IndicatorFactory) {
+	indicatorsMu.Lock()
+	defer indicatorsMu.Unlock()
+	if _, ok := indicatorFactories[kind]; ok {
+		panic("indicator " + kind + " registered twice")
+	}
+	indicatorFactories[kind] = factory
+}
+
+// IndicatorKinds returns the registered indicator kinds in order.
+func IndicatorKinds() []string {
+	indicatorsMu.RLock()
+	defer indicatorsMu.RUnlock()
+	return slices.Sorted(maps.Keys(indicatorFactories))
+}
+
+func indicatorFactory(kind string) (IndicatorFactory, bool) {
+	indicatorsMu.RLock()
+	defer indicatorsMu.RUnlock()
+	factory, ok := indicatorFactories[kind]
+	return factory, ok
+}
+
+func init() {
+	RegisterIndicator("last", func(args string) (CustomIndicator, error) {
+		if args != "" {
+			return nil, fmt.Errorf("last takes no arguments, got %q", args)
+		}
+		return &lastPrice{}, nil
+	})
+}
+
+// lastPrice is the built-in "last" indicator: the latest trade price.
+type lastPrice struct {
+	price string
+}
+
+func (l *lastPrice) OnTrade(trade Trade) error {
+	l.price = trade.Price
+	return nil
+}
+
+func (l *lastPrice) Value() string {
+	return l.price
+}
+
+// indicatorSpec is one -indicator value: a registered kind, its arguments
+// and the product it is limited to, if any.
+type indicatorSpec struct {
+	product string
+	kind    string
+	args    string
+}
+
+// name is the key the indicator's value is reported under: its kind followed
+// by its arguments, e.g. vwma20.
+func (s indicatorSpec) name() string {
+	return s.kind + s.args
+}
+
+func (s indicatorSpec) String() string {
+	spec := s.kind
+	if s.args != "" {
+		spec += ":" + s.args
+	}
+	if s.product != "" {
+		spec = s.product + "=" + spec
+	}
+	return spec
+}
+
+// calculator builds the indicator, adapted to run as one of a product's
+// indicators.
+func (s indicatorSpec) calculator(productID string) (*customCalculator, error) {
+	factory, ok := indicatorFactory(s.kind)
+	if !ok {
+		return nil, fmt.Errorf("unknown indicator %q (registered: %s)", s.kind, strings.Join(IndicatorKinds(), ", "))
+	}
+	c := &customCalculator{productID: productID, build: func() (CustomIndicator, error) { return factory(s.args) }}
+	var err error
+	if c.indicator, err = c.build(); err != nil {
+		return nil, fmt.Errorf("indicator %s: %w", s, err)
+	}
+	return c, nil
+}
+
+// indicatorList is the repeatable -indicator flag. Each value is
+// [PRODUCT=]kind[:args]; without a product it applies to every product.
+type indicatorList []indicatorSpec
+
+func (l *indicatorList) String() string {
+	parts := make([]string, len(*l))
+	for i, spec := range *l {
+		parts[i] = spec.String()
+	}
+	return strings.Join(parts, " ")
+}
+
+func (l *indicatorList) Set(s string) error {
+	var spec indicatorSpec
+	if product, rest, ok := strings.Cut(s, "="); ok {
+		spec.product, s = product, rest
+	}
+	spec.kind, spec.args, _ = strings.Cut(s, ":")
+	if spec.kind == "" {
+		return fmt.Errorf("invalid indicator %q: want [PRODUCT=]kind[:args]", s)
+	}
+	// Build it once so unknown kinds and bad arguments fail at startup.
+	if _, err := spec.calculator(spec.product); err != nil {
+		return err
+	}
+	*l = append(*l, spec)
+	return nil
+}
+
+// For returns the indicators that apply to productID.
+func (l indicatorList) For(productID string) []indicatorSpec {
+	var specs []indicatorSpec
+	for _, spec := range l {
+		if spec.product == "" || spec.product == productID {
+			specs = append(specs, spec)
+		}
+	}
+	return specs
+}
+
+// customCalculator runs a CustomIndicator as a product indicator. Resetting
+// it builds a fresh indicator from the factory.
+type customCalculator struct {
+	productID string
+	build     func() (CustomIndicator, error)
+
+	mu        sync.Mutex
+	indicator CustomIndicator
+	trades    int64
+	last      time.Time
+}
+
+func (c *customCalculator) Update(price, size string) error {
+	return c.UpdateTrade(Trade{ProductID: c.productID, Price: price, Size: size})
+}
+
+// UpdateTrade passes the whole trade, including its side and ID, to the
+// indicator.
+func (c *customCalculator) UpdateTrade(trade Trade) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.indicator.OnTrade(trade); err != nil {
+		return err
+	}
+	c.trades++
+	c.last = trade.Time
+	return nil
+}
+
+func (c *customCalculator) Calculate() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.indicator.Value()
+}
+
+func (c *customCalculator) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// The factory succeeded with these arguments at startup.
+	if indicator, err := c.build(); err == nil {
+		c.indicator = indicator
+	}
+	c.trades, c.last = 0, time.Time{}
+}
+
+func (c *customCalculator) TradeCount() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.trades
+}
+
+func (c *customCalculator) Stats() CalculatorStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CalculatorStats{LastTrade: c.last}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strconv"
+	"testing"
+)
+
+// buyShare is a test indicator: the fraction of the last trades that were
+// buys, where the window is given as its argument.
+type buyShare struct {
+	window int
+	sides  []string
+}
+
+func (b *buyShare) OnTrade(trade Trade) error {
+	b.sides = append(b.sides, trade.Side)
+	if len(b.sides) > b.window {
+		b.sides = b.sides[1:]
+	}
+	return nil
+}
+
+func (b *buyShare) Value() string {
+	buys := 0
+	for _, side := range b.sides {
+		if side == "buy" {
+			buys++
+		}
+	}
+	return strconv.FormatFloat(float64(buys)/float64(len(b.sides)), 'f', 2, 64)
+}
+
+func init() {
+	RegisterIndicator("buyshare", func(args string) (CustomIndicator, error) {
+		window, err := strconv.Atoi(args)
+		if err != nil || window <= 0 {
+			return nil, errors.New("want a positive window")
+		}
+		return &buyShare{window: window}, nil
+	})
+}
+
+func TestIndicatorList(t *testing.T) {
+	var list indicatorList
+	for _, s := range []string{"last", "BTC-USD=buyshare:2"} {
+		if err := list.Set(s); err != nil {
+			t.Fatalf("Set(%q): %v", s, err)
+		}
+	}
+	if got := list.String(); got != "last BTC-USD=buyshare:2" {
+		t.Errorf("Unexpected String %q", got)
+	}
+	if specs := list.For("ETH-USD"); len(specs) != 1 || specs[0].name() != "last" {
+		t.Errorf("Expected only last for ETH-USD, got %+v", specs)
+	}
+	if specs := list.For("BTC-USD"); len(specs) != 2 || specs[1].name() != "buyshare2" {
+		t.Errorf("Expected last and buyshare2 for BTC-USD, got %+v", specs)
+	}
+	for _, s := range []string{"nosuch", "buyshare", "buyshare:x", "last:1", "BTC-USD="} {
+		if err := list.Set(s); err == nil {
+			t.Errorf("Set(%q): expected an error", s)
+		}
+	}
+}
+
+func TestPipelineCustomIndicators(t *testing.T) {
+	store := NewStore()
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"), store)
+	cfg := &Config{}
+	cfg.Indicators.Set("last")
+	cfg.Indicators.Set("BTC-USD=buyshare:2")
+	configureProduct(cfg, pipeline, "BTC-USD")
+
+	ctx := context.Background()
+	pipeline.processMessage(ctx, []byte(`{"type":"match","product_id":"BTC-USD","trade_id":1,"price":"100","size":"1","side":"sell"}`))
+	pipeline.processMessage(ctx, []byte(`{"type":"match","product_id":"BTC-USD","trade_id":2,"price":"101","size":"1","side":"buy"}`))
+	pipeline.processMessage(ctx, []byte(`{"type":"match","product_id":"BTC-USD","trade_id":3,"price":"102","size":"1","side":"buy"}`))
+
+	update, _ := store.Get("BTC-USD")
+	if update.Indicators["last"] != "102" || update.Indicators["buyshare2"] != "1.00" {
+		t.Errorf("Unexpected indicators %+v", update.Indicators)
+	}
+
+	// Resetting the product builds fresh indicators.
+	pipeline.ResetProduct("BTC-USD")
+	pipeline.processMessage(ctx, []byte(`{"type":"match","product_id":"BTC-USD","trade_id":4,"price":"103","size":"1","side":"sell"}`))
+	update, _ = store.Get("BTC-USD")
+	if update.Indicators["last"] != "103" || update.Indicators["buyshare2"] != "0.00" {
+		t.Errorf("Unexpected indicators after reset %+v", update.Indicators)
+	}
+}
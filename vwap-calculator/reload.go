@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// reloadableSink forwards to a sink that can be swapped while running, so a
+// reload can change the -output format.
+type reloadableSink struct {
+	mu   sync.RWMutex
+	sink OutputSink
+}
+
+func (s *reloadableSink) set(sink OutputSink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sink = sink
+}
+
+func (s *reloadableSink) current() OutputSink {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sink
+}
+
+func (s *reloadableSink) Publish(update VWAPUpdate) error {
+	return s.current().Publish(update)
+}
+
+func (s *reloadableSink) PublishCandle(candle Candle) error {
+	return s.current().PublishCandle(candle)
+}
+
+// ReplaceCalculator swaps productID's calculator for calculator, seeding it
+// with the most recent trades of the old one where both allow it. The swap
+// runs on the product's worker, so each trade reaches one calculator or the
+// other.
+func (p *Pipeline) ReplaceCalculator(productID string, calculator Calculator) error {
+	var err error
+	p.onWorker(productID, func() { err = p.replaceCalculator(productID, calculator) })
+	return err
+}
+
+func (p *Pipeline) replaceCalculator(productID string, calculator Calculator) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	old, ok := p.calculators[productID]
+	if !ok {
+		return errUnknownProduct
+	}
+	if s, ok := old.(Snapshotter); ok {
+		trades := s.Snapshot().Trades
+		if n := windowSizeOf(calculator); n > 0 && len(trades) > n {
+			trades = trades[len(trades)-n:]
+		}
+		for _, trade := range trades {
+			if calculator.Update(trade[0], trade[1]) != nil {
+				calculator.Reset()
+				break
+			}
+		}
+	}
+	calculators := maps.Clone(p.calculators)
+	calculators[productID] = calculator
+	p.calculators = calculators
+	return nil
+}
+
+// reloadOnHangup reloads the configuration on every SIGHUP until ctx is
+// cancelled.
+func reloadOnHangup(ctx context.Context, admin *productAdmin, logger Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-hup:
+			logger.Infof("Reloading %s", admin.cfg.ConfigFile)
+			if err := admin.reload(ctx); err != nil {
+				logger.Errorf("Reloading configuration failed: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reload re-reads the command line and -config file and applies the settings
+// that can change while running: the log level, -output, -products and each
+// product's -calculator, -window, -precision and -rounding. Changed
+// calculators keep as much of their window as they can. The new settings are
+// checked in full before any is applied, and a change to any other setting
+// rejects the reload, as it needs a restart.
+func (a *productAdmin) reload(ctx context.Context) error {
+	next, err := parseFlags(a.cfg.args)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	cur := a.cfg
+	if changed := restartOnly(cur, next); len(changed) > 0 {
+		return fmt.Errorf("changes to %s need a restart, so nothing was reloaded", strings.Join(changed, ", "))
+	}
+	changes, err := a.planCalculators(cur, next)
+	if err != nil {
+		return err
+	}
+	add, remove, err := a.planProducts(cur, next)
+	if err != nil {
+		return err
+	}
+
+	// Everything checks out, so apply it all. Anything that still fails is
+	// reported without stopping the rest.
+	cur.LogLevel.Set(next.LogLevel.Level())
+	if next.Output != cur.Output && a.output != nil {
+		a.output.set(newOutputSink(next.Output, a.stdout))
+		cur.Output = next.Output
+	}
+	var errs []error
+	for _, change := range changes {
+		if err := change.apply(a.pipeline); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", change.productID, err))
+			continue
+		}
+		a.logger.With("product", change.productID).Infof("%s", change)
+	}
+	for _, sp := range cur.Synthetics {
+		if a.pipeline.cross != nil && next.formatFor(sp.Name) != cur.formatFor(sp.Name) {
+			a.pipeline.cross.SetFormat(sp.Name, next.formatFor(sp.Name))
+		}
+	}
+	cur.Calculators, cur.WindowSizes = next.Calculators, next.WindowSizes
+	cur.Precision, cur.Rounding = next.Precision, next.Rounding
+
+	for _, productID := range remove {
+		if err := a.removeLocked(ctx, productID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	cur.Products = next.Products
+	for _, productID := range add {
+		if err := a.addLocked(ctx, productID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	a.logger.Infof("Configuration reloaded")
+	return nil
+}
+
+// calculatorChange is how a reload changes one product's calculator: resizing
+// its window, replacing it, and setting its format.
+type calculatorChange struct {
+	productID  string
+	method     string
+	window     int
+	resize     bool
+	calculator Calculator   // the replacement, unless resizing
+	format     *priceFormat // the new format, if it changed
+}
+
+// planCalculators works out the calculator changes from cur to next, building
+// any replacement calculators, without changing anything.
+func (a *productAdmin) planCalculators(cur, next *Config) ([]calculatorChange, error) {
+	var changes []calculatorChange
+	for _, productID := range a.pipeline.Subscriptions() {
+		calculator, _, ok := a.pipeline.calculator(productID)
+		if !ok {
+			continue
+		}
+		change := calculatorChange{productID: productID, method: next.Calculators.Get(productID, "vwap"), window: next.windowFor(productID)}
+		if format := next.formatFor(productID); format != cur.formatFor(productID) {
+			change.format = &format
+		}
+		sameMethod := change.method == cur.Calculators.Get(productID, "vwap")
+		if sameMethod && change.window == cur.windowFor(productID) {
+			if change.format != nil {
+				changes = append(changes, change)
+			}
+			continue
+		}
+		if _, ok := calculator.(ResizableCalculator); ok && sameMethod {
+			// Only the window changed, and the calculator keeps its trades.
+			change.resize = true
+		} else {
+			c, err := newCalculator(change.method, change.window, cur.HalfLife)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", productID, err)
+			}
+			if f, ok := c.(Formatter); ok {
+				f.SetFormat(next.formatFor(productID))
+			}
+			change.calculator = c
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// apply makes the change on the product's worker, between two of its trades.
+func (c calculatorChange) apply(p *Pipeline) error {
+	var err error
+	p.onWorker(c.productID, func() {
+		switch {
+		case c.resize:
+			err = p.ResizeWindow(c.productID, c.window)
+		case c.calculator != nil:
+			err = p.replaceCalculator(c.productID, c.calculator)
+		}
+		if err == nil && c.format != nil {
+			p.SetFormat(c.productID, *c.format)
+		}
+	})
+	return err
+}
+
+func (c calculatorChange) String() string {
+	switch {
+	case c.resize:
+		return fmt.Sprintf("Window resized to %d trades", c.window)
+	case c.calculator != nil:
+		return fmt.Sprintf("Calculator changed to %s over %d trades", c.method, c.window)
+	}
+	return fmt.Sprintf("Format changed to %d places, rounding %s", c.format.places, c.format.rounding)
+}
+
+// planProducts returns the products a reload from cur to next adds and
+// removes, or an error if any of them cannot be.
+func (a *productAdmin) planProducts(cur, next *Config) (add, remove []string, err error) {
+	// Discovered products are not rediscovered, and synthetic legs stay as
+	// the synthetics themselves are not reloaded.
+	want := slices.Clone(next.Products)
+	if cur.AllProducts != "" {
+		want = a.pipeline.Subscriptions()
+	}
+	for _, leg := range cur.Synthetics.legs() {
+		if !slices.Contains(want, leg) {
+			want = append(want, leg)
+		}
+	}
+	for _, productID := range a.pipeline.Subscriptions() {
+		if !slices.Contains(want, productID) {
+			remove = append(remove, productID)
+		}
+	}
+	for _, productID := range want {
+		if _, _, ok := a.pipeline.calculator(productID); ok {
+			continue
+		}
+		if slices.ContainsFunc(cur.Synthetics, func(sp SyntheticProduct) bool { return sp.Name == productID }) {
+			return nil, nil, fmt.Errorf("%s is a synthetic product", productID)
+		}
+		add = append(add, productID)
+	}
+	return add, remove, nil
+}
+
+// restartOnly returns the settings, by Config field, that differ between cur
+// and next but that reload cannot apply.
+func restartOnly(cur, next *Config) []string {
+	a, b := *cur, *next
+	for _, c := range []*Config{&a, &b} {
+		c.LogLevel, c.Output, c.Products, c.Calculators, c.WindowSizes = nil, "", nil, nil, nil
+		c.Precision, c.Rounding = nil, nil
+	}
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	var changed []string
+	for i := range va.NumField() {
+		field := va.Type().Field(i)
+		if field.IsExported() && !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			changed = append(changed, field.Name)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProductAdminReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vwap.conf")
+	write := func(s string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(s), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("products = BTC-USD,ETH-USD\nwindow = 3\n")
+	cfg, err := parseFlags([]string{"-config", path})
+	if err != nil {
+		t.Fatalf("parseFlags returned error: %v", err)
+	}
+
+	var stdout bytes.Buffer
+	output := &reloadableSink{sink: newOutputSink(cfg.Output, io.Discard)}
+	calculators := map[string]Calculator{"BTC-USD": NewWindowedVWAPCalculator(3), "ETH-USD": NewWindowedVWAPCalculator(3)}
+	logger := NewLogger(io.Discard, slog.LevelInfo, "text")
+	pipeline := NewPipeline(calculators, logger, output)
+	admin := &productAdmin{cfg: cfg, pipeline: pipeline, output: output, stdout: &stdout, logger: logger}
+	for i, price := range []string{"100", "200", "300"} {
+		msg := fmt.Sprintf(`{"type":"match","product_id":"BTC-USD","trade_id":%d,"price":"%s","size":"1"}`, i+1, price)
+		pipeline.processMessage(context.Background(), []byte(msg))
+	}
+
+	write("products = BTC-USD,SOL-USD\nwindow = BTC-USD=2\nlog-level = debug\noutput = json\n")
+	if err := admin.reload(context.Background()); err != nil {
+		t.Fatalf("reload returned error: %v", err)
+	}
+
+	if cfg.LogLevel.Level() != slog.LevelDebug {
+		t.Errorf("Expected the log level to change, got %v", cfg.LogLevel.Level())
+	}
+	if got, want := pipeline.Subscriptions(), []string{"BTC-USD", "SOL-USD"}; !slices.Equal(got, want) {
+		t.Errorf("Expected products %v, got %v", want, got)
+	}
+	calc, _, _ := pipeline.calculator("BTC-USD")
+	if windowSizeOf(calc) != 2 || calc.Calculate() != "250.0000" {
+		t.Errorf("Expected a 2-trade window seeded with the last trades, got %d trades at %s", windowSizeOf(calc), calc.Calculate())
+	}
+
+	pipeline.processMessage(context.Background(), []byte(`{"type":"match","product_id":"SOL-USD","trade_id":1,"price":"150","size":"1"}`))
+	if !strings.Contains(stdout.String(), `"product_id":"SOL-USD"`) {
+		t.Errorf("Expected JSON output after the reload, got %q", stdout.String())
+	}
+
+	write("products = BTC-USD,SOL-USD\nwindow = BTC-USD=2\nbogus = 1\n")
+	if err := admin.reload(context.Background()); err == nil {
+		t.Error("Expected an invalid file to be rejected")
+	}
+	if got := pipeline.Subscriptions(); !slices.Equal(got, []string{"BTC-USD", "SOL-USD"}) {
+		t.Errorf("Expected a failed reload to change nothing, got %v", got)
+	}
+
+	write("products = BTC-USD,SOL-USD\nwindow = BTC-USD=2\noutput = json\nprecision = 2\nrounding = truncate\n")
+	if err := admin.reload(context.Background()); err != nil {
+		t.Fatalf("reload returned error: %v", err)
+	}
+	if calc, _, _ := pipeline.calculator("BTC-USD"); calc.Calculate() != "250.00" {
+		t.Errorf("Expected the new precision to apply, got %s", calc.Calculate())
+	}
+
+	write("products = BTC-USD\nwindow = BTC-USD=2\noutput = json\nprecision = 3\nsma = 20\n")
+	if err := admin.reload(context.Background()); err == nil || !strings.Contains(err.Error(), "SMA") {
+		t.Errorf("Expected a new indicator to reject the reload, got %v", err)
+	}
+	if calc, _, _ := pipeline.calculator("BTC-USD"); calc.Calculate() != "250.00" || len(pipeline.Subscriptions()) != 2 {
+		t.Errorf("Expected a rejected reload to change nothing, got %s for %v", calc.Calculate(), pipeline.Subscriptions())
+	}
+}
+
+func TestReloadWithoutProductsUsesDefault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vwap.conf")
+	if err := os.WriteFile(path, []byte("products = SOL-USD,ETH-USD\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := parseFlags([]string{"-config", path})
+	if err != nil {
+		t.Fatalf("parseFlags returned error: %v", err)
+	}
+	calculators := map[string]Calculator{"ETH-USD": NewVWAPCalculator(), "SOL-USD": NewVWAPCalculator()}
+	logger := NewLogger(io.Discard, slog.LevelInfo, "text")
+	pipeline := NewPipeline(calculators, logger)
+	pipeline.SetSubscriptionOrder(cfg.Products)
+	if got := pipeline.Subscriptions(); !slices.Equal(got, cfg.Products) {
+		t.Fatalf("Expected products in the order of -products, got %v", got)
+	}
+	admin := &productAdmin{cfg: cfg, pipeline: pipeline, logger: logger}
+
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := admin.reload(context.Background()); err != nil {
+		t.Fatalf("reload returned error: %v", err)
+	}
+	want := []string{"BTC-USD", "ETH-USD", "ETH-BTC"}
+	if got := pipeline.Subscriptions(); !slices.Equal(slices.Sorted(slices.Values(got)), slices.Sorted(slices.Values(want))) {
+		t.Errorf("Expected the default products %v, got %v", want, got)
+	}
+	if !slices.Equal(products, want) {
+		t.Errorf("Expected the default products to stay %v, got %v", want, products)
+	}
+}
+
+func TestRestartOnly(t *testing.T) {
+	cur, _ := parseFlags([]string{"-window", "100"})
+	next, _ := parseFlags([]string{"-window", "200", "-log-level", "debug", "-products", "BTC-USD", "-precision", "2", "-rounding", "truncate"})
+	if changed := restartOnly(cur, next); len(changed) > 0 {
+		t.Errorf("Expected reloadable changes not to need a restart, got %v", changed)
+	}
+	next, _ = parseFlags([]string{"-sma", "20"})
+	if changed := restartOnly(cur, next); !slices.Equal(changed, []string{"SMA"}) {
+		t.Errorf("Expected a new indicator to need a restart, got %v", changed)
+	}
+}
+
+// heldCalculator signals when a trade reaches it and holds the trade there
+// until released.
+type heldCalculator struct {
+	*VWAPCalculator
+	updating, release chan struct{}
+}
+
+func (c *heldCalculator) UpdateAt(price, size string, at time.Time) error {
+	close(c.updating)
+	<-c.release
+	return c.VWAPCalculator.UpdateAt(price, size, at)
+}
+
+func TestReplaceCalculatorWaitsForTrade(t *testing.T) {
+	old := &heldCalculator{VWAPCalculator: NewWindowedVWAPCalculator(10), updating: make(chan struct{}), release: make(chan struct{})}
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": old}, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	stop := pipeline.StartWorkers(16, backpressureBlock)
+	defer stop()
+
+	pipeline.dispatchMessage(context.Background(), []byte(`{"type":"match","product_id":"BTC-USD","trade_id":1,"price":"100","size":"1"}`), nil)
+	<-old.updating
+	replacement := NewWindowedVWAPCalculator(10)
+	replaced := make(chan error, 1)
+	go func() { replaced <- pipeline.ReplaceCalculator("BTC-USD", replacement) }()
+	select {
+	case <-replaced:
+		t.Error("Expected the swap to wait for the trade in progress")
+		close(old.release)
+	case <-time.After(50 * time.Millisecond):
+		close(old.release)
+		if err := <-replaced; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(replacement.Snapshot().Trades); n != 1 {
+		t.Errorf("Expected the replacement to take the trade applied during the swap, got %d trades", n)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// RemoteWriteConfig configures the Prometheus remote-write exporter.
+type RemoteWriteConfig struct {
+	URL      string
+	Interval time.Duration
+}
+
+// RemoteWriter pushes the calculator's vwap_ metrics to a Prometheus
+// remote_write endpoint, for deployments with nothing to scrape /metrics.
+// Every flush sends each series' current value: counters stay cumulative, as
+// Prometheus expects, and histograms become their _bucket, _sum and _count
+// series. A failed push is not retried; the next flush carries the same
+// series forward.
+type RemoteWriter struct {
+	cfg      RemoteWriteConfig
+	endpoint string
+	user     *url.Userinfo
+	gatherer prometheus.Gatherer
+	labels   []*dto.LabelPair // added to every series
+	client   *http.Client
+	logger   Logger
+	now      func() time.Time
+}
+
+// NewRemoteWriter sends metrics from gatherer to cfg.URL, adding labels to
+// each series. Credentials in the URL are sent as basic auth.
+func NewRemoteWriter(cfg RemoteWriteConfig, gatherer prometheus.Gatherer, labels map[string]string, logger Logger) (*RemoteWriter, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("remote write: invalid URL %q", cfg.URL)
+	}
+	user := u.User
+	u.User = nil
+	w := &RemoteWriter{
+		cfg:      cfg,
+		endpoint: u.String(),
+		user:     user,
+		gatherer: gatherer,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		logger:   logger,
+		now:      time.Now,
+	}
+	for name, value := range labels {
+		w.labels = append(w.labels, labelPair(name, value))
+	}
+	return w, nil
+}
+
+// Run flushes every cfg.Interval until ctx is cancelled, then flushes once
+// more.
+func (w *RemoteWriter) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			w.flush()
+			return
+		}
+		w.flush()
+	}
+}
+
+// flush gathers the vwap_ metrics and pushes them.
+func (w *RemoteWriter) flush() {
+	families, err := w.gatherer.Gather()
+	if err != nil {
+		w.logger.Warnf("Remote write gather failed: %v", err)
+	}
+	timestamp := w.now().UnixMilli()
+	var req []byte
+	for _, family := range families {
+		if !strings.HasPrefix(family.GetName(), "vwap_") {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			req = w.appendMetric(req, family.GetName(), family.GetType(), m, timestamp)
+		}
+	}
+	if err := w.send(req); err != nil {
+		w.logger.Warnf("Remote write failed: %v", err)
+	}
+}
+
+func (w *RemoteWriter) appendMetric(req []byte, name string, kind dto.MetricType, m *dto.Metric, timestamp int64) []byte {
+	labels := append(slices.Clone(m.GetLabel()), w.labels...)
+	switch kind {
+	case dto.MetricType_COUNTER:
+		req = appendTimeSeries(req, name, labels, m.GetCounter().GetValue(), timestamp)
+	case dto.MetricType_GAUGE:
+		req = appendTimeSeries(req, name, labels, m.GetGauge().GetValue(), timestamp)
+	case dto.MetricType_HISTOGRAM:
+		h := m.GetHistogram()
+		for _, bucket := range h.GetBucket() {
+			le := strconv.FormatFloat(bucket.GetUpperBound(), 'g', -1, 64)
+			req = appendTimeSeries(req, name+"_bucket", append(slices.Clone(labels), labelPair("le", le)), float64(bucket.GetCumulativeCount()), timestamp)
+		}
+		req = appendTimeSeries(req, name+"_bucket", append(slices.Clone(labels), labelPair("le", "+Inf")), float64(h.GetSampleCount()), timestamp)
+		req = appendTimeSeries(req, name+"_sum", labels, h.GetSampleSum(), timestamp)
+		req = appendTimeSeries(req, name+"_count", labels, float64(h.GetSampleCount()), timestamp)
+	}
+	return req
+}
+
+func labelPair(name, value string) *dto.LabelPair {
+	return &dto.LabelPair{Name: &name, Value: &value}
+}
+
+// appendTimeSeries appends one sample of a series to a WriteRequest, in the
+// protobuf encoding of the remote write protocol:
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label        { string name = 1; string value = 2; }
+//	Sample       { double value = 1; int64 timestamp = 2; }
+//
+// Labels are sorted by name, with the metric name as __name__.
+func appendTimeSeries(req []byte, name string, labels []*dto.LabelPair, value float64, timestamp int64) []byte {
+	labels = append(slices.Clone(labels), labelPair("__name__", name))
+	slices.SortFunc(labels, func(a, b *dto.LabelPair) int { return strings.Compare(a.GetName(), b.GetName()) })
+
+	var series []byte
+	for _, label := range labels {
+		var l []byte
+		l = protowire.AppendTag(l, 1, protowire.BytesType)
+		l = protowire.AppendString(l, label.GetName())
+		l = protowire.AppendTag(l, 2, protowire.BytesType)
+		l = protowire.AppendString(l, label.GetValue())
+		series = protowire.AppendTag(series, 1, protowire.BytesType)
+		series = protowire.AppendBytes(series, l)
+	}
+	var sample []byte
+	sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+	sample = protowire.AppendFixed64(sample, math.Float64bits(value))
+	sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+	sample = protowire.AppendVarint(sample, uint64(timestamp))
+	series = protowire.AppendTag(series, 2, protowire.BytesType)
+	series = protowire.AppendBytes(series, sample)
+
+	req = protowire.AppendTag(req, 1, protowire.BytesType)
+	return protowire.AppendBytes(req, series)
+}
+
+// send posts a snappy-compressed WriteRequest.
+func (w *RemoteWriter) send(req []byte) error {
+	if len(req) == 0 {
+		return nil
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, w.endpoint, bytes.NewReader(snappy.Encode(nil, req)))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	httpReq.Header.Set("Content-Encoding", "snappy")
+	httpReq.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if w.user != nil {
+		password, _ := w.user.Password()
+		httpReq.SetBasicAuth(w.user.Username(), password)
+	}
+	resp, err := w.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
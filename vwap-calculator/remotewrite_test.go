@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodeWriteRequest renders each series of a WriteRequest as
+// "labels value @timestamp", with labels as name=value in order.
+func decodeWriteRequest(t *testing.T, req []byte) []string {
+	t.Helper()
+	fields := func(b []byte, each func(num protowire.Number, typ protowire.Type, b []byte) int) {
+		for len(b) > 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			if n < 0 {
+				t.Fatalf("Bad tag: %v", protowire.ParseError(n))
+			}
+			b = b[n:]
+			n = each(num, typ, b)
+			if n < 0 {
+				t.Fatalf("Bad field %d: %v", num, protowire.ParseError(n))
+			}
+			b = b[n:]
+		}
+	}
+	var series []string
+	fields(req, func(_ protowire.Number, _ protowire.Type, b []byte) int {
+		ts, n := protowire.ConsumeBytes(b)
+		var labels []string
+		var sample string
+		fields(ts, func(num protowire.Number, _ protowire.Type, b []byte) int {
+			msg, n := protowire.ConsumeBytes(b)
+			var parts [2]string
+			fields(msg, func(num protowire.Number, typ protowire.Type, b []byte) int {
+				switch typ {
+				case protowire.BytesType:
+					s, n := protowire.ConsumeString(b)
+					parts[num-1] = s
+					return n
+				case protowire.Fixed64Type:
+					v, n := protowire.ConsumeFixed64(b)
+					parts[num-1] = fmt.Sprint(math.Float64frombits(v))
+					return n
+				default:
+					v, n := protowire.ConsumeVarint(b)
+					parts[num-1] = fmt.Sprint(int64(v))
+					return n
+				}
+			})
+			if num == 1 {
+				labels = append(labels, parts[0]+"="+parts[1])
+			} else {
+				sample = parts[0] + " @" + parts[1]
+			}
+			return n
+		})
+		series = append(series, strings.Join(labels, ",")+" "+sample)
+		return n
+	})
+	return series
+}
+
+func TestRemoteWriter(t *testing.T) {
+	received := make(chan []string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("Content-Type") != "application/x-protobuf" ||
+			r.Header.Get("X-Prometheus-Remote-Write-Version") != "0.1.0" || user != "writer" || password != "secret" {
+			http.Error(w, "bad request headers", http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		req, err := snappy.Decode(nil, body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		series := decodeWriteRequest(t, req)
+		slices.Sort(series)
+		received <- series
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	trades := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "vwap_trades_processed_total"}, []string{"product"})
+	current := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "vwap_current"}, []string{"product"})
+	latency := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "vwap_ws_read_seconds", Buckets: []float64{0.1, 1}})
+	other := prometheus.NewCounter(prometheus.CounterOpts{Name: "go_other_total"})
+	registry.MustRegister(trades, current, latency, other)
+	trades.WithLabelValues("BTC-USD").Add(3)
+	current.WithLabelValues("BTC-USD").Set(45000.5)
+	latency.Observe(0.25)
+	other.Inc()
+
+	url := strings.Replace(server.URL, "http://", "http://writer:secret@", 1)
+	writer, err := NewRemoteWriter(RemoteWriteConfig{URL: url, Interval: time.Second}, registry, map[string]string{"venue": "coinbase"}, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.UnixMilli(1704067200000)
+	writer.now = func() time.Time { return now }
+	writer.flush()
+
+	want := []string{
+		"__name__=vwap_current,product=BTC-USD,venue=coinbase 45000.5 @1704067200000",
+		"__name__=vwap_trades_processed_total,product=BTC-USD,venue=coinbase 3 @1704067200000",
+		"__name__=vwap_ws_read_seconds_bucket,le=+Inf,venue=coinbase 1 @1704067200000",
+		"__name__=vwap_ws_read_seconds_bucket,le=0.1,venue=coinbase 0 @1704067200000",
+		"__name__=vwap_ws_read_seconds_bucket,le=1,venue=coinbase 1 @1704067200000",
+		"__name__=vwap_ws_read_seconds_count,venue=coinbase 1 @1704067200000",
+		"__name__=vwap_ws_read_seconds_sum,venue=coinbase 0.25 @1704067200000",
+	}
+	select {
+	case got := <-received:
+		if !slices.Equal(got, want) {
+			t.Errorf("Expected series\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the remote write, or it was rejected")
+	}
+}
+
+func TestNewRemoteWriterRejectsBadURL(t *testing.T) {
+	if _, err := NewRemoteWriter(RemoteWriteConfig{URL: "prometheus:9090", Interval: time.Second}, prometheus.NewRegistry(), nil, NewLogger(io.Discard, slog.LevelInfo, "text")); err == nil {
+		t.Error("Expected error for a URL without an http scheme")
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import "math/big"
+
+// recompute rebuilds the running sums from the trades in the window. The
+// sums are exact, but their backing storage only ever grows to fit the
+// largest numerator and denominator seen; starting from fresh values every
+// window keeps Update's cost tied to the trades currently held.
+func (v *VWAPCalculator) recompute() {
+	var totalPV, totalPV2, totalVolume big.Rat
+	pv := new(big.Rat)
+	v.buffer.Each(func(price, size *big.Rat) {
+		pv.Mul(price, size)
+		totalPV.Add(&totalPV, pv)
+		totalPV2.Add(&totalPV2, pv.Mul(pv, price))
+		totalVolume.Add(&totalVolume, size)
+	})
+	v.totalPV, v.totalPV2, v.totalVolume = totalPV, totalPV2, totalVolume
+	v.evicted = 0
+}
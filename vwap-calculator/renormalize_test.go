@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVWAPCalculatorRecompute(t *testing.T) {
+	calc := NewWindowedVWAPCalculator(4)
+	// Long decimals inflate the sums' storage while they are in the window.
+	long := "1." + strings.Repeat("3", 200)
+	for i := 0; i < 4; i++ {
+		calc.Update(long, long)
+	}
+	inflated := cap(calc.totalPV2.Denom().Bits())
+
+	for i := 0; i < 8; i++ {
+		calc.Update("100", "2")
+	}
+	if calc.evicted != 0 {
+		t.Errorf("Expected the sums to have just been recomputed, %d evictions pending", calc.evicted)
+	}
+	if got := cap(calc.totalPV2.Denom().Bits()); got >= inflated {
+		t.Errorf("Expected recomputation to release storage, capacity still %d (was %d)", got, inflated)
+	}
+	if calc.Calculate() != "100.0000" || calc.totalVolume.RatString() != "8" || calc.totalPV2.RatString() != "80000" {
+		t.Errorf("Unexpected sums after recompute: VWAP %s, volume %s, Σvp² %s", calc.Calculate(), calc.totalVolume.RatString(), calc.totalPV2.RatString())
+	}
+}
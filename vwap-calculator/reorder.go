@@ -0,0 +1,136 @@
+package main
+
+import (
+	"container/heap"
+	"time"
+)
+
+// reorderBuffer holds a product's trades for a short window and releases
+// them in exchange time order, so trades that arrive slightly out of order
+// reach time-based windows in sequence. Trades without a timestamp are
+// ordered by when they arrived.
+type reorderBuffer struct {
+	window   time.Duration
+	held     heldTrades
+	seq      int64
+	released time.Time // exchange time of the newest trade released
+}
+
+type heldTrade struct {
+	item    workItem
+	at      time.Time // exchange time
+	arrived time.Time
+	seq     int64 // arrival order, to keep ties stable
+}
+
+func newReorderBuffer(window time.Duration) *reorderBuffer {
+	return &reorderBuffer{window: window}
+}
+
+func (b *reorderBuffer) push(item workItem, now time.Time) {
+	at := item.trade.Time
+	if at.IsZero() {
+		at = now
+	}
+	b.seq++
+	heap.Push(&b.held, heldTrade{item: item, at: at, arrived: now, seq: b.seq})
+}
+
+// wait returns how long until the earliest held trade is due, or false when
+// nothing is held.
+func (b *reorderBuffer) wait(now time.Time) (time.Duration, bool) {
+	if len(b.held) == 0 {
+		return 0, false
+	}
+	return max(b.held[0].arrived.Add(b.window).Sub(now), 0), true
+}
+
+// ready removes and returns, in exchange time order, the trades that have
+// been held for the window. A trade older than one already released is
+// counted as late and released anyway.
+func (b *reorderBuffer) ready(now time.Time) []workItem {
+	var items []workItem
+	for len(b.held) > 0 && !now.Before(b.held[0].arrived.Add(b.window)) {
+		items = append(items, b.release())
+	}
+	return items
+}
+
+// drain removes and returns every held trade in exchange time order.
+func (b *reorderBuffer) drain() []workItem {
+	items := make([]workItem, 0, len(b.held))
+	for len(b.held) > 0 {
+		items = append(items, b.release())
+	}
+	return items
+}
+
+func (b *reorderBuffer) release() workItem {
+	t := heap.Pop(&b.held).(heldTrade)
+	if t.at.Before(b.released) {
+		lateTrades.WithLabelValues(t.item.trade.ProductID).Inc()
+	} else {
+		b.released = t.at
+	}
+	return t.item
+}
+
+// heldTrades is a min-heap by exchange time, then arrival.
+type heldTrades []heldTrade
+
+func (h heldTrades) Len() int { return len(h) }
+func (h heldTrades) Less(i, j int) bool {
+	if !h[i].at.Equal(h[j].at) {
+		return h[i].at.Before(h[j].at)
+	}
+	return h[i].seq < h[j].seq
+}
+func (h heldTrades) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *heldTrades) Push(x any)   { *h = append(*h, x.(heldTrade)) }
+func (h *heldTrades) Pop() any {
+	old := *h
+	t := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return t
+}
+
+// runReordered is a product worker that passes trades through a
+// reorderBuffer. Functions sent on control run between trades. Closing queue
+// releases whatever is still held.
+func (w *productWorkers) runReordered(p *Pipeline, queue <-chan workItem, control <-chan func()) {
+	buffer := newReorderBuffer(w.reorder)
+	timer := time.NewTimer(w.reorder)
+	defer timer.Stop()
+	for {
+		var due <-chan time.Time
+		if d, ok := buffer.wait(time.Now()); ok {
+			timer.Reset(d)
+			due = timer.C
+		}
+		select {
+		case item, ok := <-queue:
+			if !ok {
+				for _, item := range buffer.drain() {
+					p.processItem(item)
+				}
+				return
+			}
+			buffer.push(item, time.Now())
+		case fn := <-control:
+			// Trades still held are applied after fn, as they would be
+			// had they arrived after it.
+			fn()
+		case <-due:
+		}
+		for _, item := range buffer.ready(time.Now()) {
+			p.processItem(item)
+		}
+	}
+}
+
+// SetReorderWindow holds each trade for window before processing it, so
+// trades up to that late are applied in exchange time order. It applies to
+// workers started afterwards; zero disables it.
+func (p *Pipeline) SetReorderWindow(window time.Duration) {
+	p.reorder = window
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestReorderBuffer(t *testing.T) {
+	base := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	now := base
+	b := newReorderBuffer(100 * time.Millisecond)
+	push := func(id int64, offset time.Duration) {
+		b.push(workItem{trade: Trade{ProductID: "REORDER-USD", TradeID: id, Time: base.Add(offset)}}, now)
+	}
+	ids := func(items []workItem) []int64 {
+		var out []int64
+		for _, item := range items {
+			out = append(out, item.trade.TradeID)
+		}
+		return out
+	}
+
+	if _, ok := b.wait(now); ok {
+		t.Error("Expected nothing to wait for while empty")
+	}
+	push(2, 20*time.Millisecond)
+	now = now.Add(30 * time.Millisecond)
+	push(1, 10*time.Millisecond)
+	push(3, 30*time.Millisecond)
+	// Trade 2 has been held longest, but waits behind the earlier trade 1.
+	if d, ok := b.wait(now); !ok || d != 100*time.Millisecond {
+		t.Errorf("Expected to wait 100ms for trade 1, got %v %v", d, ok)
+	}
+	if got := b.ready(now); len(got) != 0 {
+		t.Errorf("Expected nothing ready inside the window, got %v", ids(got))
+	}
+
+	now = now.Add(100 * time.Millisecond)
+	if got := ids(b.ready(now)); len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 3 {
+		t.Errorf("Expected trades in exchange time order, got %v", got)
+	}
+
+	late := testutil.ToFloat64(lateTrades.WithLabelValues("REORDER-USD"))
+	push(4, 0)
+	if got := ids(b.drain()); len(got) != 1 || got[0] != 4 {
+		t.Errorf("Expected the late trade to be released, got %v", got)
+	}
+	if got := testutil.ToFloat64(lateTrades.WithLabelValues("REORDER-USD")) - late; got != 1 {
+		t.Errorf("Expected one late trade, got %v", got)
+	}
+}
+
+type orderRecorder struct {
+	mu  sync.Mutex
+	ids []int64
+}
+
+func (r *orderRecorder) RecordTrade(trade Trade) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ids = append(r.ids, trade.TradeID)
+	return nil
+}
+
+func TestPipelineWorkersReorder(t *testing.T) {
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	recorder := &orderRecorder{}
+	pipeline.AddTradeSink(recorder)
+	pipeline.SetReorderWindow(50 * time.Millisecond)
+	stop := pipeline.StartWorkers(16, backpressureBlock)
+
+	base := time.Now()
+	for _, id := range []int64{3, 1, 2} {
+		pipeline.dispatch(context.Background(), Trade{Type: "match", ProductID: "BTC-USD", TradeID: id, Price: "100", Size: "1", Time: base.Add(time.Duration(id) * time.Millisecond)}, nil)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		recorder.mu.Lock()
+		n := len(recorder.ids)
+		recorder.mu.Unlock()
+		if n == 3 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	stop()
+	if got := recorder.ids; len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 3 {
+		t.Errorf("Expected trades applied in exchange time order, got %v", got)
+	}
+}
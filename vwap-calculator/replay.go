@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// tradeReader yields recorded trades in file order, returning io.EOF at the
+// end of the recording.
+type tradeReader func() (Trade, error)
+
+// runReplay feeds the trades recorded in path through the pipeline, spacing
+// them by their original timestamps divided by speed. A speed of 0 replays as
+// fast as possible. It returns nil at the end of the file or once ctx is
+// cancelled.
+func runReplay(ctx context.Context, path string, speed float64, pipeline *Pipeline, logger Logger) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening replay file: %w", err)
+	}
+	defer f.Close()
+
+	next := jsonTradeReader(f, logger)
+	if filepath.Ext(path) == ".csv" {
+		if next, err = csvTradeReader(f); err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+	}
+
+	logger.Infof("Replaying %s at %vx", path, speed)
+	var first time.Time
+	start := time.Now()
+	count := 0
+	for ctx.Err() == nil {
+		trade, err := next()
+		if errors.Is(err, io.EOF) {
+			logger.Infof("Replay finished after %d trades", count)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+
+		if speed > 0 && !trade.Time.IsZero() {
+			if first.IsZero() {
+				first = trade.Time
+			}
+			// Schedule against the start of the replay rather than the
+			// previous trade so sleep overshoot doesn't accumulate.
+			offset := time.Duration(float64(trade.Time.Sub(first)) / speed)
+			sleepContext(ctx, time.Until(start.Add(offset)))
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		pipeline.dispatch(ctx, trade, nil)
+		count++
+	}
+	return nil
+}
+
+// jsonTradeReader reads one feed message per line, as written by -stdin
+// producers or the Kafka trades topic. Malformed lines are logged and
+// skipped.
+func jsonTradeReader(r io.Reader, logger Logger) tradeReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	return func() (Trade, error) {
+		for scanner.Scan() {
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+			var trade Trade
+			if err := json.Unmarshal(scanner.Bytes(), &trade); err != nil {
+				logger.Errorf("JSON decode error: %v", err)
+				parseErrors.Inc()
+				continue
+			}
+			return trade, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return Trade{}, err
+		}
+		return Trade{}, io.EOF
+	}
+}
+
+// csvTradeReader reads a trades file written by the CSV sink.
+func csvTradeReader(r io.Reader) (tradeReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(csvTradeHeader)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Equal(header, csvTradeHeader) {
+		return nil, fmt.Errorf("unexpected CSV header %v", header)
+	}
+	return func() (Trade, error) {
+		row, err := cr.Read()
+		if err != nil {
+			return Trade{}, err
+		}
+		trade := Trade{Type: "match", ProductID: row[1], Price: row[3], Size: row[4], Side: row[5]}
+		if trade.Time, err = time.Parse(time.RFC3339Nano, row[0]); err != nil {
+			return Trade{}, err
+		}
+		if trade.TradeID, err = strconv.ParseInt(row[2], 10, 64); err != nil {
+			return Trade{}, err
+		}
+		return trade, nil
+	}, nil
+}
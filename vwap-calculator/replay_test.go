@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func replayPipeline() (*Pipeline, *VWAPCalculator) {
+	calculator := NewVWAPCalculator()
+	return NewPipeline(map[string]Calculator{"BTC-USD": calculator}, NewLogger(io.Discard, slog.LevelInfo, "text")), calculator
+}
+
+func TestRunReplayJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trades.jsonl")
+	os.WriteFile(path, []byte(`{"type":"match","product_id":"BTC-USD","trade_id":1,"price":"100","size":"1","time":"2024-01-01T00:00:00Z"}
+{"type":"match","product_id":"BTC-USD","trade_id":2,"price":"200","size":"1","time":"2024-01-01T00:00:01Z"}
+{"type":"match","product_id":"BTC-USD","trade_id":3,"price":"300","size":"2","time":"2024-01-01T00:00:02Z"}
+`), 0o644)
+
+	pipeline, calculator := replayPipeline()
+	start := time.Now()
+	if err := runReplay(context.Background(), path, 50, pipeline, pipeline.logger); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("Expected 2s of trades at 50x to take at least 40ms, took %v", elapsed)
+	}
+	if got := calculator.Calculate(); got != "225.0000" {
+		t.Errorf("Expected VWAP 225.0000, got %s", got)
+	}
+}
+
+func TestRunReplayCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trades-20240101T000000Z.csv")
+	os.WriteFile(path, []byte(`time,product_id,trade_id,price,size,side
+2024-01-01T00:00:00Z,BTC-USD,1,100,1,buy
+2024-01-01T01:00:00Z,BTC-USD,2,200,1,sell
+`), 0o644)
+
+	pipeline, calculator := replayPipeline()
+	start := time.Now()
+	if err := runReplay(context.Background(), path, 0, pipeline, pipeline.logger); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Max-speed replay took %v", elapsed)
+	}
+	if got := calculator.Calculate(); got != "150.0000" {
+		t.Errorf("Expected VWAP 150.0000, got %s", got)
+	}
+}
+
+func TestRunReplayCancel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trades.jsonl")
+	os.WriteFile(path, []byte(`{"type":"match","product_id":"BTC-USD","trade_id":1,"price":"100","size":"1","time":"2024-01-01T00:00:00Z"}
+{"type":"match","product_id":"BTC-USD","trade_id":2,"price":"200","size":"1","time":"2024-01-02T00:00:00Z"}
+`), 0o644)
+
+	pipeline, calculator := replayPipeline()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := runReplay(ctx, path, 1, pipeline, pipeline.logger); err != nil {
+		t.Fatal(err)
+	}
+	if got := calculator.Calculate(); got != "100.0000" {
+		t.Errorf("Expected only the first trade before cancel, got VWAP %s", got)
+	}
+}
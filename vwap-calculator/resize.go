@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+	"time"
+)
+
+// ResizableCalculator is implemented by windowed calculators whose window
+// can change size while keeping their trades.
+type ResizableCalculator interface {
+	WindowedCalculator
+	// Resize changes the window to the last size trades. Growing keeps every
+	// trade; shrinking evicts the oldest ones beyond size.
+	Resize(size int)
+}
+
+// ResizeWindow changes productID's window to size trades without a restart
+// or losing the trades it holds, as far as they fit, and has the trade log
+// keep enough trades to refill it. Indicators that follow the window at
+// startup keep their size.
+func (p *Pipeline) ResizeWindow(productID string, size int) error {
+	calculator, _, ok := p.calculator(productID)
+	if !ok {
+		return fmt.Errorf("%w %s", errUnknownProduct, productID)
+	}
+	resizable, ok := calculator.(ResizableCalculator)
+	if !ok {
+		return fmt.Errorf("%s's %s calculator cannot be resized", productID, calculatorMethod(calculator))
+	}
+	resizable.Resize(size)
+	if p.wal != nil {
+		p.wal.Keep(size)
+	}
+	return nil
+}
+
+// window returns the times of the trades in the window, oldest first.
+func (c *tradeClock) window() []time.Time {
+	return append(slices.Clone(c.times[c.start:]), c.times[:c.start]...)
+}
+
+// Resize replays the newest trades that fit into a window of size, so the
+// sums, range and clock come out as if the window had always been that size.
+func (v *VWAPCalculator) Resize(size int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	resized := NewWindowedVWAPCalculator(size)
+	resized.SetFormat(v.Format())
+	times, skip, i := v.clock.window(), v.buffer.count-size, 0
+	v.buffer.Each(func(price, amount *big.Rat) {
+		if i >= skip {
+			// The buffer's trades were valid when they were added.
+			resized.UpdateAt(price.RatString(), amount.RatString(), times[i])
+		}
+		i++
+	})
+	resized.clock.trades = v.clock.trades
+
+	v.buffer = resized.buffer
+	v.totalPV.Set(&resized.totalPV)
+	v.totalVolume.Set(&resized.totalVolume)
+	v.totalPV2.Set(&resized.totalPV2)
+	v.evicted = 0
+	v.priceRange = resized.priceRange
+	v.clock = resized.clock
+	v.vwap.Store(resized.vwap.Load())
+}
+
+// Resize replays the newest trades that fit into a window of size. Each
+// trade's time is in the buffer, so the TWAP's time weighting is unchanged.
+func (c *TWAPCalculator) Resize(size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	resized := NewWindowedTWAPCalculator(size)
+	skip, i := c.buffer.count-size, 0
+	c.buffer.Each(func(price, nanos *big.Rat) {
+		if i >= skip {
+			resized.UpdateAt(price.RatString(), "1", time.Unix(0, nanos.Num().Int64()))
+		}
+		i++
+	})
+	resized.clock.trades = c.clock.trades
+
+	c.buffer = resized.buffer
+	c.totalPT.Set(&resized.totalPT)
+	c.totalPrice.Set(&resized.totalPrice)
+	c.last.Set(&resized.last)
+	c.priceRange = resized.priceRange
+	c.clock = resized.clock
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVWAPCalculatorResize(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	trades := [][2]string{{"100", "1"}, {"200", "1"}, {"300", "2"}, {"400", "1"}}
+	c := NewWindowedVWAPCalculator(3)
+	for i, trade := range trades {
+		c.UpdateAt(trade[0], trade[1], start.Add(time.Duration(i)*time.Second))
+	}
+
+	// Growing keeps the three trades held and makes room for more.
+	c.Resize(4)
+	if c.WindowSize() != 4 || c.Calculate() != "300.0000" {
+		t.Errorf("Expected (200+600+400)/4 = 300 over a window of 4, got %s over %d", c.Calculate(), c.WindowSize())
+	}
+	c.UpdateAt("500", "1", start.Add(4*time.Second))
+	if got := c.Calculate(); got != "340.0000" {
+		t.Errorf("Expected (200+600+400+500)/5 = 340 once the window grew, got %s", got)
+	}
+
+	// Shrinking evicts the oldest trades, and matches a calculator that
+	// always had the smaller window.
+	c.Resize(2)
+	want := NewWindowedVWAPCalculator(2)
+	for i, trade := range append(trades, [2]string{"500", "1"}) {
+		want.UpdateAt(trade[0], trade[1], start.Add(time.Duration(i)*time.Second))
+	}
+	if c.Calculate() != want.Calculate() || c.Stats() != want.Stats() {
+		t.Errorf("Expected %s %+v, got %s %+v", want.Calculate(), want.Stats(), c.Calculate(), c.Stats())
+	}
+	if high, low := c.Range(); high != "500.0000" || low != "400.0000" {
+		t.Errorf("Expected the range of the two newest trades, got %s-%s", low, high)
+	}
+	if c.TradeCount() != 5 {
+		t.Errorf("Expected the trade count to survive resizing, got %d", c.TradeCount())
+	}
+}
+
+func TestTWAPCalculatorResize(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c, want := NewWindowedTWAPCalculator(4), NewWindowedTWAPCalculator(2)
+	for i, price := range []string{"100", "200", "300", "400"} {
+		at := start.Add(time.Duration(i*i) * time.Second)
+		c.UpdateAt(price, "1", at)
+		want.UpdateAt(price, "1", at)
+	}
+	c.Resize(2)
+	if c.Calculate() != want.Calculate() || c.WindowSize() != 2 {
+		t.Errorf("Expected %s over 2 trades, got %s over %d", want.Calculate(), c.Calculate(), c.WindowSize())
+	}
+}
+
+func TestResizeWindowRoute(t *testing.T) {
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator(), "ETH-USD": NewEWVWAPCalculator(time.Minute)}, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	cfg := &Config{}
+	mux := http.NewServeMux()
+	addAdminRoutes(mux, &productAdmin{cfg: cfg, pipeline: pipeline, logger: pipeline.logger})
+
+	for _, tt := range []struct {
+		path, body string
+		status     int
+	}{
+		{"/products/BTC-USD/window", `{"size":500}`, http.StatusOK},
+		{"/products/BTC-USD/window", `{"size":0}`, http.StatusConflict},
+		{"/products/BTC-USD/window", `size=5`, http.StatusBadRequest},
+		{"/products/ETH-USD/window", `{"size":500}`, http.StatusConflict}, // ewvwap has no window
+		{"/products/DOGE-USD/window", `{"size":500}`, http.StatusNotFound},
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, tt.path, strings.NewReader(tt.body)))
+		if rec.Code != tt.status {
+			t.Errorf("PUT %s %s: expected %d, got %d: %s", tt.path, tt.body, tt.status, rec.Code, rec.Body)
+		}
+	}
+	if c, _, _ := pipeline.calculator("BTC-USD"); windowSizeOf(c) != 500 || cfg.windowFor("BTC-USD") != 500 {
+		t.Errorf("Expected BTC-USD's window to be 500, got %d (config %d)", windowSizeOf(c), cfg.windowFor("BTC-USD"))
+	}
+}
+
+func TestResizeWindowKeepsTradeLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trades.wal")
+	logger := NewLogger(io.Discard, slog.LevelInfo, "text")
+	wal, _, err := OpenTradeLog(path, 2, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewWindowedVWAPCalculator(2)}, logger)
+	pipeline.SetTradeLog(wal)
+	if err := pipeline.ResizeWindow("BTC-USD", 4); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 8; i++ {
+		pipeline.processMessage(context.Background(), []byte(fmt.Sprintf(`{"type":"match","product_id":"BTC-USD","trade_id":%d,"price":"%d","size":"1"}`, i, 100*i)))
+	}
+	wal.Close()
+
+	// A restart with the grown window finds enough trades to fill it.
+	wal, trades, err := OpenTradeLog(path, 4, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	if got := trades["BTC-USD"]; len(got) != 4 || got[0].TradeID != 5 {
+		t.Errorf("Expected trades 5 to 8 in the log, got %+v", got)
+	}
+}
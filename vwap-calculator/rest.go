@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// maxTradesPerRequest is the page size limit of the Coinbase trades endpoint.
+const maxTradesPerRequest = 1000
+
+// maxGapFill bounds how many missed trades a reconnect fetches, so a long
+// outage costs a few requests rather than hundreds. Only the most recent are
+// fetched; older ones stay counted as missed.
+const maxGapFill = 5000
+
+// RESTClient fetches historical data from the Coinbase Exchange REST API.
+type RESTClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewRESTClient(baseURL string) *RESTClient {
+	return &RESTClient{
+		baseURL: baseURL,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// RecentTrades returns up to limit of the most recent trades for productID,
+// oldest first so they can be replayed in order.
+func (c *RESTClient) RecentTrades(ctx context.Context, productID string, limit int) ([]Trade, error) {
+	if limit > maxTradesPerRequest {
+		limit = maxTradesPerRequest
+	}
+	trades, err := c.trades(ctx, productID, url.Values{"limit": {strconv.Itoa(limit)}})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(trades, func(i, j int) bool { return trades[i].TradeID < trades[j].TradeID })
+	return trades, nil
+}
+
+// TradesBetween returns productID's trades with IDs from first to last
+// inclusive, oldest first, paging back from last with the endpoint's after
+// cursor. Trade IDs the exchange no longer serves are left out.
+func (c *RESTClient) TradesBetween(ctx context.Context, productID string, first, last int64) ([]Trade, error) {
+	var trades []Trade
+	for cursor := last + 1; cursor > first; {
+		limit := min(cursor-first, maxTradesPerRequest)
+		page, err := c.trades(ctx, productID, url.Values{
+			"after": {strconv.FormatInt(cursor, 10)},
+			"limit": {strconv.FormatInt(limit, 10)},
+		})
+		if err != nil {
+			return nil, err
+		}
+		oldest := cursor
+		for _, trade := range page {
+			if trade.TradeID >= first && trade.TradeID < cursor {
+				trades = append(trades, trade)
+			}
+			oldest = min(oldest, trade.TradeID)
+		}
+		if len(page) == 0 || oldest >= cursor {
+			break
+		}
+		cursor = oldest
+	}
+	sort.Slice(trades, func(i, j int) bool { return trades[i].TradeID < trades[j].TradeID })
+	return trades, nil
+}
+
+// trades fetches one page of productID's trades, newest first.
+func (c *RESTClient) trades(ctx context.Context, productID string, query url.Values) ([]Trade, error) {
+	endpoint := fmt.Sprintf("%s/products/%s/trades?%s", c.baseURL, url.PathEscape(productID), query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching trades for %s: %w", productID, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching trades for %s: unexpected status %s", productID, resp.Status)
+	}
+
+	var trades []Trade
+	if err := json.NewDecoder(resp.Body).Decode(&trades); err != nil {
+		return nil, fmt.Errorf("decoding trades for %s: %w", productID, err)
+	}
+	for i := range trades {
+		trades[i].Type = "match"
+		trades[i].ProductID = productID
+	}
+	return trades, nil
+}
+
+// backfill pre-seeds the given products so their windows are full from the
+// start. Failures are logged and leave that product to warm up from the live
+// feed.
+func backfill(ctx context.Context, client *RESTClient, pipeline *Pipeline, products []string, logger Logger) {
+	sort.Strings(products)
+
+	for _, productID := range products {
+		limit := windowSizeOf(pipeline.Calculators()[productID])
+		if limit == 0 {
+			limit = windowSize
+		}
+		trades, err := client.RecentTrades(ctx, productID, limit)
+		if err != nil {
+			logger.Warnf("Backfill skipped: %v", err)
+			continue
+		}
+		applied := pipeline.Backfill(ctx, productID, trades)
+		logger.With("product", productID).Infof("Backfilled %d trades", applied)
+	}
+}
+
+// SetGapFill fetches the trades missed while the feed was disconnected from
+// client when the last_match sent on resubscribing shows a gap.
+func (p *Pipeline) SetGapFill(client *RESTClient) {
+	p.gapFill = client
+}
+
+// fillGap applies productID's trades from first to last, which the feed
+// skipped, before any live trade after them. They go through the same
+// checks, calculators and sinks as live trades, and one update for the
+// result is offered to the emit policy. Trades it applies no longer count as
+// missed; those the checks reject still do.
+func (p *Pipeline) fillGap(ctx context.Context, logger Logger, productID string, first, last int64) {
+	first = max(first, last-maxGapFill+1)
+	trades, err := p.gapFill.TradesBetween(ctx, productID, first, last)
+	if err != nil {
+		logger.Warnf("Gap fill failed: %v", err)
+		p.reportError(productID, fmt.Errorf("gap fill failed: %w", err))
+		return
+	}
+	var (
+		update  VWAPUpdate
+		applied int
+	)
+	for _, trade := range trades {
+		if u, ok := p.applyTrade(ctx, logger, trade); ok {
+			update = u
+			applied++
+		}
+	}
+	p.gaps.Recovered(productID, int64(applied))
+	gapFilledTrades.WithLabelValues(productID).Add(float64(applied))
+	logger.Infof("Gap fill recovered %d of %d missed trades", applied, last-first+1)
+	if applied > 0 {
+		update.MissedTrades = p.gaps.Missed(productID)
+		if p.emit.offerBatch(update, int64(applied)) {
+			p.publish(ctx, logger, update)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBackfill(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/products/BTC-USD/trades" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("limit") != "200" {
+			t.Errorf("Expected limit=200, got %s", r.URL.RawQuery)
+		}
+		// Newest first, as the exchange returns them.
+		io.WriteString(w, `[
+			{"time":"2024-01-01T00:00:02Z","trade_id":3,"price":"300","size":"1","side":"buy"},
+			{"time":"2024-01-01T00:00:01Z","trade_id":2,"price":"200","size":"1","side":"sell"},
+			{"time":"2024-01-01T00:00:00Z","trade_id":1,"price":"100","size":"2","side":"buy"}
+		]`)
+	}))
+	defer server.Close()
+
+	client := NewRESTClient(server.URL)
+	trades, err := client.RecentTrades(context.Background(), "BTC-USD", windowSize)
+	if err != nil {
+		t.Fatalf("RecentTrades returned error: %v", err)
+	}
+	if len(trades) != 3 || trades[0].TradeID != 1 || trades[0].Type != "match" || trades[0].ProductID != "BTC-USD" {
+		t.Fatalf("Unexpected trades: %+v", trades)
+	}
+
+	store := NewStore()
+	logger := NewLogger(io.Discard, slog.LevelInfo, "text")
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator(), "ETH-USD": NewVWAPCalculator()}, logger, store)
+	backfill(context.Background(), client, pipeline, []string{"BTC-USD", "ETH-USD"}, logger)
+
+	update, ok := store.Get("BTC-USD")
+	if !ok || update.VWAP != "175.0000" || update.TradeCount != 3 {
+		t.Errorf("Unexpected update after backfill: %+v", update)
+	}
+	if _, ok := store.Get("ETH-USD"); ok {
+		t.Error("Expected no update for a product whose backfill failed")
+	}
+
+	// The live feed replaying the newest backfilled trade must be ignored.
+	pipeline.processMessage(context.Background(), []byte(`{"type":"match","product_id":"BTC-USD","trade_id":3,"price":"300","size":"1"}`))
+	if update, _ := store.Get("BTC-USD"); update.TradeCount != 3 {
+		t.Errorf("Expected duplicate live trade to be dropped, got %d trades", update.TradeCount)
+	}
+}
+
+func TestGapFill(t *testing.T) {
+	const latest = 1500
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// Serve trades 1 to latest newest first, paged back from the after
+		// cursor as the exchange does.
+		after, _ := strconv.ParseInt(r.URL.Query().Get("after"), 10, 64)
+		limit, _ := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
+		if limit > maxTradesPerRequest {
+			t.Errorf("Requested %d trades, over the page limit", limit)
+		}
+		var page []Trade
+		for id := min(after-1, latest); id >= 1 && int64(len(page)) < limit; id-- {
+			page = append(page, Trade{TradeID: id, Price: "200", Size: "1", Side: "buy"})
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer server.Close()
+
+	store := NewStore()
+	logger := NewLogger(io.Discard, slog.LevelInfo, "text")
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, logger, store)
+	pipeline.SetGapFill(NewRESTClient(server.URL))
+	ctx := context.Background()
+
+	pipeline.processMessage(ctx, []byte(`{"type":"match","product_id":"BTC-USD","trade_id":1,"price":"100","size":"1"}`))
+	// Reconnecting, the last_match shows trades 2 to 1500 were missed.
+	pipeline.processMessage(ctx, []byte(`{"type":"last_match","product_id":"BTC-USD","trade_id":1500,"price":"200","size":"1"}`))
+	if requests != 2 {
+		t.Errorf("Expected the gap to be fetched in 2 pages, got %d requests", requests)
+	}
+	update, _ := store.Get("BTC-USD")
+	if update.TradeCount != latest || update.VWAP != "200.0000" || update.MissedTrades != 0 {
+		t.Errorf("Expected all %d trades applied with none missed, got %+v", latest, update)
+	}
+
+	pipeline.processMessage(ctx, []byte(`{"type":"match","product_id":"BTC-USD","trade_id":1500,"price":"200","size":"1"}`))
+	pipeline.processMessage(ctx, []byte(`{"type":"match","product_id":"BTC-USD","trade_id":1501,"price":"200","size":"1"}`))
+	if update, _ := store.Get("BTC-USD"); update.TradeCount != latest+1 || update.MissedTrades != 0 {
+		t.Errorf("Expected live trading to resume after the filled gap, got %+v", update)
+	}
+}
+
+func TestGapFillCountsAppliedTrades(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Trade 3 has a price no calculator accepts.
+		io.WriteString(w, `[
+			{"trade_id":4,"price":"200","size":"1","side":"buy"},
+			{"trade_id":3,"price":"-1","size":"1","side":"buy"},
+			{"trade_id":2,"price":"200","size":"1","side":"buy"}
+		]`)
+	}))
+	defer server.Close()
+
+	store, sink := NewStore(), &countingSink{}
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"), store, sink)
+	pipeline.SetGapFill(NewRESTClient(server.URL))
+	pipeline.SetEmitPolicy("BTC-USD", emitPolicy{interval: time.Second})
+	now := time.Unix(1700000000, 0)
+	pipeline.emit.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	pipeline.processMessage(ctx, []byte(`{"type":"match","product_id":"BTC-USD","trade_id":1,"price":"100","size":"1"}`))
+	pipeline.processMessage(ctx, []byte(`{"type":"last_match","product_id":"BTC-USD","trade_id":4,"price":"200","size":"1"}`))
+	if want := []int64{1}; !slices.Equal(sink.counts, want) {
+		t.Fatalf("Expected the gap fill's update to wait for the emit interval, got updates at %v", sink.counts)
+	}
+
+	now = now.Add(time.Second)
+	pipeline.publishHeld(false)
+	update, _ := store.Get("BTC-USD")
+	if update.TradeCount != 3 || update.MissedTrades != 1 {
+		t.Errorf("Expected 3 trades applied and the rejected one still missed, got %+v", update)
+	}
+}
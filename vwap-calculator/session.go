@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// AnchoredVWAPCalculator accumulates VWAP over every trade since a session
+// anchor rather than over a fixed number of trades. With a non-zero period
+// the session restarts every period after the anchor, e.g. daily at UTC
+// midnight; with a zero period it accumulates from the anchor indefinitely.
+type AnchoredVWAPCalculator struct {
+	anchor time.Time
+	period time.Duration
+
+	mu          sync.Mutex
+	session     time.Time
+	totalPV     big.Rat
+	totalVolume big.Rat
+	clock       tradeClock
+	formatted
+}
+
+func NewAnchoredVWAPCalculator(anchor time.Time, period time.Duration) *AnchoredVWAPCalculator {
+	return &AnchoredVWAPCalculator{anchor: anchor, period: period}
+}
+
+func (c *AnchoredVWAPCalculator) Update(priceStr, sizeStr string) error {
+	return c.UpdateAt(priceStr, sizeStr, time.Now())
+}
+
+// UpdateAt adds a trade to its session. Trades before the anchor, or from a
+// session that has already been replaced, are ignored.
+func (c *AnchoredVWAPCalculator) UpdateAt(priceStr, sizeStr string, at time.Time) error {
+	price, err := parsePrice(priceStr, sizeStr)
+	if err != nil {
+		return err
+	}
+	size, _ := new(big.Rat).SetString(sizeStr)
+	if at.Before(c.anchor) {
+		return nil
+	}
+	session := c.anchor
+	if c.period > 0 {
+		session = c.anchor.Add(at.Sub(c.anchor) / c.period * c.period)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case session.Before(c.session):
+		return nil
+	case session.After(c.session):
+		c.session = session
+		c.totalPV.SetInt64(0)
+		c.totalVolume.SetInt64(0)
+		c.clock.reset()
+	}
+	c.totalPV.Add(&c.totalPV, new(big.Rat).Mul(price, size))
+	c.totalVolume.Add(&c.totalVolume, size)
+	c.clock.add(at)
+	return nil
+}
+
+func (c *AnchoredVWAPCalculator) Calculate() string {
+	vwap := c.CalculateRat()
+	if vwap == nil {
+		return "0"
+	}
+	return c.formatRat(vwap)
+}
+
+// CalculateRat returns the exact VWAP, or nil before the first trade.
+func (c *AnchoredVWAPCalculator) CalculateRat() *big.Rat {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.totalVolume.Sign() == 0 {
+		return nil
+	}
+	return new(big.Rat).Quo(&c.totalPV, &c.totalVolume)
+}
+
+func (c *AnchoredVWAPCalculator) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.session = time.Time{}
+	c.totalPV.SetInt64(0)
+	c.totalVolume.SetInt64(0)
+	c.clock.reset()
+}
+
+// TradeCount returns the trades in the current session.
+func (c *AnchoredVWAPCalculator) TradeCount() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clock.trades
+}
+
+func (c *AnchoredVWAPCalculator) Stats() CalculatorStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clock.stats(volumeString(&c.totalVolume), volumeString(&c.totalPV))
+}
+
+// parseAnchor reads a -session-anchor value: "midnight", a UTC time of day
+// such as "13:30", or an RFC 3339 timestamp. Times of day are anchored on the
+// Unix epoch, keeping the distance to any trade within time.Duration's range.
+func parseAnchor(s string) (time.Time, error) {
+	if s == "midnight" {
+		s = "00:00"
+	}
+	if t, err := time.Parse("15:04", s); err == nil {
+		return time.Date(1970, 1, 1, t.Hour(), t.Minute(), 0, 0, time.UTC), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid -session-anchor %q: use midnight, HH:MM or an RFC 3339 timestamp", s)
+}
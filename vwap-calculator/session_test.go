@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnchoredVWAPCalculator(t *testing.T) {
+	anchor, err := parseAnchor("midnight")
+	if err != nil {
+		t.Fatal(err)
+	}
+	calc := NewAnchoredVWAPCalculator(anchor, 24*time.Hour)
+	day := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+
+	calc.UpdateAt("100", "1", day.Add(1*time.Hour))
+	calc.UpdateAt("200", "3", day.Add(23*time.Hour))
+	if got := calc.Calculate(); got != "175.0000" {
+		t.Errorf("Expected 175.0000 within the session, got %s", got)
+	}
+
+	calc.UpdateAt("300", "1", day.Add(25*time.Hour))
+	if got := calc.Calculate(); got != "300.0000" {
+		t.Errorf("Expected a reset at midnight, got %s", got)
+	}
+	calc.UpdateAt("1", "100", day.Add(22*time.Hour))
+	if got := calc.Calculate(); got != "300.0000" {
+		t.Errorf("Expected a late trade from the previous session to be ignored, got %s", got)
+	}
+}
+
+func TestAnchoredVWAPCalculatorFixedAnchor(t *testing.T) {
+	anchor, err := parseAnchor("2024-03-05T14:30:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	calc := NewAnchoredVWAPCalculator(anchor, 0)
+	calc.UpdateAt("50", "10", anchor.Add(-time.Minute))
+	calc.UpdateAt("100", "1", anchor)
+	calc.UpdateAt("200", "1", anchor.Add(72*time.Hour))
+	if got := calc.Calculate(); got != "150.0000" {
+		t.Errorf("Expected 150.0000 from the anchor onwards, got %s", got)
+	}
+}
+
+func TestParseAnchor(t *testing.T) {
+	anchor, err := parseAnchor("13:30")
+	if err != nil || anchor.Hour() != 13 || anchor.Minute() != 30 || anchor.Location() != time.UTC {
+		t.Errorf("Unexpected anchor %v, %v", anchor, err)
+	}
+	if _, err := parseAnchor("tomorrow"); err == nil {
+		t.Error("Expected error for invalid anchor")
+	}
+}
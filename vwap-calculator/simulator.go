@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	// simVolatility is the standard deviation of each trade's log return.
+	simVolatility = 0.0005
+	simTick       = 10 * time.Millisecond
+)
+
+// simStartPrices seeds the random walk near realistic levels for the default
+// products. Anything else starts at 100.
+var simStartPrices = map[string]float64{
+	"BTC-USD": 45000,
+	"ETH-USD": 3000,
+	"ETH-BTC": 0.067,
+}
+
+// Simulator generates random-walk match messages for a fixed set of products.
+type Simulator struct {
+	products []string
+	prices   map[string]float64
+	nextID   map[string]int64
+	rand     *rand.Rand
+}
+
+func NewSimulator(products []string, seed uint64) *Simulator {
+	s := &Simulator{
+		products: slices.Sorted(slices.Values(products)),
+		prices:   make(map[string]float64),
+		nextID:   make(map[string]int64),
+		rand:     rand.New(rand.NewPCG(seed, seed)),
+	}
+	for _, product := range s.products {
+		price, ok := simStartPrices[product]
+		if !ok {
+			price = 100
+		}
+		s.prices[product] = price
+		s.nextID[product] = 1
+	}
+	return s
+}
+
+// Next returns a trade for a randomly chosen product, moving its price by a
+// small random step.
+func (s *Simulator) Next(now time.Time) Trade {
+	product := s.products[s.rand.IntN(len(s.products))]
+	price := s.prices[product] * math.Exp(simVolatility*s.rand.NormFloat64())
+	s.prices[product] = price
+
+	side := "buy"
+	if s.rand.IntN(2) == 0 {
+		side = "sell"
+	}
+	id := s.nextID[product]
+	s.nextID[product]++
+	return Trade{
+		Type:      "match",
+		ProductID: product,
+		TradeID:   id,
+		Sequence:  id,
+		Price:     strconv.FormatFloat(price, 'g', 8, 64),
+		Size:      strconv.FormatFloat(0.001+s.rand.ExpFloat64()*0.1, 'f', 8, 64),
+		Side:      side,
+		Time:      now.UTC(),
+	}
+}
+
+// runSimulator feeds generated trades through the pipeline at rate trades per
+// second, spread across the simulator's products, until ctx is cancelled.
+func runSimulator(ctx context.Context, sim *Simulator, rate float64, pipeline *Pipeline, logger Logger) error {
+	logger.Infof("Simulating %v trades/s across %d products", rate, len(sim.products))
+	ticker := time.NewTicker(simTick)
+	defer ticker.Stop()
+
+	start := time.Now()
+	var sent int64
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			due := int64(now.Sub(start).Seconds() * rate)
+			for ; sent < due && ctx.Err() == nil; sent++ {
+				pipeline.dispatch(ctx, sim.Next(now), nil)
+			}
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestSimulatorNext(t *testing.T) {
+	sim := NewSimulator([]string{"BTC-USD", "XYZ-USD"}, 1)
+	ids := map[string]int64{}
+	for i := 0; i < 1000; i++ {
+		trade := sim.Next(time.Now())
+		if trade.TradeID != ids[trade.ProductID]+1 {
+			t.Fatalf("Expected consecutive trade IDs for %s, got %d after %d", trade.ProductID, trade.TradeID, ids[trade.ProductID])
+		}
+		ids[trade.ProductID] = trade.TradeID
+		for _, field := range []string{trade.Price, trade.Size} {
+			if r, ok := new(big.Rat).SetString(field); !ok || r.Sign() <= 0 {
+				t.Fatalf("Expected a positive decimal, got %q", field)
+			}
+		}
+	}
+	if ids["BTC-USD"] == 0 || ids["XYZ-USD"] == 0 {
+		t.Errorf("Expected trades for both products, got %v", ids)
+	}
+	if price := sim.prices["BTC-USD"]; price < 30000 || price > 60000 {
+		t.Errorf("BTC-USD wandered implausibly far: %v", price)
+	}
+}
+
+func TestRunSimulator(t *testing.T) {
+	calculator := NewVWAPCalculator()
+	pipeline := NewPipeline(map[string]Calculator{"ETH-USD": calculator}, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := runSimulator(ctx, NewSimulator([]string{"ETH-USD"}, 1), 500, pipeline, pipeline.logger); err != nil {
+		t.Fatal(err)
+	}
+	if n := pipeline.tradeCount("ETH-USD"); n < 20 || n > 150 {
+		t.Errorf("Expected about 100 trades in 200ms at 500/s, got %d", n)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const snapshotVersion = 1
+
+// Snapshotter is implemented by calculators whose state can be persisted.
+type Snapshotter interface {
+	Snapshot() CalculatorSnapshot
+	Restore(snapshot CalculatorSnapshot) error
+}
+
+// CalculatorSnapshot is the persisted state of a VWAPCalculator. Values are
+// exact rationals ("a/b") so a restored calculator matches bit for bit.
+type CalculatorSnapshot struct {
+	// Trades holds [price, size] pairs, oldest first.
+	Trades      [][2]string `json:"trades"`
+	TotalPV     string      `json:"total_pv"`
+	TotalVolume string      `json:"total_volume"`
+}
+
+// Snapshot is the on-disk format written by saveSnapshot.
+type Snapshot struct {
+	Version  int                           `json:"version"`
+	SavedAt  time.Time                     `json:"saved_at"`
+	Products map[string]CalculatorSnapshot `json:"products"`
+}
+
+// Each calls fn for every entry in the buffer, oldest first.
+func (rb *RingBuffer) Each(fn func(price, size *big.Rat)) {
+	for i := 0; i < rb.count; i++ {
+		pos := (rb.start + i*2) % len(rb.data)
+		fn(&rb.data[pos], &rb.data[pos+1])
+	}
+}
+
+func (v *VWAPCalculator) Snapshot() CalculatorSnapshot {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	snapshot := CalculatorSnapshot{
+		Trades:      make([][2]string, 0, v.buffer.count),
+		TotalPV:     v.totalPV.RatString(),
+		TotalVolume: v.totalVolume.RatString(),
+	}
+	v.buffer.Each(func(price, size *big.Rat) {
+		snapshot.Trades = append(snapshot.Trades, [2]string{price.RatString(), size.RatString()})
+	})
+	return snapshot
+}
+
+// Restore replaces the calculator's window with the snapshot's trades. The
+// stored totals are checked against the trades to catch corrupt files.
+func (v *VWAPCalculator) Restore(snapshot CalculatorSnapshot) error {
+	if len(snapshot.Trades) > v.buffer.size {
+		return fmt.Errorf("snapshot holds %d trades but the window is %d", len(snapshot.Trades), v.buffer.size)
+	}
+
+	restored := NewWindowedVWAPCalculator(v.buffer.size)
+	for _, trade := range snapshot.Trades {
+		if err := restored.Update(trade[0], trade[1]); err != nil {
+			return fmt.Errorf("restoring trade %v: %w", trade, err)
+		}
+	}
+	totalPV, ok1 := new(big.Rat).SetString(snapshot.TotalPV)
+	totalVolume, ok2 := new(big.Rat).SetString(snapshot.TotalVolume)
+	if !ok1 || !ok2 || totalPV.Cmp(&restored.totalPV) != 0 || totalVolume.Cmp(&restored.totalVolume) != 0 {
+		return errors.New("snapshot totals do not match its trades")
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.buffer = restored.buffer
+	v.totalPV.Set(&restored.totalPV)
+	v.totalVolume.Set(&restored.totalVolume)
+	v.totalPV2.Set(&restored.totalPV2)
+	v.priceRange = restored.priceRange
+	v.clock = restored.clock
+	v.vwap.Store(restored.vwap.Load())
+	return nil
+}
+
+// saveSnapshot atomically writes the state of every snapshottable calculator
+// to path.
+func saveSnapshot(path string, calculators map[string]Calculator) error {
+	snapshot := Snapshot{
+		Version:  snapshotVersion,
+		SavedAt:  time.Now().UTC(),
+		Products: make(map[string]CalculatorSnapshot, len(calculators)),
+	}
+	for productID, calculator := range calculators {
+		if s, ok := calculator.(Snapshotter); ok {
+			snapshot.Products[productID] = s.Snapshot()
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("saving snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := json.NewEncoder(tmp).Encode(snapshot); err != nil {
+		tmp.Close()
+		return fmt.Errorf("saving snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("saving snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("saving snapshot: %w", err)
+	}
+	return nil
+}
+
+// loadSnapshot restores calculators from path and returns the products it
+// restored. A missing file is not an error.
+func loadSnapshot(path string, calculators map[string]Calculator, logger Logger) (map[string]bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading snapshot: %w", err)
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("loading snapshot: %w", err)
+	}
+	if snapshot.Version != snapshotVersion {
+		return nil, fmt.Errorf("loading snapshot: unsupported version %d", snapshot.Version)
+	}
+
+	restored := make(map[string]bool)
+	for productID, state := range snapshot.Products {
+		s, ok := calculators[productID].(Snapshotter)
+		if !ok {
+			logger.Warnf("Ignoring snapshot for unconfigured product %s", productID)
+			continue
+		}
+		if err := s.Restore(state); err != nil {
+			logger.With("product", productID).Warnf("Snapshot not restored: %v", err)
+			continue
+		}
+		restored[productID] = true
+	}
+	logger.Infof("Restored %d products from snapshot taken at %s", len(restored), snapshot.SavedAt.Format(time.RFC3339))
+	return restored, nil
+}
+
+// runSnapshotter saves a snapshot of the calculators returned by calculators
+// every interval until ctx is cancelled.
+func runSnapshotter(ctx context.Context, path string, interval time.Duration, calculators func() map[string]Calculator, logger Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := saveSnapshot(path, calculators()); err != nil {
+				logger.Errorf("%v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	logger := NewLogger(io.Discard, slog.LevelInfo, "text")
+	path := filepath.Join(t.TempDir(), "vwap.json")
+
+	original := NewVWAPCalculator()
+	for i := 1; i <= windowSize+10; i++ {
+		if err := original.Update(fmt.Sprintf("%d.125", i), "0.3"); err != nil {
+			t.Fatalf("Update returned error: %v", err)
+		}
+	}
+	if err := saveSnapshot(path, map[string]Calculator{"BTC-USD": original}); err != nil {
+		t.Fatalf("saveSnapshot returned error: %v", err)
+	}
+
+	restoredCalc := NewVWAPCalculator()
+	restored, err := loadSnapshot(path, map[string]Calculator{"BTC-USD": restoredCalc}, logger)
+	if err != nil {
+		t.Fatalf("loadSnapshot returned error: %v", err)
+	}
+	if !restored["BTC-USD"] {
+		t.Fatal("Expected BTC-USD to be restored")
+	}
+	if got, want := restoredCalc.Calculate(), original.Calculate(); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	// Both calculators must evict the same trade next.
+	original.Update("5000", "1")
+	restoredCalc.Update("5000", "1")
+	if got, want := restoredCalc.Calculate(), original.Calculate(); got != want {
+		t.Errorf("After eviction expected %s, got %s", want, got)
+	}
+}
+
+func TestSnapshotRejectsInconsistentTotals(t *testing.T) {
+	calc := NewVWAPCalculator()
+	err := calc.Restore(CalculatorSnapshot{
+		Trades:      [][2]string{{"100", "1"}},
+		TotalPV:     "999",
+		TotalVolume: "1",
+	})
+	if err == nil {
+		t.Error("Expected error for totals that do not match the trades")
+	}
+	if result := calc.Calculate(); result != "0" {
+		t.Errorf("Failed restore must leave the calculator untouched, got %s", result)
+	}
+}
+
+func TestLoadSnapshotMissingFile(t *testing.T) {
+	restored, err := loadSnapshot(filepath.Join(t.TempDir(), "absent.json"), nil, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	if err != nil || len(restored) != 0 {
+		t.Errorf("Expected missing snapshot to be ignored, got %v, %v", restored, err)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grantis/gopkg/vwap-calculator/internal/mockexchange"
+)
+
+// TestChaosSoak streams trades through a mock exchange that randomly drops
+// the connection, sends malformed frames, stalls and repeats trades, then
+// checks the calculators against the trades that were actually applied. It
+// runs 400 trades by default. Set VWAP_SOAK_DURATION (e.g. 10m) to soak for
+// longer, and VWAP_SOAK_SEED to repeat a run; the seed is logged.
+func TestChaosSoak(t *testing.T) {
+	trades, until := 400, time.Time{}
+	if s := os.Getenv("VWAP_SOAK_DURATION"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			t.Fatalf("Invalid VWAP_SOAK_DURATION: %v", err)
+		}
+		until = time.Now().Add(d)
+	}
+	seed := int64(1)
+	if s := os.Getenv("VWAP_SOAK_SEED"); s != "" {
+		var err error
+		if seed, err = strconv.ParseInt(s, 10, 64); err != nil {
+			t.Fatalf("Invalid VWAP_SOAK_SEED: %v", err)
+		}
+	}
+	t.Logf("Chaos seed %d", seed)
+
+	exchange := mockexchange.New()
+	exchange.LastMatch = true
+	defer exchange.Close()
+	store := NewStore()
+	var mu sync.Mutex
+	applied := make(map[string][]Trade)
+	startFeed(t, exchange, store, func(_ *Config, p *Pipeline) {
+		p.SetHooks(Hooks{OnTrade: func(trade Trade) {
+			mu.Lock()
+			defer mu.Unlock()
+			applied[trade.ProductID] = append(applied[trade.ProductID], trade)
+		}})
+	})
+	nextRequest(t, exchange)
+
+	// Each product's first trade gets through before the chaos starts, so
+	// the gap detector has a baseline to count lost trades from.
+	products := []string{"BTC-USD", "ETH-USD"}
+	rng := rand.New(rand.NewPCG(uint64(seed), 1))
+	match := func(productID string) int64 {
+		return exchange.Match(mockexchange.Match{
+			ProductID: productID,
+			Price:     strconv.Itoa(100 + rng.IntN(50)),
+			Size:      strconv.Itoa(1 + rng.IntN(5)),
+		})
+	}
+	lastApplied := func(productID string) int64 {
+		mu.Lock()
+		defer mu.Unlock()
+		if trades := applied[productID]; len(trades) > 0 {
+			return trades[len(trades)-1].TradeID
+		}
+		return 0
+	}
+	// settle sends trades for productID until one is applied, so that any
+	// trades lost to a disconnect are counted as missed.
+	settle := func(productID string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			id := match(productID)
+			for wait := time.Now().Add(200 * time.Millisecond); time.Now().Before(wait); time.Sleep(5 * time.Millisecond) {
+				if lastApplied(productID) == id {
+					return
+				}
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("No %s trade got through", productID)
+			}
+		}
+	}
+	for _, product := range products {
+		settle(product)
+	}
+
+	exchange.SetChaos(&mockexchange.Chaos{
+		Seed:       seed,
+		Disconnect: 0.02,
+		Malformed:  0.05,
+		Duplicate:  0.05,
+		Stall:      0.05,
+		MaxStall:   20 * time.Millisecond,
+	})
+	for i := 0; i < trades || time.Now().Before(until); i++ {
+		match(products[i%len(products)])
+	}
+	faults := exchange.Faults()
+	exchange.SetChaos(nil)
+	t.Logf("Injected %+v", faults)
+	if faults.Disconnects == 0 || faults.Malformed == 0 || faults.Duplicates == 0 || faults.Stalls == 0 {
+		t.Errorf("Expected every kind of fault to be injected, got %+v", faults)
+	}
+
+	for _, product := range products {
+		settle(product)
+		mu.Lock()
+		got := slices.Clone(applied[product])
+		mu.Unlock()
+		update := waitForUpdate(t, store, product, func(u VWAPUpdate) bool { return u.TradeCount == int64(len(got)) })
+
+		// Trades are applied once each, in order, and every trade ID is
+		// either applied or counted as missed.
+		want := NewVWAPCalculator()
+		for i, trade := range got {
+			if i > 0 && trade.TradeID <= got[i-1].TradeID {
+				t.Fatalf("%s: trade %d applied after trade %d", product, trade.TradeID, got[i-1].TradeID)
+			}
+			want.Update(trade.Price, trade.Size)
+		}
+		if last := got[len(got)-1].TradeID; update.TradeCount+update.MissedTrades != last {
+			t.Errorf("%s: %d trades applied and %d missed, expected %d in all", product, update.TradeCount, update.MissedTrades, last)
+		}
+		if update.VWAP != want.Calculate() {
+			t.Errorf("%s: expected VWAP %s over the applied trades, got %s", product, want.Calculate(), update.VWAP)
+		}
+	}
+}
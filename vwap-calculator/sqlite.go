@@ -0,0 +1,110 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS trades (
+	product_id  TEXT    NOT NULL,
+	trade_id    INTEGER,
+	price       TEXT    NOT NULL,
+	size        TEXT    NOT NULL,
+	side        TEXT,
+	time        TIMESTAMP,
+	received_at TIMESTAMP NOT NULL,
+	UNIQUE (product_id, trade_id)
+);
+CREATE INDEX IF NOT EXISTS trades_product_time ON trades (product_id, time);
+`
+
+// TradeSink receives every trade accepted into a calculator.
+type TradeSink interface {
+	RecordTrade(trade Trade) error
+}
+
+// SQLiteStore persists accepted trades to a SQLite database. Inserts are
+// batched on a background goroutine so disk latency never stalls the feed.
+type SQLiteStore struct {
+	db     *sql.DB
+	queue  *batchQueue[recordedTrade]
+	logger Logger
+}
+
+type recordedTrade struct {
+	Trade
+	receivedAt time.Time
+}
+
+func OpenSQLiteStore(path string, logger Logger) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating schema in %s: %w", path, err)
+	}
+
+	s := &SQLiteStore{db: db, logger: logger}
+	s.queue = newBatchQueue(storageQueueSize, storageBatchSize, storageFlushWait, func(batch []recordedTrade) {
+		if err := s.insert(batch); err != nil {
+			s.logger.Errorf("Writing %d trades to SQLite failed: %v", len(batch), err)
+		}
+	})
+	return s, nil
+}
+
+// RecordTrade queues trade for insertion. It never blocks; when the writer
+// falls behind the trade is dropped and an error returned.
+func (s *SQLiteStore) RecordTrade(trade Trade) error {
+	if !s.queue.Offer(recordedTrade{Trade: trade, receivedAt: time.Now().UTC()}) {
+		return errQueueFull
+	}
+	return nil
+}
+
+// Close flushes queued trades and closes the database.
+func (s *SQLiteStore) Close() error {
+	s.queue.Close()
+	return s.db.Close()
+}
+
+func (s *SQLiteStore) insert(batch []recordedTrade) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT OR IGNORE INTO trades
+		(product_id, trade_id, price, size, side, time, received_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, t := range batch {
+		if _, err := stmt.Exec(t.ProductID, nullInt64(t.TradeID), t.Price, t.Size, nullString(t.Side), nullTime(t.Time), t.receivedAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func nullInt64(v int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: v, Valid: v != 0}
+}
+
+func nullString(v string) sql.NullString {
+	return sql.NullString{String: v, Valid: v != ""}
+}
+
+func nullTime(v time.Time) sql.NullTime {
+	return sql.NullTime{Time: v, Valid: !v.IsZero()}
+}
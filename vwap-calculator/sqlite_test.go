@@ -0,0 +1,56 @@
+package main
+
+import (
+	"database/sql"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trades.db")
+	store, err := OpenSQLiteStore(path, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore returned error: %v", err)
+	}
+
+	tradeTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	trades := []Trade{
+		{ProductID: "BTC-USD", TradeID: 1, Price: "100.5", Size: "0.25", Side: "buy", Time: tradeTime},
+		{ProductID: "BTC-USD", TradeID: 1, Price: "100.5", Size: "0.25", Side: "buy", Time: tradeTime},
+		{ProductID: "ETH-USD", Price: "3000", Size: "1"},
+	}
+	for _, trade := range trades {
+		if err := store.RecordTrade(trade); err != nil {
+			t.Fatalf("RecordTrade returned error: %v", err)
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("Reopening database failed: %v", err)
+	}
+	defer db.Close()
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM trades`).Scan(&count); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 rows after dropping the duplicate, got %d", count)
+	}
+
+	var price, size string
+	var stored time.Time
+	if err := db.QueryRow(`SELECT price, size, time FROM trades WHERE trade_id = 1`).Scan(&price, &size, &stored); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if price != "100.5" || size != "0.25" || !stored.Equal(tradeTime) {
+		t.Errorf("Unexpected row: %s %s %v", price, size, stored)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// statsdPacketSize keeps each datagram within a typical MTU.
+const statsdPacketSize = 1432
+
+// StatsDConfig configures the StatsD emitter.
+type StatsDConfig struct {
+	Addr     string
+	Prefix   string
+	Interval time.Duration
+}
+
+// StatsDEmitter forwards the calculator's Prometheus metrics to a StatsD or
+// DogStatsD agent over UDP. Counters are sent as the increase since the last
+// flush, gauges as their value, and histograms as the increase of their
+// count and sum. Metric labels, such as product, become DogStatsD tags.
+type StatsDEmitter struct {
+	cfg      StatsDConfig
+	gatherer prometheus.Gatherer
+	tags     []string // sent with every metric
+	conn     net.Conn
+	logger   Logger
+
+	last map[string]float64 // previous counter values, by name and tags
+}
+
+// NewStatsDEmitter sends metrics from gatherer to cfg.Addr, adding tags to
+// each.
+func NewStatsDEmitter(cfg StatsDConfig, gatherer prometheus.Gatherer, tags []string, logger Logger) (*StatsDEmitter, error) {
+	conn, err := net.Dial("udp", cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("statsd: %w", err)
+	}
+	return &StatsDEmitter{cfg: cfg, gatherer: gatherer, tags: tags, conn: conn, logger: logger, last: make(map[string]float64)}, nil
+}
+
+// Run flushes every cfg.Interval until ctx is cancelled, then flushes once
+// more.
+func (e *StatsDEmitter) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			e.flush()
+			return
+		}
+		e.flush()
+	}
+}
+
+func (e *StatsDEmitter) Close() error {
+	return e.conn.Close()
+}
+
+// flush gathers the vwap_ metrics and sends them.
+func (e *StatsDEmitter) flush() {
+	families, err := e.gatherer.Gather()
+	if err != nil {
+		e.logger.Warnf("StatsD gather failed: %v", err)
+	}
+	var lines []string
+	for _, family := range families {
+		if !strings.HasPrefix(family.GetName(), "vwap_") {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			lines = e.appendMetric(lines, family.GetName(), family.GetType(), m)
+		}
+	}
+	if err := e.send(lines); err != nil {
+		e.logger.Warnf("StatsD send failed: %v", err)
+	}
+}
+
+func (e *StatsDEmitter) appendMetric(lines []string, name string, kind dto.MetricType, m *dto.Metric) []string {
+	tags := e.metricTags(m)
+	switch kind {
+	case dto.MetricType_COUNTER:
+		if delta, ok := e.delta(name, tags, m.GetCounter().GetValue()); ok {
+			lines = append(lines, e.line(name, delta, "c", tags))
+		}
+	case dto.MetricType_GAUGE:
+		lines = append(lines, e.line(name, m.GetGauge().GetValue(), "g", tags))
+	case dto.MetricType_HISTOGRAM:
+		h := m.GetHistogram()
+		if delta, ok := e.delta(name+"_count", tags, float64(h.GetSampleCount())); ok {
+			lines = append(lines, e.line(name+"_count", delta, "c", tags))
+		}
+		if delta, ok := e.delta(name+"_sum", tags, h.GetSampleSum()); ok {
+			lines = append(lines, e.line(name+"_sum", delta, "c", tags))
+		}
+	}
+	return lines
+}
+
+// delta returns how much a counter grew since the last flush. Unchanged
+// counters are skipped; a counter seen for the first time reports its whole
+// value.
+func (e *StatsDEmitter) delta(name, tags string, value float64) (float64, bool) {
+	key := name + "|" + tags
+	previous := e.last[key]
+	e.last[key] = value
+	if value < previous {
+		// The counter was recreated, e.g. after a product was removed and
+		// added again.
+		previous = 0
+	}
+	return value - previous, value != previous
+}
+
+// metricTags renders m's labels and the emitter's tags as a sorted DogStatsD
+// tag list.
+func (e *StatsDEmitter) metricTags(m *dto.Metric) string {
+	tags := make([]string, 0, len(m.GetLabel())+len(e.tags))
+	for _, label := range m.GetLabel() {
+		tags = append(tags, label.GetName()+":"+label.GetValue())
+	}
+	tags = append(tags, e.tags...)
+	sort.Strings(tags)
+	return strings.Join(tags, ",")
+}
+
+func (e *StatsDEmitter) line(name string, value float64, kind, tags string) string {
+	line := e.cfg.Prefix + name + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|" + kind
+	if tags != "" {
+		line += "|#" + tags
+	}
+	return line
+}
+
+// send writes lines in as few datagrams as fit statsdPacketSize, one metric
+// per line.
+func (e *StatsDEmitter) send(lines []string) error {
+	var packet bytes.Buffer
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsdPacketSize {
+			if _, err := e.conn.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if packet.Len() == 0 {
+		return nil
+	}
+	_, err := e.conn.Write(packet.Bytes())
+	return err
+}
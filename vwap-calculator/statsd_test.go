@@ -0,0 +1,110 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestStatsDEmitter(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	receive := func() []string {
+		t.Helper()
+		listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buf := make([]byte, statsdPacketSize)
+		n, _, err := listener.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(string(buf[:n]), "\n")
+		slices.Sort(lines)
+		return lines
+	}
+
+	registry := prometheus.NewRegistry()
+	trades := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "vwap_trades_processed_total"}, []string{"product"})
+	current := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "vwap_current"}, []string{"product"})
+	latency := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "vwap_ws_read_seconds"})
+	other := prometheus.NewCounter(prometheus.CounterOpts{Name: "go_other_total"})
+	registry.MustRegister(trades, current, latency, other)
+
+	cfg := StatsDConfig{Addr: listener.LocalAddr().String(), Prefix: "app.", Interval: time.Second}
+	emitter, err := NewStatsDEmitter(cfg, registry, []string{"venue:coinbase"}, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer emitter.Close()
+
+	trades.WithLabelValues("BTC-USD").Add(3)
+	current.WithLabelValues("BTC-USD").Set(45000.5)
+	latency.Observe(0.25)
+	other.Inc()
+	emitter.flush()
+	want := []string{
+		"app.vwap_current:45000.5|g|#product:BTC-USD,venue:coinbase",
+		"app.vwap_trades_processed_total:3|c|#product:BTC-USD,venue:coinbase",
+		"app.vwap_ws_read_seconds_count:1|c|#venue:coinbase",
+		"app.vwap_ws_read_seconds_sum:0.25|c|#venue:coinbase",
+	}
+	if got := receive(); !slices.Equal(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	// Counters report only their increase, and unchanged ones are skipped.
+	trades.WithLabelValues("BTC-USD").Add(2)
+	emitter.flush()
+	want = []string{
+		"app.vwap_current:45000.5|g|#product:BTC-USD,venue:coinbase",
+		"app.vwap_trades_processed_total:2|c|#product:BTC-USD,venue:coinbase",
+	}
+	if got := receive(); !slices.Equal(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestStatsDEmitterSplitsPackets(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	emitter, err := NewStatsDEmitter(StatsDConfig{Addr: listener.LocalAddr().String()}, prometheus.NewRegistry(), nil, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer emitter.Close()
+
+	lines := make([]string, 100)
+	for i := range lines {
+		lines[i] = "vwap_current:1|g|#product:PRODUCT-" + strings.Repeat("X", 20)
+	}
+	if err := emitter.send(lines); err != nil {
+		t.Fatal(err)
+	}
+	received := 0
+	buf := make([]byte, 65536)
+	for received < len(lines) {
+		listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := listener.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n > statsdPacketSize {
+			t.Errorf("Packet of %d bytes exceeds %d", n, statsdPacketSize)
+		}
+		received += len(strings.Split(string(buf[:n]), "\n"))
+	}
+	if received != len(lines) {
+		t.Errorf("Expected %d lines, got %d", len(lines), received)
+	}
+}
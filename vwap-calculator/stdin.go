@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+)
+
+// maxLineSize bounds a single JSON line read from a stream source.
+const maxLineSize = 1 << 20
+
+// runReader feeds newline-delimited match messages from r through the
+// pipeline until EOF or until ctx is cancelled. Lines use the websocket feed's
+// format, so anything the Kafka trades topic or another feed handler writes
+// can be piped straight in.
+func runReader(ctx context.Context, r io.Reader, pipeline *Pipeline, logger Logger) error {
+	lines := make(chan []byte)
+	errc := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+		for scanner.Scan() {
+			line := append([]byte(nil), scanner.Bytes()...)
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+		errc <- scanner.Err()
+		close(lines)
+	}()
+
+	count := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case line, ok := <-lines:
+			if !ok {
+				if err := <-errc; err != nil {
+					return fmt.Errorf("reading input: %w", err)
+				}
+				logger.Infof("End of input after %d lines", count)
+				return nil
+			}
+			count++
+			if len(line) == 0 {
+				continue
+			}
+			pipeline.processMessage(ctx, line)
+		}
+	}
+}
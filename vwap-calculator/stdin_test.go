@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRunReader(t *testing.T) {
+	calculator := NewVWAPCalculator()
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": calculator}, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	input := `{"type":"match","product_id":"BTC-USD","trade_id":1,"price":"100","size":"1"}
+
+{"type":"heartbeat","product_id":"BTC-USD"}
+not json
+{"type":"match","product_id":"BTC-USD","trade_id":2,"price":"200","size":"3"}
+`
+	if err := runReader(context.Background(), strings.NewReader(input), pipeline, pipeline.logger); err != nil {
+		t.Fatal(err)
+	}
+	if got := calculator.Calculate(); got != "175.0000" {
+		t.Errorf("Expected VWAP 175.0000, got %s", got)
+	}
+}
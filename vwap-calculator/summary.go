@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of per-product trade errors counted for the shutdown summary.
+const (
+	tradeErrDuplicate = "duplicate" // dropped as an already-applied trade_id
+	tradeErrDust      = "dust"      // below -min-size or -min-notional
+	tradeErrOutlier   = "outlier"   // quarantined by the outlier filter
+	tradeErrInvalid   = "invalid"   // rejected by the calculator
+	tradeErrMissed    = "missed"    // skipped by the feed, from trade_id gaps
+)
+
+// runCounts keeps the totals the shutdown summary reports beyond what the
+// calculators and throughput stats already hold.
+type runCounts struct {
+	now   func() time.Time
+	start time.Time
+
+	mu        sync.Mutex
+	errors    map[string]map[string]int64 // by product, then kind
+	malformed int64
+}
+
+func newRunCounts() *runCounts {
+	return &runCounts{now: time.Now, start: time.Now(), errors: make(map[string]map[string]int64)}
+}
+
+func (c *runCounts) tradeError(productID, kind string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts, ok := c.errors[productID]
+	if !ok {
+		counts = make(map[string]int64)
+		c.errors[productID] = counts
+	}
+	counts[kind]++
+}
+
+func (c *runCounts) malformedMessage() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.malformed++
+}
+
+// ProductSummary is one product's line of the shutdown summary.
+type ProductSummary struct {
+	ProductID string  `json:"product_id"`
+	VWAP      string  `json:"vwap"`
+	Trades    int64   `json:"trades"`
+	Volume    float64 `json:"volume"`
+	// Errors counts the product's trades that were not applied, by kind:
+	// duplicate, dust, outlier, invalid or missed. Kinds that did not occur
+	// are left out.
+	Errors map[string]int64 `json:"errors,omitempty"`
+}
+
+// RunSummary describes a run, as reported on exit.
+type RunSummary struct {
+	Uptime string `json:"uptime"`
+	// MalformedMessages counts feed messages and trades that could not be
+	// decoded or applied.
+	MalformedMessages int64            `json:"malformed_messages"`
+	Reconnects        int64            `json:"reconnects"`
+	Products          []ProductSummary `json:"products"`
+}
+
+// Summary reports every tracked product, ordered by product ID, and the
+// run's totals so far.
+func (p *Pipeline) Summary() RunSummary {
+	calculators := p.Calculators()
+	products := slices.Sorted(maps.Keys(calculators))
+	throughput := p.throughput.report(products)
+
+	p.counts.mu.Lock()
+	defer p.counts.mu.Unlock()
+	summary := RunSummary{
+		Uptime:            p.counts.now().Sub(p.counts.start).Round(time.Millisecond).String(),
+		MalformedMessages: p.counts.malformed,
+		Reconnects:        p.health.reconnectCount(),
+		Products:          make([]ProductSummary, 0, len(products)),
+	}
+	for i, productID := range products {
+		product := ProductSummary{
+			ProductID: productID,
+			VWAP:      calculators[productID].Calculate(),
+			Trades:    p.tradeCount(productID),
+			Volume:    throughput[i].Volume,
+		}
+		errors := maps.Clone(p.counts.errors[productID])
+		if missed := p.gaps.Missed(productID); missed > 0 {
+			if errors == nil {
+				errors = make(map[string]int64)
+			}
+			errors[tradeErrMissed] = missed
+		}
+		product.Errors = errors
+		summary.Products = append(summary.Products, product)
+	}
+	return summary
+}
+
+// WriteSummary prints each product's final VWAP, trade count, volume and
+// errors, then the run's uptime and connection totals.
+func (p *Pipeline) WriteSummary(w io.Writer) {
+	summary := p.Summary()
+	for _, product := range summary.Products {
+		details := []string{
+			fmt.Sprintf("%d trades", product.Trades),
+			"volume " + strconv.FormatFloat(product.Volume, 'f', -1, 64),
+		}
+		for _, kind := range slices.Sorted(maps.Keys(product.Errors)) {
+			details = append(details, fmt.Sprintf("%s=%d", kind, product.Errors[kind]))
+		}
+		fmt.Fprintf(w, "%s final VWAP: %s (%s)\n", product.ProductID, product.VWAP, strings.Join(details, ", "))
+	}
+	fmt.Fprintf(w, "Ran for %s: %d malformed messages, %d reconnects\n", summary.Uptime, summary.MalformedMessages, summary.Reconnects)
+}
+
+// WriteSummaryFile writes the summary to path as JSON.
+func (p *Pipeline) WriteSummaryFile(path string) error {
+	data, err := json.MarshalIndent(p.Summary(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteSummaryFile(t *testing.T) {
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	pipeline.SetMinimum("BTC-USD", big.NewRat(1, 100), nil)
+	ctx := context.Background()
+	for _, msg := range []string{
+		`{"type":"match","product_id":"BTC-USD","trade_id":1,"price":"100","size":"1"}`,
+		`{"type":"match","product_id":"BTC-USD","price":"100","size":"0.001"}`,
+		`{"type":"match","product_id":"BTC-USD","trade_id":4,"price":"200","size":"0.5"}`,
+		`{"type":"match","product_id":"BTC-USD","trade_id":5,"price":"-1","size":"1"}`,
+	} {
+		pipeline.processMessage(ctx, []byte(msg))
+	}
+
+	path := filepath.Join(t.TempDir(), "summary.json")
+	if err := pipeline.WriteSummaryFile(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary RunSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		t.Fatalf("Invalid summary %s: %v", data, err)
+	}
+	if summary.MalformedMessages != 1 || len(summary.Products) != 1 {
+		t.Fatalf("Unexpected summary %+v", summary)
+	}
+	product := summary.Products[0]
+	if product.VWAP != "133.3333" || product.Trades != 2 || product.Volume != 1.5 {
+		t.Errorf("Unexpected product summary %+v", product)
+	}
+	// Trades 2 and 3 never arrived.
+	want := map[string]int64{tradeErrDust: 1, tradeErrInvalid: 1, tradeErrMissed: 2}
+	if !reflect.DeepEqual(product.Errors, want) {
+		t.Errorf("Expected errors %v, got %v", want, product.Errors)
+	}
+}
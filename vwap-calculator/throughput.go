@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// throughputStats counts trades, bytes and volume per product, and the rates
+// of each over the last reporting interval.
+type throughputStats struct {
+	now func() time.Time
+
+	mu       sync.Mutex
+	products map[string]*productThroughput
+	rolled   time.Time // start of the current interval
+	elapsed  time.Duration
+}
+
+// productThroughput holds a product's counts since start, in the current
+// interval and in the last complete one.
+type productThroughput struct {
+	total, interval, rate throughputCounts
+}
+
+type throughputCounts struct {
+	trades int64
+	bytes  int64
+	volume float64
+}
+
+func newThroughputStats() *throughputStats {
+	return &throughputStats{now: time.Now, products: make(map[string]*productThroughput), rolled: time.Now()}
+}
+
+func (s *throughputStats) product(productID string) *productThroughput {
+	p, ok := s.products[productID]
+	if !ok {
+		p = &productThroughput{}
+		s.products[productID] = p
+	}
+	return p
+}
+
+// addBytes counts a feed message about productID.
+func (s *throughputStats) addBytes(productID string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.product(productID)
+	p.total.bytes += int64(n)
+	p.interval.bytes += int64(n)
+	productBytes.WithLabelValues(productID).Add(float64(n))
+}
+
+// addTrade counts a trade accepted into productID's calculator.
+func (s *throughputStats) addTrade(productID, size string) {
+	volume, _ := strconv.ParseFloat(size, 64)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.product(productID)
+	p.total.trades++
+	p.interval.trades++
+	p.total.volume += volume
+	p.interval.volume += volume
+	tradedVolume.WithLabelValues(productID).Add(volume)
+}
+
+// roll ends the current interval, making its counts the reported rates.
+func (s *throughputStats) roll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.elapsed = now.Sub(s.rolled)
+	s.rolled = now
+	for _, p := range s.products {
+		p.rate, p.interval = p.interval, throughputCounts{}
+	}
+}
+
+// forget drops productID's counts.
+func (s *throughputStats) forget(productID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.products, productID)
+}
+
+// ThroughputReport is a product's throughput as served by /stats. Rates
+// cover the last reporting interval.
+type ThroughputReport struct {
+	ProductID       string  `json:"product_id"`
+	Trades          int64   `json:"trades"`
+	Bytes           int64   `json:"bytes"`
+	Volume          float64 `json:"volume"`
+	Interval        string  `json:"interval"`
+	TradesPerSecond float64 `json:"trades_per_second"`
+	BytesPerSecond  float64 `json:"bytes_per_second"`
+	VolumePerSecond float64 `json:"volume_per_second"`
+}
+
+// report returns the throughput of each of productIDs, in order. Before the
+// first interval ends, rates cover the time since the stats started.
+func (s *throughputStats) report(productIDs []string) []ThroughputReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elapsed := s.elapsed
+	useInterval := elapsed == 0
+	if useInterval {
+		elapsed = s.now().Sub(s.rolled)
+	}
+	reports := make([]ThroughputReport, 0, len(productIDs))
+	for _, productID := range productIDs {
+		report := ThroughputReport{ProductID: productID, Interval: elapsed.Round(time.Second).String()}
+		if p, ok := s.products[productID]; ok {
+			report.Trades, report.Bytes, report.Volume = p.total.trades, p.total.bytes, p.total.volume
+			rate := p.rate
+			if useInterval {
+				rate = p.interval
+			}
+			if seconds := elapsed.Seconds(); seconds > 0 {
+				report.TradesPerSecond = float64(rate.trades) / seconds
+				report.BytesPerSecond = float64(rate.bytes) / seconds
+				report.VolumePerSecond = rate.volume / seconds
+			}
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// Throughput reports every product's throughput, ordered by product ID.
+func (p *Pipeline) Throughput() []ThroughputReport {
+	productIDs := slices.Sorted(maps.Keys(p.Calculators()))
+	return p.throughput.report(productIDs)
+}
+
+// runThroughputLog ends a throughput interval every interval and logs each
+// product's rates, warning about products that did not trade at all.
+func runThroughputLog(ctx context.Context, pipeline *Pipeline, interval time.Duration, logger Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		pipeline.throughput.roll()
+		for _, report := range pipeline.Throughput() {
+			productLogger := logger.With("product", report.ProductID)
+			if report.TradesPerSecond == 0 {
+				productLogger.Warnf("No trades in the last %s", report.Interval)
+				continue
+			}
+			productLogger.Infof("Throughput: %.2f trades/s, %.0f bytes/s, volume %g/s", report.TradesPerSecond, report.BytesPerSecond, report.VolumePerSecond)
+		}
+	}
+}
+
+// addStatsRoutes serves each product's throughput.
+func addStatsRoutes(mux *http.ServeMux, pipeline *Pipeline) {
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, pipeline.Throughput())
+	})
+}
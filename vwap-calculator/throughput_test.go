@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestThroughputStats(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	s := newThroughputStats()
+	s.now = func() time.Time { return now }
+	s.rolled = now
+
+	s.addBytes("BTC-USD", 100)
+	s.addTrade("BTC-USD", "0.5")
+	s.addTrade("BTC-USD", "1.5")
+	now = now.Add(10 * time.Second)
+	reports := s.report([]string{"BTC-USD", "ETH-USD"})
+	if r := reports[0]; r.Trades != 2 || r.Volume != 2 || r.TradesPerSecond != 0.2 || r.BytesPerSecond != 10 || r.Interval != "10s" {
+		t.Errorf("Unexpected report before the first interval %+v", r)
+	}
+	if r := reports[1]; r.ProductID != "ETH-USD" || r.Trades != 0 || r.TradesPerSecond != 0 {
+		t.Errorf("Expected an empty ETH-USD report, got %+v", r)
+	}
+
+	s.roll()
+	s.addTrade("BTC-USD", "4")
+	now = now.Add(5 * time.Second)
+	// Rates stay those of the completed interval until the next roll.
+	if r := s.report([]string{"BTC-USD"})[0]; r.Trades != 3 || r.Volume != 6 || r.TradesPerSecond != 0.2 || r.VolumePerSecond != 0.2 {
+		t.Errorf("Unexpected report after a roll %+v", r)
+	}
+	s.roll()
+	if r := s.report([]string{"BTC-USD"})[0]; r.TradesPerSecond != 0.2 || r.VolumePerSecond != 0.8 || r.Interval != "5s" {
+		t.Errorf("Unexpected report after the second roll %+v", r)
+	}
+}
+
+func TestStatsRoute(t *testing.T) {
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	message := `{"type":"match","product_id":"BTC-USD","trade_id":1,"price":"100","size":"2"}`
+	pipeline.processMessage(context.Background(), []byte(message))
+	mux := http.NewServeMux()
+	addStatsRoutes(mux, pipeline)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	var reports []ThroughputReport
+	if err := json.NewDecoder(rec.Body).Decode(&reports); err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || reports[0].Trades != 1 || reports[0].Bytes != int64(len(message)) || reports[0].Volume != 2 {
+		t.Errorf("Unexpected stats %+v", reports)
+	}
+}
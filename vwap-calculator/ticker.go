@@ -0,0 +1,49 @@
+package main
+
+import "fmt"
+
+// Channels trades can be taken from, chosen with -trade-channel.
+const (
+	// channelMatches delivers every trade.
+	channelMatches = "matches"
+	// channelTicker delivers the last trade with each price update. It is
+	// lighter and more widely permitted, but may skip trades under load.
+	channelTicker = "ticker"
+	// channelFull delivers every order's lifecycle, matches included. Only
+	// the matches are used, so it suits connections that need the rest too.
+	channelFull = "full"
+)
+
+func parseTradeChannel(s string) (string, error) {
+	switch s {
+	case channelMatches, channelTicker, channelFull:
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid -trade-channel %q: must be %s, %s or %s", s, channelMatches, channelTicker, channelFull)
+}
+
+// isOrderMessage reports whether msgType is one of the full channel's order
+// messages, which carry no trade.
+func isOrderMessage(msgType string) bool {
+	switch msgType {
+	case "received", "open", "done", "change", "activate":
+		return true
+	}
+	return false
+}
+
+// SetTradeChannel makes the pipeline subscribe to channel for trades.
+func (p *Pipeline) SetTradeChannel(channel string) {
+	p.channel = channel
+}
+
+// tickerTrade turns a ticker message into the match it reports. A ticker's
+// price, trade_id and time are those of the last trade, whose size is in
+// last_size.
+func tickerTrade(trade Trade) Trade {
+	trade.Type = "match"
+	trade.Size, trade.LastSize = trade.LastSize, ""
+	// A ticker's side is the taker's, where a match's is the maker's.
+	trade.Side = makerSide(trade.Side)
+	return trade
+}
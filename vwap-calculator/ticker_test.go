@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPipelineTickerChannel(t *testing.T) {
+	store := NewStore()
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"), store)
+	pipeline.SetTradeChannel(channelTicker)
+	if got := pipeline.feedChannels(); !slices.Equal(got, []string{"ticker", "heartbeat"}) {
+		t.Errorf("Expected ticker and heartbeat channels, got %v", got)
+	}
+
+	ctx := context.Background()
+	pipeline.dispatchMessage(ctx, []byte(`{"type":"ticker","product_id":"BTC-USD","trade_id":10,"price":"100","last_size":"1","best_bid":"99","volume_24h":"5000"}`), nil)
+	// Trades 11 and 12 were not reported by the ticker.
+	pipeline.dispatchMessage(ctx, []byte(`{"type":"ticker","product_id":"BTC-USD","trade_id":13,"price":"200","last_size":"3"}`), nil)
+
+	update, _ := store.Get("BTC-USD")
+	if update.VWAP != "175.0000" || update.TradeCount != 2 {
+		t.Errorf("Expected VWAP 175.0000 over 2 trades, got %s over %d", update.VWAP, update.TradeCount)
+	}
+	if update.MissedTrades != 2 {
+		t.Errorf("Expected the 2 skipped trades to be counted, got %d", update.MissedTrades)
+	}
+}
+
+func TestPipelineFullChannel(t *testing.T) {
+	store := NewStore()
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"), store)
+	pipeline.SetTradeChannel(channelFull)
+	if got := pipeline.feedChannels(); !slices.Equal(got, []string{"full", "heartbeat"}) {
+		t.Errorf("Expected full and heartbeat channels, got %v", got)
+	}
+
+	doneBefore := testutil.ToFloat64(fullMessages.WithLabelValues("done"))
+	ctx := context.Background()
+	for _, message := range []string{
+		`{"type":"received","product_id":"BTC-USD","order_id":"a","size":"1","price":"100","side":"buy","order_type":"limit"}`,
+		`{"type":"open","product_id":"BTC-USD","order_id":"a","price":"100","remaining_size":"1","side":"buy"}`,
+		`{"type":"match","product_id":"BTC-USD","trade_id":1,"maker_order_id":"a","taker_order_id":"b","size":"1","price":"100","side":"buy"}`,
+		`{"type":"done","product_id":"BTC-USD","order_id":"a","price":"100","remaining_size":"0","reason":"filled","side":"buy"}`,
+		`{"type":"match","product_id":"BTC-USD","trade_id":2,"maker_order_id":"c","taker_order_id":"d","size":"3","price":"200","side":"sell"}`,
+	} {
+		pipeline.dispatchMessage(ctx, []byte(message), nil)
+	}
+
+	update, _ := store.Get("BTC-USD")
+	if update.VWAP != "175.0000" || update.TradeCount != 2 {
+		t.Errorf("Expected VWAP 175.0000 over the 2 matches, got %s over %d", update.VWAP, update.TradeCount)
+	}
+	if got := testutil.ToFloat64(fullMessages.WithLabelValues("done")) - doneBefore; got != 1 {
+		t.Errorf("Expected 1 done message counted, got %v", got)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata" // so -trading-hours zones resolve without system zoneinfo
+)
+
+// tradingHours is a daily session in a time zone. A session whose end is
+// before its start runs overnight.
+type tradingHours struct {
+	start, end time.Duration // offsets from local midnight
+	loc        *time.Location
+}
+
+// parseTradingHours parses a -trading-hours value, HH:MM-HH:MM[@ZONE] with
+// the zone defaulting to UTC. "" and "always" mean no session, and return
+// nil.
+func parseTradingHours(s string) (*tradingHours, error) {
+	if s == "" || s == "always" {
+		return nil, nil
+	}
+	window, zone, _ := strings.Cut(s, "@")
+	from, to, ok := strings.Cut(window, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid trading hours %q: want HH:MM-HH:MM[@ZONE]", s)
+	}
+	hours := &tradingHours{loc: time.UTC}
+	var err error
+	if hours.start, err = parseTimeOfDay(from); err != nil {
+		return nil, fmt.Errorf("invalid trading hours %q: %w", s, err)
+	}
+	if hours.end, err = parseTimeOfDay(to); err != nil {
+		return nil, fmt.Errorf("invalid trading hours %q: %w", s, err)
+	}
+	if hours.start == hours.end {
+		return nil, fmt.Errorf("invalid trading hours %q: session is empty", s)
+	}
+	if zone != "" {
+		if hours.loc, err = time.LoadLocation(zone); err != nil {
+			return nil, fmt.Errorf("invalid trading hours %q: %w", s, err)
+		}
+	}
+	return hours, nil
+}
+
+// parseTimeOfDay parses HH:MM, allowing 24:00 for the end of the day.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	if s == "24:00" {
+		return 24 * time.Hour, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// contains reports whether t falls within the session, start inclusive and
+// end exclusive.
+func (h *tradingHours) contains(t time.Time) bool {
+	local := t.In(h.loc)
+	offset := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute +
+		time.Duration(local.Second())*time.Second + time.Duration(local.Nanosecond())
+	if h.start < h.end {
+		return offset >= h.start && offset < h.end
+	}
+	return offset >= h.start || offset < h.end
+}
+
+// SetTradingHours limits the trades applied to productID's VWAP to those
+// within hours; nil lifts the limit. Trades outside the session still reach
+// the trade sinks.
+func (p *Pipeline) SetTradingHours(productID string, hours *tradingHours) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if hours == nil {
+		delete(p.sessions, productID)
+		return
+	}
+	p.sessions[productID] = hours
+}
+
+// offSession reports whether trade falls outside its product's trading
+// hours. Trades without a timestamp are judged by the time they arrive.
+func (p *Pipeline) offSession(logger Logger, trade Trade) bool {
+	p.mu.RLock()
+	hours, ok := p.sessions[trade.ProductID]
+	p.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	at := trade.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+	if hours.contains(at) {
+		return false
+	}
+	logger.Debugf("Passing through trade_id %d outside trading hours", trade.TradeID)
+	offSessionTrades.WithLabelValues(trade.ProductID).Inc()
+	return true
+}
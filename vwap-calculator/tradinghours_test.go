@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTradingHoursContains(t *testing.T) {
+	for _, tc := range []struct {
+		hours string
+		at    string
+		want  bool
+	}{
+		{"09:30-16:00@America/New_York", "2024-01-02T14:30:00Z", true}, // 09:30 EST
+		{"09:30-16:00@America/New_York", "2024-01-02T14:29:59Z", false},
+		{"09:30-16:00@America/New_York", "2024-01-02T21:00:00Z", false}, // 16:00 EST
+		{"09:30-16:00@America/New_York", "2024-07-02T13:30:00Z", true},  // 09:30 EDT
+		{"22:00-06:00", "2024-01-02T23:00:00Z", true},
+		{"22:00-06:00", "2024-01-02T05:59:00Z", true},
+		{"22:00-06:00", "2024-01-02T12:00:00Z", false},
+		{"00:00-24:00", "2024-01-02T23:59:59Z", true},
+	} {
+		hours, err := parseTradingHours(tc.hours)
+		if err != nil {
+			t.Fatalf("parseTradingHours(%q) returned error: %v", tc.hours, err)
+		}
+		at, _ := time.Parse(time.RFC3339, tc.at)
+		if got := hours.contains(at); got != tc.want {
+			t.Errorf("%s contains %s = %v, want %v", tc.hours, tc.at, got, tc.want)
+		}
+	}
+}
+
+type recordedTrades []Trade
+
+func (r *recordedTrades) RecordTrade(trade Trade) error {
+	*r = append(*r, trade)
+	return nil
+}
+
+func TestPipelineTradingHours(t *testing.T) {
+	store := NewStore()
+	pipeline := NewPipeline(map[string]Calculator{"SPY-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"), store)
+	hours, _ := parseTradingHours("09:30-16:00@America/New_York")
+	pipeline.SetTradingHours("SPY-USD", hours)
+	var trades recordedTrades
+	pipeline.AddTradeSink(&trades)
+	before := testutil.ToFloat64(offSessionTrades.WithLabelValues("SPY-USD"))
+
+	for _, msg := range []string{
+		`{"type":"match","product_id":"SPY-USD","trade_id":1,"price":"500","size":"1","time":"2024-01-02T14:00:00Z"}`, // pre-market
+		`{"type":"match","product_id":"SPY-USD","trade_id":2,"price":"400","size":"1","time":"2024-01-02T15:00:00Z"}`,
+		`{"type":"match","product_id":"SPY-USD","trade_id":3,"price":"410","size":"1","time":"2024-01-02T20:00:00Z"}`,
+		`{"type":"match","product_id":"SPY-USD","trade_id":4,"price":"300","size":"1","time":"2024-01-02T21:30:00Z"}`, // after hours
+	} {
+		pipeline.processMessage(context.Background(), []byte(msg))
+	}
+
+	update, _ := store.Get("SPY-USD")
+	if update.TradeCount != 2 || update.VWAP != "405.0000" {
+		t.Errorf("Expected VWAP 405.0000 over 2 session trades, got %s over %d", update.VWAP, update.TradeCount)
+	}
+	if len(trades) != 4 {
+		t.Errorf("Expected all 4 trades to reach the trade sink, got %d", len(trades))
+	}
+	if got := testutil.ToFloat64(offSessionTrades.WithLabelValues("SPY-USD")) - before; got != 2 {
+		t.Errorf("Expected 2 off-session trades, got %v", got)
+	}
+	if missed := pipeline.gaps.Missed("SPY-USD"); missed != 0 {
+		t.Errorf("Expected off-session trades to count as seen, got %d missed", missed)
+	}
+}
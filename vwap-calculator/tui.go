@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	// tuiRefresh is how often the dashboard is redrawn.
+	tuiRefresh = time.Second
+	// tuiRateWindow is the span trade rates are averaged over.
+	tuiRateWindow = 10 * time.Second
+	// tuiLogLines is how many recent log lines the dashboard shows.
+	tuiLogLines = 5
+)
+
+// ANSI sequences used to draw the dashboard on the terminal's alternate
+// screen, so the shell's scrollback is left as it was.
+const (
+	ansiEnterScreen = "\x1b[?1049h\x1b[?25l"
+	ansiLeaveScreen = "\x1b[?25h\x1b[?1049l"
+	ansiHome        = "\x1b[H"
+	ansiClearLine   = "\x1b[K"
+	ansiClearBelow  = "\x1b[J"
+)
+
+// TerminalDashboard renders a live table of products in place of the
+// scrolling stdout output. It is an OutputSink for updates and a TradeSink
+// for last prices; candles are not shown.
+type TerminalDashboard struct {
+	w    io.Writer
+	logs *logTail
+	now  func() time.Time
+
+	mu      sync.Mutex
+	rows    map[string]*dashboardRow
+	samples []rateSample // trade counts at recent redraws, oldest first
+}
+
+type dashboardRow struct {
+	vwap   string
+	last   string
+	trades int64
+	traded time.Time
+}
+
+type rateSample struct {
+	at     time.Time
+	trades map[string]int64
+}
+
+// NewTerminalDashboard draws to w, which should be a terminal.
+func NewTerminalDashboard(w io.Writer) *TerminalDashboard {
+	return &TerminalDashboard{w: w, logs: newLogTail(tuiLogLines, os.Stderr), now: time.Now, rows: make(map[string]*dashboardRow)}
+}
+
+// Logs returns a writer whose most recent lines are shown below the table,
+// for logs that would otherwise scroll the dashboard off the screen. Once the
+// dashboard stops, writes go to stderr again.
+func (d *TerminalDashboard) Logs() io.Writer {
+	return d.logs
+}
+
+func (d *TerminalDashboard) row(productID string) *dashboardRow {
+	row, ok := d.rows[productID]
+	if !ok {
+		row = &dashboardRow{}
+		d.rows[productID] = row
+	}
+	return row
+}
+
+func (d *TerminalDashboard) Publish(update VWAPUpdate) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.row(update.ProductID).vwap = update.VWAP
+	return nil
+}
+
+func (d *TerminalDashboard) PublishCandle(Candle) error {
+	return nil
+}
+
+func (d *TerminalDashboard) RecordTrade(trade Trade) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	row := d.row(trade.ProductID)
+	row.last = trade.Price
+	row.trades++
+	row.traded = d.now()
+	return nil
+}
+
+// Start switches the terminal to the dashboard and redraws it every
+// tuiRefresh. The returned stop function restores the terminal and replays
+// the last log lines to stderr.
+func (d *TerminalDashboard) Start(pipeline *Pipeline) (stop func()) {
+	io.WriteString(d.w, ansiEnterScreen)
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(tuiRefresh)
+		defer ticker.Stop()
+		for {
+			io.WriteString(d.w, ansiHome+d.render(pipeline)+ansiClearBelow)
+			select {
+			case <-ticker.C:
+			case <-quit:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(quit)
+		<-done
+		io.WriteString(d.w, ansiLeaveScreen)
+		d.logs.release()
+	}
+}
+
+// render returns one frame: a status line, the product table and the most
+// recent log lines. Every line clears what an older, longer frame left.
+func (d *TerminalDashboard) render(pipeline *Pipeline) string {
+	now := d.now()
+	d.mu.Lock()
+	rates := d.rates(now)
+	rows := make(map[string]dashboardRow, len(d.rows))
+	for productID, row := range d.rows {
+		rows[productID] = *row
+	}
+	d.mu.Unlock()
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s  feed: %s\n\n", now.Format(time.TimeOnly), feedStatus(pipeline.health, now))
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "PRODUCT\tVWAP\tLAST\tDEV\tTRADES/S\tTRADES\tLAST TRADE\n")
+	for _, productID := range slices.Sorted(maps.Keys(pipeline.Calculators())) {
+		row := rows[productID]
+		vwap := row.vwap
+		if vwap == "" {
+			vwap = "-"
+		}
+		last, age := "-", "-"
+		if row.last != "" {
+			last = row.last
+			age = now.Sub(row.traded).Round(time.Second).String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%.2f\t%d\t%s\n", productID, vwap, last, deviation(row.last, row.vwap), rates[productID], row.trades, age)
+	}
+	tw.Flush()
+	if lines := d.logs.lines(); len(lines) > 0 {
+		b.WriteByte('\n')
+		for _, line := range lines {
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	return strings.ReplaceAll(b.String(), "\n", ansiClearLine+"\n")
+}
+
+// rates records the current trade counts and returns each product's trades
+// per second since the oldest sample within tuiRateWindow. d.mu must be
+// held.
+func (d *TerminalDashboard) rates(now time.Time) map[string]float64 {
+	sample := rateSample{at: now, trades: make(map[string]int64, len(d.rows))}
+	for productID, row := range d.rows {
+		sample.trades[productID] = row.trades
+	}
+	d.samples = append(d.samples, sample)
+	for len(d.samples) > 1 && now.Sub(d.samples[0].at) > tuiRateWindow {
+		d.samples = d.samples[1:]
+	}
+	rates := make(map[string]float64, len(sample.trades))
+	oldest := d.samples[0]
+	elapsed := now.Sub(oldest.at).Seconds()
+	if elapsed <= 0 {
+		return rates
+	}
+	for productID, trades := range sample.trades {
+		rates[productID] = float64(trades-oldest.trades[productID]) / elapsed
+	}
+	return rates
+}
+
+// deviation formats how far last is from vwap, as a percentage of vwap.
+func deviation(last, vwap string) string {
+	l, err1 := strconv.ParseFloat(last, 64)
+	v, err2 := strconv.ParseFloat(vwap, 64)
+	if err1 != nil || err2 != nil || v == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%+.3f%%", (l-v)/v*100)
+}
+
+// feedStatus describes the websocket connection for the dashboard.
+func feedStatus(h *feedHealth, now time.Time) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.tracking {
+		return "n/a"
+	}
+	state := "disconnected"
+	if h.connected {
+		state = "connected"
+	}
+	return fmt.Sprintf("%s for %s, %d reconnects", state, now.Sub(h.changed).Round(time.Second), h.reconnects)
+}
+
+// logTail keeps the last lines written to it until released, after which it
+// replays them to out and passes later writes through.
+type logTail struct {
+	max int
+	out io.Writer
+
+	mu       sync.Mutex
+	kept     []string
+	partial  []byte
+	released bool
+}
+
+func newLogTail(max int, out io.Writer) *logTail {
+	return &logTail{max: max, out: out}
+}
+
+func (t *logTail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.released {
+		return t.out.Write(p)
+	}
+	t.partial = append(t.partial, p...)
+	for {
+		i := bytes.IndexByte(t.partial, '\n')
+		if i < 0 {
+			break
+		}
+		t.kept = append(t.kept, string(t.partial[:i]))
+		t.partial = t.partial[i+1:]
+	}
+	if len(t.kept) > t.max {
+		t.kept = slices.Clone(t.kept[len(t.kept)-t.max:])
+	}
+	return len(p), nil
+}
+
+func (t *logTail) lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return slices.Clone(t.kept)
+}
+
+func (t *logTail) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, line := range t.kept {
+		fmt.Fprintln(t.out, line)
+	}
+	t.out.Write(t.partial)
+	t.kept, t.partial, t.released = nil, nil, true
+}
+
+// isTerminal reports whether f is a character device, as a terminal is.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
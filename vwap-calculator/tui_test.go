@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTerminalDashboardRender(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator(), "ETH-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	pipeline.health.now = func() time.Time { return now }
+	pipeline.health.start()
+	pipeline.health.setConnected(true)
+
+	var stderr bytes.Buffer
+	d := NewTerminalDashboard(io.Discard)
+	d.logs.out = &stderr
+	d.now = func() time.Time { return now }
+	d.render(pipeline)
+
+	for _, price := range []string{"99", "101"} {
+		d.RecordTrade(Trade{ProductID: "BTC-USD", Price: price, Size: "1"})
+	}
+	d.Publish(VWAPUpdate{ProductID: "BTC-USD", VWAP: "100"})
+	io.WriteString(d.Logs(), "level=WARN msg=first\nlevel=WARN msg=")
+	now = now.Add(4 * time.Second)
+	frame := d.render(pipeline)
+
+	for _, want := range []string{
+		"03:04:09  feed: connected for 4s, 0 reconnects",
+		"BTC-USD  100   101   +1.000%  0.50      2       4s",
+		"ETH-USD  -     -     -        0.00      0       -",
+		"level=WARN msg=first",
+	} {
+		if !strings.Contains(frame, want) {
+			t.Errorf("Expected %q in frame:\n%s", want, frame)
+		}
+	}
+	if strings.Contains(frame, "msg=\n") || !strings.HasSuffix(frame, ansiClearLine+"\n") {
+		t.Errorf("Unexpected frame ending:\n%q", frame)
+	}
+
+	d.logs.release()
+	io.WriteString(d.Logs(), "second\n")
+	if got := stderr.String(); got != "level=WARN msg=first\nlevel=WARN msg=second\n" {
+		t.Errorf("Expected kept logs replayed to stderr, got %q", got)
+	}
+}
+
+func TestTerminalDashboardRates(t *testing.T) {
+	now := time.Unix(0, 0)
+	d := NewTerminalDashboard(io.Discard)
+	d.now = func() time.Time { return now }
+	for i := 0; i < 20; i++ {
+		d.rates(now)
+		d.RecordTrade(Trade{ProductID: "BTC-USD", Price: "1"})
+		now = now.Add(time.Second)
+	}
+	// Each second adds one trade, over a window trimmed to the last 10s.
+	if got := d.rates(now)["BTC-USD"]; got != 1 {
+		t.Errorf("Expected 1 trade/s, got %v", got)
+	}
+	if len(d.samples) > 12 {
+		t.Errorf("Expected old samples to be dropped, have %d", len(d.samples))
+	}
+}
+
+func TestParseFlagsTUI(t *testing.T) {
+	if _, err := parseFlags([]string{"-tui", "-output", "json"}); err == nil {
+		t.Error("Expected an error combining -tui with -output json")
+	}
+	cfg, err := parseFlags([]string{"-tui"})
+	if err != nil || !cfg.TUI {
+		t.Errorf("Expected -tui to be accepted, got %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// TWAPCalculator computes the time-weighted average price over a window of
+// recent trades. Each price is held until the next trade, so the result
+// is the average of that step function between the oldest and newest trade
+// in the window. Trade sizes are ignored.
+type TWAPCalculator struct {
+	mu     sync.Mutex
+	buffer RingBuffer // [price, unix nanos] pairs
+	// totalPT is the sum of price × time held for every trade but the newest.
+	totalPT    big.Rat
+	totalPrice big.Rat
+	last       big.Rat // time of the newest trade
+	priceRange windowRange
+	clock      tradeClock
+	formatted
+}
+
+func NewTWAPCalculator() *TWAPCalculator {
+	return NewWindowedTWAPCalculator(windowSize)
+}
+
+// NewWindowedTWAPCalculator returns a TWAPCalculator over the last size
+// trades.
+func NewWindowedTWAPCalculator(size int) *TWAPCalculator {
+	return &TWAPCalculator{buffer: NewRingBuffer(size), priceRange: windowRange{size: int64(size)}, clock: newTradeClock(size)}
+}
+
+func (c *TWAPCalculator) WindowSize() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buffer.size
+}
+
+func (c *TWAPCalculator) Update(priceStr, sizeStr string) error {
+	return c.UpdateAt(priceStr, sizeStr, time.Now())
+}
+
+func (c *TWAPCalculator) UpdateAt(priceStr, sizeStr string, at time.Time) error {
+	price, ok1 := new(big.Rat).SetString(priceStr)
+	size, ok2 := new(big.Rat).SetString(sizeStr)
+	if !ok1 || !ok2 || price.Sign() <= 0 || size.Sign() <= 0 {
+		return errors.New("invalid trade data: price and size must be positive rational numbers")
+	}
+	ts := new(big.Rat).SetInt64(at.UnixNano())
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.buffer.count > 0 {
+		// Out-of-order trades (from backfill or replay) are treated as
+		// simultaneous with the newest so no price is held for negative time.
+		if ts.Cmp(&c.last) < 0 {
+			ts.Set(&c.last)
+		}
+		newest := c.buffer.newest()
+		c.totalPT.Add(&c.totalPT, new(big.Rat).Mul(newest, new(big.Rat).Sub(ts, &c.last)))
+	}
+	oldPrice, oldTime, removed := c.buffer.Add(price, ts)
+	if removed {
+		// The evicted price was held until the time of the new oldest trade.
+		_, nextTime := c.buffer.oldest()
+		c.totalPT.Sub(&c.totalPT, new(big.Rat).Mul(oldPrice, new(big.Rat).Sub(nextTime, oldTime)))
+		c.totalPrice.Sub(&c.totalPrice, oldPrice)
+	}
+	c.totalPrice.Add(&c.totalPrice, price)
+	c.last.Set(ts)
+	c.priceRange.Add(price)
+	c.clock.add(at)
+	return nil
+}
+
+func (c *TWAPCalculator) Range() (high, low string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.priceRange.Range(c.Format())
+}
+
+func (c *TWAPCalculator) Calculate() string {
+	twap := c.CalculateRat()
+	if twap == nil {
+		return "0"
+	}
+	return c.formatRat(twap)
+}
+
+// CalculateRat returns the exact TWAP, or nil before the first trade.
+func (c *TWAPCalculator) CalculateRat() *big.Rat {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.buffer.count == 0 {
+		return nil
+	}
+	_, first := c.buffer.oldest()
+	span := new(big.Rat).Sub(&c.last, first)
+	if span.Sign() == 0 {
+		// Every trade in the window shares a timestamp; fall back to the
+		// plain mean.
+		return new(big.Rat).Quo(&c.totalPrice, big.NewRat(int64(c.buffer.count), 1))
+	}
+	return new(big.Rat).Quo(&c.totalPT, span)
+}
+
+func (c *TWAPCalculator) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buffer.reset()
+	c.totalPT.SetInt64(0)
+	c.totalPrice.SetInt64(0)
+	c.last.SetInt64(0)
+	c.priceRange = windowRange{size: int64(c.buffer.size)}
+	c.clock.reset()
+}
+
+func (c *TWAPCalculator) TradeCount() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clock.trades
+}
+
+// Stats leaves Volume empty: the TWAP does not track trade sizes.
+func (c *TWAPCalculator) Stats() CalculatorStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clock.stats("", "")
+}
+
+// oldest returns the first pair in the buffer. The buffer must not be empty.
+func (rb *RingBuffer) oldest() (a, b *big.Rat) {
+	return &rb.data[rb.start], &rb.data[rb.start+1]
+}
+
+// newest returns the first value of the most recent pair. The buffer must not
+// be empty.
+func (rb *RingBuffer) newest() *big.Rat {
+	return &rb.data[(rb.start+(rb.count-1)*2)%len(rb.data)]
+}
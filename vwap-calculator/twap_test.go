@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTWAPCalculator(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Empty", func(t *testing.T) {
+		if got := NewTWAPCalculator().Calculate(); got != "0" {
+			t.Errorf("Expected 0, got %s", got)
+		}
+	})
+
+	t.Run("WeightsByTimeHeld", func(t *testing.T) {
+		calc := NewTWAPCalculator()
+		// 100 for 3s, then 200 for 1s; the size of each trade is irrelevant.
+		calc.UpdateAt("100", "50", base)
+		calc.UpdateAt("200", "1", base.Add(3*time.Second))
+		calc.UpdateAt("400", "1", base.Add(4*time.Second))
+		if got := calc.Calculate(); got != "125.0000" {
+			t.Errorf("Expected 125.0000, got %s", got)
+		}
+	})
+
+	t.Run("SimultaneousTrades", func(t *testing.T) {
+		calc := NewTWAPCalculator()
+		calc.UpdateAt("100", "1", base)
+		calc.UpdateAt("200", "1", base)
+		// An earlier timestamp is clamped to the newest.
+		calc.UpdateAt("300", "1", base.Add(-time.Second))
+		if got := calc.Calculate(); got != "200.0000" {
+			t.Errorf("Expected mean 200.0000, got %s", got)
+		}
+	})
+
+	t.Run("WindowEviction", func(t *testing.T) {
+		calc := NewTWAPCalculator()
+		calc.UpdateAt("1000", "1", base)
+		for i := 1; i <= windowSize; i++ {
+			calc.UpdateAt(fmt.Sprint(100+i%2*100), "1", base.Add(time.Duration(i)*time.Second))
+		}
+		// The 1000 print has rolled out. Of the remaining trades, 100 at 200
+		// and 99 at 100 were each held for 1s; the newest hasn't been held.
+		if got := calc.Calculate(); got != "150.2513" {
+			t.Errorf("Expected 150.2513 after eviction, got %s", got)
+		}
+	})
+
+	t.Run("InvalidInput", func(t *testing.T) {
+		if err := NewTWAPCalculator().UpdateAt("-1", "1", base); err == nil {
+			t.Error("Expected error for negative price")
+		}
+	})
+}
+
+func TestNewCalculator(t *testing.T) {
+	for method, want := range map[string]string{"": "vwap", "vwap": "vwap", "twap": "twap", "ewvwap": "ewvwap"} {
+		calc, err := newCalculator(method, windowSize, time.Minute)
+		if err != nil || calculatorMethod(calc) != want {
+			t.Errorf("newCalculator(%q) = %T, %v", method, calc, err)
+		}
+	}
+	if _, err := newCalculator("median", windowSize, time.Minute); err == nil {
+		t.Error("Expected error for unknown method")
+	}
+	if _, err := newCalculator("ewvwap", windowSize, 0); err == nil {
+		t.Error("Expected error for ewvwap without a half-life")
+	}
+}
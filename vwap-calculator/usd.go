@@ -0,0 +1,86 @@
+package main
+
+import (
+	"math/big"
+	"strings"
+	"sync"
+)
+
+// USDConverter converts prices quoted in other currencies into USD using the
+// latest trade price of each currency's USD product, e.g. BTC-USD for
+// ETH-BTC.
+type USDConverter struct {
+	mu    sync.Mutex
+	rates map[string]*big.Rat
+}
+
+func NewUSDConverter() *USDConverter {
+	return &USDConverter{rates: make(map[string]*big.Rat)}
+}
+
+// Observe records trade's price as its base currency's USD rate if the
+// product is quoted in USD.
+func (c *USDConverter) Observe(trade Trade) {
+	base, quote, found := strings.Cut(trade.ProductID, "-")
+	if !found || quote != "USD" {
+		return
+	}
+	price, ok := new(big.Rat).SetString(trade.Price)
+	if !ok || price.Sign() <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rates[base] = price
+}
+
+// Rate returns the USD value of one unit of productID's quote currency, or
+// false until the currency has a USD price.
+func (c *USDConverter) Rate(productID string) (*big.Rat, bool) {
+	_, quote, found := strings.Cut(productID, "-")
+	if !found {
+		return nil, false
+	}
+	if quote == "USD" {
+		return big.NewRat(1, 1), true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rate, ok := c.rates[quote]
+	return rate, ok
+}
+
+// SetUSDConverter makes the pipeline report USD-notional values using usd.
+func (p *Pipeline) SetUSDConverter(usd *USDConverter) {
+	p.usd = usd
+}
+
+// normalizeUSD fills in update's USD fields for trade, once the product's
+// quote currency has a USD rate.
+func (p *Pipeline) normalizeUSD(update *VWAPUpdate, trade Trade, calculator Calculator) {
+	if p.usd == nil {
+		return
+	}
+	p.usd.Observe(trade)
+	rate, ok := p.usd.Rate(trade.ProductID)
+	if !ok {
+		return
+	}
+	price, ok1 := new(big.Rat).SetString(trade.Price)
+	size, ok2 := new(big.Rat).SetString(trade.Size)
+	if !ok1 || !ok2 {
+		return
+	}
+	format := formatOf(calculator)
+	notional := new(big.Rat).Mul(price, size)
+	notional.Mul(notional, rate)
+	update.USDNotional = format.rat(notional)
+	usdNotional, _ := notional.Float64()
+	notionalUSD.WithLabelValues(trade.ProductID).Add(usdNotional)
+
+	if rate.Cmp(big.NewRat(1, 1)) != 0 {
+		if vwap, ok := new(big.Rat).SetString(update.VWAP); ok {
+			update.USDVWAP = format.rat(vwap.Mul(vwap, rate))
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestUSDConverterRate(t *testing.T) {
+	usd := NewUSDConverter()
+	if rate, ok := usd.Rate("BTC-USD"); !ok || rate.RatString() != "1" {
+		t.Errorf("Expected USD products to have rate 1, got %v", rate)
+	}
+	if _, ok := usd.Rate("ETH-BTC"); ok {
+		t.Error("Expected no ETH-BTC rate before any BTC-USD trade")
+	}
+	usd.Observe(Trade{ProductID: "BTC-USD", Price: "45000"})
+	usd.Observe(Trade{ProductID: "ETH-BTC", Price: "0.07"})
+	if rate, ok := usd.Rate("ETH-BTC"); !ok || rate.RatString() != "45000" {
+		t.Errorf("Expected ETH-BTC rate 45000, got %v", rate)
+	}
+}
+
+func TestPipelineUSDNotional(t *testing.T) {
+	store := NewStore()
+	calculators := map[string]Calculator{"BTC-USD": NewVWAPCalculator(), "ETH-BTC": NewVWAPCalculator()}
+	pipeline := NewPipeline(calculators, NewLogger(io.Discard, slog.LevelInfo, "text"), store)
+	pipeline.SetUSDConverter(NewUSDConverter())
+
+	pipeline.processMessage(context.Background(), []byte(`{"type":"match","product_id":"ETH-BTC","trade_id":1,"price":"0.07","size":"2"}`))
+	if update, _ := store.Get("ETH-BTC"); update.USDNotional != "" || update.USDVWAP != "" {
+		t.Errorf("Expected no USD values before a BTC-USD price, got %+v", update)
+	}
+
+	pipeline.processMessage(context.Background(), []byte(`{"type":"match","product_id":"BTC-USD","trade_id":1,"price":"45000","size":"0.5"}`))
+	pipeline.processMessage(context.Background(), []byte(`{"type":"match","product_id":"ETH-BTC","trade_id":2,"price":"0.08","size":"1"}`))
+
+	if update, _ := store.Get("BTC-USD"); update.USDNotional != "22500.0000" || update.USDVWAP != "" {
+		t.Errorf("Unexpected BTC-USD USD values %q, %q", update.USDNotional, update.USDVWAP)
+	}
+	// The published VWAP 0.0733 is what gets converted: × 45000 = 3298.5.
+	if update, _ := store.Get("ETH-BTC"); update.USDNotional != "3600.0000" || update.USDVWAP != "3298.5000" {
+		t.Errorf("Unexpected ETH-BTC USD values %q, %q", update.USDNotional, update.USDVWAP)
+	}
+}
@@ -1,11 +1,22 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 func TestVWAPCalculator_EdgeCases(t *testing.T) {
@@ -122,3 +133,156 @@ func TestConcurrentUpdates(t *testing.T) {
 		t.Errorf("Invalid VWAP result: %f", result)
 	}
 }
+
+func TestVWAPCalculatorLockFreeReads(t *testing.T) {
+	calc := NewVWAPCalculator()
+	if got := calc.Calculate(); got != "0" {
+		t.Errorf("Expected 0 for an empty window, got %s", got)
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				if _, err := strconv.ParseFloat(calc.Calculate(), 64); err != nil {
+					t.Errorf("Read an unparseable VWAP: %v", err)
+					return
+				}
+			}
+		}
+	}()
+	for i := 0; i < 500; i++ {
+		calc.Update(fmt.Sprintf("%d.125", 100+i%7), "1")
+	}
+	close(stop)
+	wg.Wait()
+
+	// A format set after the last update still applies.
+	calc = NewVWAPCalculator()
+	calc.Update("100.125", "1")
+	calc.SetFormat(priceFormat{places: 2, rounding: roundTruncate})
+	if got := calc.Calculate(); got != "100.12" {
+		t.Errorf("Expected 100.12, got %s", got)
+	}
+}
+
+func TestPipelineSummary(t *testing.T) {
+	calculators := map[string]Calculator{
+		"BTC-USD": NewVWAPCalculator(),
+		"ETH-USD": NewVWAPCalculator(),
+	}
+	store := NewStore()
+	pipeline := NewPipeline(calculators, NewLogger(io.Discard, slog.LevelInfo, "text"), store)
+
+	for _, msg := range []string{
+		`{"type":"match","product_id":"BTC-USD","price":"100","size":"1"}`,
+		`{"type":"match","product_id":"BTC-USD","price":"200","size":"3"}`,
+		`{"type":"match","product_id":"BTC-USD","trade_id":7,"price":"300","size":"1"}`,
+		`{"type":"match","product_id":"BTC-USD","trade_id":7,"price":"300","size":"1"}`,
+		`{"type":"heartbeat","product_id":"BTC-USD"}`,
+		`not json`,
+	} {
+		pipeline.processMessage(context.Background(), []byte(msg))
+	}
+
+	if update, ok := store.Get("BTC-USD"); !ok || update.VWAP != "200.0000" || update.TradeCount != 3 {
+		t.Errorf("Unexpected update: %+v", update)
+	}
+
+	var buf bytes.Buffer
+	pipeline.counts.now = func() time.Time { return pipeline.counts.start.Add(90 * time.Second) }
+	pipeline.WriteSummary(&buf)
+	expected := "BTC-USD final VWAP: 200.0000 (3 trades, volume 5, duplicate=1)\n" +
+		"ETH-USD final VWAP: 0 (0 trades, volume 0)\n" +
+		"Ran for 1m30s: 1 malformed messages, 0 reconnects\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+}
+
+// dialTestFeed starts a websocket server running serve for each connection
+// and returns a client connection to it.
+func dialTestFeed(t *testing.T, serve func(conn *websocket.Conn)) *websocket.Conn {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		serve(conn)
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	return conn
+}
+
+func TestHandleConnectionCancel(t *testing.T) {
+	conn := dialTestFeed(t, func(conn *websocket.Conn) {
+		var sub map[string]interface{}
+		if err := conn.ReadJSON(&sub); err != nil {
+			return
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"match","product_id":"BTC-USD","price":"100","size":"1"}`))
+		// Echo the client's close frame, as the exchange would.
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	store := NewStore()
+	logger := NewLogger(io.Discard, slog.LevelInfo, "text")
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, logger, store)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- handleConnection(ctx, conn, &Config{}, pipeline, logger) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for _, ok := store.Get("BTC-USD"); !ok; _, ok = store.Get("BTC-USD") {
+		if time.Now().After(deadline) {
+			t.Fatal("Trade was never processed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("handleConnection did not return after cancellation")
+	}
+}
+
+func TestHandleConnectionStaleFeed(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	conn := dialTestFeed(t, func(conn *websocket.Conn) {
+		var sub map[string]interface{}
+		conn.ReadJSON(&sub)
+		<-release
+	})
+
+	logger := NewLogger(io.Discard, slog.LevelInfo, "text")
+	pipeline := NewPipeline(map[string]Calculator{}, logger)
+	err := handleConnection(context.Background(), conn, &Config{StaleTimeout: 100 * time.Millisecond}, pipeline, logger)
+	if !errors.Is(err, errStaleFeed) {
+		t.Errorf("Expected errStaleFeed, got %v", err)
+	}
+}
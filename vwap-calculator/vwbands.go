@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DeviationCalculator is implemented by calculators that track the
+// volume-weighted standard deviation of price around their VWAP.
+type DeviationCalculator interface {
+	// Deviation returns the VWAP and standard deviation, or false when the
+	// window is empty.
+	Deviation() (vwap, stddev *big.Float, ok bool)
+}
+
+// Band is a pair of prices k standard deviations either side of VWAP.
+type Band struct {
+	K     float64 `json:"k"`
+	Upper string  `json:"upper"`
+	Lower string  `json:"lower"`
+}
+
+// Deviation computes sqrt(Σvp²/Σv - VWAP²) from exact running sums.
+func (v *VWAPCalculator) Deviation() (vwap, stddev *big.Float, ok bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.totalVolume.Sign() == 0 {
+		return nil, nil, false
+	}
+	mean := new(big.Rat).Quo(&v.totalPV, &v.totalVolume)
+	variance := new(big.Rat).Quo(&v.totalPV2, &v.totalVolume)
+	variance.Sub(variance, new(big.Rat).Mul(mean, mean))
+	return new(big.Float).SetRat(mean), sqrtRat(variance), true
+}
+
+// SetBands makes every update from a DeviationCalculator carry bands at each
+// multiple in ks.
+func (p *Pipeline) SetBands(ks []float64) {
+	p.bands = ks
+}
+
+// deviationBands renders the standard deviation and configured bands.
+func (p *Pipeline) deviationBands(calculator Calculator) (string, []Band) {
+	dev, ok := calculator.(DeviationCalculator)
+	if !ok {
+		return "", nil
+	}
+	vwap, stddev, ok := dev.Deviation()
+	if !ok {
+		return "", nil
+	}
+	format := formatOf(calculator)
+	bands := make([]Band, 0, len(p.bands))
+	for _, k := range p.bands {
+		width := new(big.Float).Mul(big.NewFloat(k), stddev)
+		bands = append(bands, Band{
+			K:     k,
+			Upper: format.float(new(big.Float).Add(vwap, width)),
+			Lower: format.float(new(big.Float).Sub(vwap, width)),
+		})
+	}
+	return format.float(stddev), bands
+}
+
+// sqrtRat returns the square root of a non-negative rational.
+func sqrtRat(r *big.Rat) *big.Float {
+	return new(big.Float).SetPrec(128).Sqrt(new(big.Float).SetPrec(128).SetRat(r))
+}
+
+// floatList is a flag holding a comma-separated list of positive numbers.
+type floatList []float64
+
+func (l *floatList) String() string {
+	parts := make([]string, len(*l))
+	for i, f := range *l {
+		parts[i] = strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *floatList) Set(s string) error {
+	*l = nil
+	for _, part := range strings.Split(s, ",") {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || f <= 0 {
+			return fmt.Errorf("invalid multiple %q: must be a positive number", part)
+		}
+		*l = append(*l, f)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"reflect"
+	"testing"
+)
+
+func TestVWAPCalculatorDeviation(t *testing.T) {
+	calc := NewVWAPCalculator()
+	if _, _, ok := calc.Deviation(); ok {
+		t.Error("Expected no deviation for an empty window")
+	}
+	// VWAP = (90*1 + 100*2 + 110*1) / 4 = 100; variance = (100+0+100)/4 = 50.
+	calc.Update("90", "1")
+	calc.Update("100", "2")
+	calc.Update("110", "1")
+	vwap, stddev, _ := calc.Deviation()
+	if vwap.Text('f', 4) != "100.0000" || stddev.Text('f', 4) != "7.0711" {
+		t.Errorf("Expected 100.0000 ± 7.0711, got %s ± %s", vwap.Text('f', 4), stddev.Text('f', 4))
+	}
+
+	for i := 0; i < windowSize; i++ {
+		calc.Update("100", "1")
+	}
+	if _, stddev, _ := calc.Deviation(); stddev.Sign() != 0 {
+		t.Errorf("Expected zero deviation once the spread-out trades roll out, got %s", stddev.Text('g', 10))
+	}
+}
+
+func TestPipelineBands(t *testing.T) {
+	store := NewStore()
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"), store)
+	pipeline.SetBands([]float64{1, 2})
+	pipeline.processMessage(context.Background(), []byte(`{"type":"match","product_id":"BTC-USD","trade_id":1,"price":"90","size":"1"}`))
+	pipeline.processMessage(context.Background(), []byte(`{"type":"match","product_id":"BTC-USD","trade_id":2,"price":"110","size":"1"}`))
+
+	update, _ := store.Get("BTC-USD")
+	expected := []Band{{K: 1, Upper: "110.0000", Lower: "90.0000"}, {K: 2, Upper: "120.0000", Lower: "80.0000"}}
+	if update.StdDev != "10.0000" || !reflect.DeepEqual(update.Bands, expected) {
+		t.Errorf("Unexpected deviation %s and bands %+v", update.StdDev, update.Bands)
+	}
+}
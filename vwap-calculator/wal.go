@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// TradeLog is a write-ahead log of accepted trades, one JSON match message
+// per line, so windows survive a crash between snapshots. Each trade is
+// written before it is applied. Only the last keep trades of each product
+// are needed to rebuild its window, so the file is compacted to those once
+// it has grown to twice their number.
+type TradeLog struct {
+	path   string
+	keep   int
+	logger Logger
+
+	mu       sync.Mutex
+	f        *os.File
+	tails    map[string][][]byte // each product's last keep lines, oldest first
+	retained int                 // lines across tails
+	written  int                 // lines in the file
+}
+
+// OpenTradeLog opens or creates the log at path and returns the trades it
+// holds for each product, oldest first, for replaying into the calculators.
+// A line torn by a crash is skipped.
+func OpenTradeLog(path string, keep int, logger Logger) (*TradeLog, map[string][]Trade, error) {
+	l := &TradeLog{path: path, keep: keep, logger: logger, tails: make(map[string][][]byte)}
+	f, err := os.Open(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, nil, fmt.Errorf("opening trade log: %w", err)
+	default:
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+		skipped := 0
+		for scanner.Scan() {
+			var trade Trade
+			if err := json.Unmarshal(scanner.Bytes(), &trade); err != nil || trade.ProductID == "" {
+				skipped++
+				continue
+			}
+			l.add(trade.ProductID, slices.Clone(scanner.Bytes()))
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, nil, fmt.Errorf("reading trade log: %w", err)
+		}
+		if skipped > 0 {
+			logger.Warnf("Skipped %d unreadable lines in trade log %s", skipped, path)
+		}
+	}
+
+	trades := make(map[string][]Trade, len(l.tails))
+	for productID, lines := range l.tails {
+		for _, line := range lines {
+			var trade Trade
+			json.Unmarshal(line, &trade)
+			trades[productID] = append(trades[productID], trade)
+		}
+	}
+	if err := l.compact(); err != nil {
+		return nil, nil, err
+	}
+	return l, trades, nil
+}
+
+// Append writes trade to the log. The write reaches the operating system
+// before Append returns, so it survives the process crashing, but it is not
+// synced to disk.
+func (l *TradeLog) Append(trade Trade) error {
+	line, err := json.Marshal(trade)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	l.written++
+	l.add(trade.ProductID, line)
+	if l.written >= 2*max(l.retained, l.keep) {
+		return l.compact()
+	}
+	return nil
+}
+
+func (l *TradeLog) add(productID string, line []byte) {
+	lines := append(l.tails[productID], line)
+	if len(lines) > l.keep {
+		lines = lines[1:]
+	} else {
+		l.retained++
+	}
+	l.tails[productID] = lines
+}
+
+// Keep raises how many trades of each product the log retains to n, for a
+// window grown at runtime. It never lowers it: trades kept beyond a window
+// that shrank do no harm on replay.
+func (l *TradeLog) Keep(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.keep = max(l.keep, n)
+}
+
+// Forget drops productID's trades from the log at its next compaction, so a
+// product removed at runtime is not restored.
+func (l *TradeLog) Forget(productID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.retained -= len(l.tails[productID])
+	delete(l.tails, productID)
+}
+
+// compact atomically replaces the file with the retained lines and reopens
+// it for appending. Callers hold mu, or own l before it is shared.
+func (l *TradeLog) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("compacting trade log: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	for _, productID := range slices.Sorted(maps.Keys(l.tails)) {
+		for _, line := range l.tails[productID] {
+			w.Write(line)
+			w.WriteByte('\n')
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("compacting trade log: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("compacting trade log: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), l.path); err != nil {
+		return fmt.Errorf("compacting trade log: %w", err)
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("compacting trade log: %w", err)
+	}
+	if l.f != nil {
+		l.f.Close()
+	}
+	l.f, l.written = f, l.retained
+	return nil
+}
+
+func (l *TradeLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// SetTradeLog writes every trade to log before it is applied to the
+// calculators.
+func (p *Pipeline) SetTradeLog(log *TradeLog) {
+	p.wal = log
+}
+
+// ReplayTradeLog rebuilds the windows of the products in trades from the
+// log, replacing any state restored from a snapshot, and returns the
+// products it replayed. Replayed trades reach the calculators, indicators
+// and duplicate filter, but no sinks: they were published before the crash.
+func (p *Pipeline) ReplayTradeLog(trades map[string][]Trade, logger Logger) map[string]bool {
+	replayed := make(map[string]bool)
+	for productID, productTrades := range trades {
+		calculator, list, ok := p.calculator(productID)
+		if !ok {
+			logger.Warnf("Ignoring trade log entries for unconfigured product %s", productID)
+			continue
+		}
+		p.ResetProduct(productID)
+		for _, trade := range productTrades {
+			p.dedupe.Seen(productID, trade.TradeID)
+			if err := updateCalculator(calculator, trade); err != nil {
+				logger.With("product", productID).Warnf("Replaying trade_id %d failed: %v", trade.TradeID, err)
+				continue
+			}
+			for _, ind := range list {
+				updateCalculator(ind.calculator, trade)
+			}
+		}
+		replayed[productID] = true
+	}
+	if len(replayed) > 0 {
+		logger.Infof("Replayed the trade log for %d products", len(replayed))
+	}
+	return replayed
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTradeLogReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trades.wal")
+	logger := NewLogger(io.Discard, slog.LevelInfo, "text")
+	wal, trades, err := OpenTradeLog(path, 3, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trades) != 0 {
+		t.Errorf("Expected no trades in a new log, got %v", trades)
+	}
+	ts := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	for i := int64(1); i <= 5; i++ {
+		wal.Append(Trade{ProductID: "BTC-USD", TradeID: i, Price: "45000", Size: "1", Time: ts})
+	}
+	wal.Append(Trade{ProductID: "ETH-USD", TradeID: 1, Price: "3000", Size: "1", Time: ts})
+	wal.Close()
+
+	// A crash can leave the last line half written.
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	f.WriteString(`{"type":"match","product_id":"BTC-USD","trade_id":6,"pri`)
+	f.Close()
+
+	wal, trades, err = OpenTradeLog(path, 3, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	var ids []int64
+	for _, trade := range trades["BTC-USD"] {
+		ids = append(ids, trade.TradeID)
+	}
+	if len(ids) != 3 || ids[0] != 3 || ids[2] != 5 {
+		t.Errorf("Expected the last 3 BTC-USD trades, got %v", ids)
+	}
+	if len(trades["ETH-USD"]) != 1 || trades["ETH-USD"][0].Price != "3000" {
+		t.Errorf("Unexpected ETH-USD trades %v", trades["ETH-USD"])
+	}
+	data, _ := os.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines != 4 {
+		t.Errorf("Expected the log compacted to 4 lines on open, got %d", lines)
+	}
+}
+
+func TestTradeLogCompacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trades.wal")
+	wal, _, err := OpenTradeLog(path, 10, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	for i := int64(1); i <= 1000; i++ {
+		if err := wal.Append(Trade{ProductID: "BTC-USD", TradeID: i, Price: "45000", Size: "1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, _ := os.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines > 20 {
+		t.Errorf("Expected at most 20 lines after compaction, got %d", lines)
+	}
+
+	wal.Forget("BTC-USD")
+	for i := int64(1); i <= 20; i++ {
+		wal.Append(Trade{ProductID: "ETH-USD", TradeID: i, Price: "3000", Size: "1"})
+	}
+	data, _ = os.ReadFile(path)
+	if strings.Contains(string(data), "BTC-USD") {
+		t.Error("Expected a forgotten product to be dropped at compaction")
+	}
+}
+
+func TestPipelineReplaysTradeLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trades.wal")
+	logger := NewLogger(io.Discard, slog.LevelInfo, "text")
+	wal, _, err := OpenTradeLog(path, windowSize, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, logger)
+	pipeline.SetTradeLog(wal)
+	for _, msg := range []string{
+		`{"type":"match","product_id":"BTC-USD","trade_id":1,"price":"100","size":"1","time":"2024-01-01T10:00:00Z"}`,
+		`{"type":"match","product_id":"BTC-USD","trade_id":2,"price":"200","size":"3","time":"2024-01-01T10:00:01Z"}`,
+		`{"type":"match","product_id":"BTC-USD","trade_id":3,"price":"-5","size":"1","time":"2024-01-01T10:00:02Z"}`,
+	} {
+		pipeline.processMessage(context.Background(), []byte(msg))
+	}
+	wal.Close() // the process crashes before any snapshot
+
+	wal, trades, err := OpenTradeLog(path, windowSize, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	if n := len(trades["BTC-USD"]); n != 2 {
+		t.Errorf("Expected only the 2 valid trades in the log, got %d", n)
+	}
+	store := NewStore()
+	restarted := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, logger, store)
+	if replayed := restarted.ReplayTradeLog(trades, logger); !replayed["BTC-USD"] {
+		t.Fatalf("Expected BTC-USD to be replayed, got %v", replayed)
+	}
+	calculator, _, _ := restarted.calculator("BTC-USD")
+	if vwap := calculator.Calculate(); vwap != "175.0000" {
+		t.Errorf("Expected replayed VWAP 175.0000, got %s", vwap)
+	}
+	if _, ok := store.Get("BTC-USD"); ok {
+		t.Error("Expected replayed trades not to be published")
+	}
+
+	restarted.processMessage(context.Background(), []byte(`{"type":"match","product_id":"BTC-USD","trade_id":2,"price":"200","size":"3","time":"2024-01-01T10:00:01Z"}`))
+	if count := calculator.TradeCount(); count != 2 {
+		t.Errorf("Expected a redelivered trade to be dropped as a duplicate, got %d trades", count)
+	}
+}
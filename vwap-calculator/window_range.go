@@ -0,0 +1,52 @@
+package main
+
+import "math/big"
+
+// RangeCalculator is implemented by calculators that track the highest and
+// lowest trade price in their window.
+type RangeCalculator interface {
+	Range() (high, low string)
+}
+
+// windowRange tracks the maximum and minimum price over the last size
+// values added, using a monotonic deque for each so that every update is
+// amortised O(1) however prices roll out of the window.
+type windowRange struct {
+	size     int64
+	seq      int64
+	max, min []rangeEntry
+}
+
+type rangeEntry struct {
+	seq   int64
+	price *big.Rat
+}
+
+func (r *windowRange) Add(price *big.Rat) {
+	r.seq++
+	entry := rangeEntry{seq: r.seq, price: price}
+	r.max = pushMonotonic(r.max, entry, r.seq-r.size, func(c int) bool { return c <= 0 })
+	r.min = pushMonotonic(r.min, entry, r.seq-r.size, func(c int) bool { return c >= 0 })
+}
+
+// pushMonotonic appends entry after dropping every back element it
+// dominates, then drops front elements with seq <= expired.
+func pushMonotonic(deque []rangeEntry, entry rangeEntry, expired int64, dominated func(cmp int) bool) []rangeEntry {
+	for len(deque) > 0 && dominated(deque[len(deque)-1].price.Cmp(entry.price)) {
+		deque = deque[:len(deque)-1]
+	}
+	deque = append(deque, entry)
+	for deque[0].seq <= expired {
+		deque = deque[1:]
+	}
+	return deque
+}
+
+// Range returns the window's high and low rendered with format, or "0"s when
+// empty.
+func (r *windowRange) Range(format priceFormat) (high, low string) {
+	if len(r.max) == 0 {
+		return "0", "0"
+	}
+	return format.rat(r.max[0].price), format.rat(r.min[0].price)
+}
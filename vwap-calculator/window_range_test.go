@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestWindowRangeMatchesBruteForce(t *testing.T) {
+	r := windowRange{size: 5}
+	rng := rand.New(rand.NewPCG(1, 2))
+	var prices []int
+	for i := 0; i < 500; i++ {
+		p := rng.IntN(20) + 1
+		prices = append(prices, p)
+		r.Add(big.NewRat(int64(p), 1))
+
+		window := prices[max(0, len(prices)-5):]
+		hi, lo := window[0], window[0]
+		for _, p := range window {
+			hi, lo = max(hi, p), min(lo, p)
+		}
+		high, low := r.Range(defaultPriceFormat)
+		if high != fmt.Sprintf("%d.0000", hi) || low != fmt.Sprintf("%d.0000", lo) {
+			t.Fatalf("After %v: expected %d/%d, got %s/%s", window, hi, lo, high, low)
+		}
+	}
+	if len(r.max) > 5 || len(r.min) > 5 {
+		t.Errorf("Deques outgrew the window: %d, %d", len(r.max), len(r.min))
+	}
+}
+
+func TestVWAPCalculatorRange(t *testing.T) {
+	calc := NewVWAPCalculator()
+	if high, low := calc.Range(); high != "0" || low != "0" {
+		t.Errorf("Expected 0/0 when empty, got %s/%s", high, low)
+	}
+	calc.Update("1000", "1")
+	for i := 0; i < windowSize; i++ {
+		calc.Update(fmt.Sprint(100+i%7), "1")
+	}
+	if high, low := calc.Range(); high != "106.0000" || low != "100.0000" {
+		t.Errorf("Expected the evicted 1000 print to leave the range, got %s/%s", high, low)
+	}
+
+	restored := NewVWAPCalculator()
+	if err := restored.Restore(calc.Snapshot()); err != nil {
+		t.Fatal(err)
+	}
+	if high, low := restored.Range(); high != "106.0000" || low != "100.0000" {
+		t.Errorf("Expected the range to survive a snapshot, got %s/%s", high, low)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TimeWindowVWAPCalculator computes VWAP over the trades in the last period
+// of exchange time, measured back from the newest trade.
+type TimeWindowVWAPCalculator struct {
+	period time.Duration
+
+	mu          sync.Mutex
+	trades      []timedTrade // oldest first
+	newest      time.Time
+	totalPV     big.Rat
+	totalVolume big.Rat
+	clock       tradeClock
+	formatted
+}
+
+type timedTrade struct {
+	at       time.Time
+	pv, size *big.Rat
+}
+
+func NewTimeWindowVWAPCalculator(period time.Duration) *TimeWindowVWAPCalculator {
+	return &TimeWindowVWAPCalculator{period: period}
+}
+
+func (c *TimeWindowVWAPCalculator) Update(priceStr, sizeStr string) error {
+	return c.UpdateAt(priceStr, sizeStr, time.Now())
+}
+
+func (c *TimeWindowVWAPCalculator) UpdateAt(priceStr, sizeStr string, at time.Time) error {
+	price, err := parsePrice(priceStr, sizeStr)
+	if err != nil {
+		return err
+	}
+	size, _ := new(big.Rat).SetString(sizeStr)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Late trades join the window as if they arrived with the newest, so
+	// the slice stays ordered for eviction.
+	if at.After(c.newest) {
+		c.newest = at
+	}
+	pv := new(big.Rat).Mul(price, size)
+	c.trades = append(c.trades, timedTrade{at: c.newest, pv: pv, size: size})
+	c.totalPV.Add(&c.totalPV, pv)
+	c.totalVolume.Add(&c.totalVolume, size)
+
+	cutoff := c.newest.Add(-c.period)
+	n := 0
+	for ; !c.trades[n].at.After(cutoff); n++ {
+		c.totalPV.Sub(&c.totalPV, c.trades[n].pv)
+		c.totalVolume.Sub(&c.totalVolume, c.trades[n].size)
+	}
+	c.trades = c.trades[n:]
+	c.clock.add(at)
+	return nil
+}
+
+func (c *TimeWindowVWAPCalculator) Calculate() string {
+	vwap := c.CalculateRat()
+	if vwap == nil {
+		return "0"
+	}
+	return c.formatRat(vwap)
+}
+
+// CalculateRat returns the exact VWAP, or nil before the first trade.
+func (c *TimeWindowVWAPCalculator) CalculateRat() *big.Rat {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.totalVolume.Sign() == 0 {
+		return nil
+	}
+	return new(big.Rat).Quo(&c.totalPV, &c.totalVolume)
+}
+
+func (c *TimeWindowVWAPCalculator) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.trades = nil
+	c.newest = time.Time{}
+	c.totalPV.SetInt64(0)
+	c.totalVolume.SetInt64(0)
+	c.clock.reset()
+}
+
+func (c *TimeWindowVWAPCalculator) TradeCount() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clock.trades
+}
+
+func (c *TimeWindowVWAPCalculator) Stats() CalculatorStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.clock.stats(volumeString(&c.totalVolume), volumeString(&c.totalPV))
+	if len(c.trades) > 0 {
+		stats.WindowSpan = c.newest.Sub(c.trades[0].at)
+	}
+	return stats
+}
+
+// windowSpec is an extra VWAP window: either a trade count or a period.
+type windowSpec struct {
+	trades int
+	period time.Duration
+}
+
+func (w windowSpec) label() string {
+	if w.trades > 0 {
+		return "vwap_" + strconv.Itoa(w.trades)
+	}
+	return "vwap_" + formatInterval(w.period)
+}
+
+func (w windowSpec) calculator() Calculator {
+	if w.trades > 0 {
+		return NewWindowedVWAPCalculator(w.trades)
+	}
+	return NewTimeWindowVWAPCalculator(w.period)
+}
+
+// windowList is a flag holding comma-separated window specs such as
+// "1000,5m".
+type windowList []windowSpec
+
+func (l *windowList) String() string {
+	parts := make([]string, len(*l))
+	for i, w := range *l {
+		parts[i] = strings.TrimPrefix(w.label(), "vwap_")
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *windowList) Set(s string) error {
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if n, err := strconv.Atoi(part); err == nil && n > 0 {
+			*l = append(*l, windowSpec{trades: n})
+			continue
+		}
+		if d, err := time.ParseDuration(part); err == nil && d > 0 {
+			*l = append(*l, windowSpec{period: d})
+			continue
+		}
+		return fmt.Errorf("invalid window %q: use a trade count such as 1000 or a duration such as 5m", part)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeWindowVWAPCalculator(t *testing.T) {
+	calc := NewTimeWindowVWAPCalculator(time.Minute)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	calc.UpdateAt("100", "1", base)
+	calc.UpdateAt("200", "1", base.Add(30*time.Second))
+	if got := calc.Calculate(); got != "150.0000" {
+		t.Errorf("Expected 150.0000, got %s", got)
+	}
+	calc.UpdateAt("400", "2", base.Add(time.Minute))
+	if got := calc.Calculate(); got != "333.3333" {
+		t.Errorf("Expected the trade a full minute old to leave the window, got %s", got)
+	}
+	calc.UpdateAt("10", "1", base.Add(5*time.Minute))
+	if got := calc.Calculate(); got != "10.0000" {
+		t.Errorf("Expected only the newest trade, got %s", got)
+	}
+}
+
+func TestWindowList(t *testing.T) {
+	var windows windowList
+	if err := windows.Set("1000, 5m"); err != nil {
+		t.Fatal(err)
+	}
+	if len(windows) != 2 || windows[0].label() != "vwap_1000" || windows[1].label() != "vwap_5m" {
+		t.Errorf("Unexpected windows %+v", windows)
+	}
+	if _, ok := windows[0].calculator().(*VWAPCalculator); !ok {
+		t.Error("Expected a trade-count window to use VWAPCalculator")
+	}
+	if windows.String() != "1000,5m" {
+		t.Errorf("Unexpected String %q", windows.String())
+	}
+	if err := windows.Set("-3"); err == nil {
+		t.Error("Expected error for a negative window")
+	}
+}
+
+func TestWindowedVWAPCalculator(t *testing.T) {
+	calc := NewWindowedVWAPCalculator(2)
+	calc.Update("100", "1")
+	calc.Update("200", "1")
+	calc.Update("400", "2")
+	if got := calc.Calculate(); got != "333.3333" {
+		t.Errorf("Expected a 2-trade window, got %s", got)
+	}
+}
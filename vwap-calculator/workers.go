@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// productWorkers processes each product's trades on its own goroutine, so a
+// slow calculator or sink for one product does not hold up the others.
+// Trades for the same product are still processed in order.
+type productWorkers struct {
+	mu        sync.RWMutex // guards queues and controls
+	queues    map[string]chan workItem
+	controls  map[string]chan func() // run on the worker between trades
+	queueSize int
+	policy    string
+	reorder   time.Duration
+	wg        sync.WaitGroup
+}
+
+type workItem struct {
+	ctx   context.Context
+	trade Trade
+	done  func()
+}
+
+// StartWorkers starts one worker per product, each with a queue of queueSize
+// trades that fills according to the backpressure policy. Until the returned
+// stop function is called, dispatched trades are processed asynchronously;
+// stop waits for every queued trade to finish.
+func (p *Pipeline) StartWorkers(queueSize int, policy string) (stop func()) {
+	calculators := p.Calculators()
+	w := &productWorkers{queues: make(map[string]chan workItem, len(calculators)), controls: make(map[string]chan func(), len(calculators)), queueSize: queueSize, policy: policy, reorder: p.reorder}
+	for productID := range calculators {
+		w.start(p, productID)
+	}
+	p.workers.Store(w)
+	return func() {
+		p.workers.Store(nil)
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		for productID, queue := range w.queues {
+			close(queue)
+			delete(w.queues, productID)
+			delete(w.controls, productID)
+		}
+		w.wg.Wait()
+	}
+}
+
+// start runs a worker for productID. w.mu must be held, or w not yet shared.
+func (w *productWorkers) start(p *Pipeline, productID string) {
+	queue, control := make(chan workItem, w.queueSize), make(chan func())
+	w.queues[productID] = queue
+	w.controls[productID] = control
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		if w.reorder > 0 {
+			w.runReordered(p, queue, control)
+			return
+		}
+		for {
+			select {
+			case item, ok := <-queue:
+				if !ok {
+					return
+				}
+				p.processItem(item)
+			case fn := <-control:
+				fn()
+			}
+		}
+	}()
+}
+
+func (p *Pipeline) processItem(item workItem) {
+	p.processTrade(item.ctx, item.trade)
+	if item.done != nil {
+		item.done()
+	}
+}
+
+// add starts a worker for a product added at runtime.
+func (w *productWorkers) add(p *Pipeline, productID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.queues[productID]; !ok {
+		w.start(p, productID)
+	}
+}
+
+// remove stops productID's worker once its queued trades are processed.
+func (w *productWorkers) remove(productID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if queue, ok := w.queues[productID]; ok {
+		close(queue)
+		delete(w.queues, productID)
+		delete(w.controls, productID)
+	}
+}
+
+// dispatch hands trade to its product's worker, or processes it directly when
+// workers aren't running or the product has none. done, if not nil, is
+// called once the trade has been processed or dropped by backpressure.
+func (p *Pipeline) dispatch(ctx context.Context, trade Trade, done func()) {
+	if w := p.workers.Load(); w != nil {
+		w.mu.RLock()
+		queue, ok := w.queues[trade.ProductID]
+		if ok {
+			enqueue(queue, workItem{ctx: ctx, trade: trade, done: done}, w.policy, nil, func(old workItem) {
+				backpressureDrops.WithLabelValues(old.trade.ProductID).Inc()
+				if old.done != nil {
+					old.done()
+				}
+			})
+		}
+		w.mu.RUnlock()
+		if ok {
+			return
+		}
+	}
+	p.processTrade(ctx, trade)
+	if done != nil {
+		done()
+	}
+}
+
+// onWorker runs fn on productID's worker between two of its trades and waits
+// for it, so fn can swap the product's calculator without a trade reaching
+// the old one meanwhile. Without a worker, fn runs directly.
+func (p *Pipeline) onWorker(productID string, fn func()) {
+	if w := p.workers.Load(); w != nil {
+		done := make(chan struct{})
+		w.mu.RLock()
+		control, ok := w.controls[productID]
+		if ok {
+			// The worker only exits once remove or stop, which wait for the
+			// lock, closes its queue.
+			control <- func() {
+				defer close(done)
+				fn()
+			}
+		}
+		w.mu.RUnlock()
+		if ok {
+			<-done
+			return
+		}
+	}
+	fn()
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingSink holds up updates for one product until released, and records
+// the trade counts it sees per product.
+type blockingSink struct {
+	product string
+	release chan struct{}
+
+	mu     sync.Mutex
+	counts map[string][]int64
+}
+
+func (s *blockingSink) Publish(update VWAPUpdate) error {
+	if update.ProductID == s.product {
+		<-s.release
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[update.ProductID] = append(s.counts[update.ProductID], update.TradeCount)
+	return nil
+}
+
+func TestPipelineWorkersAvoidHeadOfLineBlocking(t *testing.T) {
+	sink := &blockingSink{product: "BTC-USD", release: make(chan struct{}), counts: make(map[string][]int64)}
+	calculators := map[string]Calculator{"BTC-USD": NewVWAPCalculator(), "ETH-USD": NewVWAPCalculator()}
+	pipeline := NewPipeline(calculators, NewLogger(io.Discard, slog.LevelInfo, "text"), sink)
+	stop := pipeline.StartWorkers(16, backpressureBlock)
+
+	var done sync.WaitGroup
+	for i := 1; i <= 5; i++ {
+		for _, product := range []string{"BTC-USD", "ETH-USD"} {
+			done.Add(1)
+			msg := fmt.Sprintf(`{"type":"match","product_id":"%s","trade_id":%d,"price":"100","size":"1"}`, product, i)
+			pipeline.dispatchMessage(context.Background(), []byte(msg), done.Done)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		sink.mu.Lock()
+		eth := len(sink.counts["ETH-USD"])
+		sink.mu.Unlock()
+		if eth == 5 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ETH-USD updates were held up behind BTC-USD: %d of 5 published", eth)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	close(sink.release)
+	done.Wait()
+	stop()
+
+	for product, counts := range sink.counts {
+		for i, n := range counts {
+			if n != int64(i+1) {
+				t.Errorf("%s updates out of order: %v", product, counts)
+				break
+			}
+		}
+	}
+	if len(sink.counts["BTC-USD"]) != 5 {
+		t.Errorf("Expected 5 BTC-USD updates, got %v", sink.counts["BTC-USD"])
+	}
+}
+
+func TestPipelineDispatchWithoutWorkers(t *testing.T) {
+	store := NewStore()
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"), store)
+	called := false
+	pipeline.dispatch(context.Background(), Trade{Type: "match", ProductID: "BTC-USD", TradeID: 1, Price: "100", Size: "1"}, func() { called = true })
+	if update, ok := store.Get("BTC-USD"); !ok || update.TradeCount != 1 || !called {
+		t.Errorf("Expected the trade to be processed synchronously, got %+v (done called: %v)", update, called)
+	}
+}
+
+func TestPipelineWorkersDropOldest(t *testing.T) {
+	sink := &blockingSink{product: "BTC-USD", release: make(chan struct{}), counts: make(map[string][]int64)}
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"), sink)
+	stop := pipeline.StartWorkers(2, backpressureDropOldest)
+
+	var done sync.WaitGroup
+	for i := 1; i <= 10; i++ {
+		done.Add(1)
+		pipeline.dispatch(context.Background(), Trade{Type: "match", ProductID: "BTC-USD", TradeID: int64(i), Price: "100", Size: "1"}, done.Done)
+	}
+	close(sink.release)
+	// Every dispatched trade is either processed or dropped, never lost.
+	done.Wait()
+	stop()
+
+	if n := pipeline.tradeCount("BTC-USD"); n < 2 || n >= 10 {
+		t.Errorf("Expected the worker to process some trades and the rest to be dropped, processed %d", n)
+	}
+}
+
+func TestPipelineWorkersStartDuringProductChanges(t *testing.T) {
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	ctx := context.Background()
+	stopChanges := make(chan struct{})
+	changed := make(chan struct{})
+	go func() {
+		defer close(changed)
+		for {
+			select {
+			case <-stopChanges:
+				return
+			default:
+			}
+			pipeline.AddProduct("SOL-USD", NewVWAPCalculator())
+			pipeline.RemoveProduct(ctx, "SOL-USD")
+		}
+	}()
+	for range 20 {
+		stop := pipeline.StartWorkers(4, backpressureBlock)
+		pipeline.processMessage(ctx, []byte(`{"type":"match","product_id":"BTC-USD","price":"100","size":"1"}`))
+		stop()
+	}
+	close(stopChanges)
+	<-changed
+}
+
+// blockingCalculator holds up its first Update until released.
+type blockingCalculator struct {
+	Calculator
+	release chan struct{}
+}
+
+func (c *blockingCalculator) Update(price, size string) error {
+	<-c.release
+	return c.Calculator.Update(price, size)
+}
+
+func TestPipelineWorkersProductChangesWhileQueueFull(t *testing.T) {
+	btc := &blockingCalculator{Calculator: NewVWAPCalculator(), release: make(chan struct{})}
+	pipeline := NewPipeline(map[string]Calculator{"BTC-USD": btc, "ETH-USD": NewVWAPCalculator()}, NewLogger(io.Discard, slog.LevelInfo, "text"))
+	admin := &productAdmin{cfg: &Config{}, pipeline: pipeline, logger: pipeline.logger}
+	// Stopped only on success, as stopping waits for a deadlocked worker.
+	stop := pipeline.StartWorkers(1, backpressureBlock)
+
+	// The worker holds the first trade in the calculator and the second
+	// fills the queue, so dispatching the third blocks. Once released, the
+	// worker needs the pipeline's lock to count the first trade before it
+	// takes the second.
+	var done sync.WaitGroup
+	done.Add(3)
+	go func() {
+		for i := 1; i <= 3; i++ {
+			msg := fmt.Sprintf(`{"type":"match","product_id":"BTC-USD","trade_id":%d,"price":"100","size":"1"}`, i)
+			pipeline.dispatchMessage(context.Background(), []byte(msg), done.Done)
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	changed := make(chan error, 2)
+	go func() { changed <- admin.add(context.Background(), "SOL-USD") }()
+	go func() { changed <- admin.remove(context.Background(), "ETH-USD") }()
+	time.Sleep(50 * time.Millisecond)
+	close(btc.release)
+
+	finished := make(chan struct{})
+	go func() {
+		done.Wait()
+		for range 2 {
+			if err := <-changed; err != nil {
+				t.Error(err)
+			}
+		}
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Adding and removing products deadlocked against a full queue")
+	}
+	stop()
+	if _, _, ok := pipeline.calculator("SOL-USD"); !ok {
+		t.Error("Expected SOL-USD to be added")
+	}
+	if _, _, ok := pipeline.calculator("ETH-USD"); ok {
+		t.Error("Expected ETH-USD to be removed")
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	clientSendBuffer = 256
+	clientWriteWait  = 10 * time.Second
+	// clientReadLimit caps a client request; subscribes naming a few
+	// hundred products fit well within it.
+	clientReadLimit = 16 << 10
+)
+
+// SubscribeRequest is sent by /ws clients to choose which products they receive.
+// An empty ProductIDs list subscribes to every product.
+type SubscribeRequest struct {
+	Type       string   `json:"type"`
+	ProductIDs []string `json:"product_ids"`
+}
+
+// wsError tells a client why its request was rejected.
+type wsError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+type vwapMessage struct {
+	Type string `json:"type"`
+	VWAPUpdate
+}
+
+// Hub re-publishes VWAP updates to connected websocket clients.
+type Hub struct {
+	mu       sync.Mutex
+	clients  map[*wsClient]struct{}
+	upgrader websocket.Upgrader
+	encoding string
+	logger   Logger
+}
+
+type wsClient struct {
+	conn  *websocket.Conn
+	send  chan []byte
+	frame int // websocket message type of payloads
+
+	mu         sync.RWMutex
+	subscribed bool
+	products   map[string]bool
+}
+
+func NewHub(logger Logger) *Hub {
+	return &Hub{
+		clients:  make(map[*wsClient]struct{}),
+		encoding: encodingJSON,
+		logger:   logger,
+	}
+}
+
+// SetEncoding sets how messages to clients are encoded: json, sent as text
+// frames, or msgpack, sent as binary frames. Client requests are JSON
+// either way. Call it before serving.
+func (h *Hub) SetEncoding(encoding string) {
+	h.encoding = encoding
+}
+
+// marshal encodes msg in the hub's encoding.
+func (h *Hub) marshal(msg any) ([]byte, error) {
+	if h.encoding == encodingMsgpack {
+		return marshalMsgpack(msg)
+	}
+	return json.Marshal(msg)
+}
+
+// Publish fans the update out to every interested client. Clients whose send
+// buffer is full are disconnected rather than allowed to stall the pipeline.
+func (h *Hub) Publish(update VWAPUpdate) error {
+	return h.broadcast(update.ProductID, vwapMessage{Type: "vwap", VWAPUpdate: update})
+}
+
+func (h *Hub) broadcast(productID string, msg interface{}) error {
+	payload, err := h.marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for client := range h.clients {
+		if !client.wants(productID) {
+			continue
+		}
+		select {
+		case client.send <- payload:
+		default:
+			h.logger.Warnf("Dropping slow websocket client %s", client.conn.RemoteAddr())
+			h.removeLocked(client)
+		}
+	}
+	return nil
+}
+
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		h.logger.Errorf("Websocket upgrade failed: %v", err)
+		return
+	}
+	client := &wsClient{conn: conn, send: make(chan []byte, clientSendBuffer), frame: websocket.TextMessage}
+	if h.encoding == encodingMsgpack {
+		client.frame = websocket.BinaryMessage
+	}
+
+	h.mu.Lock()
+	h.clients[client] = struct{}{}
+	h.mu.Unlock()
+
+	go client.writeLoop()
+	h.readLoop(client)
+}
+
+func (h *Hub) readLoop(client *wsClient) {
+	defer func() {
+		h.mu.Lock()
+		h.removeLocked(client)
+		h.mu.Unlock()
+	}()
+
+	client.conn.SetReadLimit(clientReadLimit)
+	for {
+		var req SubscribeRequest
+		if err := client.conn.ReadJSON(&req); err != nil {
+			return
+		}
+		switch req.Type {
+		case "subscribe":
+			client.subscribe(req.ProductIDs)
+		case "unsubscribe":
+			if err := client.unsubscribe(req.ProductIDs); err != nil {
+				h.reply(client, wsError{Type: "error", Message: err.Error()})
+				continue
+			}
+		default:
+			continue
+		}
+		h.reply(client, SubscribeRequest{Type: "subscriptions", ProductIDs: client.productList()})
+	}
+}
+
+// reply queues v for client, unless its buffer is full.
+func (h *Hub) reply(client *wsClient, v any) {
+	payload, err := h.marshal(v)
+	if err != nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[client]; ok {
+		select {
+		case client.send <- payload:
+		default:
+		}
+	}
+}
+
+func (h *Hub) removeLocked(client *wsClient) {
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+	delete(h.clients, client)
+	close(client.send)
+}
+
+func (c *wsClient) writeLoop() {
+	defer c.conn.Close()
+	for payload := range c.send {
+		c.conn.SetWriteDeadline(time.Now().Add(clientWriteWait))
+		if err := c.conn.WriteMessage(c.frame, payload); err != nil {
+			return
+		}
+	}
+	c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+}
+
+func (c *wsClient) subscribe(productIDs []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscribed = true
+	if len(productIDs) == 0 {
+		c.products = nil
+		return
+	}
+	if c.products == nil {
+		c.products = make(map[string]bool, len(productIDs))
+	}
+	for _, id := range productIDs {
+		c.products[id] = true
+	}
+}
+
+// unsubscribe drops productIDs, or every product when the list is empty.
+// A client subscribed to every product can only drop them all, as the
+// hub does not know which products exist.
+func (c *wsClient) unsubscribe(productIDs []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(productIDs) == 0 {
+		c.subscribed = false
+		c.products = nil
+		return nil
+	}
+	if c.subscribed && c.products == nil {
+		return errors.New("cannot unsubscribe from some products while subscribed to all; unsubscribe from all, then subscribe to the products wanted")
+	}
+	for _, id := range productIDs {
+		delete(c.products, id)
+	}
+	return nil
+}
+
+func (c *wsClient) wants(productID string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.subscribed {
+		return false
+	}
+	return c.products == nil || c.products[productID]
+}
+
+func (c *wsClient) productList() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	ids := make([]string, 0, len(c.products))
+	for id := range c.products {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestHubFiltersByProduct(t *testing.T) {
+	hub := NewHub(NewLogger(io.Discard, slog.LevelInfo, "text"))
+	server := httptest.NewServer(hub)
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	if err := conn.WriteJSON(SubscribeRequest{Type: "subscribe", ProductIDs: []string{"ETH-USD"}}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	var ack SubscribeRequest
+	if err := conn.ReadJSON(&ack); err != nil {
+		t.Fatalf("Reading ack failed: %v", err)
+	}
+	if ack.Type != "subscriptions" || len(ack.ProductIDs) != 1 || ack.ProductIDs[0] != "ETH-USD" {
+		t.Fatalf("Unexpected ack: %+v", ack)
+	}
+
+	hub.Publish(VWAPUpdate{ProductID: "BTC-USD", VWAP: "45000.0000"})
+	hub.Publish(VWAPUpdate{ProductID: "ETH-USD", VWAP: "3000.0000"})
+
+	var msg vwapMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("Reading update failed: %v", err)
+	}
+	if msg.Type != "vwap" || msg.ProductID != "ETH-USD" || msg.VWAP != "3000.0000" {
+		t.Errorf("Expected ETH-USD update, got %+v", msg)
+	}
+}
+
+func TestHubRejectsPartialUnsubscribeFromAll(t *testing.T) {
+	hub := NewHub(NewLogger(io.Discard, slog.LevelInfo, "text"))
+	server := httptest.NewServer(hub)
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	conn.WriteJSON(SubscribeRequest{Type: "subscribe"})
+	var ack SubscribeRequest
+	if err := conn.ReadJSON(&ack); err != nil || ack.Type != "subscriptions" {
+		t.Fatalf("Expected an ack, got %+v, %v", ack, err)
+	}
+	conn.WriteJSON(SubscribeRequest{Type: "unsubscribe", ProductIDs: []string{"BTC-USD"}})
+	var reply wsError
+	if err := conn.ReadJSON(&reply); err != nil || reply.Type != "error" || reply.Message == "" {
+		t.Fatalf("Expected an error, got %+v, %v", reply, err)
+	}
+
+	// The subscription to every product is left as it was.
+	hub.Publish(VWAPUpdate{ProductID: "BTC-USD", VWAP: "45000.0000"})
+	var msg vwapMessage
+	if err := conn.ReadJSON(&msg); err != nil || msg.ProductID != "BTC-USD" {
+		t.Errorf("Expected the BTC-USD update, got %+v, %v", msg, err)
+	}
+}
+
+func TestHubReadLimit(t *testing.T) {
+	hub := NewHub(NewLogger(io.Discard, slog.LevelInfo, "text"))
+	server := httptest.NewServer(hub)
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	ids := make([]string, clientReadLimit/8)
+	for i := range ids {
+		ids[i] = "BTC-USD"
+	}
+	conn.WriteJSON(SubscribeRequest{Type: "subscribe", ProductIDs: ids})
+	var ack SubscribeRequest
+	if err := conn.ReadJSON(&ack); err == nil {
+		t.Fatalf("Expected the connection to be closed, got %+v", ack)
+	}
+}